@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
@@ -122,6 +123,7 @@ type DNSResolver interface {
 	LookupHost(context.Context, string) ([]net.IP, error)
 	LookupCAA(context.Context, string) ([]*dns.CAA, error)
 	LookupMX(context.Context, string) ([]string, error)
+	LookupCNAME(context.Context, string) (string, error)
 }
 
 // DNSResolverImpl represents a client that talks to an external resolver
@@ -136,6 +138,11 @@ type DNSResolverImpl struct {
 	aStats                   metrics.Scope
 	caaStats                 metrics.Scope
 	mxStats                  metrics.Scope
+	cnameStats               metrics.Scope
+	dnssecStats              metrics.Scope
+	trustAnchors             []*dns.DS
+	keyCacheMu               sync.Mutex
+	keyCache                 map[string]cachedKeys
 }
 
 var _ DNSResolver = &DNSResolverImpl{}
@@ -165,6 +172,8 @@ func NewDNSResolverImpl(readTimeout time.Duration, servers []string, stats metri
 		aStats:                   stats.NewScope("A"),
 		caaStats:                 stats.NewScope("CAA"),
 		mxStats:                  stats.NewScope("MX"),
+		cnameStats:               stats.NewScope("CNAME"),
+		dnssecStats:              stats.NewScope("DNSSEC"),
 	}
 }
 
@@ -181,12 +190,15 @@ func NewTestDNSResolverImpl(readTimeout time.Duration, servers []string, stats m
 // out of the server list, returning the response, time, and error (if any).
 // This method sets the DNSSEC OK bit on the message to true before sending
 // it to the resolver in case validation isn't the resolvers default behaviour.
+// When DNSSEC validation is enabled the CD bit is also set, so that the
+// resolver hands back unvalidated data for us to check.
 func (dnsResolver *DNSResolverImpl) exchangeOne(ctx context.Context, hostname string, qtype uint16, msgStats metrics.Scope) (*dns.Msg, error) {
 	m := new(dns.Msg)
 	// Set question type
 	m.SetQuestion(dns.Fqdn(hostname), qtype)
 	// Set DNSSEC OK bit for resolver
 	m.SetEdns0(4096, true)
+	m.CheckingDisabled = dnsResolver.validating()
 
 	if len(dnsResolver.Servers) < 1 {
 		return nil, fmt.Errorf("Not configured with at least one DNS Server")
@@ -252,6 +264,9 @@ func (dnsResolver *DNSResolverImpl) LookupTXT(ctx context.Context, hostname stri
 	if err != nil {
 		return nil, nil, &dnsError{dnsType, hostname, err, -1}
 	}
+	if err := dnsResolver.validateResponse(ctx, hostname, dnsType, r); err != nil {
+		return nil, nil, err
+	}
 	if r.Rcode != dns.RcodeSuccess {
 		return nil, nil, &dnsError{dnsType, hostname, nil, r.Rcode}
 	}
@@ -293,6 +308,9 @@ func (dnsResolver *DNSResolverImpl) LookupHost(ctx context.Context, hostname str
 	if err != nil {
 		return addrs, &dnsError{dnsType, hostname, err, -1}
 	}
+	if err := dnsResolver.validateResponse(ctx, hostname, dnsType, r); err != nil {
+		return nil, err
+	}
 	if r.Rcode != dns.RcodeSuccess {
 		return nil, &dnsError{dnsType, hostname, nil, r.Rcode}
 	}
@@ -310,7 +328,8 @@ func (dnsResolver *DNSResolverImpl) LookupHost(ctx context.Context, hostname str
 
 // LookupCAA sends a DNS query to find all CAA records associated with
 // the provided hostname. If the response code from the resolver is
-// SERVFAIL an empty slice of CAA records is returned.
+// SERVFAIL an empty slice of CAA records is returned. When DNSSEC validation
+// is enabled this only happens if the zone of hostname is provably unsigned.
 func (dnsResolver *DNSResolverImpl) LookupCAA(ctx context.Context, hostname string) ([]*dns.CAA, error) {
 	dnsType := dns.TypeCAA
 	r, err := dnsResolver.exchangeOne(ctx, hostname, dnsType, dnsResolver.caaStats)
@@ -322,8 +341,20 @@ func (dnsResolver *DNSResolverImpl) LookupCAA(ctx context.Context, hostname stri
 	// set and no error.
 	var CAAs []*dns.CAA
 	if r.Rcode == dns.RcodeServerFailure {
+		if dnsResolver.validating() {
+			insecure, err := dnsResolver.provablyInsecure(ctx, hostname)
+			if _, ok := err.(*dnsError); ok {
+				return nil, err
+			}
+			if err != nil || !insecure {
+				return nil, &dnsError{dnsType, hostname, nil, r.Rcode}
+			}
+		}
 		return CAAs, nil
 	}
+	if err := dnsResolver.validateResponse(ctx, hostname, dnsType, r); err != nil {
+		return nil, err
+	}
 
 	for _, answer := range r.Answer {
 		if answer.Header().Rrtype == dnsType {
@@ -343,6 +374,9 @@ func (dnsResolver *DNSResolverImpl) LookupMX(ctx context.Context, hostname strin
 	if err != nil {
 		return nil, &dnsError{dnsType, hostname, err, -1}
 	}
+	if err := dnsResolver.validateResponse(ctx, hostname, dnsType, r); err != nil {
+		return nil, err
+	}
 	if r.Rcode != dns.RcodeSuccess {
 		return nil, &dnsError{dnsType, hostname, nil, r.Rcode}
 	}
@@ -356,3 +390,30 @@ func (dnsResolver *DNSResolverImpl) LookupMX(ctx context.Context, hostname strin
 
 	return results, nil
 }
+
+// LookupCNAME sends a DNS query to find a CNAME record for hostname and
+// returns its target, without following it any further. If hostname is not
+// an alias, or does not exist, an empty string is returned.
+func (dnsResolver *DNSResolverImpl) LookupCNAME(ctx context.Context, hostname string) (string, error) {
+	dnsType := dns.TypeCNAME
+	r, err := dnsResolver.exchangeOne(ctx, hostname, dnsType, dnsResolver.cnameStats)
+	if err != nil {
+		return "", &dnsError{dnsType, hostname, err, -1}
+	}
+	if err := dnsResolver.validateResponse(ctx, hostname, dnsType, r); err != nil {
+		return "", err
+	}
+	if r.Rcode == dns.RcodeNameError {
+		return "", nil
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return "", &dnsError{dnsType, hostname, nil, r.Rcode}
+	}
+
+	for _, answer := range r.Answer {
+		if cname, ok := answer.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, dns.Fqdn(hostname)) {
+			return strings.TrimRight(cname.Target, "."), nil
+		}
+	}
+	return "", nil
+}
@@ -303,6 +303,21 @@ func TestDNSLookupCAA(t *testing.T) {
 	test.Assert(t, len(caas) > 0, "Should follow CNAME to find CAA")
 }
 
+func TestDNSLookupCNAME(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats, clock.NewFake(), 1)
+
+	target, err := obj.LookupCNAME(context.Background(), "cname.letsencrypt.org")
+	test.AssertNotError(t, err, "CNAME lookup failed")
+	test.AssertEquals(t, target, "cps.letsencrypt.org")
+
+	target, err = obj.LookupCNAME(context.Background(), "letsencrypt.org")
+	test.AssertNotError(t, err, "CNAME lookup failed")
+	test.AssertEquals(t, target, "")
+
+	_, err = obj.LookupCNAME(context.Background(), "servfail.com")
+	test.AssertError(t, err, "CNAME lookup didn't return SERVFAIL")
+}
+
 func TestDNSTXTAuthorities(t *testing.T) {
 	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats, clock.NewFake(), 1)
 
@@ -0,0 +1,756 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// maxKeyCacheTTL bounds how long a validated DNSKEY RRset is trusted without
+// being fetched and validated again, regardless of its TTL.
+const maxKeyCacheTTL = time.Hour
+
+// maxNSEC3Iterations is the most hash iterations an NSEC3 record may ask for
+// before it is ignored, so that a zone can't make each denial arbitrarily
+// expensive to check. RFC 9276 suggests treating higher counts as insecure.
+const maxNSEC3Iterations = 150
+
+// dnssecError is returned by the Lookup... methods when a response could not
+// be validated against the configured trust anchors.
+type dnssecError struct {
+	recordType uint16
+	hostname   string
+	detail     string
+}
+
+func (d dnssecError) Error() string {
+	return fmt.Sprintf("DNSSEC problem: %s validating %s for %s", d.detail,
+		dns.TypeToString[d.recordType], d.hostname)
+}
+
+type cachedKeys struct {
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+// ParseTrustAnchors reads DS and DNSKEY records in zone file format from r
+// and returns them as DS records suitable for EnableDNSSECValidation. DNSKEY
+// records are converted to DS records using a SHA-256 digest.
+func ParseTrustAnchors(r io.Reader) ([]*dns.DS, error) {
+	var anchors []*dns.DS
+	for token := range dns.ParseZone(r, "", "") {
+		if token.Error != nil {
+			return nil, token.Error
+		}
+		switch rr := token.RR.(type) {
+		case *dns.DS:
+			anchors = append(anchors, rr)
+		case *dns.DNSKEY:
+			ds := rr.ToDS(dns.SHA256)
+			if ds == nil {
+				return nil, fmt.Errorf("unable to compute DS for trust anchor %s", rr.Hdr.Name)
+			}
+			anchors = append(anchors, ds)
+		}
+	}
+	if len(anchors) == 0 {
+		return nil, errors.New("no DS or DNSKEY records found in trust anchors")
+	}
+	return anchors, nil
+}
+
+// LoadTrustAnchors reads trust anchors from the named file, as described for
+// ParseTrustAnchors.
+func LoadTrustAnchors(filename string) ([]*dns.DS, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseTrustAnchors(f)
+}
+
+// EnableDNSSECValidation makes the resolver verify the RRSIG chain of every
+// response from the given trust anchors instead of trusting the upstream
+// resolver. Queries are sent with the CD bit set so that bogus data is
+// returned to us and reported as a DNSSEC problem rather than as SERVFAIL.
+func (dnsResolver *DNSResolverImpl) EnableDNSSECValidation(anchors []*dns.DS) {
+	dnsResolver.trustAnchors = anchors
+	dnsResolver.keyCache = make(map[string]cachedKeys)
+}
+
+func (dnsResolver *DNSResolverImpl) validating() bool {
+	return len(dnsResolver.trustAnchors) > 0
+}
+
+// validateResponse checks the signatures on the answer section of r. If the
+// answer doesn't hold qtype records for hostname, or for the end of the CNAME
+// chain it starts, the authority section must also prove that name or type
+// doesn't exist. RRsets without signatures, and negative answers without that
+// proof, are only accepted if their zone is provably unsigned. Responses with
+// an Rcode other than NOERROR or NXDOMAIN carry no data to validate and are
+// left to the caller.
+func (dnsResolver *DNSResolverImpl) validateResponse(ctx context.Context, hostname string, qtype uint16, r *dns.Msg) error {
+	if !dnsResolver.validating() {
+		return nil
+	}
+	if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return nil
+	}
+	dnsResolver.dnssecStats.Inc("Validations", 1)
+
+	err := dnsResolver.verifyResponse(ctx, hostname, qtype, r)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*dnsError); ok {
+		return err
+	}
+	dnsResolver.dnssecStats.Inc("Bogus", 1)
+	return &dnssecError{qtype, hostname, err.Error()}
+}
+
+func (dnsResolver *DNSResolverImpl) verifyResponse(ctx context.Context, hostname string, qtype uint16, r *dns.Msg) error {
+	target, found := answerTarget(hostname, qtype, r.Answer)
+	if len(r.Answer) > 0 {
+		if err := dnsResolver.verifySection(ctx, hostname, r.Answer); err != nil {
+			return err
+		}
+	}
+	if found {
+		return nil
+	}
+
+	// A signed zone always includes a proof with a negative answer
+	if len(r.Ns) == 0 {
+		return dnsResolver.requireInsecure(ctx, target)
+	}
+	if err := dnsResolver.verifySection(ctx, target, r.Ns); err != nil {
+		return err
+	}
+	err := dnsResolver.verifyDenial(ctx, target, qtype, r.Rcode == dns.RcodeNameError, r.Ns)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*dnsError); ok {
+		return err
+	}
+	// Unsigned zones can't prove anything doesn't exist
+	insecure, insecureErr := dnsResolver.provablyInsecure(ctx, target)
+	if insecureErr != nil {
+		return insecureErr
+	}
+	if !insecure {
+		return err
+	}
+	dnsResolver.dnssecStats.Inc("Insecure", 1)
+	return nil
+}
+
+// answerTarget follows the CNAME chain starting at hostname through answer
+// and returns the name it ends at, and whether answer has qtype records for
+// that name.
+func answerTarget(hostname string, qtype uint16, answer []dns.RR) (string, bool) {
+	target := dns.Fqdn(strings.ToLower(hostname))
+	// Each step consumes a CNAME, so this bounds loops in the chain
+	for i := 0; i <= len(answer); i++ {
+		var next string
+		for _, rr := range answer {
+			if !strings.EqualFold(rr.Header().Name, target) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype {
+				return target, true
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				next = dns.Fqdn(strings.ToLower(cname.Target))
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+	}
+	return target, false
+}
+
+// verifySection verifies every RRset in rrs. If rrs is empty the zone of
+// hostname must be provably unsigned, since a signed zone always includes a
+// signed SOA or NSEC/NSEC3 proof with a negative answer.
+func (dnsResolver *DNSResolverImpl) verifySection(ctx context.Context, hostname string, rrs []dns.RR) error {
+	if len(rrs) == 0 {
+		return dnsResolver.requireInsecure(ctx, hostname)
+	}
+	sets, sigs := splitRRsets(rrs)
+	for key, set := range sets {
+		if len(sigs[key]) == 0 {
+			if err := dnsResolver.requireInsecure(ctx, set[0].Header().Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := dnsResolver.verifyRRset(ctx, set, sigs[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dnsResolver *DNSResolverImpl) requireInsecure(ctx context.Context, name string) error {
+	insecure, err := dnsResolver.provablyInsecure(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !insecure {
+		return fmt.Errorf("missing signatures for %s", name)
+	}
+	dnsResolver.dnssecStats.Inc("Insecure", 1)
+	return nil
+}
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// splitRRsets groups rrs into RRsets by owner name and type, and collects the
+// RRSIGs covering each of them.
+func splitRRsets(rrs []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	sets := make(map[rrsetKey][]dns.RR)
+	sigs := make(map[rrsetKey][]*dns.RRSIG)
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header().Name)
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{name, sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{name, rr.Header().Rrtype}
+		sets[key] = append(sets[key], rr)
+	}
+	return sets, sigs
+}
+
+// verifyRRset succeeds if at least one of sigs is currently valid and was
+// made by a trusted key of its signer zone.
+func (dnsResolver *DNSResolverImpl) verifyRRset(ctx context.Context, set []dns.RR, sigs []*dns.RRSIG) error {
+	owner := set[0].Header().Name
+	lastErr := fmt.Errorf("no valid signature for %s", owner)
+	for _, sig := range sigs {
+		if !dns.IsSubDomain(sig.SignerName, owner) {
+			lastErr = fmt.Errorf("signer %s is not authoritative for %s", sig.SignerName, owner)
+			continue
+		}
+		if !sig.ValidityPeriod(dnsResolver.clk.Now()) {
+			lastErr = fmt.Errorf("signature for %s is expired or not yet valid", owner)
+			continue
+		}
+		keys, err := dnsResolver.zoneKeys(ctx, sig.SignerName)
+		if err != nil {
+			if _, ok := err.(*dnsError); ok {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		for _, key := range keys {
+			if sig.Verify(key, set) == nil {
+				return nil
+			}
+		}
+	}
+	return lastErr
+}
+
+// zoneKeys returns the DNSKEY RRset of zone once it has been authenticated
+// against the zone's DS records, which are themselves either a configured trust
+// anchor or authenticated by the parent zone.
+func (dnsResolver *DNSResolverImpl) zoneKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, error) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	now := dnsResolver.clk.Now()
+	dnsResolver.keyCacheMu.Lock()
+	cached, ok := dnsResolver.keyCache[zone]
+	dnsResolver.keyCacheMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.keys, nil
+	}
+
+	r, err := dnsResolver.exchangeOne(ctx, zone, dns.TypeDNSKEY, dnsResolver.dnssecStats)
+	if err != nil {
+		return nil, &dnsError{dns.TypeDNSKEY, zone, err, -1}
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, &dnsError{dns.TypeDNSKEY, zone, nil, r.Rcode}
+	}
+	var keySet []dns.RR
+	var keys []*dns.DNSKEY
+	var sigs []*dns.RRSIG
+	for _, rr := range r.Answer {
+		if !strings.EqualFold(rr.Header().Name, zone) {
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			keySet = append(keySet, rr)
+			keys = append(keys, rr)
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records for %s", zone)
+	}
+
+	dsSet, err := dnsResolver.delegationSigners(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || !matchesDS(key, dsSet) {
+				continue
+			}
+			if sig.Verify(key, keySet) == nil {
+				ttl := time.Duration(keys[0].Hdr.Ttl) * time.Second
+				if ttl > maxKeyCacheTTL {
+					ttl = maxKeyCacheTTL
+				}
+				dnsResolver.keyCacheMu.Lock()
+				dnsResolver.keyCache[zone] = cachedKeys{keys: keys, expires: now.Add(ttl)}
+				dnsResolver.keyCacheMu.Unlock()
+				return keys, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no DNSKEY for %s matching its DS records signed the key set", zone)
+}
+
+// delegationSigners returns the authenticated DS RRset for zone.
+func (dnsResolver *DNSResolverImpl) delegationSigners(ctx context.Context, zone string) ([]*dns.DS, error) {
+	var anchors []*dns.DS
+	for _, ds := range dnsResolver.trustAnchors {
+		if strings.EqualFold(ds.Hdr.Name, zone) {
+			anchors = append(anchors, ds)
+		}
+	}
+	if len(anchors) > 0 {
+		return anchors, nil
+	}
+	if zone == "." {
+		return nil, errors.New("no trust anchor for the root zone")
+	}
+
+	r, err := dnsResolver.exchangeOne(ctx, zone, dns.TypeDS, dnsResolver.dnssecStats)
+	if err != nil {
+		return nil, &dnsError{dns.TypeDS, zone, err, -1}
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, &dnsError{dns.TypeDS, zone, nil, r.Rcode}
+	}
+	var dsSet []dns.RR
+	var result []*dns.DS
+	var sigs []*dns.RRSIG
+	for _, rr := range r.Answer {
+		if !strings.EqualFold(rr.Header().Name, zone) {
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.DS:
+			dsSet = append(dsSet, rr)
+			result = append(result, rr)
+		case *dns.RRSIG:
+			// The DS RRset must be signed by a proper ancestor, otherwise we
+			// would loop trying to authenticate zone with its own keys.
+			if rr.TypeCovered == dns.TypeDS && !strings.EqualFold(rr.SignerName, zone) {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no DS records for %s", zone)
+	}
+	if err := dnsResolver.verifyRRset(ctx, dsSet, sigs); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func matchesDS(key *dns.DNSKEY, dsSet []*dns.DS) bool {
+	for _, ds := range dsSet {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		computed := key.ToDS(ds.DigestType)
+		if computed != nil && strings.EqualFold(computed.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// provablyInsecure walks down from the closest trust anchor towards name and
+// reports whether a signed denial shows a delegation without DS records on the
+// way, meaning name lives in an unsigned zone. Names outside every trust
+// anchor are insecure by definition (RFC 4033, Section 5).
+func (dnsResolver *DNSResolverImpl) provablyInsecure(ctx context.Context, name string) (bool, error) {
+	name = dns.Fqdn(strings.ToLower(name))
+	anchorLabels := -1
+	for _, ds := range dnsResolver.trustAnchors {
+		if dns.IsSubDomain(ds.Hdr.Name, name) && dns.CountLabel(ds.Hdr.Name) > anchorLabels {
+			anchorLabels = dns.CountLabel(ds.Hdr.Name)
+		}
+	}
+	if anchorLabels < 0 {
+		return true, nil
+	}
+
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - anchorLabels - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		r, err := dnsResolver.exchangeOne(ctx, child, dns.TypeDS, dnsResolver.dnssecStats)
+		if err != nil {
+			return false, &dnsError{dns.TypeDS, child, err, -1}
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			return false, nil
+		}
+
+		sets, sigs := splitRRsets(r.Answer)
+		if set, ok := sets[rrsetKey{child, dns.TypeDS}]; ok {
+			if err := dnsResolver.verifyRRset(ctx, set, sigs[rrsetKey{child, dns.TypeDS}]); err != nil {
+				return false, err
+			}
+			// Secure delegation, keep walking down.
+			continue
+		}
+
+		sets, sigs = splitRRsets(r.Ns)
+		for key, set := range sets {
+			var bitmap []uint16
+			optOut := false
+			switch rr := set[0].(type) {
+			case *dns.NSEC:
+				if !strings.EqualFold(rr.Hdr.Name, child) {
+					continue
+				}
+				bitmap = rr.TypeBitMap
+			case *dns.NSEC3:
+				if nsec3Matches(rr, child) {
+					bitmap = rr.TypeBitMap
+				} else if rr.Flags&1 == 1 && nsec3Covers(rr, child) {
+					optOut = true
+				} else {
+					continue
+				}
+			default:
+				continue
+			}
+			if len(sigs[key]) == 0 || dnsResolver.verifyRRset(ctx, set, sigs[key]) != nil {
+				continue
+			}
+			if optOut || (hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeDS) && !hasType(bitmap, dns.TypeSOA)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// verifyDenial checks that the authenticated NSEC or NSEC3 records in rrs
+// prove that qname doesn't exist, if nxdomain is set, or otherwise that it has
+// no qtype records, following RFC 4035, Section 5.4 and RFC 5155, Section 8.
+// Signed records from elsewhere in the zone, or from other zones, prove
+// nothing about qname and are rejected.
+func (dnsResolver *DNSResolverImpl) verifyDenial(ctx context.Context, qname string, qtype uint16, nxdomain bool, rrs []dns.RR) error {
+	qname = dns.Fqdn(strings.ToLower(qname))
+	nsecs, nsec3s, err := dnsResolver.denialRecords(ctx, qname, rrs)
+	if err != nil {
+		return err
+	}
+	if len(nsecs) > 0 {
+		return denyWithNSEC(qname, qtype, nxdomain, nsecs)
+	}
+	if len(nsec3s) > 0 {
+		return denyWithNSEC3(qname, qtype, nxdomain, nsec3s)
+	}
+	return fmt.Errorf("no authenticated NSEC or NSEC3 records deny %s", qname)
+}
+
+// denialRecords returns the NSEC and NSEC3 records in rrs that are signed by
+// a zone containing qname. An NSEC3 record must be signed by the zone its
+// owner name is a hash in, since that is what its hashes are relative to.
+func (dnsResolver *DNSResolverImpl) denialRecords(ctx context.Context, qname string, rrs []dns.RR) ([]*dns.NSEC, []*dns.NSEC3, error) {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	sets, sigs := splitRRsets(rrs)
+	for key, set := range sets {
+		if key.rtype != dns.TypeNSEC && key.rtype != dns.TypeNSEC3 {
+			continue
+		}
+		var zoneSigs []*dns.RRSIG
+		for _, sig := range sigs[key] {
+			if !dns.IsSubDomain(sig.SignerName, qname) {
+				continue
+			}
+			if key.rtype == dns.TypeNSEC3 && !strings.EqualFold(dns.Fqdn(sig.SignerName), nsec3Zone(key.name)) {
+				continue
+			}
+			zoneSigs = append(zoneSigs, sig)
+		}
+		if len(zoneSigs) == 0 {
+			continue
+		}
+		if err := dnsResolver.verifyRRset(ctx, set, zoneSigs); err != nil {
+			if _, ok := err.(*dnsError); ok {
+				return nil, nil, err
+			}
+			continue
+		}
+		for _, rr := range set {
+			switch rr := rr.(type) {
+			case *dns.NSEC:
+				nsecs = append(nsecs, rr)
+			case *dns.NSEC3:
+				if rr.Hash == dns.SHA1 && rr.Iterations <= maxNSEC3Iterations {
+					nsec3s = append(nsec3s, rr)
+				}
+			}
+		}
+	}
+	return nsecs, nsec3s, nil
+}
+
+func denyWithNSEC(qname string, qtype uint16, nxdomain bool, nsecs []*dns.NSEC) error {
+	if !nxdomain {
+		for _, nsec := range nsecs {
+			if strings.EqualFold(nsec.Hdr.Name, qname) {
+				if !noData(nsec.TypeBitMap, qtype) {
+					return fmt.Errorf("NSEC record for %s doesn't deny its %s records", qname, dns.TypeToString[qtype])
+				}
+				return nil
+			}
+		}
+	}
+
+	// Otherwise qname doesn't exist, and neither may a wildcard at its
+	// closest encloser that could have answered for it, unless it's a
+	// wildcard without qtype records.
+	var cover *dns.NSEC
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, qname) {
+			cover = nsec
+			break
+		}
+	}
+	if cover == nil {
+		return fmt.Errorf("no NSEC record proves %s doesn't exist", qname)
+	}
+	encloser := commonAncestor(qname, cover.Hdr.Name)
+	if next := commonAncestor(qname, cover.NextDomain); dns.CountLabel(next) > dns.CountLabel(encloser) {
+		encloser = next
+	}
+	wildcard := wildcardOf(encloser)
+	if nxdomain {
+		for _, nsec := range nsecs {
+			if nsecCovers(nsec, wildcard) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no NSEC record proves %s doesn't exist", wildcard)
+	}
+	for _, nsec := range nsecs {
+		if strings.EqualFold(nsec.Hdr.Name, wildcard) && noData(nsec.TypeBitMap, qtype) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no NSEC record proves %s has no %s records", wildcard, dns.TypeToString[qtype])
+}
+
+func denyWithNSEC3(qname string, qtype uint16, nxdomain bool, nsec3s []*dns.NSEC3) error {
+	if !nxdomain {
+		if match := nsec3Matching(nsec3s, qname); match != nil {
+			if !noData(match.TypeBitMap, qtype) {
+				return fmt.Errorf("NSEC3 record for %s doesn't deny its %s records", qname, dns.TypeToString[qtype])
+			}
+			return nil
+		}
+	}
+
+	// The closest encloser proof: the longest existing ancestor of qname has
+	// a matching record, and the name one label below it towards qname is
+	// covered by one.
+	labels := dns.SplitDomainName(qname)
+	var encloser, nextCloser string
+	for i := 1; i <= len(labels); i++ {
+		candidate := dns.Fqdn(strings.Join(labels[i:], "."))
+		match := nsec3Matching(nsec3s, candidate)
+		if match == nil {
+			continue
+		}
+		if isDelegation(match.TypeBitMap) || hasType(match.TypeBitMap, dns.TypeDNAME) {
+			return fmt.Errorf("closest encloser %s of %s is a delegation", candidate, qname)
+		}
+		encloser = candidate
+		nextCloser = dns.Fqdn(strings.Join(labels[i-1:], "."))
+		break
+	}
+	if encloser == "" {
+		return fmt.Errorf("no NSEC3 record matches an ancestor of %s", qname)
+	}
+	if nsec3Covering(nsec3s, nextCloser) == nil {
+		return fmt.Errorf("no NSEC3 record proves %s doesn't exist", nextCloser)
+	}
+	wildcard := wildcardOf(encloser)
+	if nxdomain {
+		if nsec3Covering(nsec3s, wildcard) == nil {
+			return fmt.Errorf("no NSEC3 record proves %s doesn't exist", wildcard)
+		}
+		return nil
+	}
+	if match := nsec3Matching(nsec3s, wildcard); match != nil && noData(match.TypeBitMap, qtype) {
+		return nil
+	}
+	return fmt.Errorf("no NSEC3 record proves %s has no %s records", wildcard, dns.TypeToString[qtype])
+}
+
+// canonicalCompare orders domain names as RFC 4034, Section 6.1 does,
+// comparing labels from the right.
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// between reports whether name sorts strictly between owner and next, the
+// ends of a denial record's span. The last span in a zone wraps around to
+// the first name.
+func between(owner, next, name string, compare func(a, b string) int) bool {
+	if compare(owner, next) < 0 {
+		return compare(owner, name) < 0 && compare(name, next) < 0
+	}
+	return compare(owner, name) < 0 || compare(name, next) < 0
+}
+
+// nsecCovers reports whether nsec proves that name doesn't exist. An NSEC
+// record at a delegation comes from the parent side of the zone cut and says
+// nothing about names below it.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	if dns.IsSubDomain(nsec.Hdr.Name, name) && !strings.EqualFold(nsec.Hdr.Name, name) &&
+		(isDelegation(nsec.TypeBitMap) || hasType(nsec.TypeBitMap, dns.TypeDNAME)) {
+		return false
+	}
+	return between(nsec.Hdr.Name, nsec.NextDomain, name, canonicalCompare)
+}
+
+// nsec3Zone returns the zone an NSEC3 owner name is a hash in
+func nsec3Zone(owner string) string {
+	labels := dns.SplitDomainName(strings.ToLower(owner))
+	if len(labels) == 0 {
+		return "."
+	}
+	return dns.Fqdn(strings.Join(labels[1:], "."))
+}
+
+// nsec3Hashes returns the hash of name with nsec3's parameters, and the hash
+// nsec3's owner name is, if name is in nsec3's zone
+func nsec3Hashes(nsec3 *dns.NSEC3, name string) (string, string, bool) {
+	if !dns.IsSubDomain(nsec3Zone(nsec3.Hdr.Name), name) {
+		return "", "", false
+	}
+	hash := dns.HashName(name, nsec3.Hash, nsec3.Iterations, nsec3.Salt)
+	if hash == "" {
+		return "", "", false
+	}
+	owner := strings.ToUpper(dns.SplitDomainName(nsec3.Hdr.Name)[0])
+	return hash, owner, true
+}
+
+func nsec3Matches(nsec3 *dns.NSEC3, name string) bool {
+	hash, owner, ok := nsec3Hashes(nsec3, name)
+	return ok && hash == owner
+}
+
+func nsec3Covers(nsec3 *dns.NSEC3, name string) bool {
+	hash, owner, ok := nsec3Hashes(nsec3, name)
+	return ok && between(owner, strings.ToUpper(nsec3.NextDomain), hash, strings.Compare)
+}
+
+func nsec3Matching(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3Matches(nsec3, name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+func nsec3Covering(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3Covers(nsec3, name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+// commonAncestor returns the longest name that is an ancestor of, or equal
+// to, both a and b
+func commonAncestor(a, b string) string {
+	labels := dns.SplitDomainName(strings.ToLower(a))
+	n := dns.CompareDomainName(strings.ToLower(a), strings.ToLower(b))
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+func wildcardOf(encloser string) string {
+	if encloser == "." {
+		return "*."
+	}
+	return "*." + encloser
+}
+
+// noData reports whether a denial record's type bitmap shows its owner has
+// neither qtype records nor a CNAME that would have answered instead
+func noData(bitmap []uint16, qtype uint16) bool {
+	if hasType(bitmap, qtype) || hasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	// At a delegation only the parent's DS records are authoritative
+	return qtype == dns.TypeDS || !isDelegation(bitmap)
+}
+
+// isDelegation reports whether a type bitmap is that of a zone cut, seen
+// from the parent side
+func isDelegation(bitmap []uint16) bool {
+	return hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA)
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"crypto"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+type signedZone struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newSignedZone(t *testing.T, name string) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	test.AssertNotError(t, err, "Failed to generate zone key")
+	return &signedZone{key: key, priv: priv.(crypto.Signer)}
+}
+
+func (z *signedZone) sign(t *testing.T, clk clock.Clock, rrset ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrset[0].Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(clk.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(clk.Now().Add(time.Hour).Unix()),
+	}
+	test.AssertNotError(t, sig.Sign(z.priv, rrset), "Failed to sign RRset")
+	return append(rrset, sig)
+}
+
+// zoneExchanger answers queries from a fixed table of responses keyed by
+// question name and type, mimicking a recursive resolver with the CD bit set.
+type zoneExchanger map[rrsetKey]*dns.Msg
+
+func (ze zoneExchanger) Exchange(m *dns.Msg, _ string) (*dns.Msg, time.Duration, error) {
+	q := m.Question[0]
+	r, ok := ze[rrsetKey{strings.ToLower(q.Name), q.Qtype}]
+	if !ok {
+		r = &dns.Msg{}
+	}
+	r = r.Copy()
+	rcode := r.Rcode
+	r.SetReply(m)
+	r.Rcode = rcode
+	if !ok {
+		r.Rcode = dns.RcodeServerFailure
+	}
+	return r, time.Millisecond, nil
+}
+
+func (ze zoneExchanger) answer(name string, qtype uint16, rrs []dns.RR) {
+	ze[rrsetKey{name, qtype}] = &dns.Msg{Answer: rrs}
+}
+
+func (ze zoneExchanger) deny(name string, qtype uint16, ns []dns.RR) {
+	ze[rrsetKey{name, qtype}] = &dns.Msg{Ns: ns}
+}
+
+func (ze zoneExchanger) nxdomain(name string, qtype uint16, ns []dns.RR) {
+	r := &dns.Msg{Ns: ns}
+	r.Rcode = dns.RcodeNameError
+	ze[rrsetKey{name, qtype}] = r
+}
+
+func concat(sets ...[]dns.RR) []dns.RR {
+	var rrs []dns.RR
+	for _, set := range sets {
+		rrs = append(rrs, set...)
+	}
+	return rrs
+}
+
+func newNSEC(owner, next string, types ...uint16) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: next,
+		TypeBitMap: typeBitMap(append(types, dns.TypeRRSIG, dns.TypeNSEC)),
+	}
+}
+
+// newNSEC3 makes the NSEC3 record for owner in zone, whose span ends at the
+// hash of next
+func newNSEC3(zone, owner, next string, types ...uint16) *dns.NSEC3 {
+	hash := func(name string) string { return dns.HashName(name, dns.SHA1, 2, "AABB") }
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: hash(owner) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash:       dns.SHA1,
+		Iterations: 2,
+		SaltLength: 2,
+		Salt:       "AABB",
+		HashLength: 20,
+		NextDomain: hash(next),
+		TypeBitMap: typeBitMap(append(types, dns.TypeRRSIG)),
+	}
+}
+
+type uint16s []uint16
+
+func (u uint16s) Len() int           { return len(u) }
+func (u uint16s) Less(a, b int) bool { return u[a] < u[b] }
+func (u uint16s) Swap(a, b int)      { u[a], u[b] = u[b], u[a] }
+
+// typeBitMap sorts types, since they must be in order to be packed
+func typeBitMap(types []uint16) []uint16 {
+	sort.Sort(uint16s(types))
+	return types
+}
+
+func newDNSSECResolver(t *testing.T) (*DNSResolverImpl, clock.FakeClock) {
+	clk := clock.NewFake()
+	clk.Set(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	root := newSignedZone(t, ".")
+	com := newSignedZone(t, "com.")
+	example := newSignedZone(t, "example.com.")
+
+	ze := zoneExchanger{}
+	ze.answer(".", dns.TypeDNSKEY, root.sign(t, clk, root.key))
+	ze.answer("com.", dns.TypeDNSKEY, com.sign(t, clk, com.key))
+	ze.answer("example.com.", dns.TypeDNSKEY, example.sign(t, clk, example.key))
+	ze.answer("com.", dns.TypeDS, root.sign(t, clk, com.key.ToDS(dns.SHA256)))
+	ze.answer("example.com.", dns.TypeDS, com.sign(t, clk, example.key.ToDS(dns.SHA256)))
+
+	a := &dns.A{
+		Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("93.184.216.34"),
+	}
+	ze.answer("www.example.com.", dns.TypeA, example.sign(t, clk, a))
+
+	forged := *a
+	forged.A = net.ParseIP("93.184.216.35")
+	signed := example.sign(t, clk, a)
+	ze.answer("forged.example.com.", dns.TypeA, []dns.RR{&forged, signed[1]})
+
+	stripped := *a
+	stripped.Hdr.Name = "stripped.example.com."
+	ze.answer("stripped.example.com.", dns.TypeA, []dns.RR{&stripped})
+
+	// unsigned.com is delegated from com without a DS record, and the denial
+	// of that DS record is signed by com.
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "unsigned.com.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: "v.com.",
+		TypeBitMap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+	}
+	ze.deny("unsigned.com.", dns.TypeDS, com.sign(t, clk, nsec))
+	ze.deny("www.unsigned.com.", dns.TypeDS, nil)
+	insecureA := *a
+	insecureA.Hdr.Name = "www.unsigned.com."
+	ze.answer("www.unsigned.com.", dns.TypeA, []dns.RR{&insecureA})
+
+	// servfail.example.com has no entry and the exchanger answers SERVFAIL.
+	ze.deny("servfail.example.com.", dns.TypeDS, nil)
+
+	// example.com is denied with NSEC records. Its names, in canonical order,
+	// are example.com, *.wild.example.com, wild.example.com and
+	// www.example.com.
+	soa := example.sign(t, clk, &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:     "ns.example.com.",
+		Mbox:   "hostmaster.example.com.",
+		Serial: 1,
+	})
+	apexNSEC := example.sign(t, clk, newNSEC("example.com.", "*.wild.example.com.", dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY))
+	wildcardNSEC := example.sign(t, clk, newNSEC("*.wild.example.com.", "wild.example.com.", dns.TypeA))
+	wildNSEC := example.sign(t, clk, newNSEC("wild.example.com.", "www.example.com.", dns.TypeTXT))
+	wwwNSEC := example.sign(t, clk, newNSEC("www.example.com.", "example.com.", dns.TypeA))
+	ze.deny("www.example.com.", dns.TypeCAA, concat(soa, wwwNSEC))
+	ze.nxdomain("nope.example.com.", dns.TypeCAA, concat(soa, apexNSEC))
+	ze.deny("a.wild.example.com.", dns.TypeCAA, concat(soa, wildNSEC, wildcardNSEC))
+	// Replays of validly signed records that deny other names or types
+	ze.deny("other.example.com.", dns.TypeCAA, concat(soa, wwwNSEC))
+	ze.deny("soa-only.example.com.", dns.TypeCAA, soa)
+	ze.deny("wild.example.com.", dns.TypeTXT, concat(soa, wildNSEC))
+	ze.nxdomain("zzz.example.com.", dns.TypeCAA, concat(soa, wwwNSEC))
+	ze.nxdomain("www.example.com.", dns.TypeTXT, concat(soa, wildNSEC, apexNSEC))
+	// alias.example.com is a CNAME for www.example.com
+	cname := example.sign(t, clk, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "alias.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: "www.example.com.",
+	})
+	ze[rrsetKey{"alias.example.com.", dns.TypeCAA}] = &dns.Msg{Answer: cname, Ns: concat(soa, wwwNSEC)}
+	ze[rrsetKey{"alias.example.com.", dns.TypeTXT}] = &dns.Msg{Answer: cname, Ns: soa}
+
+	// nsec3.com is denied with NSEC3 records for its apex and www.nsec3.com
+	nsec3Zone := newSignedZone(t, "nsec3.com.")
+	ze.answer("nsec3.com.", dns.TypeDNSKEY, nsec3Zone.sign(t, clk, nsec3Zone.key))
+	ze.answer("nsec3.com.", dns.TypeDS, com.sign(t, clk, nsec3Zone.key.ToDS(dns.SHA256)))
+	apexNSEC3 := nsec3Zone.sign(t, clk, newNSEC3("nsec3.com.", "nsec3.com.", "www.nsec3.com.", dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY))
+	wwwNSEC3 := nsec3Zone.sign(t, clk, newNSEC3("nsec3.com.", "www.nsec3.com.", "nsec3.com.", dns.TypeA))
+	// Which of the two spans covers a name depends on its hash, so deny
+	// with both
+	ze.deny("www.nsec3.com.", dns.TypeCAA, wwwNSEC3)
+	ze.nxdomain("nope.nsec3.com.", dns.TypeCAA, concat(apexNSEC3, wwwNSEC3))
+	ze.deny("other.nsec3.com.", dns.TypeCAA, wwwNSEC3)
+	ze.deny("other2.nsec3.com.", dns.TypeCAA, concat(apexNSEC3, wwwNSEC3))
+	ze.nxdomain("www.nsec3.com.", dns.TypeTXT, concat(apexNSEC3, wwwNSEC3))
+	ze.deny("www.nsec3.com.", dns.TypeA, wwwNSEC3)
+	// Records from one zone deny nothing in another
+	ze.deny("www2.example.com.", dns.TypeCAA, concat(apexNSEC3, wwwNSEC3))
+
+	resolver := NewTestDNSResolverImpl(time.Second, []string{dnsLoopbackAddr}, testStats, clk, 1)
+	resolver.DNSClient = ze
+	resolver.EnableDNSSECValidation([]*dns.DS{root.key.ToDS(dns.SHA256)})
+	return resolver, clk
+}
+
+func TestDNSSECValidAnswer(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+	addrs, err := resolver.LookupHost(context.Background(), "www.example.com")
+	test.AssertNotError(t, err, "Validation of a correctly signed answer failed")
+	test.AssertEquals(t, len(addrs), 1)
+	test.AssertEquals(t, addrs[0].String(), "93.184.216.34")
+}
+
+func TestDNSSECBogusAnswer(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+	for _, name := range []string{"forged.example.com", "stripped.example.com"} {
+		_, err := resolver.LookupHost(context.Background(), name)
+		test.AssertError(t, err, "Validation of a bogus answer succeeded")
+		prob := ProblemDetailsFromDNSError(err)
+		test.AssertEquals(t, prob.Type, probs.DNSSECProblem)
+	}
+}
+
+func TestDNSSECExpiredSignatures(t *testing.T) {
+	resolver, clk := newDNSSECResolver(t)
+	clk.Add(2 * time.Hour)
+	_, err := resolver.LookupHost(context.Background(), "www.example.com")
+	test.AssertError(t, err, "Validation with expired signatures succeeded")
+	test.AssertEquals(t, ProblemDetailsFromDNSError(err).Type, probs.DNSSECProblem)
+}
+
+func TestDNSSECInsecureDelegation(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+	addrs, err := resolver.LookupHost(context.Background(), "www.unsigned.com")
+	test.AssertNotError(t, err, "Unsigned answer from an insecure zone was rejected")
+	test.AssertEquals(t, len(addrs), 1)
+}
+
+func TestDNSSECCAAServFail(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+
+	caas, err := resolver.LookupCAA(context.Background(), "www.unsigned.com")
+	test.AssertNotError(t, err, "SERVFAIL in a provably unsigned zone should be ignored")
+	test.AssertEquals(t, len(caas), 0)
+
+	_, err = resolver.LookupCAA(context.Background(), "servfail.example.com")
+	test.AssertError(t, err, "SERVFAIL in a signed zone should not be ignored")
+	test.AssertEquals(t, err.Error(), "DNS problem: SERVFAIL looking up CAA for servfail.example.com")
+}
+
+func TestDNSSECDenial(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+	for _, name := range []string{
+		// NODATA, from an NSEC record for the name
+		"www.example.com",
+		// NXDOMAIN, from one NSEC record covering both the name and the
+		// wildcard at its closest encloser
+		"nope.example.com",
+		// NODATA from a wildcard: the name is covered and the wildcard has
+		// no CAA records
+		"a.wild.example.com",
+		// NODATA for the target of a CNAME
+		"alias.example.com",
+		// NODATA and NXDOMAIN from NSEC3 records
+		"www.nsec3.com",
+		"nope.nsec3.com",
+	} {
+		caas, err := resolver.LookupCAA(context.Background(), name)
+		test.AssertNotError(t, err, "Failed to validate denial of CAA records for "+name)
+		test.AssertEquals(t, len(caas), 0)
+	}
+}
+
+func TestDNSSECBogusDenial(t *testing.T) {
+	resolver, _ := newDNSSECResolver(t)
+	for _, name := range []string{
+		// A signed NSEC record for another name
+		"other.example.com",
+		// A signed SOA record without any NSEC records
+		"soa-only.example.com",
+		// An NSEC record covering the name but not the wildcard that could
+		// have answered for it
+		"zzz.example.com",
+		// A signed NSEC3 record for another name, alone and with the proof
+		// that other2.nsec3.com doesn't exist, when NOERROR says it does
+		"other.nsec3.com",
+		"other2.nsec3.com",
+		// NSEC3 records from another zone
+		"www2.example.com",
+	} {
+		_, err := resolver.LookupCAA(context.Background(), name)
+		test.AssertError(t, err, "Accepted a replayed denial of CAA records for "+name)
+		test.AssertEquals(t, ProblemDetailsFromDNSError(err).Type, probs.DNSSECProblem)
+	}
+
+	// Denial records whose type bitmaps show the type exists
+	_, _, err := resolver.LookupTXT(context.Background(), "wild.example.com")
+	test.AssertError(t, err, "Accepted a denial of TXT records listed in the type bitmap")
+	test.AssertEquals(t, ProblemDetailsFromDNSError(err).Type, probs.DNSSECProblem)
+	_, err = resolver.LookupHost(context.Background(), "www.nsec3.com")
+	test.AssertError(t, err, "Accepted a denial of A records listed in the type bitmap")
+	test.AssertEquals(t, ProblemDetailsFromDNSError(err).Type, probs.DNSSECProblem)
+
+	// NXDOMAIN for names that exist, and a CNAME target without proof that
+	// it has no TXT records
+	for _, name := range []string{"www.example.com", "www.nsec3.com", "alias.example.com"} {
+		_, _, err := resolver.LookupTXT(context.Background(), name)
+		test.AssertError(t, err, "Accepted a bogus denial of TXT records for "+name)
+		test.AssertEquals(t, ProblemDetailsFromDNSError(err).Type, probs.DNSSECProblem)
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	// The example from RFC 4034, Section 6.1
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.",
+		"zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 0; i+1 < len(ordered); i++ {
+		if strings.HasPrefix(ordered[i+1], "\\") || strings.HasPrefix(ordered[i], "\\") {
+			// Escaped labels aren't decoded before comparing
+			continue
+		}
+		test.Assert(t, canonicalCompare(ordered[i], ordered[i+1]) < 0, ordered[i]+" doesn't sort before "+ordered[i+1])
+	}
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	anchors, err := ParseTrustAnchors(strings.NewReader(
+		". IN DS 19036 8 2 49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5\n"))
+	test.AssertNotError(t, err, "Failed to parse DS trust anchor")
+	test.AssertEquals(t, len(anchors), 1)
+	test.AssertEquals(t, anchors[0].KeyTag, uint16(19036))
+
+	_, err = ParseTrustAnchors(strings.NewReader("example.com. IN A 127.0.0.1\n"))
+	test.AssertError(t, err, "Parsed trust anchors without DS or DNSKEY records")
+}
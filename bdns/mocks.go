@@ -20,7 +20,7 @@ func (mock *MockDNSResolver) LookupTXT(_ context.Context, hostname string) ([]st
 	if hostname == "_acme-challenge.servfail.com" {
 		return nil, nil, fmt.Errorf("SERVFAIL")
 	}
-	if hostname == "_acme-challenge.good-dns01.com" {
+	if hostname == "_acme-challenge.good-dns01.com" || hostname == "delegated.validation-zone.com" {
 		// base64(sha256("LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
 		//               + "." + "9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"))
 		// expected token + test account jwk thumbprint
@@ -115,3 +115,18 @@ func (mock *MockDNSResolver) LookupMX(_ context.Context, domain string) ([]strin
 	}
 	return nil, nil
 }
+
+// LookupCNAME is a mock
+func (mock *MockDNSResolver) LookupCNAME(_ context.Context, hostname string) (string, error) {
+	switch strings.TrimRight(hostname, ".") {
+	case "_acme-challenge.delegated-dns01.com":
+		return "delegated.validation-zone.com", nil
+	case "_acme-challenge.delegated-private.com":
+		return "validation.local", nil
+	case "_acme-challenge.cname-loop.com":
+		return "_acme-challenge.cname-loop.com", nil
+	case "_acme-challenge.cname-servfail.com":
+		return "", &dnsError{dns.TypeCNAME, hostname, nil, dns.RcodeServerFailure}
+	}
+	return "", nil
+}
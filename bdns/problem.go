@@ -53,8 +53,15 @@ const detailServerFailure = "server failure at resolver"
 // and tests if the error was an underlying net.OpError or an error caused by
 // resolver returning SERVFAIL or other invalid Rcodes and returns the relevant
 // core.ProblemDetails. The detail string will contain a mention of the DNS
-// record type and domain given.
+// record type and domain given. Responses that failed DNSSEC validation are
+// reported with a DNSSECProblem.
 func ProblemDetailsFromDNSError(err error) *probs.ProblemDetails {
+	if dnssecErr, ok := err.(*dnssecError); ok {
+		return &probs.ProblemDetails{
+			Type:   probs.DNSSECProblem,
+			Detail: dnssecErr.Error(),
+		}
+	}
 	if dnsErr, ok := err.(*dnsError); ok {
 		return &probs.ProblemDetails{
 			Type:   probs.ConnectionProblem,
@@ -1,79 +1,178 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
-	"github.com/letsencrypt/boulder/akamai"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/purger"
+	"github.com/letsencrypt/boulder/sa"
 )
 
-func main() {
-	app := cli.NewApp()
-	app.Name = "akamai-purger"
-	app.Usage = "Purge a resource from the Akamai CDN cache"
-	app.Version = cmd.Version()
-	app.Author = "Boulder contributors"
-	app.Email = "ca-dev@letsencrypt.org"
-
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:   "config",
-			Value:  "config.json",
-			EnvVar: "BOULDER_CONFIG",
-			Usage:  "Path to Boulder JSON configuration file",
-		},
-		cli.StringFlag{
-			Name:  "url",
-			Usage: "URL to purge from CDN",
-		},
+const (
+	defaultBatchSize       = 100
+	defaultPollInterval    = 10 * time.Second
+	defaultMaxAttempts     = 10
+	defaultRetryBackoff    = time.Minute
+	defaultRetryBackoffMax = time.Hour
+)
+
+// queueDrainer purges the URLs in the purge queue from the CDN's cache in
+// batches, retrying failed purges with an exponential backoff
+type queueDrainer struct {
+	purger purger.Purger
+	queue  *purger.Queue
+	clk    clock.Clock
+	stats  statsd.Statter
+	log    *blog.AuditLogger
+
+	batchSize       int
+	maxAttempts     int
+	retryBackoff    time.Duration
+	retryBackoffMax time.Duration
+}
+
+// drainBatch purges the next batch of queued URLs that are due and returns how
+// many there were
+func (d *queueDrainer) drainBatch() (int, error) {
+	due, err := d.queue.Due(d.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	urls := make([]string, len(due))
+	ids := make([]int64, len(due))
+	for i, p := range due {
+		urls[i] = p.URL
+		ids[i] = p.ID
+	}
+	start := d.clk.Now()
+	purgeErr := d.purger.Purge(urls)
+	d.stats.TimingDuration("PurgeQueue.BatchLatency", d.clk.Now().Sub(start), 1.0)
+	if purgeErr == nil {
+		d.stats.Inc("PurgeQueue.Purged", int64(len(due)), 1.0)
+		return len(due), d.queue.Remove(ids)
 	}
 
-	app.Action = func(c *cli.Context) {
-		configFileName := c.GlobalString("config")
-		url := c.GlobalString("url")
+	// If the purger says which URLs failed only they are retried
+	failed := due
+	if partial, ok := purgeErr.(purger.PartialPurgeError); ok {
+		failed = nil
+		var purged []int64
+		for _, p := range due {
+			if _, present := partial[p.URL]; present {
+				failed = append(failed, p)
+			} else {
+				purged = append(purged, p.ID)
+			}
+		}
+		d.stats.Inc("PurgeQueue.Purged", int64(len(purged)), 1.0)
+		if err = d.queue.Remove(purged); err != nil {
+			return len(due), err
+		}
+	}
 
-		if url == "" || configFileName == "" {
-			fmt.Println("Both -url -config (or BOULDER_CONFIG) are required")
-			return
+	d.log.AuditErr(fmt.Errorf("Failed to purge %d queued URLs: %s", len(failed), purgeErr))
+	var abandoned []int64
+	for _, p := range failed {
+		attempts := p.Attempts + 1
+		if attempts >= d.maxAttempts {
+			d.log.AuditErr(fmt.Errorf("Giving up on purging %s after %d attempts", p.URL, attempts))
+			abandoned = append(abandoned, p.ID)
+			continue
 		}
+		next := d.clk.Now().Add(core.RetryBackoff(attempts, d.retryBackoff, d.retryBackoffMax, 2))
+		if err = d.queue.Postpone(p.ID, next); err != nil {
+			return len(due), err
+		}
+	}
+	d.stats.Inc("PurgeQueue.Retried", int64(len(failed)-len(abandoned)), 1.0)
+	d.stats.Inc("PurgeQueue.Abandoned", int64(len(abandoned)), 1.0)
+	return len(due), d.queue.Remove(abandoned)
+}
 
-		configJSON, err := ioutil.ReadFile(configFileName)
+// drain purges queued URLs as they become due. It never returns.
+func (d *queueDrainer) drain(pollInterval time.Duration) {
+	for {
+		n, err := d.drainBatch()
 		if err != nil {
-			fmt.Printf("Failed to read config file: %s\n", err)
+			d.log.AuditErr(fmt.Errorf("Failed to drain purge queue: %s", err))
+		}
+		if err != nil || n < d.batchSize {
+			d.clk.Sleep(pollInterval)
+		}
+	}
+}
+
+func main() {
+	app := cmd.NewAppShell("akamai-purger", "Purges queued OCSP responses, or a single resource, from the CDN cache")
+	app.App.Flags = append(app.App.Flags, cli.StringFlag{
+		Name:  "url",
+		Usage: "URL to purge from CDN, instead of draining the purge queue",
+	})
+
+	var url string
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		url = c.GlobalString("url")
+		return config
+	}
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		conf := c.AkamaiPurger
+		p, err := purger.New(conf.Purger, auditlogger, stats)
+		cmd.FailOnError(err, "Failed to create purger")
+
+		if url != "" {
+			err = p.Purge([]string{url})
+			cmd.FailOnError(err, "Failed to purge requested resource")
 			return
 		}
 
-		var config cmd.Config
-		err = json.Unmarshal(configJSON, &config)
-
-		// Set up logging
-		stats, auditlogger := cmd.StatsAndLogging(config.Statsd, config.Syslog)
-		auditlogger.Info(app.Version)
-
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		defer auditlogger.AuditPanic()
-
-		akamaiClient, err := akamai.NewCachePurgeClient(
-			config.OCSPUpdater.AkamaiBaseURL,
-			config.OCSPUpdater.AkamaiClientToken,
-			config.OCSPUpdater.AkamaiClientSecret,
-			config.OCSPUpdater.AkamaiAccessToken,
-			config.OCSPUpdater.AkamaiPurgeRetries,
-			config.OCSPUpdater.AkamaiPurgeRetryBackoff.Duration,
-			auditlogger,
-			stats,
-		)
-		cmd.FailOnError(err, "Failed to create Akamai CachePurgeClient")
-
-		err = akamaiClient.Purge([]string{url})
-		cmd.FailOnError(err, "Failed to purge requested resource")
+		dbURL, err := conf.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		clk := clock.Default()
+		drainer := &queueDrainer{
+			purger:          p,
+			queue:           purger.NewQueue(dbMap, clk),
+			clk:             clk,
+			stats:           stats,
+			log:             auditlogger,
+			batchSize:       conf.BatchSize,
+			maxAttempts:     conf.MaxAttempts,
+			retryBackoff:    conf.RetryBackoff.Duration,
+			retryBackoffMax: conf.RetryBackoffMax.Duration,
+		}
+		if drainer.batchSize <= 0 {
+			drainer.batchSize = defaultBatchSize
+		}
+		if drainer.maxAttempts <= 0 {
+			drainer.maxAttempts = defaultMaxAttempts
+		}
+		if drainer.retryBackoff == 0 {
+			drainer.retryBackoff = defaultRetryBackoff
+		}
+		if drainer.retryBackoffMax == 0 {
+			drainer.retryBackoffMax = defaultRetryBackoffMax
+		}
+		pollInterval := conf.PollInterval.Duration
+		if pollInterval == 0 {
+			pollInterval = defaultPollInterval
+		}
+
+		drainer.drain(pollInterval)
 	}
 
-	err := app.Run(os.Args)
-	cmd.FailOnError(err, "Failed to run application")
+	app.Run()
 }
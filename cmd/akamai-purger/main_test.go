@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/purger"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+// fakePurger records the URLs it is asked to purge, failing while err is set,
+// and reporting the URLs in failing as not purged
+type fakePurger struct {
+	purged  [][]string
+	err     error
+	failing map[string]bool
+}
+
+func (p *fakePurger) Purge(urls []string) error {
+	p.purged = append(p.purged, urls)
+	if p.err != nil {
+		return p.err
+	}
+	failed := make(purger.PartialPurgeError)
+	for _, u := range urls {
+		if p.failing[u] {
+			failed[u] = errors.New("CDN is down")
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func TestDrainBatch(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Couldn't connect to the database")
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	stats, _ := statsd.NewNoopClient(nil)
+	fp := &fakePurger{err: errors.New("CDN is down")}
+	queue := purger.NewQueue(dbMap, fc)
+	d := &queueDrainer{
+		purger:          fp,
+		queue:           queue,
+		clk:             fc,
+		stats:           stats,
+		log:             blog.GetAuditLogger(),
+		batchSize:       2,
+		maxAttempts:     2,
+		retryBackoff:    time.Minute,
+		retryBackoffMax: time.Hour,
+	}
+	err = queue.Add([]string{"http://ocsp.example.com/a", "http://ocsp.example.com/b", "http://ocsp.example.com/c"})
+	test.AssertNotError(t, err, "Failed to queue purges")
+
+	// A failed batch is retried after a backoff, leaving the rest of the queue
+	// to the next batch
+	n, err := d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 2)
+	test.AssertEquals(t, len(fp.purged[0]), 2)
+	n, err = d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 1)
+	test.AssertEquals(t, fp.purged[1][0], "http://ocsp.example.com/c")
+	n, err = d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 0)
+
+	// After failing maxAttempts times purges are given up on
+	fc.Add(2 * time.Minute)
+	n, err = d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 2)
+	due, err := queue.Due(10)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 1)
+	test.AssertEquals(t, due[0].URL, "http://ocsp.example.com/c")
+
+	// Successful purges are removed from the queue
+	fp.err = nil
+	n, err = d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 1)
+	due, err = queue.Due(10)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 0)
+}
+
+func TestDrainBatchPartialFailure(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Couldn't connect to the database")
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	stats, _ := statsd.NewNoopClient(nil)
+	fp := &fakePurger{failing: map[string]bool{"http://ocsp.example.com/b": true}}
+	queue := purger.NewQueue(dbMap, fc)
+	d := &queueDrainer{
+		purger:          fp,
+		queue:           queue,
+		clk:             fc,
+		stats:           stats,
+		log:             blog.GetAuditLogger(),
+		batchSize:       10,
+		maxAttempts:     10,
+		retryBackoff:    time.Minute,
+		retryBackoffMax: time.Hour,
+	}
+	err = queue.Add([]string{"http://ocsp.example.com/a", "http://ocsp.example.com/b", "http://ocsp.example.com/c"})
+	test.AssertNotError(t, err, "Failed to queue purges")
+
+	// Only the URL that failed is retried, the others are removed
+	n, err := d.drainBatch()
+	test.AssertNotError(t, err, "Failed to drain batch")
+	test.AssertEquals(t, n, 3)
+	fc.Add(2 * time.Minute)
+	due, err := queue.Due(10)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 1)
+	test.AssertEquals(t, due[0].URL, "http://ocsp.example.com/b")
+	test.AssertEquals(t, due[0].Attempts, 1)
+}
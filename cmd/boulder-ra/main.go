@@ -6,13 +6,17 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/ratelimit"
 	"github.com/letsencrypt/boulder/sa"
 
 	"github.com/letsencrypt/boulder/cmd"
@@ -23,8 +27,52 @@ import (
 
 const clientName = "RA"
 
+// checkRateLimitPolicies validates the rate limit policies in filename, prints
+// a summary of each policy and exits. It lets a policy change be checked
+// before the RAs are signalled to reload it.
+func checkRateLimitPolicies(filename string) {
+	rlc, err := cmd.LoadRateLimitPolicies(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid rate limit policies in %s: %s\n", filename, err)
+		os.Exit(1)
+	}
+	policies := []struct {
+		name   string
+		policy cmd.RateLimitPolicy
+	}{
+		{"totalCertificates", rlc.TotalCertificates},
+		{"certificatesPerName", rlc.CertificatesPerName},
+		{"certificatesPerFQDNSet", rlc.CertificatesPerFQDNSet},
+		{"registrationsPerIP", rlc.RegistrationsPerIP},
+		{"pendingAuthorizationsPerAccount", rlc.PendingAuthorizationsPerAccount},
+		{"invalidAuthorizationsPerAccount", rlc.InvalidAuthorizationsPerAccount},
+	}
+	for _, p := range policies {
+		mode := "enforced"
+		if !p.policy.Enabled() {
+			mode = "disabled"
+		} else if p.policy.Shadow {
+			mode = "shadow"
+		}
+		fmt.Printf("%s: %s, threshold %d per %s, %d overrides, %d registration overrides\n",
+			p.name, mode, p.policy.Threshold, p.policy.Window.Duration,
+			len(p.policy.Overrides), len(p.policy.RegistrationOverrides))
+	}
+	os.Exit(0)
+}
+
 func main() {
 	app := cmd.NewAppShell("boulder-ra", "Handles service orchestration")
+	app.App.Flags = append(app.App.Flags, cli.BoolFlag{
+		Name:  "check-rate-limits",
+		Usage: "Validate the rate limit policies file named in the config and exit, without starting the RA",
+	})
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		if c.GlobalBool("check-rate-limits") {
+			checkRateLimitPolicies(config.RA.RateLimitPoliciesFilename)
+		}
+		return config
+	}
 	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
 		// Validate PA config and set defaults if needed
 		cmd.FailOnError(c.PA.CheckChallenges(), "Invalid PA configuration")
@@ -68,20 +116,69 @@ func main() {
 		if dnsTries < 1 {
 			dnsTries = 1
 		}
+		var resolver *bdns.DNSResolverImpl
 		if !c.Common.DNSAllowLoopbackAddresses {
-			rai.DNSResolver = bdns.NewDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver}, scoped, clock.Default(), dnsTries)
+			resolver = bdns.NewDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver}, scoped, clock.Default(), dnsTries)
 		} else {
-			rai.DNSResolver = bdns.NewTestDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver}, scoped, clock.Default(), dnsTries)
+			resolver = bdns.NewTestDNSResolverImpl(raDNSTimeout, []string{c.Common.DNSResolver}, scoped, clock.Default(), dnsTries)
 		}
+		if c.Common.DNSSECTrustAnchors != "" {
+			anchors, err := bdns.LoadTrustAnchors(c.Common.DNSSECTrustAnchors)
+			cmd.FailOnError(err, "Couldn't load DNSSEC trust anchors")
+			resolver.EnableDNSSECValidation(anchors)
+		}
+		rai.DNSResolver = resolver
 
 		rai.VA = vac
 		rai.CA = cac
 		rai.SA = sac
 
+		rlc := c.RA.RateLimitCounter
+		switch rlc.Type {
+		case "":
+		case "memory":
+			rai.RateLimits = ratelimit.NewMemoryCounter(rlc.Resolution.Duration)
+		case "sql":
+			dbURL, err := rlc.DBConfig.URL()
+			cmd.FailOnError(err, "Couldn't load rate limit counter DB URL")
+			rlDbMap, err := sa.NewDbMap(dbURL)
+			cmd.FailOnError(err, "Couldn't connect to rate limit counter database")
+			rai.RateLimits = ratelimit.NewSQLCounter(rlDbMap, rlc.Resolution.Duration)
+		default:
+			cmd.FailOnError(fmt.Errorf("unknown type %q", rlc.Type), "Invalid rate limit counter configuration")
+		}
+		rai.RateLimitsSince = rlc.Since
+		if rai.RateLimits != nil {
+			pruneInterval := rlc.PruneInterval.Duration
+			if pruneInterval == 0 {
+				pruneInterval = time.Hour
+			}
+			go func() {
+				for range time.Tick(pruneInterval) {
+					pruned, err := rai.PruneRateLimitCounters()
+					if err != nil {
+						auditlogger.Warning(fmt.Sprintf("Couldn't prune rate limit counters: %s", err))
+						continue
+					}
+					stats.Inc("RA.RateLimitCounters.Pruned", pruned, 1.0)
+				}
+			}()
+		}
+
+		rai.RateLimitOverridesTTL = c.RA.RateLimitOverridesTTL.Duration
+		if rai.RateLimitOverridesTTL == 0 {
+			rai.RateLimitOverridesTTL = 5 * time.Minute
+		}
+
+		rai.AuthorizationReuseWindow = c.RA.AuthorizationReuseWindow.Duration
+
 		ras, err := rpc.NewAmqpRPCServer(amqpConf, c.RA.MaxConcurrentRPCServerRequests, stats)
 		cmd.FailOnError(err, "Unable to create RA RPC server")
 		rpc.NewRegistrationAuthorityServer(ras, rai)
 
+		// Send SIGUSR1 to pick up changes to the rate limit policies file.
+		cmd.ReloadRateLimitPoliciesOnSignal(c.RA.RateLimitPoliciesFilename, auditlogger, rai.SetRateLimitPolicies)
+
 		err = ras.Start(amqpConf)
 		cmd.FailOnError(err, "Unable to run RA RPC server")
 	}
@@ -28,6 +28,7 @@ func main() {
 		sai, err := sa.NewSQLStorageAuthority(dbMap, clock.Default())
 		cmd.FailOnError(err, "Failed to create SA impl")
 		sai.SetSQLDebug(c.SQL.SQLDebug)
+		sai.RecordCertificateEvents = saConf.RecordCertificateEvents
 
 		go cmd.ProfileCmd("SA", stats)
 
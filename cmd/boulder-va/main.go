@@ -6,12 +6,15 @@
 package main
 
 import (
+	"errors"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/sa"
 
 	"github.com/letsencrypt/boulder/cmd"
 	blog "github.com/letsencrypt/boulder/log"
@@ -45,6 +48,7 @@ func main() {
 		clk := clock.Default()
 		sbc := newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
 		vai := va.NewValidationAuthorityImpl(pc, sbc, stats, clk)
+		vai.Reputation = append(vai.Reputation, newReputationChecks(c.VA.Reputation)...)
 		dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse DNS timeout")
 		scoped := metrics.NewStatsdScope(stats, "VA", "DNS")
@@ -52,14 +56,34 @@ func main() {
 		if dnsTries < 1 {
 			dnsTries = 1
 		}
+		var resolver *bdns.DNSResolverImpl
 		if !c.Common.DNSAllowLoopbackAddresses {
-			vai.DNSResolver = bdns.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped, clk, dnsTries)
+			resolver = bdns.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped, clk, dnsTries)
 		} else {
-			vai.DNSResolver = bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped, clk, dnsTries)
+			resolver = bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped, clk, dnsTries)
 		}
+		if c.Common.DNSSECTrustAnchors != "" {
+			anchors, err := bdns.LoadTrustAnchors(c.Common.DNSSECTrustAnchors)
+			cmd.FailOnError(err, "Couldn't load DNSSEC trust anchors")
+			resolver.EnableDNSSECValidation(anchors)
+		}
+		vai.DNSResolver = resolver
 		vai.UserAgent = c.VA.UserAgent
 		vai.IssuerDomain = c.VA.IssuerDomain
 
+		// The PA vets the targets of dns-01 CNAME delegation. Without it every
+		// delegated validation would fail, so it must be configured.
+		dbURL, err := c.PA.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		if dbURL == "" {
+			cmd.FailOnError(errors.New("no PA database configured"), "The VA needs the PA to check dns-01 delegations")
+		}
+		paDbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Couldn't connect to policy database")
+		pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist, c.PA.Challenges)
+		cmd.FailOnError(err, "Couldn't create PA")
+		vai.PA = pa
+
 		amqpConf := c.VA.AMQP
 		rac, err := rpc.NewRegistrationAuthorityClient(clientName, amqpConf, stats)
 		cmd.FailOnError(err, "Unable to create RA client")
@@ -0,0 +1,57 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/va"
+)
+
+// newReputationChecks builds the VA's chain of domain reputation providers
+// from config, running cmd.FailOnError on any provider it can't construct.
+func newReputationChecks(configs []cmd.ReputationProviderConfig) []va.ReputationCheck {
+	var checks []va.ReputationCheck
+	for _, rc := range configs {
+		name := rc.Name
+		if name == "" {
+			name = rc.Type
+		}
+		var provider va.ReputationProvider
+		switch rc.Type {
+		case "gsb":
+			sbc := newGoogleSafeBrowsing(rc.GoogleSafeBrowsing)
+			if sbc == nil {
+				cmd.FailOnError(fmt.Errorf("no GoogleSafeBrowsing config"), fmt.Sprintf("reputation provider %s", name))
+			}
+			provider = va.SafeBrowsingProvider{Client: sbc}
+		case "blocklist-file", "highrisk-file":
+			verdict := va.ReputationUnsafe
+			if rc.Type == "highrisk-file" {
+				verdict = va.ReputationReview
+			}
+			dl, err := va.LoadDomainList(rc.File, verdict)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't load domain list for reputation provider %s", name))
+			provider = dl
+		case "sql":
+			dbURL, err := rc.DBConfig.URL()
+			cmd.FailOnError(err, "Couldn't load DB URL")
+			dbMap, err := sa.NewDbMap(dbURL)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't connect to database for reputation provider %s", name))
+			provider = va.NewSQLDomainList(dbMap)
+		default:
+			cmd.FailOnError(fmt.Errorf("unknown type %q", rc.Type), fmt.Sprintf("reputation provider %s", name))
+		}
+		checks = append(checks, va.ReputationCheck{
+			Name:     name,
+			Provider: provider,
+			FailOpen: rc.FailOpen,
+		})
+	}
+	return checks
+}
@@ -6,7 +6,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -84,6 +86,12 @@ func main() {
 		go cmd.ProfileCmd("WFE", stats)
 
 		// Set up paths
+		if c.WFE.UnsubscribeKeyFile != "" {
+			key, err := ioutil.ReadFile(c.WFE.UnsubscribeKeyFile)
+			cmd.FailOnError(err, "Could not read unsubscribe key")
+			wfe.UnsubscribeKey = bytes.TrimSpace(key)
+		}
+
 		wfe.BaseURL = c.Common.BaseURL
 		h, err := wfe.Handler()
 		cmd.FailOnError(err, "Problem setting up HTTP handlers")
@@ -47,6 +47,10 @@ type Config struct {
 
 		ShutdownStopTimeout string
 		ShutdownKillTimeout string
+
+		// File holding the key the expiration mailer signs unsubscribe links
+		// with. Unsubscribing is disabled if it isn't set.
+		UnsubscribeKeyFile string
 	}
 
 	CA CAConfig
@@ -67,6 +71,20 @@ type Config struct {
 		// before giving up. May be short-circuited by deadlines. A zero value
 		// will be turned into 1.
 		DNSTries int
+
+		// Where to keep rate limit counters. If unset, rate limits are
+		// checked with live queries against the SA.
+		RateLimitCounter RateLimitCounterConfig
+
+		// How long to cache the rate limit overrides stored in the SA before
+		// reading them again. Defaults to five minutes.
+		RateLimitOverridesTTL ConfigDuration
+
+		// How long an existing valid or pending authorization must remain
+		// usable for a new-authz request to be given it rather than a new
+		// authorization. If unset or zero, a new authorization is always
+		// created.
+		AuthorizationReuseWindow ConfigDuration
 	}
 
 	SA struct {
@@ -74,6 +92,11 @@ type Config struct {
 		DBConfig
 
 		MaxConcurrentRPCServerRequests int64
+
+		// RecordCertificateEvents has the SA record issuances and revocations
+		// for the OCSP updater, whose CertificateEventWindow and
+		// CertificateEventBatchSize must be set for them to be consumed
+		RecordCertificateEvents bool
 	}
 
 	VA struct {
@@ -87,8 +110,15 @@ type Config struct {
 
 		MaxConcurrentRPCServerRequests int64
 
+		// GoogleSafeBrowsing installs the Google Safe Browsing client as the
+		// first, fail-closed, domain reputation provider. To choose its failure
+		// policy, configure it in Reputation instead.
 		GoogleSafeBrowsing *GoogleSafeBrowsingConfig
 
+		// Reputation is the chain of domain reputation providers consulted, in
+		// order, by IsSafeDomain.
+		Reputation []ReputationProviderConfig
+
 		// The number of times to try a DNS query (that has a temporary error)
 		// before giving up. May be short-circuited by deadlines. A zero value
 		// will be turned into 1.
@@ -110,6 +140,24 @@ type Config struct {
 		AMQP *AMQPConfig
 	}
 
+	RateLimitOverrides struct {
+		// Like the revoker, rate-limit-overrides is a one-shot admin tool and
+		// only needs an AMQPConfig with an SA server.
+		AMQP *AMQPConfig
+	}
+
+	ManualReviews struct {
+		// Like the revoker, manual-reviews is a one-shot admin tool and only
+		// needs an AMQPConfig with an SA server.
+		AMQP *AMQPConfig
+	}
+
+	ValidationReplay struct {
+		// Like the revoker, validation-replay is a one-shot admin tool and only
+		// needs an AMQPConfig with VA and SA servers.
+		AMQP *AMQPConfig
+	}
+
 	Mailer struct {
 		ServiceConfig
 		DBConfig
@@ -129,6 +177,22 @@ type Config struct {
 		NagCheckInterval string
 		// Path to a text/template email template
 		EmailTemplate string
+		// Path to an html/template email template. If set, emails are sent as
+		// multipart/alternative with both an HTML and a plain text body.
+		HTMLEmailTemplate string
+		// LocalizedEmailTemplates maps BCP 47 language tags, like "de" or
+		// "pt-BR", to the templates used for registrations whose notification
+		// preferences ask for that locale. Tags match case insensitively, and
+		// a locale without templates falls back to its shorter prefixes, then
+		// to the templates above.
+		LocalizedEmailTemplates map[string]LocalizedEmailTemplate
+
+		// File holding the key unsubscribe links are signed with, which the
+		// WFE must share. UnsubscribeURL is the WFE's unsubscribe path, e.g.
+		// https://acme.example.com/acme/unsubscribe/, that signed tokens are
+		// appended to. Emails have no unsubscribe link unless both are set.
+		UnsubscribeKeyFile string
+		UnsubscribeURL     string
 	}
 
 	OCSPResponder struct {
@@ -141,12 +205,36 @@ type Config struct {
 		// If DBConfig has non-empty fields, it takes precedence over this.
 		Source string
 
+		// Issuers lists the issuers to answer OCSP requests for. Requests are
+		// matched to an issuer by the hashes of its name and key. If empty,
+		// requests are answered from Source, and if that is a database only
+		// for Common.IssuerCert.
+		Issuers []OCSPIssuerConfig
+
 		Path          string
 		ListenAddress string
 		// MaxAge is the max-age to set in the Cache-Control response
 		// header. It is a time.Duration formatted string.
 		MaxAge ConfigDuration
 
+		// RedirectToCanonical redirects GET requests whose path isn't the
+		// canonical encoding of the OCSP request they carry to the canonical
+		// path, rather than answering them directly, so that a CDN caches
+		// every client's requests for a certificate under the URLs the OCSP
+		// updater purges.
+		RedirectToCanonical bool
+
+		// CacheSize is the number of responses from a database source to keep
+		// in memory. Defaults to 10000.
+		CacheSize int
+		// CacheRefreshInterval is how often the cache is refreshed with the
+		// responses the OCSP updater has written. Defaults to 10 seconds.
+		CacheRefreshInterval ConfigDuration
+
+		// LiveSigning, if present, has the CA sign a response for a known,
+		// unexpired certificate whose response is missing from the database.
+		LiveSigning *OCSPLiveSigningConfig
+
 		ShutdownStopTimeout string
 		ShutdownKillTimeout string
 	}
@@ -175,6 +263,10 @@ type Config struct {
 		DNSResolver               string
 		DNSTimeout                string
 		DNSAllowLoopbackAddresses bool
+		// Path to a file of DS or DNSKEY records in zone file format. When
+		// set, DNS responses are validated against these trust anchors
+		// instead of trusting the DNSSEC validation of DNSResolver.
+		DNSSECTrustAnchors string
 
 		CT struct {
 			Logs                       []LogDescription
@@ -188,6 +280,52 @@ type Config struct {
 		Workers             int
 		ReportDirectoryPath string
 	}
+
+	OCSPChecker struct {
+		DBConfig
+
+		// ResponderURL is the public OCSP responder URL responses are fetched
+		// from, as clients see it
+		ResponderURL string
+		// IssuerCert is the certificate responses must be signed by, defaults
+		// to Common.IssuerCert
+		IssuerCert string
+
+		SampleSize          int
+		Workers             int
+		ReportDirectoryPath string
+	}
+
+	ExpiredAuthzPurger struct {
+		DBConfig
+
+		// How long after they expire authorizations are kept before being
+		// deleted. Defaults to one week.
+		GracePeriod ConfigDuration
+		// How many authorizations to delete in each transaction. Defaults to
+		// 1000.
+		BatchSize int
+	}
+
+	AkamaiPurger struct {
+		DBConfig
+
+		Purger PurgerConfig
+
+		// How many queued URLs to purge in each request. Defaults to 100.
+		BatchSize int
+		// How long to wait before checking an empty queue again. Defaults to
+		// 10 seconds.
+		PollInterval ConfigDuration
+		// How many times to try to purge a URL before giving up on it.
+		// Defaults to 10.
+		MaxAttempts int
+		// RetryBackoff is how long to wait before the first retry of a failed
+		// purge, each later retry waits twice as long as the last, up to
+		// RetryBackoffMax. They default to one minute and one hour.
+		RetryBackoff    ConfigDuration
+		RetryBackoffMax ConfigDuration
+	}
 	AllowedSigningAlgos *AllowedSigningAlgos
 
 	SubscriberAgreementURL string
@@ -244,6 +382,26 @@ func (d *DBConfig) URL() (string, error) {
 	return d.DBConnect, nil
 }
 
+// RateLimitCounterConfig describes the store for the RA's rate limit counters.
+type RateLimitCounterConfig struct {
+	// "memory" or "sql". Empty disables the counters.
+	Type string
+	// Width of the time buckets events are counted in. Every RA sharing a
+	// "sql" store must use the same value.
+	Resolution ConfigDuration
+	// When the counters started recording events, in RFC 3339 format. Until
+	// the longest rate limit window has passed since then, windows beginning
+	// earlier are still counted with live queries against the SA. Leave it
+	// unset only if the store already holds every event in the longest
+	// window.
+	Since time.Time
+	// How often to discard counted events older than the longest rate limit
+	// window. Defaults to one hour.
+	PruneInterval ConfigDuration
+	// Connection to the SA database, for the "sql" type.
+	DBConfig
+}
+
 // AMQPConfig describes how to connect to AMQP, and how to speak to each of the
 // RPC services we offer via AMQP.
 type AMQPConfig struct {
@@ -353,6 +511,27 @@ type RPCServerConfig struct {
 	RPCTimeout ConfigDuration
 }
 
+// OCSPIssuerConfig describes an issuer the OCSP responder answers requests for
+type OCSPIssuerConfig struct {
+	// Path to a PEM-encoded copy of the issuer certificate.
+	IssuerCert string
+	// Source is a file URL of pre-signed responses for the certificates this
+	// issuer signed, as used for roots and intermediates. If empty, responses
+	// come from the responder's database.
+	Source string
+}
+
+// OCSPLiveSigningConfig limits how often the OCSP responder asks the CA to sign
+// responses that are missing from its database
+type OCSPLiveSigningConfig struct {
+	// At most MaxSignings responses are signed in each Window
+	MaxSignings int
+	Window      ConfigDuration
+
+	SignFailureBackoffFactor float64
+	SignFailureBackoffMax    ConfigDuration
+}
+
 // OCSPUpdaterConfig provides the various window tick times and batch sizes needed
 // for the OCSP (and SCT) updater
 type OCSPUpdaterConfig struct {
@@ -363,15 +542,29 @@ type OCSPUpdaterConfig struct {
 	OldOCSPWindow            ConfigDuration
 	MissingSCTWindow         ConfigDuration
 	RevokedCertificateWindow ConfigDuration
+	// CertificateEventWindow and CertificateEventBatchSize enable the loop
+	// that signs responses for the certificates the SA records as issued or
+	// revoked in the certificateEvents table, when its RecordCertificateEvents
+	// is set
+	CertificateEventWindow ConfigDuration
 
 	NewCertificateBatchSize     int
 	OldOCSPBatchSize            int
 	MissingSCTBatchSize         int
 	RevokedCertificateBatchSize int
+	CertificateEventBatchSize   int
 
 	OCSPMinTimeToExpiry ConfigDuration
 	OldestIssuedSCT     ConfigDuration
 
+	// PurgeOCSPResponses queues the GET URLs of each new OCSP response to be
+	// purged from the CDN's cache by the akamai-purger.
+	PurgeOCSPResponses bool
+
+	// The Akamai* fields used to have the updater purge responses itself.
+	// Purging is now configured in AkamaiPurger and enabled with
+	// PurgeOCSPResponses, and the updater refuses to start if any of these are
+	// set so that purging isn't silently turned off.
 	AkamaiBaseURL           string
 	AkamaiClientToken       string
 	AkamaiClientSecret      string
@@ -381,6 +574,44 @@ type OCSPUpdaterConfig struct {
 
 	SignFailureBackoffFactor float64
 	SignFailureBackoffMax    ConfigDuration
+
+	// ShardCount splits the certificates the updater works on into that many
+	// shards, by the last two hex digits of their serials, so that several
+	// updaters can share the load, each configured with its own Shard from 0
+	// to ShardCount-1. Every shard needs an updater running. At most 256
+	// shards are supported, and a ShardCount of zero or one means a single
+	// updater handles every certificate.
+	ShardCount int
+	Shard      int
+}
+
+// PurgerConfig picks and configures the backend used to purge resources from a
+// CDN's cache. Type must be one of "akamai", which uses the Akamai CCU API,
+// "http", which sends HTTPMethod requests, such as PURGE or BAN, for each
+// resource to Varnish, nginx or similar, and "noop", for when there is no CDN.
+type PurgerConfig struct {
+	Type string
+
+	AkamaiBaseURL           string
+	AkamaiClientToken       string
+	AkamaiClientSecret      string
+	AkamaiAccessToken       string
+	AkamaiPurgeRetries      int
+	AkamaiPurgeRetryBackoff ConfigDuration
+
+	// HTTPMethod defaults to PURGE. If HTTPEndpoint is set requests are sent
+	// to it rather than to the host named in each resource's URL.
+	HTTPMethod   string
+	HTTPEndpoint string
+}
+
+// LocalizedEmailTemplate configures the expiration mailer's email in one
+// language. Subject defaults to the mailer's Subject and HTMLEmailTemplate is
+// optional, as for the mailer's default templates.
+type LocalizedEmailTemplate struct {
+	Subject           string
+	EmailTemplate     string
+	HTMLEmailTemplate string
 }
 
 // GoogleSafeBrowsingConfig is the JSON config struct for the VA's use of the
@@ -390,6 +621,23 @@ type GoogleSafeBrowsingConfig struct {
 	DataDir string
 }
 
+// ReputationProviderConfig is the JSON config struct for one of the VA's domain
+// reputation providers. Type is one of "gsb" (uses GoogleSafeBrowsing),
+// "blocklist-file" and "highrisk-file" (use File), or "sql" (uses the
+// domainReputation table in the database given by DBConfig).
+type ReputationProviderConfig struct {
+	// Name is used in stats and logs. It defaults to Type.
+	Name string
+	Type string
+	// FailOpen treats errors from this provider as a safe verdict instead of
+	// refusing to create the authorization.
+	FailOpen bool
+
+	File string
+	DBConfig
+	GoogleSafeBrowsing *GoogleSafeBrowsingConfig
+}
+
 // SyslogConfig defines the config for syslogging.
 type SyslogConfig struct {
 	Network     string
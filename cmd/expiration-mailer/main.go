@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"crypto/x509"
 	"fmt"
+	htmltemplate "html/template"
 	"io/ioutil"
 	netmail "net/mail"
 	"sort"
@@ -31,51 +32,135 @@ import (
 
 const defaultNagCheckInterval = 24 * time.Hour
 
+type certificateContent struct {
+	ExpirationDate   time.Time
+	DaysToExpiration int
+	DNSNames         string
+}
+
+// emailContent is what the email template is executed with. A registration's
+// contacts get one email per run listing all of its expiring certificates, the
+// top level fields describe the first of them to expire and the names of all
+// of them.
 type emailContent struct {
 	ExpirationDate   time.Time
 	DaysToExpiration int
 	DNSNames         string
+	Certificates     []certificateContent
+	// UnsubscribeURL is empty if unsubscribe links aren't configured
+	UnsubscribeURL string
+}
+
+// emailTemplate is the subject and bodies of the email in one language
+type emailTemplate struct {
+	subject string
+	text    *template.Template
+	// html is nil if emails are only sent as plain text
+	html *htmltemplate.Template
 }
 
 type regStore interface {
 	GetRegistration(int64) (core.Registration, error)
+	GetNotificationPreferences(int64) (core.NotificationPreferences, error)
+	CountFQDNSets([]string, time.Time, time.Time) (int, error)
 }
 
 type mailer struct {
-	stats         statsd.Statter
-	log           *blog.AuditLogger
-	dbMap         *gorp.DbMap
-	rs            regStore
-	mailer        mail.Mailer
-	emailTemplate *template.Template
-	subject       string
-	nagTimes      []time.Duration
-	limit         int
-	clk           clock.Clock
+	stats    statsd.Statter
+	log      *blog.AuditLogger
+	dbMap    *gorp.DbMap
+	rs       regStore
+	mailer   mail.Mailer
+	nagTimes []time.Duration
+	limit    int
+	clk      clock.Clock
+	// defaultTemplate is used for registrations whose locale has no
+	// localizedTemplates entry. Those are keyed by lower case BCP 47 tag.
+	defaultTemplate    emailTemplate
+	localizedTemplates map[string]emailTemplate
+	// unsubscribeKey signs the tokens appended to unsubscribeURL to make each
+	// registration's unsubscribe link, see core.UnsubscribeToken
+	unsubscribeKey []byte
+	unsubscribeURL string
+}
+
+type certsByExpiry []*x509.Certificate
+
+func (c certsByExpiry) Len() int           { return len(c) }
+func (c certsByExpiry) Less(a, b int) bool { return c[a].NotAfter.Before(c[b].NotAfter) }
+func (c certsByExpiry) Swap(a, b int)      { c[a], c[b] = c[b], c[a] }
+
+// templateFor returns the templates for the most specific prefix of locale
+// that has them, trying e.g. "zh-hant-tw", then "zh-hant", then "zh", and
+// otherwise the default templates
+func (m *mailer) templateFor(locale string) emailTemplate {
+	locale = strings.ToLower(locale)
+	for {
+		if tmpl, ok := m.localizedTemplates[locale]; ok {
+			return tmpl
+		}
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			return m.defaultTemplate
+		}
+		locale = locale[:i]
+	}
 }
 
-func (m *mailer) sendNags(parsedCert *x509.Certificate, contacts []*core.AcmeURL) error {
-	expiresIn := int(parsedCert.NotAfter.Sub(m.clk.Now()).Hours() / 24)
+// sendNags sends one email to each of contacts listing all of parsedCerts,
+// which must all belong to the registration regID, in the language of locale
+// if there are templates for it
+func (m *mailer) sendNags(regID int64, locale string, parsedCerts []*x509.Certificate, contacts []*core.AcmeURL) error {
 	emails := []string{}
 	for _, contact := range contacts {
 		if contact.Scheme == "mailto" {
 			emails = append(emails, contact.Opaque)
 		}
 	}
-	if len(emails) > 0 {
+	if len(emails) > 0 && len(parsedCerts) > 0 {
+		sort.Sort(certsByExpiry(parsedCerts))
 		email := emailContent{
-			ExpirationDate:   parsedCert.NotAfter,
-			DaysToExpiration: expiresIn,
-			DNSNames:         strings.Join(parsedCert.DNSNames, ", "),
+			ExpirationDate:   parsedCerts[0].NotAfter,
+			DaysToExpiration: m.daysToExpiration(parsedCerts[0]),
 		}
+		var names []string
+		seen := make(map[string]bool)
+		for _, cert := range parsedCerts {
+			email.Certificates = append(email.Certificates, certificateContent{
+				ExpirationDate:   cert.NotAfter,
+				DaysToExpiration: m.daysToExpiration(cert),
+				DNSNames:         strings.Join(cert.DNSNames, ", "),
+			})
+			for _, name := range cert.DNSNames {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		email.DNSNames = strings.Join(names, ", ")
+		if len(m.unsubscribeKey) > 0 && m.unsubscribeURL != "" {
+			email.UnsubscribeURL = m.unsubscribeURL + core.UnsubscribeToken(m.unsubscribeKey, regID)
+		}
+		tmpl := m.templateFor(locale)
 		msgBuf := new(bytes.Buffer)
-		err := m.emailTemplate.Execute(msgBuf, email)
+		err := tmpl.text.Execute(msgBuf, email)
 		if err != nil {
 			m.stats.Inc("Mailer.Expiration.Errors.SendingNag.TemplateFailure", 1, 1.0)
 			return err
 		}
 		startSending := m.clk.Now()
-		err = m.mailer.SendMail(emails, m.subject, msgBuf.String())
+		if tmpl.html != nil {
+			htmlBuf := new(bytes.Buffer)
+			err = tmpl.html.Execute(htmlBuf, email)
+			if err != nil {
+				m.stats.Inc("Mailer.Expiration.Errors.SendingNag.TemplateFailure", 1, 1.0)
+				return err
+			}
+			err = m.mailer.SendMultipartMail(emails, tmpl.subject, msgBuf.String(), htmlBuf.String())
+		} else {
+			err = m.mailer.SendMail(emails, tmpl.subject, msgBuf.String())
+		}
 		if err != nil {
 			m.stats.Inc("Mailer.Expiration.Errors.SendingNag.SendFailure", 1, 1.0)
 			return err
@@ -86,6 +171,17 @@ func (m *mailer) sendNags(parsedCert *x509.Certificate, contacts []*core.AcmeURL
 	return nil
 }
 
+func (m *mailer) daysToExpiration(cert *x509.Certificate) int {
+	return int(cert.NotAfter.Sub(m.clk.Now()).Hours() / 24)
+}
+
+// renewed returns whether a certificate for exactly the same names as cert
+// has been issued since it was
+func (m *mailer) renewed(cert core.Certificate, parsedCert *x509.Certificate) (bool, error) {
+	count, err := m.rs.CountFQDNSets(parsedCert.DNSNames, cert.Issued, m.clk.Now())
+	return count > 0, err
+}
+
 func (m *mailer) updateCertStatus(serial string) error {
 	// Update CertificateStatus object
 	tx, err := m.dbMap.Begin()
@@ -124,37 +220,85 @@ func (m *mailer) updateCertStatus(serial string) error {
 func (m *mailer) processCerts(certs []core.Certificate) {
 	m.log.Info(fmt.Sprintf("expiration-mailer: Found %d certificates, starting sending messages", len(certs)))
 
+	var regIDs []int64
+	certsByReg := make(map[int64][]core.Certificate)
 	for _, cert := range certs {
-		reg, err := m.rs.GetRegistration(cert.RegistrationID)
+		if _, ok := certsByReg[cert.RegistrationID]; !ok {
+			regIDs = append(regIDs, cert.RegistrationID)
+		}
+		certsByReg[cert.RegistrationID] = append(certsByReg[cert.RegistrationID], cert)
+	}
+
+	for _, regID := range regIDs {
+		reg, err := m.rs.GetRegistration(regID)
 		if err != nil {
-			m.log.Err(fmt.Sprintf("Error fetching registration %d: %s", cert.RegistrationID, err))
+			m.log.Err(fmt.Sprintf("Error fetching registration %d: %s", regID, err))
 			m.stats.Inc("Mailer.Expiration.Errors.GetRegistration", 1, 1.0)
 			continue
 		}
-		parsedCert, err := x509.ParseCertificate(cert.DER)
+		prefs, err := m.rs.GetNotificationPreferences(regID)
 		if err != nil {
-			m.log.Err(fmt.Sprintf("Error parsing certificate %s: %s", cert.Serial, err))
-			m.stats.Inc("Mailer.Expiration.Errors.ParseCertificate", 1, 1.0)
+			m.log.Err(fmt.Sprintf("Error fetching notification preferences for registration %d: %s", regID, err))
+			m.stats.Inc("Mailer.Expiration.Errors.GetNotificationPreferences", 1, 1.0)
 			continue
 		}
-		err = m.sendNags(parsedCert, reg.Contact)
-		if err != nil {
-			m.log.Err(fmt.Sprintf("Error sending nag emails: %s", err))
-			continue
+
+		// Certificates that have been renewed, or whose registration has opted
+		// out, are marked as nagged without sending anything, so that they
+		// don't take up the limit of later runs
+		var parsedCerts []*x509.Certificate
+		var nagged, skipped []string
+		for _, cert := range certsByReg[regID] {
+			parsedCert, err := x509.ParseCertificate(cert.DER)
+			if err != nil {
+				m.log.Err(fmt.Sprintf("Error parsing certificate %s: %s", cert.Serial, err))
+				m.stats.Inc("Mailer.Expiration.Errors.ParseCertificate", 1, 1.0)
+				continue
+			}
+			renewed, err := m.renewed(cert, parsedCert)
+			if err != nil {
+				m.log.Err(fmt.Sprintf("Error checking whether certificate %s was renewed: %s", cert.Serial, err))
+				m.stats.Inc("Mailer.Expiration.Errors.CheckRenewal", 1, 1.0)
+				continue
+			}
+			if renewed {
+				m.stats.Inc("Mailer.Expiration.Renewed", 1, 1.0)
+				skipped = append(skipped, cert.Serial)
+				continue
+			}
+			parsedCerts = append(parsedCerts, parsedCert)
+			nagged = append(nagged, cert.Serial)
 		}
-		err = m.updateCertStatus(cert.Serial)
-		if err != nil {
-			m.log.Err(fmt.Sprintf("Error updating certificate status for %s: %s", cert.Serial, err))
-			m.stats.Inc("Mailer.Expiration.Errors.UpdateCertificateStatus", 1, 1.0)
-			continue
+		if !prefs.ExpirationEmails {
+			m.stats.Inc("Mailer.Expiration.OptedOut", int64(len(nagged)), 1.0)
+			skipped = append(skipped, nagged...)
+			parsedCerts, nagged = nil, nil
+		}
+
+		if len(parsedCerts) > 0 {
+			err = m.sendNags(regID, prefs.Locale, parsedCerts, reg.Contact)
+			if err != nil {
+				m.log.Err(fmt.Sprintf("Error sending nag emails: %s", err))
+				nagged = nil
+			}
+		}
+		for _, serial := range append(skipped, nagged...) {
+			err = m.updateCertStatus(serial)
+			if err != nil {
+				m.log.Err(fmt.Sprintf("Error updating certificate status for %s: %s", serial, err))
+				m.stats.Inc("Mailer.Expiration.Errors.UpdateCertificateStatus", 1, 1.0)
+			}
 		}
 	}
 	m.log.Info("expiration-mailer: Finished sending messages")
 	return
 }
 
+// findExpiringCertificates finds the certificates due a nag in each window
+// and sends each registration one email listing all of its certificates
 func (m *mailer) findExpiringCertificates() error {
 	now := m.clk.Now()
+	var expiring []core.Certificate
 	// E.g. m.nagTimes = [2, 4, 8, 15] days from expiration
 	for i, expiresIn := range m.nagTimes {
 		left := now
@@ -172,8 +316,8 @@ func (m *mailer) findExpiringCertificates() error {
 			 ON cs.serial = cert.serial
 			 AND cert.expires > :cutoffA
 			 AND cert.expires <= :cutoffB
-			 AND cs.status != "revoked"
-			 AND COALESCE(TIMESTAMPDIFF(SECOND, cs.lastExpirationNagSent, cert.expires) > :nagCutoff, 1)
+			 AND cs.status != 'revoked'
+			 AND COALESCE(`+sa.DialectOf(m.dbMap).SecondsBetween("cs.lastExpirationNagSent", "cert.expires")+` > :nagCutoff, TRUE)
 			 ORDER BY cert.expires ASC
 			 LIMIT :limit`,
 			map[string]interface{}{
@@ -187,13 +331,14 @@ func (m *mailer) findExpiringCertificates() error {
 			m.log.Err(fmt.Sprintf("expiration-mailer: Error loading certificates: %s", err))
 			return err // fatal
 		}
-		if len(certs) > 0 {
-			processingStarted := m.clk.Now()
-			m.processCerts(certs)
-			m.stats.TimingDuration("Mailer.Expiration.ProcessingCertificatesLatency", time.Since(processingStarted), 1.0)
-		}
+		expiring = append(expiring, certs...)
 	}
 
+	if len(expiring) > 0 {
+		processingStarted := m.clk.Now()
+		m.processCerts(expiring)
+		m.stats.TimingDuration("Mailer.Expiration.ProcessingCertificatesLatency", time.Since(processingStarted), 1.0)
+	}
 	return nil
 }
 
@@ -213,6 +358,32 @@ func (ds durationSlice) Swap(a, b int) {
 
 const clientName = "ExpirationMailer"
 
+// loadTemplate reads and parses the text/template in textFile and, unless
+// htmlFile is empty, the html/template in it
+func loadTemplate(subject, textFile, htmlFile string) (emailTemplate, error) {
+	tmpl := emailTemplate{subject: subject}
+	contents, err := ioutil.ReadFile(textFile)
+	if err != nil {
+		return tmpl, fmt.Errorf("Could not read email template file [%s]: %s", textFile, err)
+	}
+	tmpl.text, err = template.New("expiry-email").Parse(string(contents))
+	if err != nil {
+		return tmpl, fmt.Errorf("Could not parse email template file [%s]: %s", textFile, err)
+	}
+	if htmlFile == "" {
+		return tmpl, nil
+	}
+	contents, err = ioutil.ReadFile(htmlFile)
+	if err != nil {
+		return tmpl, fmt.Errorf("Could not read HTML email template file [%s]: %s", htmlFile, err)
+	}
+	tmpl.html, err = htmltemplate.New("expiry-email").Parse(string(contents))
+	if err != nil {
+		return tmpl, fmt.Errorf("Could not parse HTML email template file [%s]: %s", htmlFile, err)
+	}
+	return tmpl, nil
+}
+
 func main() {
 	app := cmd.NewAppShell("expiration-mailer", "Sends certificate expiration emails")
 
@@ -243,11 +414,27 @@ func main() {
 		sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
 		cmd.FailOnError(err, "Failed to create SA client")
 
-		// Load email template
-		emailTmpl, err := ioutil.ReadFile(c.Mailer.EmailTemplate)
-		cmd.FailOnError(err, fmt.Sprintf("Could not read email template file [%s]", c.Mailer.EmailTemplate))
-		tmpl, err := template.New("expiry-email").Parse(string(emailTmpl))
-		cmd.FailOnError(err, "Could not parse email template")
+		subject := "Certificate expiration notice"
+		if c.Mailer.Subject != "" {
+			subject = c.Mailer.Subject
+		}
+
+		// Load email templates
+		defaultTemplate, err := loadTemplate(subject, c.Mailer.EmailTemplate, c.Mailer.HTMLEmailTemplate)
+		cmd.FailOnError(err, "Could not load email template")
+		localizedTemplates := make(map[string]emailTemplate)
+		for locale, localized := range c.Mailer.LocalizedEmailTemplates {
+			if !core.LooksLikeALocale(locale) {
+				cmd.FailOnError(fmt.Errorf("%q is not a BCP 47 language tag", locale), "Could not load localized email template")
+			}
+			localizedSubject := subject
+			if localized.Subject != "" {
+				localizedSubject = localized.Subject
+			}
+			tmpl, err := loadTemplate(localizedSubject, localized.EmailTemplate, localized.HTMLEmailTemplate)
+			cmd.FailOnError(err, fmt.Sprintf("Could not load email template for locale %s", locale))
+			localizedTemplates[strings.ToLower(locale)] = tmpl
+		}
 
 		_, err = netmail.ParseAddress(c.Mailer.From)
 		cmd.FailOnError(err, fmt.Sprintf("Could not parse from address: %s", c.Mailer.From))
@@ -277,21 +464,26 @@ func main() {
 		// Make sure durations are sorted in increasing order
 		sort.Sort(nags)
 
-		subject := "Certificate expiration notice"
-		if c.Mailer.Subject != "" {
-			subject = c.Mailer.Subject
+		var unsubscribeKey []byte
+		if c.Mailer.UnsubscribeKeyFile != "" {
+			unsubscribeKey, err = ioutil.ReadFile(c.Mailer.UnsubscribeKeyFile)
+			cmd.FailOnError(err, "Could not read unsubscribe key")
+			unsubscribeKey = bytes.TrimSpace(unsubscribeKey)
 		}
+
 		m := mailer{
-			stats:         stats,
-			subject:       subject,
-			log:           auditlogger,
-			dbMap:         dbMap,
-			rs:            sac,
-			mailer:        &mailClient,
-			emailTemplate: tmpl,
-			nagTimes:      nags,
-			limit:         c.Mailer.CertLimit,
-			clk:           clock.Default(),
+			stats:              stats,
+			log:                auditlogger,
+			dbMap:              dbMap,
+			rs:                 sac,
+			mailer:             &mailClient,
+			defaultTemplate:    defaultTemplate,
+			localizedTemplates: localizedTemplates,
+			nagTimes:           nags,
+			limit:              c.Mailer.CertLimit,
+			clk:                clock.Default(),
+			unsubscribeKey:     unsubscribeKey,
+			unsubscribeURL:     c.Mailer.UnsubscribeURL,
 		}
 
 		auditlogger.Info("expiration-mailer: Starting")
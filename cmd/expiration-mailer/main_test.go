@@ -10,11 +10,12 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	htmltemplate "html/template"
 	"math/big"
 	"net"
+	"strings"
 	"testing"
 	"text/template"
 	"time"
@@ -28,23 +29,15 @@ import (
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
 	"github.com/letsencrypt/boulder/test/vars"
 )
 
-func bigIntFromB64(b64 string) *big.Int {
-	bytes, _ := base64.URLEncoding.DecodeString(b64)
-	x := big.NewInt(0)
-	x.SetBytes(bytes)
-	return x
-}
-
-func intFromB64(b64 string) int {
-	return int(bigIntFromB64(b64).Int64())
-}
-
 type fakeRegStore struct {
-	RegByID map[int64]core.Registration
+	RegByID  map[int64]core.Registration
+	OptedOut map[int64]bool
+	FQDNSets map[string]int
 }
 
 func (f fakeRegStore) GetRegistration(id int64) (core.Registration, error) {
@@ -56,8 +49,22 @@ func (f fakeRegStore) GetRegistration(id int64) (core.Registration, error) {
 	return r, nil
 }
 
+func (f fakeRegStore) GetNotificationPreferences(id int64) (core.NotificationPreferences, error) {
+	prefs := core.DefaultNotificationPreferences(id)
+	prefs.ExpirationEmails = !f.OptedOut[id]
+	return prefs, nil
+}
+
+func (f fakeRegStore) CountFQDNSets(names []string, _, _ time.Time) (int, error) {
+	return f.FQDNSets[strings.Join(core.UniqueLowerNames(names), ",")], nil
+}
+
 func newFakeRegStore() fakeRegStore {
-	return fakeRegStore{RegByID: make(map[int64]core.Registration)}
+	return fakeRegStore{
+		RegByID:  make(map[int64]core.Registration),
+		OptedOut: make(map[int64]bool),
+		FQDNSets: make(map[string]int),
+	}
 }
 
 func newFakeClock(t *testing.T) clock.FakeClock {
@@ -73,6 +80,9 @@ func newFakeClock(t *testing.T) clock.FakeClock {
 
 const testTmpl = `hi, cert for DNS names {{.DNSNames}} is going to expire in {{.DaysToExpiration}} days ({{.ExpirationDate}})`
 
+const digestTmpl = `{{range .Certificates}}{{.DNSNames}} expires in {{.DaysToExpiration}} days
+{{end}}{{if .UnsubscribeURL}}unsubscribe: {{.UnsubscribeURL}}{{end}}`
+
 var (
 	jsonKeyA = []byte(`{
   "kty":"RSA",
@@ -95,11 +105,11 @@ func TestSendNags(t *testing.T) {
 	fc := newFakeClock(t)
 
 	m := mailer{
-		stats:         stats,
-		mailer:        &mc,
-		emailTemplate: tmpl,
-		rs:            rs,
-		clk:           fc,
+		stats:           stats,
+		mailer:          &mc,
+		defaultTemplate: emailTemplate{text: tmpl},
+		rs:              rs,
+		clk:             fc,
 	}
 
 	cert := &x509.Certificate{
@@ -113,36 +123,117 @@ func TestSendNags(t *testing.T) {
 	email, _ := core.ParseAcmeURL("mailto:rolandshoemaker@gmail.com")
 	emailB, _ := core.ParseAcmeURL("mailto:test@gmail.com")
 
-	err := m.sendNags(cert, []*core.AcmeURL{email})
+	err := m.sendNags(1, "", []*x509.Certificate{cert}, []*core.AcmeURL{email})
 	test.AssertNotError(t, err, "Failed to send warning messages")
 	test.AssertEquals(t, len(mc.Messages), 1)
 	test.AssertEquals(t, fmt.Sprintf(`hi, cert for DNS names example.com is going to expire in 2 days (%s)`, cert.NotAfter), mc.Messages[0])
 
 	mc.Clear()
-	err = m.sendNags(cert, []*core.AcmeURL{email, emailB})
+	err = m.sendNags(1, "", []*x509.Certificate{cert}, []*core.AcmeURL{email, emailB})
 	test.AssertNotError(t, err, "Failed to send warning messages")
 	test.AssertEquals(t, len(mc.Messages), 2)
 	test.AssertEquals(t, fmt.Sprintf(`hi, cert for DNS names example.com is going to expire in 2 days (%s)`, cert.NotAfter), mc.Messages[0])
 	test.AssertEquals(t, fmt.Sprintf(`hi, cert for DNS names example.com is going to expire in 2 days (%s)`, cert.NotAfter), mc.Messages[1])
 
 	mc.Clear()
-	err = m.sendNags(cert, []*core.AcmeURL{})
+	err = m.sendNags(1, "", []*x509.Certificate{cert}, []*core.AcmeURL{})
 	test.AssertNotError(t, err, "Not an error to pass no email contacts")
 	test.AssertEquals(t, len(mc.Messages), 0)
 }
 
-var n = bigIntFromB64("n4EPtAOCc9AlkeQHPzHStgAbgs7bTZLwUBZdR8_KuKPEHLd4rHVTeT-O-XV2jRojdNhxJWTDvNd7nqQ0VEiZQHz_AJmSCpMaJMRBSFKrKb2wqVwGU_NsYOYL-QtiWN2lbzcEe6XC0dApr5ydQLrHqkHHig3RBordaZ6Aj-oBHqFEHYpPe7Tpe-OfVfHd1E6cS6M1FZcD1NNLYD5lFHpPI9bTwJlsde3uhGqC0ZCuEHg8lhzwOHrtIQbS0FVbb9k3-tVTU4fg_3L_vniUFAKwuCLqKnS2BYwdq_mzSnbLY7h_qixoR7jig3__kRhuaxwUkRz5iaiQkqgc5gHdrNP5zw==")
-var e = intFromB64("AQAB")
-var d = bigIntFromB64("bWUC9B-EFRIo8kpGfh0ZuyGPvMNKvYWNtB_ikiH9k20eT-O1q_I78eiZkpXxXQ0UTEs2LsNRS-8uJbvQ-A1irkwMSMkK1J3XTGgdrhCku9gRldY7sNA_AKZGh-Q661_42rINLRCe8W-nZ34ui_qOfkLnK9QWDDqpaIsA-bMwWWSDFu2MUBYwkHTMEzLYGqOe04noqeq1hExBTHBOBdkMXiuFhUq1BU6l-DqEiWxqg82sXt2h-LMnT3046AOYJoRioz75tSUQfGCshWTBnP5uDjd18kKhyv07lhfSJdrPdM5Plyl21hsFf4L_mHCuoFau7gdsPfHPxxjVOcOpBrQzwQ==")
-var p = bigIntFromB64("uKE2dh-cTf6ERF4k4e_jy78GfPYUIaUyoSSJuBzp3Cubk3OCqs6grT8bR_cu0Dm1MZwWmtdqDyI95HrUeq3MP15vMMON8lHTeZu2lmKvwqW7anV5UzhM1iZ7z4yMkuUwFWoBvyY898EXvRD-hdqRxHlSqAZ192zB3pVFJ0s7pFc=")
-var q = bigIntFromB64("uKE2dh-cTf6ERF4k4e_jy78GfPYUIaUyoSSJuBzp3Cubk3OCqs6grT8bR_cu0Dm1MZwWmtdqDyI95HrUeq3MP15vMMON8lHTeZu2lmKvwqW7anV5UzhM1iZ7z4yMkuUwFWoBvyY898EXvRD-hdqRxHlSqAZ192zB3pVFJ0s7pFc=")
+func TestSendNagsDigest(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	mc := mocks.Mailer{}
+	fc := newFakeClock(t)
+
+	m := mailer{
+		stats:           stats,
+		mailer:          &mc,
+		defaultTemplate: emailTemplate{text: template.Must(template.New("expiry-email").Parse(digestTmpl))},
+		rs:              newFakeRegStore(),
+		clk:             fc,
+	}
+
+	certs := []*x509.Certificate{
+		{NotAfter: fc.Now().AddDate(0, 0, 5), DNSNames: []string{"b.example.com", "example.com"}},
+		{NotAfter: fc.Now().AddDate(0, 0, 2), DNSNames: []string{"a.example.com"}},
+	}
+	email, _ := core.ParseAcmeURL("mailto:rolandshoemaker@gmail.com")
+
+	err := m.sendNags(7, "", certs, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Failed to send digest")
+	test.AssertEquals(t, len(mc.Messages), 1)
+	test.AssertEquals(t, mc.Messages[0], "a.example.com expires in 2 days\nb.example.com, example.com expires in 5 days\n")
+
+	mc.Clear()
+	m.unsubscribeKey = []byte("unsubscribe key")
+	m.unsubscribeURL = "https://acme.example.com/acme/unsubscribe/"
+	err = m.sendNags(7, "", certs, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Failed to send digest")
+	test.AssertEquals(t, len(mc.Messages), 1)
+	test.AssertEquals(t, mc.Messages[0], "a.example.com expires in 2 days\nb.example.com, example.com expires in 5 days\n"+
+		"unsubscribe: https://acme.example.com/acme/unsubscribe/"+core.UnsubscribeToken(m.unsubscribeKey, 7))
+}
+
+func TestSendNagsLocalized(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	mc := mocks.Mailer{}
+	fc := newFakeClock(t)
+
+	m := mailer{
+		stats:  stats,
+		mailer: &mc,
+		defaultTemplate: emailTemplate{
+			subject: "Certificate expiration notice",
+			text:    template.Must(template.New("expiry-email").Parse(`{{.DNSNames}} expires soon`)),
+		},
+		localizedTemplates: map[string]emailTemplate{
+			"de": {
+				subject: "Zertifikat läuft ab",
+				text:    template.Must(template.New("expiry-email").Parse(`{{.DNSNames}} läuft bald ab`)),
+			},
+			"de-ch": {
+				subject: "Zertifikat läuft ab",
+				text:    template.Must(template.New("expiry-email").Parse(`{{.DNSNames}} läuft bald ab, Grüezi`)),
+				html:    htmltemplate.Must(htmltemplate.New("expiry-email").Parse(`<p>{{.DNSNames}} läuft bald ab, Grüezi</p>`)),
+			},
+		},
+		rs:  newFakeRegStore(),
+		clk: fc,
+	}
+
+	test.AssertEquals(t, m.templateFor("").subject, "Certificate expiration notice")
+	test.AssertEquals(t, m.templateFor("fr").subject, "Certificate expiration notice")
+	test.AssertEquals(t, m.templateFor("de").subject, "Zertifikat läuft ab")
+	test.Assert(t, m.templateFor("de-AT").html == nil, "de-AT didn't fall back to de")
+	test.Assert(t, m.templateFor("DE-CH").html != nil, "Locales aren't case insensitive")
+	test.Assert(t, m.templateFor("de-CH-1996").html != nil, "de-CH-1996 didn't fall back to de-CH")
+
+	certs := []*x509.Certificate{{NotAfter: fc.Now().AddDate(0, 0, 5), DNSNames: []string{"<b>.example.com"}}}
+	email, _ := core.ParseAcmeURL("mailto:rolandshoemaker@gmail.com")
 
-var testKey = rsa.PrivateKey{
-	PublicKey: rsa.PublicKey{N: n, E: e},
-	D:         d,
-	Primes:    []*big.Int{p, q},
+	err := m.sendNags(7, "fr", certs, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Failed to send nag")
+	test.AssertDeepEquals(t, mc.Messages, []string{"<b>.example.com expires soon"})
+	test.AssertEquals(t, len(mc.HTMLMessages), 0)
+
+	mc.Clear()
+	err = m.sendNags(7, "de-AT", certs, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Failed to send nag")
+	test.AssertDeepEquals(t, mc.Messages, []string{"<b>.example.com läuft bald ab"})
+	test.AssertEquals(t, len(mc.HTMLMessages), 0)
+
+	// The HTML body is escaped, the text body isn't
+	mc.Clear()
+	err = m.sendNags(7, "de-CH", certs, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Failed to send nag")
+	test.AssertDeepEquals(t, mc.Messages, []string{"<b>.example.com läuft bald ab, Grüezi"})
+	test.AssertDeepEquals(t, mc.HTMLMessages, []string{"<p>&lt;b&gt;.example.com läuft bald ab, Grüezi</p>"})
 }
 
+// testKey signs the test certificates, which must be parseable to be stored.
+var testKey, _ = rsa.GenerateKey(rand.Reader, 1024)
+
 func TestFindExpiringCertificates(t *testing.T) {
 	ctx := setup(t, []time.Duration{time.Hour * 24, time.Hour * 24 * 4, time.Hour * 24 * 7})
 
@@ -194,7 +285,8 @@ func TestFindExpiringCertificates(t *testing.T) {
 		DNSNames:     []string{"example-a.com"},
 		SerialNumber: big.NewInt(1337),
 	}
-	certDerA, _ := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, &testKey)
+	certDerA, err := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
 	certA := &core.Certificate{
 		RegistrationID: regA.ID,
 		Serial:         "001",
@@ -216,7 +308,8 @@ func TestFindExpiringCertificates(t *testing.T) {
 		DNSNames:     []string{"example-b.com"},
 		SerialNumber: big.NewInt(1337),
 	}
-	certDerB, _ := x509.CreateCertificate(rand.Reader, &rawCertB, &rawCertB, &testKey.PublicKey, &testKey)
+	certDerB, err := x509.CreateCertificate(rand.Reader, &rawCertB, &rawCertB, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
 	certB := &core.Certificate{
 		RegistrationID: regA.ID,
 		Serial:         "002",
@@ -238,7 +331,8 @@ func TestFindExpiringCertificates(t *testing.T) {
 		DNSNames:     []string{"example-c.com"},
 		SerialNumber: big.NewInt(1337),
 	}
-	certDerC, _ := x509.CreateCertificate(rand.Reader, &rawCertC, &rawCertC, &testKey.PublicKey, &testKey)
+	certDerC, err := x509.CreateCertificate(rand.Reader, &rawCertC, &rawCertC, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
 	certC := &core.Certificate{
 		RegistrationID: regB.ID,
 		Serial:         "003",
@@ -250,7 +344,7 @@ func TestFindExpiringCertificates(t *testing.T) {
 		Status: core.OCSPStatusGood,
 	}
 
-	setupDBMap, err := sa.NewDbMap("mysql+tcp://test_setup@localhost:3306/boulder_sa_test")
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
 	err = setupDBMap.Insert(certA)
 	test.AssertNotError(t, err, "Couldn't add certA")
 	err = setupDBMap.Insert(certB)
@@ -312,7 +406,8 @@ func TestLifetimeOfACert(t *testing.T) {
 		DNSNames:     []string{"example-a.com"},
 		SerialNumber: big.NewInt(1337),
 	}
-	certDerA, _ := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, &testKey)
+	certDerA, err := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
 	certA := &core.Certificate{
 		RegistrationID: regA.ID,
 		Serial:         "001",
@@ -325,7 +420,7 @@ func TestLifetimeOfACert(t *testing.T) {
 		Status: core.OCSPStatusGood,
 	}
 
-	setupDBMap, err := sa.NewDbMap("mysql+tcp://test_setup@localhost:3306/boulder_sa_test")
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
 	err = setupDBMap.Insert(certA)
 	test.AssertNotError(t, err, "unable to insert Certificate")
 	err = setupDBMap.Insert(certStatusA)
@@ -417,7 +512,8 @@ func TestDontFindRevokedCert(t *testing.T) {
 		DNSNames:     []string{"example-a.com"},
 		SerialNumber: big.NewInt(1337),
 	}
-	certDerA, _ := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, &testKey)
+	certDerA, err := x509.CreateCertificate(rand.Reader, &rawCertA, &rawCertA, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
 	certA := &core.Certificate{
 		RegistrationID: regA.ID,
 		Serial:         "001",
@@ -430,7 +526,7 @@ func TestDontFindRevokedCert(t *testing.T) {
 		Status: core.OCSPStatusRevoked,
 	}
 
-	setupDBMap, err := sa.NewDbMap("mysql+tcp://test_setup@localhost:3306/boulder_sa_test")
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
 	err = setupDBMap.Insert(certA)
 	test.AssertNotError(t, err, "unable to insert Certificate")
 	err = setupDBMap.Insert(certStatusA)
@@ -444,9 +540,64 @@ func TestDontFindRevokedCert(t *testing.T) {
 	}
 }
 
+func TestDigestRenewedAndOptedOut(t *testing.T) {
+	ctx := setup(t, []time.Duration{7 * 24 * time.Hour})
+	defer ctx.cleanUp()
+
+	regA := satest.CreateWorkingRegistration(t, ctx.ssa)
+	var keyB jose.JsonWebKey
+	err := json.Unmarshal(jsonKeyB, &keyB)
+	test.AssertNotError(t, err, "Failed to unmarshal public JWK")
+	emailB, _ := core.ParseAcmeURL("mailto:two@mail.com")
+	regB, err := ctx.ssa.NewRegistration(core.Registration{
+		Contact:   []*core.AcmeURL{emailB},
+		Key:       keyB,
+		InitialIP: net.ParseIP("3.4.4.3"),
+	})
+	test.AssertNotError(t, err, "Couldn't store regB")
+
+	addCert := func(serial int64, name string, expiresIn time.Duration, regID int64) {
+		rawCert := x509.Certificate{
+			Subject:      pkix.Name{CommonName: name},
+			NotAfter:     ctx.fc.Now().Add(expiresIn),
+			DNSNames:     []string{name},
+			SerialNumber: big.NewInt(serial),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+		test.AssertNotError(t, err, "Couldn't create certificate")
+		_, err = ctx.ssa.AddCertificate(der, regID)
+		test.AssertNotError(t, err, "Couldn't add certificate")
+	}
+	day := 24 * time.Hour
+	// regA gets one email about a.example.com and b.example.com, but not
+	// c.example.com, which has been renewed
+	addCert(1, "a.example.com", 3*day, regA.ID)
+	addCert(2, "b.example.com", 5*day, regA.ID)
+	addCert(3, "c.example.com", 4*day, regA.ID)
+	ctx.fc.Add(time.Minute)
+	addCert(4, "c.example.com", 90*day, regA.ID)
+	// regB has opted out
+	addCert(5, "d.example.com", 3*day, regB.ID)
+	err = ctx.ssa.SetNotificationPreferences(core.NotificationPreferences{RegistrationID: regB.ID})
+	test.AssertNotError(t, err, "Couldn't opt regB out")
+
+	err = ctx.m.findExpiringCertificates()
+	test.AssertNotError(t, err, "Failed to find expiring certs")
+	test.AssertEquals(t, len(ctx.mc.Messages), 1)
+	test.Assert(t, strings.HasPrefix(ctx.mc.Messages[0], "hi, cert for DNS names a.example.com, b.example.com is going to expire in 2 days"),
+		"Unexpected digest: "+ctx.mc.Messages[0])
+
+	// The renewed and opted out certificates were marked as nagged too, so
+	// the next run finds nothing
+	ctx.mc.Clear()
+	err = ctx.m.findExpiringCertificates()
+	test.AssertNotError(t, err, "Failed to find expiring certs")
+	test.AssertEquals(t, len(ctx.mc.Messages), 0)
+}
+
 type testCtx struct {
 	dbMap   *gorp.DbMap
-	ssa     core.StorageAdder
+	ssa     core.StorageAuthority
 	mc      *mocks.Mailer
 	fc      clock.FakeClock
 	m       *mailer
@@ -476,15 +627,15 @@ func setup(t *testing.T, nagTimes []time.Duration) *testCtx {
 	}
 
 	m := &mailer{
-		log:           blog.GetAuditLogger(),
-		stats:         stats,
-		mailer:        mc,
-		emailTemplate: tmpl,
-		dbMap:         dbMap,
-		rs:            ssa,
-		nagTimes:      offsetNags,
-		limit:         100,
-		clk:           fc,
+		log:             blog.GetAuditLogger(),
+		stats:           stats,
+		mailer:          mc,
+		defaultTemplate: emailTemplate{text: tmpl},
+		dbMap:           dbMap,
+		rs:              ssa,
+		nagTimes:        offsetNags,
+		limit:           100,
+		clk:             fc,
 	}
 	return &testCtx{
 		dbMap:   dbMap,
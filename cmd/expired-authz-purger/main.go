@@ -0,0 +1,228 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const (
+	defaultGracePeriod = time.Hour * 24 * 7
+	defaultBatchSize   = 1000
+)
+
+// authzTables are the tables authorizations are purged from, along with the
+// name used for them in stats
+var authzTables = []struct {
+	table, statName string
+}{
+	{"pendingAuthorizations", "PendingAuthorizations"},
+	{"authz", "Authorizations"},
+}
+
+type expiredAuthzPurger struct {
+	stats statsd.Statter
+	log   *blog.AuditLogger
+	clk   clock.Clock
+	dbMap *gorp.DbMap
+
+	gracePeriod time.Duration
+	batchSize   int
+	dryRun      bool
+}
+
+// purgeAuthzs deletes every authorization, and its challenges, that expired
+// before the grace period from each of the authorization tables
+func (p *expiredAuthzPurger) purgeAuthzs() error {
+	cutoff := p.clk.Now().Add(-p.gracePeriod)
+	p.log.Info(fmt.Sprintf("Purging authorizations that expired before %s", cutoff))
+	for _, t := range authzTables {
+		var err error
+		if p.dryRun {
+			err = p.countExpired(t.table, t.statName, cutoff)
+		} else {
+			err = p.purgeTable(t.table, t.statName, cutoff)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countExpired reports how many authorizations and challenges would be
+// deleted from table without deleting anything
+func (p *expiredAuthzPurger) countExpired(table, statName string, cutoff time.Time) error {
+	count, err := p.dbMap.SelectInt(
+		"SELECT COUNT(*) FROM "+table+" WHERE expires <= :cutoff",
+		map[string]interface{}{"cutoff": cutoff},
+	)
+	if err != nil {
+		return err
+	}
+	challCount, err := p.dbMap.SelectInt(
+		"SELECT COUNT(*) FROM challenges WHERE authorizationID IN (SELECT id FROM "+table+" WHERE expires <= :cutoff)",
+		map[string]interface{}{"cutoff": cutoff},
+	)
+	if err != nil {
+		return err
+	}
+	p.stats.Gauge(fmt.Sprintf("ExpiredAuthzPurger.%s.Expired", statName), count, 1.0)
+	p.log.Info(fmt.Sprintf("[DRY RUN] Would delete %d expired authorizations and %d challenges from %s",
+		count, challCount, table))
+	return nil
+}
+
+// purgeTable deletes expired authorizations from table in batches of
+// p.batchSize until there are none left
+func (p *expiredAuthzPurger) purgeTable(table, statName string, cutoff time.Time) error {
+	var deleted int64
+	for {
+		var ids []string
+		_, err := p.dbMap.Select(
+			&ids,
+			"SELECT id FROM "+table+" WHERE expires <= :cutoff LIMIT :limit",
+			map[string]interface{}{"cutoff": cutoff, "limit": p.batchSize},
+		)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		start := p.clk.Now()
+		challCount, err := p.deleteBatch(table, ids)
+		if err != nil {
+			return err
+		}
+		p.stats.TimingDuration("ExpiredAuthzPurger.BatchLatency", p.clk.Now().Sub(start), 1.0)
+		p.stats.Inc(fmt.Sprintf("ExpiredAuthzPurger.%s.Deleted", statName), int64(len(ids)), 1.0)
+		p.stats.Inc("ExpiredAuthzPurger.Challenges.Deleted", challCount, 1.0)
+
+		deleted += int64(len(ids))
+		p.log.Info(fmt.Sprintf("Deleted %d expired authorizations (%d total) and %d challenges from %s",
+			len(ids), deleted, challCount, table))
+		if len(ids) < p.batchSize {
+			break
+		}
+	}
+	p.log.Info(fmt.Sprintf("Finished purging %s, deleted %d expired authorizations", table, deleted))
+	return nil
+}
+
+// deleteBatch deletes the authorizations with the given IDs from table, and
+// their challenges, in a single transaction. It returns the number of
+// challenges deleted.
+func (p *expiredAuthzPurger) deleteBatch(table string, ids []string) (int64, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	tx, err := p.dbMap.Begin()
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(
+		sa.Rebind(p.dbMap, "DELETE FROM challenges WHERE authorizationID IN ("+placeholders+")"),
+		args...,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	challCount, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	_, err = tx.Exec(
+		sa.Rebind(p.dbMap, "DELETE FROM "+table+" WHERE id IN ("+placeholders+")"),
+		args...,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return challCount, tx.Commit()
+}
+
+func main() {
+	app := cmd.NewAppShell("expired-authz-purger", "Deletes expired authorizations and their challenges")
+	app.App.Flags = append(app.App.Flags, cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Report how many authorizations would be deleted without deleting them",
+	}, cli.StringFlag{
+		Name:  "grace-period",
+		Usage: "How long after expiring authorizations are kept, overrides the configuration file",
+	}, cli.IntFlag{
+		Name:  "batch-size",
+		Usage: "How many authorizations to delete per transaction, overrides the configuration file",
+	})
+
+	var dryRun bool
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		dryRun = c.GlobalBool("dry-run")
+
+		if gracePeriod := c.GlobalString("grace-period"); gracePeriod != "" {
+			d, err := time.ParseDuration(gracePeriod)
+			cmd.FailOnError(err, "Couldn't parse grace period")
+			config.ExpiredAuthzPurger.GracePeriod.Duration = d
+		}
+
+		if batchSize := c.GlobalInt("batch-size"); batchSize != 0 {
+			config.ExpiredAuthzPurger.BatchSize = batchSize
+		}
+
+		return config
+	}
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		dbURL, err := c.ExpiredAuthzPurger.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		purger := &expiredAuthzPurger{
+			stats:       stats,
+			log:         auditlogger,
+			clk:         clock.Default(),
+			dbMap:       dbMap,
+			gracePeriod: c.ExpiredAuthzPurger.GracePeriod.Duration,
+			batchSize:   c.ExpiredAuthzPurger.BatchSize,
+			dryRun:      dryRun,
+		}
+		if purger.gracePeriod < 0 {
+			// A negative grace period would delete authorizations that
+			// haven't expired yet.
+			cmd.FailOnError(fmt.Errorf("grace period %s is negative", purger.gracePeriod), "Invalid grace period")
+		}
+		if purger.gracePeriod == 0 {
+			purger.gracePeriod = defaultGracePeriod
+		}
+		if purger.batchSize <= 0 {
+			purger.batchSize = defaultBatchSize
+		}
+
+		err = purger.purgeAuthzs()
+		cmd.FailOnError(err, "Failed to purge expired authorizations")
+	}
+
+	app.Run()
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func TestPurgeExpiredAuthzs(t *testing.T) {
+	// The test_setup user is used to insert the authorizations, the purger
+	// itself uses the purger user so its grants are exercised
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Couldn't connect to the database")
+	dbMap, err := sa.NewDbMap(vars.DBConnSAPurger)
+	test.AssertNotError(t, err, "Couldn't connect to the database")
+	fc := clock.NewFake()
+	fc.Set(time.Date(2015, 3, 4, 5, 0, 0, 0, time.UTC))
+	ssa, err := sa.NewSQLStorageAuthority(setupDBMap, fc)
+	test.AssertNotError(t, err, "Couldn't create SA")
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	createAuthz := func(expires time.Time, final bool) core.Authorization {
+		authz, err := ssa.NewPendingAuthorization(core.Authorization{
+			RegistrationID: reg.ID,
+			Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+			Status:         core.StatusPending,
+			Expires:        &expires,
+			Challenges:     []core.Challenge{core.Challenge{Type: core.ChallengeTypeHTTP01, Token: core.NewToken()}},
+		})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		if final {
+			authz.Status = core.StatusValid
+			err = ssa.FinalizeAuthorization(authz)
+			test.AssertNotError(t, err, "Couldn't finalize authorization")
+		}
+		return authz
+	}
+
+	gracePeriod := time.Hour * 24 * 7
+	now := fc.Now()
+	oldPending := createAuthz(now.Add(-2*gracePeriod), false)
+	oldFinal := createAuthz(now.Add(-2*gracePeriod), true)
+	createAuthz(now.Add(-2*gracePeriod), true)
+	recentFinal := createAuthz(now.Add(-time.Hour), true)
+	currentPending := createAuthz(now.Add(time.Hour), false)
+
+	countRows := func(table string) int64 {
+		count, err := setupDBMap.SelectInt("SELECT COUNT(*) FROM " + table)
+		test.AssertNotError(t, err, "Couldn't count rows in "+table)
+		return count
+	}
+
+	stats, _ := statsd.NewNoopClient(nil)
+	purger := &expiredAuthzPurger{
+		stats:       stats,
+		log:         blog.GetAuditLogger(),
+		clk:         fc,
+		dbMap:       dbMap,
+		gracePeriod: gracePeriod,
+		batchSize:   1,
+		dryRun:      true,
+	}
+	err = purger.purgeAuthzs()
+	test.AssertNotError(t, err, "Dry run failed")
+	test.AssertEquals(t, countRows("pendingAuthorizations"), int64(2))
+	test.AssertEquals(t, countRows("authz"), int64(3))
+	test.AssertEquals(t, countRows("challenges"), int64(5))
+
+	purger.dryRun = false
+	err = purger.purgeAuthzs()
+	test.AssertNotError(t, err, "Purge failed")
+	test.AssertEquals(t, countRows("pendingAuthorizations"), int64(1))
+	test.AssertEquals(t, countRows("authz"), int64(1))
+	test.AssertEquals(t, countRows("challenges"), int64(2))
+
+	_, err = ssa.GetAuthorization(oldPending.ID)
+	test.AssertError(t, err, "Expired pending authorization wasn't purged")
+	_, err = ssa.GetAuthorization(oldFinal.ID)
+	test.AssertError(t, err, "Expired final authorization wasn't purged")
+	_, err = ssa.GetAuthorization(recentFinal.ID)
+	test.AssertNotError(t, err, "Authorization within the grace period was purged")
+	_, err = ssa.GetAuthorization(currentPending.ID)
+	test.AssertNotError(t, err, "Unexpired authorization was purged")
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/rpc"
+)
+
+const clientName = "ManualReviews"
+
+func loadConfig(c *cli.Context) (config cmd.Config, err error) {
+	configFileName := c.GlobalString("config")
+	configJSON, err := ioutil.ReadFile(configFileName)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(configJSON, &config)
+	return
+}
+
+func setupContext(c *cli.Context) *rpc.StorageAuthorityClient {
+	config, err := loadConfig(c)
+	cmd.FailOnError(err, "Failed to load Boulder configuration")
+	stats, _ := cmd.StatsAndLogging(config.Statsd, config.Syslog)
+
+	sac, err := rpc.NewStorageAuthorityClient(clientName, config.ManualReviews.AMQP, stats)
+	cmd.FailOnError(err, "Failed to create SA client")
+	return sac
+}
+
+// parseStatus parses the status the list command filters on.
+func parseStatus(s string) (core.ManualReviewStatus, error) {
+	switch status := core.ManualReviewStatus(s); status {
+	case core.ManualReviewPending, core.ManualReviewApproved, core.ManualReviewDenied:
+		return status, nil
+	}
+	return "", fmt.Errorf("status %q must be one of pending, approved or denied", s)
+}
+
+// reviewer returns the reviewer named by the --reviewer flag, defaulting to
+// the current user.
+func reviewer(c *cli.Context) string {
+	name := c.String("reviewer")
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	return name
+}
+
+// printReviews writes reviews to w as a table.
+func printReviews(w io.Writer, reviews []core.ManualReview) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tHOSTNAME\tREGISTRATION\tSTATUS\tHELD\tREVIEWER\tREVIEWED")
+	for _, r := range reviews {
+		reviewed := ""
+		if !r.Reviewed.IsZero() {
+			reviewed = r.Reviewed.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Hostname, r.RegistrationID, r.Status, r.Created.Format(time.RFC3339), r.Reviewer, reviewed)
+	}
+	tw.Flush()
+}
+
+// setStatus returns the action of a command that records the given verdict on
+// the review whose ID is the command's argument.
+func setStatus(status core.ManualReviewStatus) func(*cli.Context) {
+	return func(c *cli.Context) {
+		id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+		cmd.FailOnError(err, "Review ID argument must be an integer")
+		name := reviewer(c)
+		if name == "" {
+			cmd.FailOnError(fmt.Errorf("no reviewer given"), "Couldn't determine the current user, use --reviewer")
+		}
+
+		sac := setupContext(c)
+		err = sac.SetManualReviewStatus(id, status, name)
+		cmd.FailOnError(err, fmt.Sprintf("Couldn't set review %d to %s", id, status))
+	}
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "manual-reviews"
+	app.Usage = "Lists the hostnames held for manual review by the RA and approves or denies issuance for them"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+	}
+	reviewerFlag := cli.StringFlag{
+		Name:  "reviewer",
+		Usage: "Who reviewed the hostname. Defaults to the current user",
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the hostnames waiting for review",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "status",
+					Value: string(core.ManualReviewPending),
+					Usage: "List the reviews with this status instead: pending, approved or denied",
+				},
+			},
+			Action: func(c *cli.Context) {
+				status, err := parseStatus(c.String("status"))
+				cmd.FailOnError(err, "Invalid status")
+
+				sac := setupContext(c)
+				reviews, err := sac.GetManualReviews(status)
+				cmd.FailOnError(err, "Couldn't list reviews")
+				printReviews(os.Stdout, reviews)
+			},
+		},
+		{
+			Name:   "approve",
+			Usage:  "Allow authorizations for the hostname of the review with the given ID",
+			Flags:  []cli.Flag{reviewerFlag},
+			Action: setStatus(core.ManualReviewApproved),
+		},
+		{
+			Name:   "deny",
+			Usage:  "Refuse authorizations for the hostname of the review with the given ID",
+			Flags:  []cli.Flag{reviewerFlag},
+			Action: setStatus(core.ManualReviewDenied),
+		},
+	}
+
+	err := app.Run(os.Args)
+	cmd.FailOnError(err, "Failed to run application")
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestParseStatus(t *testing.T) {
+	status, err := parseStatus("approved")
+	test.AssertNotError(t, err, "Couldn't parse status")
+	test.AssertEquals(t, status, core.ManualReviewApproved)
+
+	_, err = parseStatus("maybe")
+	test.AssertError(t, err, "Parsed nonsense status")
+}
+
+func TestPrintReviews(t *testing.T) {
+	var out bytes.Buffer
+	printReviews(&out, []core.ManualReview{
+		{
+			ID:             1,
+			Hostname:       "example.com",
+			RegistrationID: 7,
+			Status:         core.ManualReviewPending,
+			Created:        time.Date(2016, 12, 20, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:             2,
+			Hostname:       "example.net",
+			RegistrationID: 8,
+			Status:         core.ManualReviewApproved,
+			Reviewer:       "alice",
+			Created:        time.Date(2016, 12, 20, 0, 0, 0, 0, time.UTC),
+			Reviewed:       time.Date(2016, 12, 21, 0, 0, 0, 0, time.UTC),
+		},
+	})
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	test.AssertEquals(t, len(lines), 3)
+	test.Assert(t, strings.Contains(lines[1], "example.com"), "Hostname missing from output")
+	test.Assert(t, !strings.Contains(lines[1], "0001-01-01"), "Zero review time in output")
+	test.Assert(t, strings.Contains(lines[2], "alice"), "Reviewer missing from output")
+	test.Assert(t, strings.Contains(lines[2], "2016-12-21T00:00:00Z"), "Review time missing from output")
+}
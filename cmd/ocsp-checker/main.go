@@ -0,0 +1,416 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+// Results of checking a certificate's OCSP response, in the order they take
+// precedence when a response has several kinds of problem
+const (
+	failed     = "failed"
+	unknown    = "unknown"
+	mismatched = "mismatched"
+	stale      = "stale"
+	good       = "good"
+)
+
+const (
+	filenameLayout = "20060102T150405"
+
+	defaultSampleSize = 1000
+)
+
+// errorResponses are the responses, without a signed body, that a responder
+// sends instead of a status, RFC 6960 section 4.2.1. ocsp.ParseResponse
+// rejects them, so they are recognized by their encoding.
+var errorResponses = []struct {
+	status   string
+	response []byte
+}{
+	{"malformedRequest", ocsp.MalformedRequestErrorResponse},
+	{"internalError", ocsp.InternalErrorErrorResponse},
+	{"tryLater", ocsp.TryLaterErrorResponse},
+	{"sigRequired", ocsp.SigRequredErrorResponse},
+}
+
+type report struct {
+	begin      time.Time
+	end        time.Time
+	Good       int64
+	Mismatched int64
+	Stale      int64
+	Unknown    int64
+	Failed     int64
+	Entries    map[string]reportEntry
+}
+
+func (r *report) save(directory string) error {
+	filename := path.Join(directory, fmt.Sprintf(
+		"%s-%s-ocsp-report.json",
+		r.begin.Format(filenameLayout),
+		r.end.Format(filenameLayout),
+	))
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, os.ModePerm)
+}
+
+type reportEntry struct {
+	Result   string   `json:"result"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// sampledCert is an unexpired certificate and its status as stored in the
+// database
+type sampledCert struct {
+	Serial        string              `db:"serial"`
+	DER           []byte              `db:"der"`
+	Status        core.OCSPStatus     `db:"status"`
+	RevokedDate   time.Time           `db:"revokedDate"`
+	RevokedReason core.RevocationCode `db:"revokedReason"`
+	OCSPResponse  []byte              `db:"ocspResponse"`
+}
+
+type ocspChecker struct {
+	dbMap        *gorp.DbMap
+	client       *http.Client
+	responderURL string
+	issuer       *x509.Certificate
+	clk          clock.Clock
+	stats        statsd.Statter
+	certs        chan sampledCert
+
+	rMu    sync.Mutex
+	report report
+}
+
+func newChecker(dbMap *gorp.DbMap, responderURL string, issuer *x509.Certificate, clk clock.Clock, stats statsd.Statter) *ocspChecker {
+	c := &ocspChecker{
+		dbMap:        dbMap,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		responderURL: strings.TrimSuffix(responderURL, "/"),
+		issuer:       issuer,
+		clk:          clk,
+		stats:        stats,
+		certs:        make(chan sampledCert, defaultSampleSize),
+	}
+	c.report.Entries = make(map[string]reportEntry)
+	return c
+}
+
+// randomSerial returns a serial chosen uniformly between the lowest and highest
+// stored serials, so that sampling starts at a random certificate whatever
+// prefix the CA puts on its serials
+func (c *ocspChecker) randomSerial() (string, error) {
+	var bounds struct {
+		Min sql.NullString `db:"min"`
+		Max sql.NullString `db:"max"`
+	}
+	err := c.dbMap.SelectOne(&bounds, "SELECT MIN(serial) AS min, MAX(serial) AS max FROM certificateStatus")
+	if err != nil || !bounds.Min.Valid || !bounds.Max.Valid {
+		return "", err
+	}
+	low, ok := new(big.Int).SetString(bounds.Min.String, 16)
+	if !ok {
+		return "", fmt.Errorf("Invalid serial %q", bounds.Min.String)
+	}
+	high, ok := new(big.Int).SetString(bounds.Max.String, 16)
+	if !ok {
+		return "", fmt.Errorf("Invalid serial %q", bounds.Max.String)
+	}
+	n, err := rand.Int(rand.Reader, new(big.Int).Add(new(big.Int).Sub(high, low), big.NewInt(1)))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*x", len(bounds.Max.String), n.Add(n, low)), nil
+}
+
+// sampleCerts sends up to size unexpired certificates to c.certs, starting at a
+// random serial and wrapping around to the lowest, then closes it. Serials are
+// random, so this picks a random sample without the databases' differing
+// random functions.
+func (c *ocspChecker) sampleCerts(size int) error {
+	defer close(c.certs)
+	start, err := c.randomSerial()
+	if err != nil {
+		return err
+	}
+
+	c.report.begin = c.clk.Now()
+	query := `SELECT cs.serial, c.der, cs.status, cs.revokedDate, cs.revokedReason,
+			 cs.ocspResponse
+		 FROM certificateStatus AS cs
+		 JOIN certificates AS c
+		 ON cs.serial = c.serial
+		 WHERE c.expires > :now
+		 AND cs.serial %s :start
+		 ORDER BY cs.serial ASC
+		 LIMIT :limit`
+	sampled := 0
+	for _, op := range []string{">=", "<"} {
+		var certs []sampledCert
+		_, err := c.dbMap.Select(
+			&certs,
+			fmt.Sprintf(query, op),
+			map[string]interface{}{
+				"now":   c.clk.Now(),
+				"start": start,
+				"limit": size - sampled,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			c.certs <- cert
+		}
+		sampled += len(certs)
+		if sampled >= size {
+			break
+		}
+	}
+	return nil
+}
+
+// processCerts checks the certificates sent to c.certs until it is closed
+func (c *ocspChecker) processCerts(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for cert := range c.certs {
+		result, problems := c.checkCert(cert)
+		c.stats.Inc(fmt.Sprintf("OCSPChecker.%s", strings.Title(result)), 1, 1.0)
+		c.rMu.Lock()
+		c.report.Entries[cert.Serial] = reportEntry{Result: result, Problems: problems}
+		switch result {
+		case good:
+			c.report.Good++
+		case mismatched:
+			c.report.Mismatched++
+		case stale:
+			c.report.Stale++
+		case unknown:
+			c.report.Unknown++
+		case failed:
+			c.report.Failed++
+		}
+		c.rMu.Unlock()
+	}
+}
+
+// fetch gets the response the public responder serves for cert
+func (c *ocspChecker) fetch(cert *x509.Certificate) ([]byte, error) {
+	req, err := ocsp.CreateRequest(cert, c.issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(c.responderURL + "/" + core.OCSPRequestPath(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Responder returned %s", resp.Status)
+	}
+	return body, nil
+}
+
+// checkCert fetches the response the public responder serves for cert and
+// compares it to the certificate's stored status. It returns the most serious
+// kind of problem found, or good, and a description of each problem.
+func (c *ocspChecker) checkCert(cert sampledCert) (string, []string) {
+	parsedCert, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		return failed, []string{fmt.Sprintf("Couldn't parse stored certificate: %s", err)}
+	}
+	body, err := c.fetch(parsedCert)
+	if err != nil {
+		return failed, []string{fmt.Sprintf("Couldn't fetch OCSP response: %s", err)}
+	}
+	// The responder answers requests for certificates it has no response for
+	// as unauthorized, RFC 5019 section 2.2.3
+	if bytes.Equal(body, ocsp.UnauthorizedErrorResponse) {
+		return unknown, []string{"Responder has no response for the certificate"}
+	}
+	for _, er := range errorResponses {
+		if bytes.Equal(body, er.response) {
+			return failed, []string{fmt.Sprintf("Responder returned a %s error response", er.status)}
+		}
+	}
+	// ParseResponse checks the response is signed by the issuer, or by a
+	// responder certificate the issuer signed
+	resp, err := ocsp.ParseResponse(body, c.issuer)
+	if err != nil {
+		return mismatched, []string{fmt.Sprintf("Couldn't parse or verify OCSP response: %s", err)}
+	}
+	if resp.Status == ocsp.Unknown {
+		return unknown, []string{"Responder returned status unknown"}
+	}
+
+	var problems []string
+	result := good
+	mismatch := func(problem string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(problem, args...))
+		result = mismatched
+	}
+	if resp.SerialNumber.Cmp(parsedCert.SerialNumber) != 0 {
+		mismatch("Response is for serial %s", core.SerialToString(resp.SerialNumber))
+	}
+	switch cert.Status {
+	case core.OCSPStatusGood:
+		if resp.Status != ocsp.Good {
+			mismatch("Response status is %d, stored status is good", resp.Status)
+		}
+	case core.OCSPStatusRevoked:
+		if resp.Status != ocsp.Revoked {
+			mismatch("Response status is %d, stored status is revoked", resp.Status)
+			break
+		}
+		if core.RevocationCode(resp.RevocationReason) != cert.RevokedReason {
+			mismatch("Response revocation reason is %d, stored reason is %d", resp.RevocationReason, cert.RevokedReason)
+		}
+		// Responses only have second precision
+		if d := resp.RevokedAt.Sub(cert.RevokedDate); d <= -time.Second || d >= time.Second {
+			mismatch("Response revocation time is %s, stored time is %s", resp.RevokedAt, cert.RevokedDate)
+		}
+	default:
+		mismatch("Stored status %q is unknown", cert.Status)
+	}
+
+	freshness := func(problem string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(problem, args...))
+		if result == good {
+			result = stale
+		}
+	}
+	if !c.clk.Now().Before(resp.NextUpdate) {
+		freshness("Response expired at %s", resp.NextUpdate)
+	}
+	if len(cert.OCSPResponse) > 0 {
+		stored, err := ocsp.ParseResponse(cert.OCSPResponse, c.issuer)
+		if err != nil {
+			mismatch("Couldn't parse or verify stored OCSP response: %s", err)
+		} else if resp.ThisUpdate.Before(stored.ThisUpdate) {
+			freshness("Response was produced at %s, before the stored response at %s", resp.ThisUpdate, stored.ThisUpdate)
+		}
+	}
+	return result, problems
+}
+
+func main() {
+	app := cmd.NewAppShell("ocsp-checker", "Checks the OCSP responses served for a sample of certificates against the database")
+	app.App.Flags = append(app.App.Flags, cli.IntFlag{
+		Name:  "workers",
+		Value: runtime.NumCPU(),
+		Usage: "The number of concurrent workers used to check certificates",
+	}, cli.IntFlag{
+		Name:  "sample-size",
+		Usage: "How many certificates to check, overrides the configuration file",
+	}, cli.StringFlag{
+		Name:  "report-dir-path",
+		Usage: "The path to write a JSON report on the OCSP checks to (if no path is provided the report will not be written out)",
+	}, cli.StringFlag{
+		Name:  "responder-url",
+		Usage: "The OCSP responder URL to check, overrides the configuration file",
+	})
+
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		if dir := c.GlobalString("report-dir-path"); dir != "" {
+			config.OCSPChecker.ReportDirectoryPath = dir
+		}
+		if url := c.GlobalString("responder-url"); url != "" {
+			config.OCSPChecker.ResponderURL = url
+		}
+		if workers := c.GlobalInt("workers"); workers != 0 {
+			config.OCSPChecker.Workers = workers
+		}
+		if sampleSize := c.GlobalInt("sample-size"); sampleSize != 0 {
+			config.OCSPChecker.SampleSize = sampleSize
+		}
+		return config
+	}
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		conf := c.OCSPChecker
+		dbURL, err := conf.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		issuerPath := conf.IssuerCert
+		if issuerPath == "" {
+			issuerPath = c.Common.IssuerCert
+		}
+		issuer, err := core.LoadCert(issuerPath)
+		cmd.FailOnError(err, "Couldn't load issuer certificate")
+
+		sampleSize := conf.SampleSize
+		if sampleSize <= 0 {
+			sampleSize = defaultSampleSize
+		}
+		checker := newChecker(dbMap, conf.ResponderURL, issuer, clock.Default(), stats)
+		auditlogger.Info(fmt.Sprintf("# Checking OCSP responses from %s for %d certificates", conf.ResponderURL, sampleSize))
+
+		go func() {
+			err := checker.sampleCerts(sampleSize)
+			cmd.FailOnError(err, "Sampling certificates failed")
+		}()
+
+		wg := new(sync.WaitGroup)
+		for i := 0; i < conf.Workers; i++ {
+			wg.Add(1)
+			go checker.processCerts(wg)
+		}
+		wg.Wait()
+		checker.report.end = checker.clk.Now()
+		auditlogger.Info(fmt.Sprintf(
+			"# Finished checking OCSP responses, sample: %d, good: %d, mismatched: %d, stale: %d, unknown: %d, failed: %d",
+			len(checker.report.Entries),
+			checker.report.Good,
+			checker.report.Mismatched,
+			checker.report.Stale,
+			checker.report.Unknown,
+			checker.report.Failed,
+		))
+		if conf.ReportDirectoryPath != "" {
+			err = checker.report.save(conf.ReportDirectoryPath)
+			cmd.FailOnError(err, "Couldn't save OCSP report")
+		}
+	}
+
+	app.Run()
+}
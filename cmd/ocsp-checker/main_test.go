@@ -0,0 +1,372 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Couldn't generate issuer key")
+	template := x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ocsp-checker test issuer"},
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Couldn't create issuer certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Couldn't parse issuer certificate")
+	return testIssuer{cert, key}
+}
+
+func (i testIssuer) issue(t *testing.T, serial int64, notAfter time.Time) []byte {
+	template := x509.Certificate{
+		Subject:      pkix.Name{CommonName: "example.com"},
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, i.cert, &i.key.PublicKey, i.key)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	return der
+}
+
+func (i testIssuer) sign(t *testing.T, template ocsp.Response) []byte {
+	resp, err := ocsp.CreateResponse(i.cert, i.cert, template, i.key)
+	test.AssertNotError(t, err, "Couldn't sign OCSP response")
+	return resp
+}
+
+// testResponder answers every GET with whatever response is set, after
+// checking the request decodes
+type testResponder struct {
+	t        *testing.T
+	mu       sync.Mutex
+	response []byte
+}
+
+func (r *testResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	der, err := core.DecodeOCSPRequestPath(req.URL.Path)
+	test.AssertNotError(r.t, err, "Couldn't decode OCSP request path")
+	_, err = ocsp.ParseRequest(der)
+	test.AssertNotError(r.t, err, "Couldn't parse OCSP request")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Write(r.response)
+}
+
+func (r *testResponder) set(response []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.response = response
+}
+
+func TestCheckCert(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+	responder := &testResponder{t: t}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	fc := clock.NewFake()
+	fc.Set(time.Now())
+	stats, _ := statsd.NewNoopClient(nil)
+	checker := newChecker(nil, server.URL+"/", issuer.cert, fc, stats)
+
+	revokedAt := fc.Now().Add(-time.Hour).Truncate(time.Second)
+	stored := issuer.sign(t, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(10),
+		ThisUpdate:   fc.Now().Add(-time.Hour),
+		NextUpdate:   fc.Now().Add(time.Hour),
+	})
+	good := sampledCert{
+		Serial:       core.SerialToString(big.NewInt(10)),
+		DER:          issuer.issue(t, 10, fc.Now().Add(time.Hour)),
+		Status:       core.OCSPStatusGood,
+		OCSPResponse: stored,
+	}
+	revoked := sampledCert{
+		Serial:        core.SerialToString(big.NewInt(11)),
+		DER:           issuer.issue(t, 11, fc.Now().Add(time.Hour)),
+		Status:        core.OCSPStatusRevoked,
+		RevokedDate:   revokedAt,
+		RevokedReason: core.RevocationCode(1),
+	}
+
+	testCases := []struct {
+		name     string
+		cert     sampledCert
+		response []byte
+		result   string
+	}{
+		{
+			name: "good",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now(),
+				NextUpdate:   fc.Now().Add(time.Hour),
+			}),
+			result: "good",
+		},
+		{
+			name: "revoked",
+			cert: revoked,
+			response: issuer.sign(t, ocsp.Response{
+				Status:           ocsp.Revoked,
+				SerialNumber:     big.NewInt(11),
+				ThisUpdate:       fc.Now(),
+				NextUpdate:       fc.Now().Add(time.Hour),
+				RevokedAt:        revokedAt,
+				RevocationReason: 1,
+			}),
+			result: "good",
+		},
+		{
+			name: "status mismatch",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Revoked,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now(),
+				NextUpdate:   fc.Now().Add(time.Hour),
+				RevokedAt:    revokedAt,
+			}),
+			result: "mismatched",
+		},
+		{
+			name: "revocation reason mismatch",
+			cert: revoked,
+			response: issuer.sign(t, ocsp.Response{
+				Status:           ocsp.Revoked,
+				SerialNumber:     big.NewInt(11),
+				ThisUpdate:       fc.Now(),
+				NextUpdate:       fc.Now().Add(time.Hour),
+				RevokedAt:        revokedAt,
+				RevocationReason: 4,
+			}),
+			result: "mismatched",
+		},
+		{
+			name: "revocation time mismatch",
+			cert: revoked,
+			response: issuer.sign(t, ocsp.Response{
+				Status:           ocsp.Revoked,
+				SerialNumber:     big.NewInt(11),
+				ThisUpdate:       fc.Now(),
+				NextUpdate:       fc.Now().Add(time.Hour),
+				RevokedAt:        revokedAt.Add(time.Minute),
+				RevocationReason: 1,
+			}),
+			result: "mismatched",
+		},
+		{
+			name: "serial mismatch",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: big.NewInt(12),
+				ThisUpdate:   fc.Now(),
+				NextUpdate:   fc.Now().Add(time.Hour),
+			}),
+			result: "mismatched",
+		},
+		{
+			name: "wrong signer",
+			cert: good,
+			response: other.sign(t, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now(),
+				NextUpdate:   fc.Now().Add(time.Hour),
+			}),
+			result: "mismatched",
+		},
+		{
+			name: "expired",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now().Add(-2 * time.Hour),
+				NextUpdate:   fc.Now().Add(-time.Minute),
+			}),
+			result: "stale",
+		},
+		{
+			name: "older than stored",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now().Add(-2 * time.Hour),
+				NextUpdate:   fc.Now().Add(time.Hour),
+			}),
+			result: "stale",
+		},
+		{
+			name:     "unauthorized",
+			cert:     good,
+			response: ocsp.UnauthorizedErrorResponse,
+			result:   "unknown",
+		},
+		{
+			name: "unknown status",
+			cert: good,
+			response: issuer.sign(t, ocsp.Response{
+				Status:       ocsp.Unknown,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   fc.Now(),
+				NextUpdate:   fc.Now().Add(time.Hour),
+			}),
+			result: "unknown",
+		},
+		{
+			name:     "internal error",
+			cert:     good,
+			response: ocsp.InternalErrorErrorResponse,
+			result:   "failed",
+		},
+		{
+			name:     "try later",
+			cert:     good,
+			response: ocsp.TryLaterErrorResponse,
+			result:   "failed",
+		},
+	}
+	for _, tc := range testCases {
+		responder.set(tc.response)
+		result, problems := checker.checkCert(tc.cert)
+		if result != tc.result {
+			t.Errorf("%s: got result %q, expected %q, problems: %s", tc.name, result, tc.result, problems)
+		}
+		if result != "good" && len(problems) == 0 {
+			t.Errorf("%s: got result %q without any problems", tc.name, result)
+		}
+	}
+
+	server.Close()
+	result, _ := checker.checkCert(good)
+	test.AssertEquals(t, result, "failed")
+}
+
+func TestSampleAndProcessCerts(t *testing.T) {
+	saDbMap, err := sa.NewDbMap(vars.DBConnSA)
+	test.AssertNotError(t, err, "Couldn't connect to database")
+	fc := clock.NewFake()
+	fc.Set(time.Now())
+	ssa, err := sa.NewSQLStorageAuthority(saDbMap, fc)
+	test.AssertNotError(t, err, "Couldn't create SA to insert certificates")
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	issuer := newTestIssuer(t)
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	for i := int64(1); i <= 5; i++ {
+		_, err = ssa.AddCertificate(issuer.issue(t, i, fc.Now().Add(time.Hour)), reg.ID)
+		test.AssertNotError(t, err, "Couldn't add certificate")
+	}
+	// Expired certificates aren't sampled
+	_, err = ssa.AddCertificate(issuer.issue(t, 6, fc.Now().Add(-time.Minute)), reg.ID)
+	test.AssertNotError(t, err, "Couldn't add certificate")
+
+	// The SA doesn't sign responses, so the responder doesn't know any of
+	// the certificates
+	responder := &testResponder{t: t, response: ocsp.UnauthorizedErrorResponse}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	dbMap, err := sa.NewDbMap(vars.DBConnSACertChecker)
+	test.AssertNotError(t, err, "Couldn't connect to database")
+	stats, _ := statsd.NewNoopClient(nil)
+	checker := newChecker(dbMap, server.URL, issuer.cert, fc, stats)
+
+	// Sampling starts between the lowest and highest serials, rather than
+	// before all of them when the CA prefixes its serials
+	for i := 0; i < 10; i++ {
+		start, err := checker.randomSerial()
+		test.AssertNotError(t, err, "Failed to pick a random serial")
+		test.Assert(t, start >= "000000000000000000000000000000000001" && start <= "000000000000000000000000000000000006",
+			fmt.Sprintf("Random serial %s isn't between the stored serials", start))
+	}
+
+	err = checker.sampleCerts(4)
+	test.AssertNotError(t, err, "Failed to sample certificates")
+	test.AssertEquals(t, len(checker.certs), 4)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	checker.processCerts(wg)
+	test.AssertEquals(t, checker.report.Unknown, int64(4))
+	test.AssertEquals(t, len(checker.report.Entries), 4)
+	for _, entry := range checker.report.Entries {
+		test.AssertEquals(t, entry.Result, "unknown")
+	}
+}
+
+func TestSaveReport(t *testing.T) {
+	r := report{
+		Good:       1,
+		Mismatched: 1,
+		Entries: map[string]reportEntry{
+			"00000000000000000000000000000001": reportEntry{
+				Result: "good",
+			},
+			"00000000000000000000000000000002": reportEntry{
+				Result:   "mismatched",
+				Problems: []string{"Response status is 0, stored status is revoked"},
+			},
+		},
+	}
+
+	tmpDir, err := ioutil.TempDir("", "ocsp-checker")
+	test.AssertNotError(t, err, "Couldn't create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	err = r.save(tmpDir)
+	test.AssertNotError(t, err, "Couldn't save report")
+	reportContent, err := ioutil.ReadFile(path.Join(tmpDir, "00010101T000000-00010101T000000-ocsp-report.json"))
+	test.AssertNotError(t, err, "Couldn't read report file")
+	expectedContent, err := json.Marshal(r)
+	test.AssertNotError(t, err, "Couldn't marshal report")
+	test.AssertByteEquals(t, expectedContent, reportContent)
+}
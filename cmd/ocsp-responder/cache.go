@@ -0,0 +1,206 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// cacheEntry is a response held by a cacheSource
+type cacheEntry struct {
+	serial     string
+	response   []byte
+	nextUpdate time.Time
+}
+
+// cacheSource keeps the most recently used responses from another Source in
+// memory, keyed by serial, so that requests for them don't have to wait on the
+// database. It sits behind an issuerSource, which has already matched requests
+// to an issuer, so the serial alone identifies a response. Responses are only
+// served until their NextUpdate, once a response has expired the underlying
+// source is asked for a new one and if it doesn't have a fresh response the
+// client is told to try later.
+type cacheSource struct {
+	source cfocsp.Source
+	clk    clock.Clock
+	stats  statsd.Statter
+	log    *blog.AuditLogger
+
+	maxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newCacheSource(source cfocsp.Source, maxEntries int, clk clock.Clock, stats statsd.Statter, log *blog.AuditLogger) *cacheSource {
+	return &cacheSource{
+		source:     source,
+		clk:        clk,
+		stats:      stats,
+		log:        log,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Response is called by the HTTP server to handle a new OCSP request.
+func (c *cacheSource) Response(req *ocsp.Request) ([]byte, bool) {
+	return c.issuerResponse(nil, req)
+}
+
+// issuerResponse answers a request that was matched to issuer i, passing i on
+// to the source behind the cache on a miss
+func (c *cacheSource) issuerResponse(i *issuer, req *ocsp.Request) ([]byte, bool) {
+	serial := core.SerialToString(req.SerialNumber)
+	if response, present := c.get(serial); present {
+		c.stats.Inc("OCSP.Cache.Hits", 1, 1.0)
+		return response, true
+	}
+	c.stats.Inc("OCSP.Cache.Misses", 1, 1.0)
+
+	response, present := sourceResponse(c.source, i, req)
+	if !present {
+		return nil, false
+	}
+	if isErrorResponse(response) {
+		return response, true
+	}
+	fresh, err := c.add(serial, response)
+	if err != nil {
+		c.log.Err(fmt.Sprintf("Failed to parse OCSP response for serial %s: %s", serial, err))
+		return nil, false
+	}
+	if !fresh {
+		c.stats.Inc("OCSP.Cache.Expired", 1, 1.0)
+		c.log.Warning(fmt.Sprintf("Refusing to serve expired OCSP response for serial %s", serial))
+		return ocsp.TryLaterErrorResponse, true
+	}
+	return response, true
+}
+
+// get returns the cached response for serial if there is one that hasn't
+// expired yet
+func (c *cacheSource) get(serial string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, present := c.entries[serial]
+	if !present {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.clk.Now().Before(entry.nextUpdate) {
+		c.lru.Remove(elem)
+		delete(c.entries, serial)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.response, true
+}
+
+// add caches response for serial, evicting the least recently used response
+// if the cache is full. It returns false, without caching the response, if
+// the response has already expired.
+func (c *cacheSource) add(serial string, response []byte) (bool, error) {
+	parsed, err := ocsp.ParseResponse(response, nil)
+	if err != nil {
+		return false, err
+	}
+	if !c.clk.Now().Before(parsed.NextUpdate) {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{
+		serial:     serial,
+		response:   response,
+		nextUpdate: parsed.NextUpdate,
+	}
+	if elem, present := c.entries[serial]; present {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return true, nil
+	}
+	c.entries[serial] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).serial)
+	}
+	return true, nil
+}
+
+// addUpdated caches responses written by the OCSP updater and returns the
+// cursor moved past the latest of them
+func (c *cacheSource) addUpdated(responses []updatedResponse, cursor updateCursor) updateCursor {
+	for _, r := range responses {
+		if _, err := c.add(r.Serial, r.OCSPResponse); err != nil {
+			c.log.Err(fmt.Sprintf("Failed to parse OCSP response for serial %s: %s", r.Serial, err))
+		}
+		if cursor.after(r) {
+			cursor = updateCursor{lastUpdated: r.OCSPLastUpdated, serial: r.Serial}
+		}
+	}
+	c.stats.Inc("OCSP.Cache.Prefetched", int64(len(responses)), 1.0)
+	return cursor
+}
+
+// warmUp fills the cache with the responses most recently written by the OCSP
+// updater and returns the cursor past the latest of them
+func (c *cacheSource) warmUp(src *DBSource) (updateCursor, error) {
+	responses, err := src.mostRecentlyUpdated(c.maxEntries)
+	if err != nil {
+		return updateCursor{}, err
+	}
+	return c.addUpdated(responses, updateCursor{}), nil
+}
+
+// refresh caches the responses the OCSP updater has written since the last
+// refresh, a page of maxEntries at a time, and returns the cursor past the
+// latest of them
+func (c *cacheSource) refresh(src *DBSource, cursor updateCursor) (updateCursor, error) {
+	for {
+		responses, err := src.updatedSince(cursor, c.maxEntries)
+		if err != nil {
+			return cursor, err
+		}
+		cursor = c.addUpdated(responses, cursor)
+		if len(responses) < c.maxEntries {
+			return cursor, nil
+		}
+	}
+}
+
+// prefetch warms up the cache and then follows the OCSP updater's writes to
+// the certificateStatus table every interval, so that fresh responses are
+// already in memory when they are requested. It never returns.
+func (c *cacheSource) prefetch(src *DBSource, interval time.Duration) {
+	cursor, err := c.warmUp(src)
+	if err != nil {
+		c.log.Err(fmt.Sprintf("Failed to warm up OCSP response cache: %s", err))
+		cursor = updateCursor{lastUpdated: c.clk.Now()}
+	}
+	for {
+		c.clk.Sleep(interval)
+		cursor, err = c.refresh(src, cursor)
+		if err != nil {
+			c.log.Err(fmt.Sprintf("Failed to refresh OCSP response cache: %s", err))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+// countingSource is a Source that counts how many times it has been asked
+// for a response
+type countingSource struct {
+	cfocsp.InMemorySource
+	calls int
+}
+
+func (s *countingSource) Response(req *ocsp.Request) ([]byte, bool) {
+	s.calls++
+	return s.InMemorySource.Response(req)
+}
+
+func setupCache(t *testing.T, maxEntries int) (*cacheSource, *countingSource, clock.FakeClock, *ocsp.Request) {
+	ocspReq, err := ocsp.ParseRequest(req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	src := &countingSource{InMemorySource: cfocsp.InMemorySource{ocspReq.SerialNumber.String(): resp}}
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	stats, _ := statsd.NewNoopClient(nil)
+	return newCacheSource(src, maxEntries, fc, stats, blog.GetAuditLogger()), src, fc, ocspReq
+}
+
+func TestCacheHit(t *testing.T) {
+	cache, src, _, ocspReq := setupCache(t, 10)
+
+	for i := 0; i < 3; i++ {
+		response, found := cache.Response(ocspReq)
+		test.Assert(t, found, "Didn't find OCSP response")
+		test.AssertByteEquals(t, response, resp)
+	}
+	test.AssertEquals(t, src.calls, 1)
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache, src, _, ocspReq := setupCache(t, 1)
+	serial := core.SerialToString(ocspReq.SerialNumber)
+
+	_, found := cache.Response(ocspReq)
+	test.Assert(t, found, "Didn't find OCSP response")
+	fresh, err := cache.add("other serial", resp)
+	test.AssertNotError(t, err, "Failed to add response")
+	test.Assert(t, fresh, "Response wasn't fresh")
+	test.AssertEquals(t, cache.lru.Len(), 1)
+	_, found = cache.get(serial)
+	test.Assert(t, !found, "Least recently used response wasn't evicted")
+
+	cache.Response(ocspReq)
+	test.AssertEquals(t, src.calls, 2)
+}
+
+func TestCacheExpired(t *testing.T) {
+	cache, src, fc, ocspReq := setupCache(t, 10)
+
+	_, found := cache.Response(ocspReq)
+	test.Assert(t, found, "Didn't find OCSP response")
+
+	// Once the response's NextUpdate has passed it is evicted, and since the
+	// source has nothing newer the client is told to try later
+	fc.Set(time.Date(2030, 8, 26, 0, 0, 0, 0, time.UTC))
+	response, found := cache.Response(ocspReq)
+	test.Assert(t, found, "Didn't return an OCSP response")
+	test.AssertByteEquals(t, response, ocsp.TryLaterErrorResponse)
+	test.AssertEquals(t, src.calls, 2)
+	test.AssertEquals(t, cache.lru.Len(), 0)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/", bytes.NewReader(req))
+	test.AssertNotError(t, err, "Failed to make HTTP request")
+	newResponder(cache, fc, blog.GetAuditLogger()).ServeHTTP(w, r)
+	test.AssertByteEquals(t, w.Body.Bytes(), ocsp.TryLaterErrorResponse)
+}
+
+func TestCachePrefetch(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnSAOcspResp)
+	test.AssertNotError(t, err, "Could not connect to database")
+	src := NewSourceFromDatabase(dbMap, blog.GetAuditLogger())
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	stats, _ := statsd.NewNoopClient(nil)
+	cache := newCacheSource(src, 10, fc, stats, blog.GetAuditLogger())
+
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Could not connect to database")
+	insert := func(serial string, updated time.Time) {
+		err := setupDBMap.Insert(&core.CertificateStatus{
+			Serial:          serial,
+			OCSPLastUpdated: updated,
+			OCSPResponse:    resp,
+		})
+		test.AssertNotError(t, err, "Failed to insert response")
+	}
+	insert("00000000000000000000000000000001", fc.Now().Add(-time.Hour))
+
+	cursor, err := cache.warmUp(src)
+	test.AssertNotError(t, err, "Failed to warm up cache")
+	test.AssertEquals(t, cursor, updateCursor{fc.Now().Add(-time.Hour), "00000000000000000000000000000001"})
+	_, found := cache.get("00000000000000000000000000000001")
+	test.Assert(t, found, "Response wasn't prefetched during warm up")
+
+	insert("00000000000000000000000000000002", fc.Now())
+	cursor, err = cache.refresh(src, cursor)
+	test.AssertNotError(t, err, "Failed to refresh cache")
+	test.AssertEquals(t, cursor, updateCursor{fc.Now(), "00000000000000000000000000000002"})
+	_, found = cache.get("00000000000000000000000000000002")
+	test.Assert(t, found, "Updated response wasn't prefetched")
+	test.AssertEquals(t, cache.lru.Len(), 2)
+
+	// More responses than the cache holds written in the same second are
+	// read a page at a time rather than the first page over and over
+	for i := 3; i <= 25; i++ {
+		insert(fmt.Sprintf("%032d", i), fc.Now().Add(time.Second))
+	}
+	cursor, err = cache.refresh(src, cursor)
+	test.AssertNotError(t, err, "Failed to refresh cache")
+	test.AssertEquals(t, cursor, updateCursor{fc.Now().Add(time.Second), fmt.Sprintf("%032d", 25)})
+	_, found = cache.get(fmt.Sprintf("%032d", 25))
+	test.Assert(t, found, "Last updated response wasn't prefetched")
+	test.AssertEquals(t, cache.lru.Len(), 10)
+
+	insert(fmt.Sprintf("%032d", 26), fc.Now().Add(time.Second))
+	cursor, err = cache.refresh(src, cursor)
+	test.AssertNotError(t, err, "Failed to refresh cache")
+	test.AssertEquals(t, cursor, updateCursor{fc.Now().Add(time.Second), fmt.Sprintf("%032d", 26)})
+	_, found = cache.get(fmt.Sprintf("%032d", 26))
+	test.Assert(t, found, "Response written in the same second wasn't prefetched")
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	// Register the hash algorithms requests may identify issuers with
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// issuerHashAlgorithms are the hash algorithms an OCSP request's CertID may
+// use to identify an issuer
+var issuerHashAlgorithms = []crypto.Hash{crypto.SHA1, crypto.SHA256}
+
+// issuer is a CA whose certificates the responder answers OCSP requests for
+type issuer struct {
+	name string
+	cert *x509.Certificate
+	// nameHashes and keyHashes hold the hashes of the issuer's subject name and
+	// public key for each of issuerHashAlgorithms
+	nameHashes map[crypto.Hash][]byte
+	keyHashes  map[crypto.Hash][]byte
+	source     cfocsp.Source
+}
+
+func newIssuer(cert *x509.Certificate, source cfocsp.Source) (*issuer, error) {
+	// The key hash is over the contents of the subjectPublicKey BIT STRING, not
+	// the whole SubjectPublicKeyInfo
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("Could not parse issuer public key: %s", err)
+	}
+
+	i := &issuer{
+		name:       cert.Subject.CommonName,
+		cert:       cert,
+		nameHashes: make(map[crypto.Hash][]byte),
+		keyHashes:  make(map[crypto.Hash][]byte),
+		source:     source,
+	}
+	for _, hash := range issuerHashAlgorithms {
+		h := hash.New()
+		h.Write(cert.RawSubject)
+		i.nameHashes[hash] = h.Sum(nil)
+
+		h = hash.New()
+		h.Write(spki.PublicKey.RightAlign())
+		i.keyHashes[hash] = h.Sum(nil)
+	}
+	return i, nil
+}
+
+// matches returns true if req's CertID names this issuer
+func (i *issuer) matches(req *ocsp.Request) bool {
+	nameHash, present := i.nameHashes[req.HashAlgorithm]
+	if !present {
+		return false
+	}
+	return bytes.Equal(req.IssuerNameHash, nameHash) &&
+		bytes.Equal(req.IssuerKeyHash, i.keyHashes[req.HashAlgorithm])
+}
+
+// issuerAwareSource is a Source that needs to know which issuer a request was
+// matched to, such as a liveSource, which only signs responses for the
+// certificates that issuer issued
+type issuerAwareSource interface {
+	issuerResponse(i *issuer, req *ocsp.Request) ([]byte, bool)
+}
+
+// sourceResponse asks source for the response to a request matched to issuer
+// i, passing i on if source wants it
+func sourceResponse(source cfocsp.Source, i *issuer, req *ocsp.Request) ([]byte, bool) {
+	if s, ok := source.(issuerAwareSource); ok {
+		return s.issuerResponse(i, req)
+	}
+	return source.Response(req)
+}
+
+// issuerSource routes each OCSP request to the source of the issuer its CertID
+// names, so that one responder can answer for several issuers
+type issuerSource struct {
+	issuers []*issuer
+	log     *blog.AuditLogger
+}
+
+// Response is called by the HTTP server to handle a new OCSP request.
+func (s *issuerSource) Response(req *ocsp.Request) ([]byte, bool) {
+	for _, i := range s.issuers {
+		if !i.matches(req) {
+			continue
+		}
+		response, present := sourceResponse(i.source, i, req)
+		if present {
+			s.log.Info(fmt.Sprintf("OCSP Response sent for CA=%s, Serial=%s", i.name, core.SerialToString(req.SerialNumber)))
+		}
+		return response, present
+	}
+	s.log.Debug(fmt.Sprintf("Request intended for unknown CA, name hash %s, key hash %s",
+		hex.EncodeToString(req.IssuerNameHash), hex.EncodeToString(req.IssuerKeyHash)))
+	return nil, false
+}
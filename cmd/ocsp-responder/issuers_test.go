@@ -0,0 +1,66 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"testing"
+
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestIssuerSource(t *testing.T) {
+	ocspReq, err := ocsp.ParseRequest(req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	dbSource := cfocsp.InMemorySource{ocspReq.SerialNumber.String(): resp}
+
+	src, err := makeIssuerSource([]cmd.OCSPIssuerConfig{
+		{IssuerCert: "./testdata/test-ca.der.pem"},
+		{IssuerCert: "../../test/test-root.pem", Source: "file:../../test/issuer-ocsp-responses.txt"},
+	}, dbSource, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Failed to make issuer source")
+
+	// Requests for certificates issued by the intermediate, using either SHA-1
+	// or SHA-256 CertIDs, are answered from the database
+	for _, path := range []string{"./testdata/ocsp.req", "./testdata/ocsp-sha256.req"} {
+		issuerReq, err := ocsp.ParseRequest(mustRead(path))
+		test.AssertNotError(t, err, "Failed to parse OCSP request "+path)
+		response, found := src.Response(issuerReq)
+		test.Assert(t, found, "Didn't find OCSP response for "+path)
+		test.AssertByteEquals(t, response, resp)
+	}
+
+	// Requests for the intermediate itself are answered from the root's file
+	rootReq, err := ocsp.ParseRequest(mustRead("./testdata/issuer-ocsp.req"))
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	response, found := src.Response(rootReq)
+	test.Assert(t, found, "Didn't find OCSP response for intermediate")
+	parsed, err := ocsp.ParseResponse(response, nil)
+	test.AssertNotError(t, err, "Failed to parse OCSP response")
+	test.AssertEquals(t, parsed.SerialNumber.Cmp(rootReq.SerialNumber), 0)
+
+	// Requests naming an unknown issuer, or a known issuer's key with another
+	// issuer's name, aren't answered
+	unknownReq := *ocspReq
+	unknownReq.IssuerKeyHash = []byte("unknown issuer")
+	_, found = src.Response(&unknownReq)
+	test.Assert(t, !found, "Answered a request for an unknown issuer")
+	mixedReq := *ocspReq
+	mixedReq.IssuerNameHash = rootReq.IssuerNameHash
+	_, found = src.Response(&mixedReq)
+	test.Assert(t, !found, "Answered a request with a mismatched issuer name")
+}
+
+func TestIssuerSourceWithoutDatabase(t *testing.T) {
+	_, err := makeIssuerSource([]cmd.OCSPIssuerConfig{
+		{IssuerCert: "./testdata/test-ca.der.pem"},
+	}, nil, blog.GetAuditLogger())
+	test.AssertError(t, err, "Made an issuer source with no source for an issuer")
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// liveCall is a signing request for a serial that other requests for the same
+// serial wait on instead of making their own
+type liveCall struct {
+	done     chan struct{}
+	response []byte
+	present  bool
+}
+
+// liveDB is the database behind a liveSource, which has the status of every
+// certificate the SA has stored as well as their responses
+type liveDB interface {
+	cfocsp.Source
+	certificateStatus(serial string) (core.CertificateStatus, error)
+}
+
+// liveSource asks the CA to sign a response for a known, unexpired certificate
+// when the database behind it has none, for instance right after issuance or
+// when the OCSP updater has fallen behind. Serials the database has no status
+// for are turned away without asking the SA, and the certificate must have been
+// issued by the issuer the request was matched to. The new response is stored
+// with the SA so it is only signed once. Like the OCSP updater it signs at most
+// maxSignings responses per window and backs off while the CA reports its HSM
+// unavailable, telling clients to try later in the meantime.
+type liveSource struct {
+	source liveDB
+	ca     core.CertificateAuthority
+	sa     core.StorageAuthority
+	clk    clock.Clock
+	stats  statsd.Statter
+	log    *blog.AuditLogger
+
+	maxSignings          int
+	window               time.Duration
+	failureBackoffFactor float64
+	failureBackoffMax    time.Duration
+
+	mu           sync.Mutex
+	inflight     map[string]*liveCall
+	windowStart  time.Time
+	signings     int
+	failures     int
+	blockedUntil time.Time
+}
+
+func newLiveSource(
+	source liveDB,
+	ca core.CertificateAuthority,
+	sa core.StorageAuthority,
+	config cmd.OCSPLiveSigningConfig,
+	clk clock.Clock,
+	stats statsd.Statter,
+	log *blog.AuditLogger,
+) (*liveSource, error) {
+	if config.MaxSignings == 0 || config.Window.Duration == 0 {
+		return nil, fmt.Errorf("Live signing max signings and window must be non-zero")
+	}
+	return &liveSource{
+		source:               source,
+		ca:                   ca,
+		sa:                   sa,
+		clk:                  clk,
+		stats:                stats,
+		log:                  log,
+		maxSignings:          config.MaxSignings,
+		window:               config.Window.Duration,
+		failureBackoffFactor: config.SignFailureBackoffFactor,
+		failureBackoffMax:    config.SignFailureBackoffMax.Duration,
+		inflight:             make(map[string]*liveCall),
+	}, nil
+}
+
+// Response is called by the HTTP server to handle a new OCSP request. Without
+// knowing which issuer the request was matched to no response is signed.
+func (s *liveSource) Response(req *ocsp.Request) ([]byte, bool) {
+	return s.issuerResponse(nil, req)
+}
+
+// issuerResponse answers a request that was matched to issuer i
+func (s *liveSource) issuerResponse(i *issuer, req *ocsp.Request) ([]byte, bool) {
+	if response, present := s.source.Response(req); present || i == nil {
+		return response, present
+	}
+
+	serial := core.SerialToString(req.SerialNumber)
+	s.mu.Lock()
+	if call, present := s.inflight[serial]; present {
+		s.mu.Unlock()
+		s.stats.Inc("OCSP.Live.Deduplicated", 1, 1.0)
+		<-call.done
+		return call.response, call.present
+	}
+	call := &liveCall{done: make(chan struct{})}
+	s.inflight[serial] = call
+	s.mu.Unlock()
+
+	call.response, call.present = s.sign(i, serial)
+
+	s.mu.Lock()
+	delete(s.inflight, serial)
+	s.mu.Unlock()
+	close(call.done)
+	return call.response, call.present
+}
+
+// sign has the CA sign a response for serial, if i issued it, and stores it
+func (s *liveSource) sign(i *issuer, serial string) ([]byte, bool) {
+	status, err := s.source.certificateStatus(serial)
+	if err == sql.ErrNoRows {
+		s.stats.Inc("OCSP.Live.UnknownSerials", 1, 1.0)
+		s.log.Debug(fmt.Sprintf("Not signing OCSP response for unknown serial %s", serial))
+		return nil, false
+	} else if err != nil {
+		s.log.Err(fmt.Sprintf("Failed to retrieve certificate status for serial %s: %s", serial, err))
+		return nil, false
+	}
+	cert, err := s.sa.GetCertificate(serial)
+	if err != nil {
+		s.log.Debug(fmt.Sprintf("Not signing OCSP response for unknown serial %s: %s", serial, err))
+		return nil, false
+	}
+	if !s.clk.Now().Before(cert.Expires) {
+		s.log.Debug(fmt.Sprintf("Not signing OCSP response for expired serial %s", serial))
+		return nil, false
+	}
+	parsed, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		s.log.Err(fmt.Sprintf("Failed to parse certificate for serial %s: %s", serial, err))
+		return nil, false
+	}
+	if err = parsed.CheckSignatureFrom(i.cert); err != nil {
+		s.log.Warning(fmt.Sprintf("Not signing OCSP response for serial %s, which wasn't issued by %s: %s", serial, i.name, err))
+		return nil, false
+	}
+
+	if !s.allow() {
+		s.stats.Inc("OCSP.Live.RateLimited", 1, 1.0)
+		return ocsp.TryLaterErrorResponse, true
+	}
+	response, err := s.ca.GenerateOCSP(core.OCSPSigningRequest{
+		CertDER:   cert.DER,
+		Status:    string(status.Status),
+		Reason:    status.RevokedReason,
+		RevokedAt: status.RevokedDate,
+	})
+	s.record(err)
+	if err != nil {
+		s.stats.Inc("OCSP.Live.FailedSignings", 1, 1.0)
+		s.log.AuditErr(fmt.Errorf("Failed to sign live OCSP response for serial %s: %s", serial, err))
+		return ocsp.TryLaterErrorResponse, true
+	}
+	s.stats.Inc("OCSP.Live.Signings", 1, 1.0)
+
+	if err = s.sa.UpdateOCSP(serial, response); err != nil {
+		s.log.Err(fmt.Sprintf("Failed to store live OCSP response for serial %s: %s", serial, err))
+	}
+	return response, true
+}
+
+// allow returns true, and counts a signing, if the CA may be asked to sign a
+// response now
+func (s *liveSource) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clk.Now()
+	if now.Before(s.blockedUntil) {
+		return false
+	}
+	if now.Sub(s.windowStart) >= s.window {
+		s.windowStart = now
+		s.signings = 0
+	}
+	if s.signings >= s.maxSignings {
+		return false
+	}
+	s.signings++
+	return true
+}
+
+// record notes the result of asking the CA to sign a response. If the CA's HSM
+// is unavailable no more responses are signed for the exponentially increasing
+// duration returned by core.RetryBackoff.
+func (s *liveSource) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failures = 0
+		return
+	}
+	if _, ok := err.(core.ServiceUnavailableError); ok && (s.failureBackoffFactor > 0 && s.failureBackoffMax > 0) {
+		s.failures++
+		s.blockedUntil = s.clk.Now().Add(core.RetryBackoff(s.failures, s.window, s.failureBackoffMax, s.failureBackoffFactor))
+	}
+}
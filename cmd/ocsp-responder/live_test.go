@@ -0,0 +1,249 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/helpers"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// liveCA signs every request with the test response, or fails with err, after
+// waiting for release if it is set
+type liveCA struct {
+	mu      sync.Mutex
+	calls   int
+	err     error
+	release chan struct{}
+}
+
+func (ca *liveCA) IssueCertificate(csr x509.CertificateRequest, regID int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
+func (ca *liveCA) GenerateOCSP(xferObj core.OCSPSigningRequest) ([]byte, error) {
+	ca.mu.Lock()
+	ca.calls++
+	ca.mu.Unlock()
+	if ca.release != nil {
+		<-ca.release
+	}
+	if ca.err != nil {
+		return nil, ca.err
+	}
+	return resp, nil
+}
+
+// liveStatusDB has no responses, only the status of the certificates the SA
+// knows about
+type liveStatusDB struct {
+	cfocsp.InMemorySource
+	sa *liveSA
+}
+
+func (db *liveStatusDB) certificateStatus(serial string) (core.CertificateStatus, error) {
+	if _, present := db.sa.certs[serial]; !present {
+		return core.CertificateStatus{}, sql.ErrNoRows
+	}
+	return core.CertificateStatus{Serial: serial, Status: core.OCSPStatusGood}, nil
+}
+
+// liveSA knows about a few certificates and records the responses stored for
+// them
+type liveSA struct {
+	*mocks.StorageAuthority
+	certs   map[string][]byte
+	expires time.Time
+	calls   int
+	stored  map[string][]byte
+}
+
+func (sa *liveSA) GetCertificate(serial string) (core.Certificate, error) {
+	sa.calls++
+	der, present := sa.certs[serial]
+	if !present {
+		return core.Certificate{}, errors.New("No cert")
+	}
+	return core.Certificate{Serial: serial, DER: der, Expires: sa.expires}, nil
+}
+
+func (sa *liveSA) UpdateOCSP(serial string, ocspResponse []byte) error {
+	sa.stored[serial] = ocspResponse
+	return nil
+}
+
+// makeLiveCert makes a certificate with the given serial signed by issuerKey
+func makeLiveCert(t *testing.T, serial *big.Int, issuerCert *x509.Certificate, issuerKey interface{}) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuerCert, &key.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	return der
+}
+
+// setupLive returns a liveSource behind an issuerSource for the test CA, whose
+// SA knows about the certificate ocspReq asks about
+func setupLive(t *testing.T, maxSignings int) (*issuerSource, *liveSource, *liveCA, *liveSA, clock.FakeClock, *ocsp.Request) {
+	ocspReq, err := ocsp.ParseRequest(req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	issuerCert, err := helpers.ParseCertificatePEM(mustRead("./testdata/test-ca.der.pem"))
+	test.AssertNotError(t, err, "Failed to parse issuer certificate")
+	issuerKey, err := helpers.ParsePrivateKeyPEM(mustRead("./testdata/test-ca.key"))
+	test.AssertNotError(t, err, "Failed to parse issuer key")
+
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	ca := &liveCA{}
+	sa := &liveSA{
+		certs: map[string][]byte{
+			core.SerialToString(ocspReq.SerialNumber): makeLiveCert(t, ocspReq.SerialNumber, issuerCert, issuerKey),
+		},
+		expires: fc.Now().Add(time.Hour),
+		stored:  make(map[string][]byte),
+	}
+	stats, _ := statsd.NewNoopClient(nil)
+	live, err := newLiveSource(&liveStatusDB{sa: sa}, ca, sa, cmd.OCSPLiveSigningConfig{
+		MaxSignings:              maxSignings,
+		Window:                   cmd.ConfigDuration{Duration: time.Minute},
+		SignFailureBackoffFactor: 1.5,
+		SignFailureBackoffMax:    cmd.ConfigDuration{Duration: time.Hour},
+	}, fc, stats, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Failed to make live source")
+	i, err := newIssuer(issuerCert, live)
+	test.AssertNotError(t, err, "Failed to make issuer")
+	return &issuerSource{issuers: []*issuer{i}, log: blog.GetAuditLogger()}, live, ca, sa, fc, ocspReq
+}
+
+func TestLiveSigning(t *testing.T) {
+	src, live, ca, sa, fc, ocspReq := setupLive(t, 10)
+
+	response, found := src.Response(ocspReq)
+	test.Assert(t, found, "Didn't sign an OCSP response")
+	test.AssertByteEquals(t, response, resp)
+	test.AssertEquals(t, ca.calls, 1)
+	test.AssertByteEquals(t, sa.stored[core.SerialToString(ocspReq.SerialNumber)], resp)
+
+	// Without the issuer the request was matched to nothing is signed
+	_, found = live.Response(ocspReq)
+	test.Assert(t, !found, "Signed a response without an issuer")
+
+	// Unknown serials are turned away without asking the SA
+	unknownReq := *ocspReq
+	unknownReq.SerialNumber = new(big.Int).Add(ocspReq.SerialNumber, big.NewInt(1))
+	_, found = src.Response(&unknownReq)
+	test.Assert(t, !found, "Signed a response for an unknown serial")
+	test.AssertEquals(t, sa.calls, 1)
+
+	// Certificates signed by another key under the issuer's name aren't
+	// signed for
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Failed to generate key")
+	otherIssuer := &x509.Certificate{Subject: src.issuers[0].cert.Subject}
+	sa.certs[core.SerialToString(unknownReq.SerialNumber)] = makeLiveCert(t, unknownReq.SerialNumber, otherIssuer, otherKey)
+	_, found = src.Response(&unknownReq)
+	test.Assert(t, !found, "Signed a response for a certificate from another issuer")
+
+	// Expired certificates aren't signed for
+	fc.Add(time.Hour)
+	_, found = src.Response(ocspReq)
+	test.Assert(t, !found, "Signed a response for an expired certificate")
+	test.AssertEquals(t, ca.calls, 1)
+}
+
+func TestLiveSigningDeduplication(t *testing.T) {
+	src, live, ca, _, _, ocspReq := setupLive(t, 10)
+	ca.release = make(chan struct{})
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, found := src.Response(ocspReq)
+			test.Assert(t, found, "Didn't sign an OCSP response")
+			test.AssertByteEquals(t, response, resp)
+		}()
+	}
+	// Wait for every request to be waiting on the first one before letting the
+	// CA answer it
+	for {
+		live.mu.Lock()
+		call := live.inflight[core.SerialToString(ocspReq.SerialNumber)]
+		live.mu.Unlock()
+		ca.mu.Lock()
+		calls := ca.calls
+		ca.mu.Unlock()
+		if call != nil && calls == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(ca.release)
+	wg.Wait()
+	test.AssertEquals(t, ca.calls, 1)
+}
+
+func TestLiveSigningRateLimit(t *testing.T) {
+	src, _, ca, _, fc, ocspReq := setupLive(t, 1)
+
+	_, found := src.Response(ocspReq)
+	test.Assert(t, found, "Didn't sign an OCSP response")
+	response, found := src.Response(ocspReq)
+	test.Assert(t, found, "Didn't return an OCSP response")
+	test.AssertByteEquals(t, response, ocsp.TryLaterErrorResponse)
+	test.AssertEquals(t, ca.calls, 1)
+
+	fc.Add(time.Minute)
+	response, _ = src.Response(ocspReq)
+	test.AssertByteEquals(t, response, resp)
+	test.AssertEquals(t, ca.calls, 2)
+}
+
+func TestLiveSigningBackoff(t *testing.T) {
+	src, live, ca, _, fc, ocspReq := setupLive(t, 10)
+	ca.err = core.ServiceUnavailableError("HSM is unavailable")
+
+	response, found := src.Response(ocspReq)
+	test.Assert(t, found, "Didn't return an OCSP response")
+	test.AssertByteEquals(t, response, ocsp.TryLaterErrorResponse)
+	test.AssertEquals(t, live.failures, 1)
+
+	// While backing off the CA isn't asked to sign anything
+	response, _ = src.Response(ocspReq)
+	test.AssertByteEquals(t, response, ocsp.TryLaterErrorResponse)
+	test.AssertEquals(t, ca.calls, 1)
+
+	ca.err = nil
+	fc.Add(live.blockedUntil.Sub(fc.Now()))
+	response, _ = src.Response(ocspReq)
+	test.AssertByteEquals(t, response, resp)
+	test.AssertEquals(t, ca.calls, 2)
+	test.AssertEquals(t, live.failures, 0)
+}
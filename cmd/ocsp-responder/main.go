@@ -6,10 +6,8 @@
 package main
 
 import (
-	"bytes"
 	"crypto/x509"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -26,12 +24,20 @@ import (
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/sa"
 )
 
+const (
+	clientName = "OCSP-Responder"
+
+	defaultCacheSize            = 10000
+	defaultCacheRefreshInterval = 10 * time.Second
+)
+
 /*
-DBSource maps a given Database schema to a CA Key Hash, so we can pick
-from among them when presented with OCSP requests for different certs.
+DBSource looks up OCSP responses for any issuer's certificates in a given
+Database schema. Requests are matched to an issuer before they reach it.
 
 We assume that OCSP responses are stored in a very simple database table,
 with two columns: serialNumber and response
@@ -45,43 +51,52 @@ serialNumber field, since we will always query on it.
 
 */
 type DBSource struct {
-	dbMap     dbSelector
-	caKeyHash []byte
-	log       *blog.AuditLogger
+	dbMap dbSelector
+	log   *blog.AuditLogger
 }
 
-// Since the only thing we use from gorp is the SelectOne method on the
-// gorp.DbMap object, we just define the interface an interface with that method
+// Since the only things we use from gorp are the Select and SelectOne methods
+// on the gorp.DbMap object, we just define an interface with those methods
 // instead of importing all of gorp. This also allows us to simulate MySQL failures
 // by mocking the interface.
 type dbSelector interface {
+	Select(holder interface{}, query string, args ...interface{}) ([]interface{}, error)
 	SelectOne(holder interface{}, query string, args ...interface{}) error
 }
 
-// NewSourceFromDatabase produces a DBSource representing the binding of a
-// given DB schema to a CA key.
-func NewSourceFromDatabase(dbMap dbSelector, caKeyHash []byte, log *blog.AuditLogger) (src *DBSource, err error) {
-	src = &DBSource{dbMap: dbMap, caKeyHash: caKeyHash, log: log}
-	return
+// updatedResponse is a response the OCSP updater has written to the
+// certificateStatus table
+type updatedResponse struct {
+	Serial          string    `db:"serial"`
+	OCSPResponse    []byte    `db:"ocspResponse"`
+	OCSPLastUpdated time.Time `db:"ocspLastUpdated"`
+}
+
+// updateCursor is how far the OCSP updater's writes, ordered by
+// ocspLastUpdated and then serial, have been read. The serial breaks ties
+// between the many responses written in the same second.
+type updateCursor struct {
+	lastUpdated time.Time
+	serial      string
+}
+
+// after returns true if r was written after the cursor's position
+func (c updateCursor) after(r updatedResponse) bool {
+	return r.OCSPLastUpdated.After(c.lastUpdated) ||
+		(r.OCSPLastUpdated.Equal(c.lastUpdated) && r.Serial > c.serial)
+}
+
+// NewSourceFromDatabase produces a DBSource representing the given DB schema.
+func NewSourceFromDatabase(dbMap dbSelector, log *blog.AuditLogger) *DBSource {
+	return &DBSource{dbMap: dbMap, log: log}
 }
 
 // Response is called by the HTTP server to handle a new OCSP request.
 func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
-	// Check that this request is for the proper CA
-	if bytes.Compare(req.IssuerKeyHash, src.caKeyHash) != 0 {
-		src.log.Debug(fmt.Sprintf("Request intended for CA Cert ID: %s", hex.EncodeToString(req.IssuerKeyHash)))
-		return nil, false
-	}
-
 	serialString := core.SerialToString(req.SerialNumber)
 	src.log.Debug(fmt.Sprintf("Searching for OCSP issued by us for serial %s", serialString))
 
 	var response []byte
-	defer func() {
-		if len(response) != 0 {
-			src.log.Info(fmt.Sprintf("OCSP Response sent for CA=%s, Serial=%s", hex.EncodeToString(src.caKeyHash), serialString))
-		}
-	}()
 	// Note: we first check for an OCSP response in the certificateStatus table (
 	// the new method) if we don't find a response there we instead look in the
 	// ocspResponses table (the old method) while transitioning between the two
@@ -114,22 +129,102 @@ func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
 	return response, true
 }
 
-func makeDBSource(dbMap dbSelector, issuerCert string, log *blog.AuditLogger) (*DBSource, error) {
-	// Load the CA's key so we can store its SubjectKey in the DB
-	caCertDER, err := cmd.LoadCert(issuerCert)
+// mostRecentlyUpdated returns the limit responses most recently written by
+// the OCSP updater
+func (src *DBSource) mostRecentlyUpdated(limit int) ([]updatedResponse, error) {
+	var responses []updatedResponse
+	_, err := src.dbMap.Select(
+		&responses,
+		`SELECT serial, ocspResponse, ocspLastUpdated FROM certificateStatus
+		 ORDER BY ocspLastUpdated DESC, serial DESC LIMIT :limit`,
+		map[string]interface{}{"limit": limit},
+	)
+	return responses, err
+}
+
+// certificateStatus returns the status the SA has stored for serial, or
+// sql.ErrNoRows if it has none
+func (src *DBSource) certificateStatus(serial string) (core.CertificateStatus, error) {
+	var status core.CertificateStatus
+	err := src.dbMap.SelectOne(
+		&status,
+		`SELECT serial, status, revokedDate, revokedReason FROM certificateStatus
+		 WHERE serial = :serial`,
+		map[string]interface{}{"serial": serial},
+	)
+	return status, err
+}
+
+// updatedSince returns up to limit responses written by the OCSP updater
+// after the cursor, oldest first
+func (src *DBSource) updatedSince(cursor updateCursor, limit int) ([]updatedResponse, error) {
+	var responses []updatedResponse
+	_, err := src.dbMap.Select(
+		&responses,
+		`SELECT serial, ocspResponse, ocspLastUpdated FROM certificateStatus
+		 WHERE ocspLastUpdated > :since
+		    OR (ocspLastUpdated = :since AND serial > :serial)
+		 ORDER BY ocspLastUpdated ASC, serial ASC LIMIT :limit`,
+		map[string]interface{}{"since": cursor.lastUpdated, "serial": cursor.serial, "limit": limit},
+	)
+	return responses, err
+}
+
+// makeFileSource reads the pre-signed responses in the file named by a file
+// URL
+func makeFileSource(source string) (cfocsp.Source, error) {
+	url, err := url.Parse(source)
 	if err != nil {
-		return nil, fmt.Errorf("Could not read issuer cert %s: %s", issuerCert, err)
+		return nil, fmt.Errorf("Source was not a URL: %s", source)
 	}
-	caCert, err := x509.ParseCertificate(caCertDER)
-	if err != nil {
-		return nil, fmt.Errorf("Could not parse issuer cert %s: %s", issuerCert, err)
+	if url.Scheme != "file" {
+		return nil, fmt.Errorf("Source was not a file URL: %s", source)
+	}
+	filename := url.Path
+	// Go interprets cwd-relative file urls (file:test/foo.txt) as having the
+	// relative part of the path in the 'Opaque' field.
+	if filename == "" {
+		filename = url.Opaque
 	}
-	if len(caCert.SubjectKeyId) == 0 {
-		return nil, fmt.Errorf("Empty subjectKeyID")
+	src, err := cfocsp.NewSourceFromFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read file %s: %s", filename, err)
 	}
+	return src, nil
+}
+
+// makeIssuerSource loads each of the configured issuers and routes requests for
+// them to their own file source, or otherwise to dbSource
+func makeIssuerSource(issuers []cmd.OCSPIssuerConfig, dbSource cfocsp.Source, log *blog.AuditLogger) (*issuerSource, error) {
+	src := &issuerSource{log: log}
+	for _, ic := range issuers {
+		certDER, err := cmd.LoadCert(ic.IssuerCert)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read issuer cert %s: %s", ic.IssuerCert, err)
+		}
+		cert, err := x509.ParseCertificate(certDER)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse issuer cert %s: %s", ic.IssuerCert, err)
+		}
+
+		source := dbSource
+		if ic.Source != "" {
+			source, err = makeFileSource(ic.Source)
+			if err != nil {
+				return nil, err
+			}
+		} else if source == nil {
+			return nil, fmt.Errorf("No source for issuer cert %s and no database configured", ic.IssuerCert)
+		}
 
-	// Construct source from DB
-	return NewSourceFromDatabase(dbMap, caCert.SubjectKeyId, log)
+		i, err := newIssuer(cert, source)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load issuer cert %s: %s", ic.IssuerCert, err)
+		}
+		log.Info(fmt.Sprintf("Answering OCSP requests for CA Cert: %s", ic.IssuerCert))
+		src.issuers = append(src.issuers, i)
+	}
+	return src, nil
 }
 
 func main() {
@@ -140,7 +235,6 @@ func main() {
 		go cmd.ProfileCmd("OCSP", stats)
 
 		config := c.OCSPResponder
-		var source cfocsp.Source
 
 		// DBConfig takes precedence over Source, if present.
 		dbConnect, err := config.DBConfig.URL()
@@ -148,27 +242,55 @@ func main() {
 		if dbConnect == "" {
 			dbConnect = config.Source
 		}
-		url, err := url.Parse(dbConnect)
-		cmd.FailOnError(err, fmt.Sprintf("Source was not a URL: %s", config.Source))
 
-		if url.Scheme == "mysql+tcp" {
-			auditlogger.Info(fmt.Sprintf("Loading OCSP Database for CA Cert: %s", c.Common.IssuerCert))
-			dbMap, err := sa.NewDbMap(config.Source)
+		// The database, if there is one, is shared by every issuer without its
+		// own file source
+		var dbSource cfocsp.Source
+		if sa.IsDBURL(dbConnect) {
+			auditlogger.Info("Loading OCSP Database")
+			dbMap, err := sa.NewDbMap(dbConnect)
 			cmd.FailOnError(err, "Could not connect to database")
 			if c.SQL.SQLDebug {
 				sa.SetSQLDebug(dbMap, true)
 			}
-			source, err = makeDBSource(dbMap, c.Common.IssuerCert, auditlogger)
-			cmd.FailOnError(err, "Couldn't load OCSP DB")
-		} else if url.Scheme == "file" {
-			filename := url.Path
-			// Go interprets cwd-relative file urls (file:test/foo.txt) as having the
-			// relative part of the path in the 'Opaque' field.
-			if filename == "" {
-				filename = url.Opaque
+			db := NewSourceFromDatabase(dbMap, auditlogger)
+
+			var uncached cfocsp.Source = db
+			if config.LiveSigning != nil {
+				cac, err := rpc.NewCertificateAuthorityClient(clientName, config.AMQP, stats)
+				cmd.FailOnError(err, "Unable to create CA client")
+				sac, err := rpc.NewStorageAuthorityClient(clientName, config.AMQP, stats)
+				cmd.FailOnError(err, "Unable to create SA client")
+				uncached, err = newLiveSource(db, cac, sac, *config.LiveSigning, clock.Default(), stats, auditlogger)
+				cmd.FailOnError(err, "Couldn't set up live signing")
+			}
+
+			cacheSize := config.CacheSize
+			if cacheSize == 0 {
+				cacheSize = defaultCacheSize
 			}
-			source, err = cfocsp.NewSourceFromFile(filename)
-			cmd.FailOnError(err, fmt.Sprintf("Couldn't read file: %s", url.Path))
+			refreshInterval := config.CacheRefreshInterval.Duration
+			if refreshInterval == 0 {
+				refreshInterval = defaultCacheRefreshInterval
+			}
+			cache := newCacheSource(uncached, cacheSize, clock.Default(), stats, auditlogger)
+			go cache.prefetch(db, refreshInterval)
+			dbSource = cache
+		}
+
+		var source cfocsp.Source
+		if len(config.Issuers) > 0 {
+			source, err = makeIssuerSource(config.Issuers, dbSource, auditlogger)
+			cmd.FailOnError(err, "Couldn't load OCSP issuers")
+		} else if dbSource != nil {
+			issuers := []cmd.OCSPIssuerConfig{{IssuerCert: c.Common.IssuerCert}}
+			source, err = makeIssuerSource(issuers, dbSource, auditlogger)
+			cmd.FailOnError(err, "Couldn't load OCSP issuers")
+		} else if dbConnect != "" {
+			// Without a database or any issuers, every request is answered from
+			// the file named by Source
+			source, err = makeFileSource(dbConnect)
+			cmd.FailOnError(err, "Couldn't load OCSP responses")
 		} else {
 			cmd.FailOnError(errors.New(`"source" parameter not found in JSON config`), "unable to start ocsp-responder")
 		}
@@ -178,7 +300,12 @@ func main() {
 		killTimeout, err := time.ParseDuration(c.OCSPResponder.ShutdownKillTimeout)
 		cmd.FailOnError(err, "Couldn't parse shutdown kill timeout")
 
-		m := http.StripPrefix(c.OCSPResponder.Path, cfocsp.NewResponder(source))
+		m := newNormalizer(
+			c.OCSPResponder.Path,
+			http.StripPrefix(c.OCSPResponder.Path, newResponder(source, clock.Default(), auditlogger)),
+			c.OCSPResponder.RedirectToCanonical,
+			stats,
+		)
 
 		httpMonitor := metrics.NewHTTPMonitor(stats, m, "OCSP")
 		srv := &http.Server{
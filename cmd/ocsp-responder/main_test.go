@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
 
 	"github.com/letsencrypt/boulder/core"
@@ -34,7 +36,7 @@ func TestHandler(t *testing.T) {
 	src := make(cfocsp.InMemorySource)
 	src[ocspReq.SerialNumber.String()] = resp
 
-	h := cfocsp.NewResponder(src)
+	h := newResponder(src, clock.NewFake(), blog.GetAuditLogger())
 	w := httptest.NewRecorder()
 	r, err := http.NewRequest("POST", "/", bytes.NewReader(req))
 	if err != nil {
@@ -52,10 +54,7 @@ func TestHandler(t *testing.T) {
 func TestDBHandler(t *testing.T) {
 	dbMap, err := sa.NewDbMap(vars.DBConnSAOcspResp)
 	test.AssertNotError(t, err, "Could not connect to database")
-	src, err := makeDBSource(dbMap, "./testdata/test-ca.der.pem", blog.GetAuditLogger())
-	if err != nil {
-		t.Fatalf("makeDBSource: %s", err)
-	}
+	src := NewSourceFromDatabase(dbMap, blog.GetAuditLogger())
 	defer test.ResetSATestDatabase(t)
 
 	ocspResp, err := ocsp.ParseResponse(resp, nil)
@@ -68,7 +67,7 @@ func TestDBHandler(t *testing.T) {
 		OCSPLastUpdated: time.Now(),
 		OCSPResponse:    resp,
 	}
-	setupDBMap, err := sa.NewDbMap("mysql+tcp://test_setup@localhost:3306/boulder_sa_test")
+	setupDBMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,7 +76,7 @@ func TestDBHandler(t *testing.T) {
 		t.Fatalf("unable to insert response: %s", err)
 	}
 
-	h := cfocsp.NewResponder(src)
+	h := newResponder(src, clock.NewFake(), blog.GetAuditLogger())
 	w := httptest.NewRecorder()
 	r, err := http.NewRequest("POST", "/", bytes.NewReader(req))
 	if err != nil {
@@ -90,20 +89,29 @@ func TestDBHandler(t *testing.T) {
 	if !bytes.Equal(w.Body.Bytes(), resp) {
 		t.Errorf("Mismatched body: want %#v, got %#v", resp, w.Body.Bytes())
 	}
+
+	stored, err := src.certificateStatus(status.Serial)
+	test.AssertNotError(t, err, "Failed to get certificate status")
+	test.AssertEquals(t, stored.Serial, status.Serial)
+	test.AssertEquals(t, stored.Status, status.Status)
+	_, err = src.certificateStatus("00000000000000000000000000000000")
+	test.AssertEquals(t, err, sql.ErrNoRows)
 }
 
-// brokenSelector allows us to test what happens when gorp SelectOne statements
+// brokenSelector allows us to test what happens when gorp Select statements
 // throw errors and satisfies the dbSelector interface
 type brokenSelector struct{}
 
+func (bs brokenSelector) Select(_ interface{}, _ string, _ ...interface{}) ([]interface{}, error) {
+	return nil, fmt.Errorf("Failure!")
+}
+
 func (bs brokenSelector) SelectOne(_ interface{}, _ string, _ ...interface{}) error {
 	return fmt.Errorf("Failure!")
 }
 
 func TestErrorLog(t *testing.T) {
-	src, err := makeDBSource(brokenSelector{}, "./testdata/test-ca.der.pem", blog.GetAuditLogger())
-	test.AssertNotError(t, err, "Failed to create broken dbMap")
-
+	src := NewSourceFromDatabase(brokenSelector{}, blog.GetAuditLogger())
 	src.log.SyslogWriter = mocks.NewSyslogWriter()
 	mockLog := src.log.SyslogWriter.(*mocks.SyslogWriter)
 
@@ -0,0 +1,71 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// normalizer rewrites the paths of GET requests to the canonical encoding of
+// the OCSP request they carry, see core.CanonicalOCSPRequest, so that requests
+// encoded with the URL-safe base64 alphabet, without padding or with a nonce
+// can all be answered. With redirect set clients are instead redirected to the
+// canonical path, so that a CDN in front of the responder caches one response
+// per certificate, under the URLs the OCSP updater purges, however clients
+// encode their requests.
+type normalizer struct {
+	handler  http.Handler
+	prefix   string
+	redirect bool
+	stats    statsd.Statter
+}
+
+func newNormalizer(prefix string, handler http.Handler, redirect bool, stats statsd.Statter) *normalizer {
+	return &normalizer{
+		handler:  handler,
+		prefix:   prefix,
+		redirect: redirect,
+		stats:    stats,
+	}
+}
+
+func (n *normalizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, n.prefix) {
+		n.handler.ServeHTTP(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, n.prefix)
+	// Requests that can't be decoded are left for the handler to reject
+	der, err := core.DecodeOCSPRequestPath(path)
+	if err != nil {
+		n.handler.ServeHTTP(w, r)
+		return
+	}
+	canonical, err := core.CanonicalOCSPRequest(der)
+	if err != nil {
+		n.handler.ServeHTTP(w, r)
+		return
+	}
+	if path == base64.StdEncoding.EncodeToString(canonical) {
+		n.handler.ServeHTTP(w, r)
+		return
+	}
+
+	n.stats.Inc("OCSP.NormalizedRequests", 1, 1.0)
+	if n.redirect {
+		http.Redirect(w, r, n.prefix+core.OCSPRequestPath(canonical), http.StatusMovedPermanently)
+		return
+	}
+	r.URL.Path = n.prefix + base64.StdEncoding.EncodeToString(canonical)
+	r.URL.RawPath = ""
+	n.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// tbsRequestWithNonce is an OCSP request's TBSRequest with its list of
+// requests left encoded and a nonce extension
+type tbsRequestWithNonce struct {
+	RequestList asn1.RawValue
+	Extensions  []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+// addNonce returns the OCSP request der with a nonce extension added, as
+// OpenSSL sends by default
+func addNonce(t *testing.T, der []byte) []byte {
+	var req struct {
+		TBSRequest tbsRequestWithNonce
+	}
+	_, err := asn1.Unmarshal(der, &req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	req.TBSRequest.Extensions = []pkix.Extension{{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2},
+		Value: []byte{4, 4, 1, 2, 3, 4},
+	}}
+	withNonce, err := asn1.Marshal(req)
+	test.AssertNotError(t, err, "Failed to marshal OCSP request")
+	return withNonce
+}
+
+func TestNormalizer(t *testing.T) {
+	ocspReq, err := ocsp.ParseRequest(req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+	src := cfocsp.InMemorySource{ocspReq.SerialNumber.String(): resp}
+	stats, _ := statsd.NewNoopClient(nil)
+	canonical := "/ocsp/" + core.OCSPRequestPath(req)
+
+	for _, redirect := range []bool{false, true} {
+		n := newNormalizer("/ocsp/", http.StripPrefix("/ocsp/", newResponder(src, clock.NewFake(), blog.GetAuditLogger())), redirect, stats)
+		for _, path := range []string{
+			canonical,
+			"/ocsp/" + base64.RawURLEncoding.EncodeToString(req),
+			"/ocsp/" + core.OCSPRequestPath(addNonce(t, req)),
+		} {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", "http://localhost:4002"+path, nil)
+			test.AssertNotError(t, err, "Failed to create request")
+			n.ServeHTTP(w, r)
+			if redirect && path != canonical {
+				test.AssertEquals(t, w.Code, http.StatusMovedPermanently)
+				test.AssertEquals(t, w.Header().Get("Location"), canonical)
+				continue
+			}
+			test.AssertEquals(t, w.Code, http.StatusOK)
+			test.AssertByteEquals(t, w.Body.Bytes(), resp)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	cfocsp "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// responder serves the responses from a Source over HTTP, like cfssl's
+// ocsp.Responder, except that error responses from the Source, such as the
+// tryLater sent for expired responses, are passed on to the client rather
+// than replaced with unauthorized because they can't be parsed.
+//
+// GET requests must have had any path prefix stripped, see http.StripPrefix.
+type responder struct {
+	source cfocsp.Source
+	clk    clock.Clock
+	log    *blog.AuditLogger
+}
+
+func newResponder(source cfocsp.Source, clk clock.Clock, log *blog.AuditLogger) *responder {
+	return &responder{source: source, clk: clk, log: log}
+}
+
+// isErrorResponse returns true if response is one of the unsigned error
+// responses, which have no NextUpdate and which ocsp.ParseResponse rejects.
+func isErrorResponse(response []byte) bool {
+	for _, er := range [][]byte{
+		ocsp.MalformedRequestErrorResponse,
+		ocsp.InternalErrorErrorResponse,
+		ocsp.TryLaterErrorResponse,
+		ocsp.SigRequredErrorResponse,
+		ocsp.UnauthorizedErrorResponse,
+	} {
+		if bytes.Equal(response, er) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs *responder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var err error
+	switch r.Method {
+	case "GET":
+		body, err = core.DecodeOCSPRequestPath(r.URL.Path)
+	case "POST":
+		body, err = ioutil.ReadAll(r.Body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	response, found := rs.source.Response(req)
+	if !found {
+		w.Write(ocsp.UnauthorizedErrorResponse)
+		return
+	}
+	if isErrorResponse(response) {
+		w.Write(response)
+		return
+	}
+	parsed, err := ocsp.ParseResponse(response, nil)
+	if err != nil {
+		rs.log.Err(fmt.Sprintf("Failed to parse OCSP response for serial %s: %s", core.SerialToString(req.SerialNumber), err))
+		w.Write(ocsp.UnauthorizedErrorResponse)
+		return
+	}
+
+	w.Header().Set("Last-Modified", parsed.ProducedAt.Format(time.RFC1123))
+	w.Header().Set("Expires", parsed.NextUpdate.Format(time.RFC1123))
+	if maxAge := int64(parsed.NextUpdate.Sub(rs.clk.Now()) / time.Second); maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge))
+	}
+	w.Write(response)
+}
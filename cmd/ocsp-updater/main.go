@@ -8,21 +8,18 @@ package main
 import (
 	"crypto/x509"
 	"database/sql"
-	"encoding/base64"
 	"fmt"
-	"net/url"
-	"path"
+	"strings"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 
-	"github.com/letsencrypt/boulder/akamai"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/purger"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/sa"
 )
@@ -48,8 +45,13 @@ type OCSPUpdater struct {
 
 	loops []*looper
 
-	ccu    *akamai.CachePurgeClient
-	issuer *x509.Certificate
+	// shard and shardCount pick the certificates this updater works on, see
+	// shardCondition
+	shard      int
+	shardCount int
+
+	purgeQueue *purger.Queue
+	issuer     *x509.Certificate
 }
 
 // This is somewhat gross but can be pared down a bit once the publisher and this
@@ -75,6 +77,24 @@ func newUpdater(
 		config.MissingSCTWindow.Duration == 0 {
 		return nil, fmt.Errorf("Loop window sizes must be non-zero")
 	}
+	if config.AkamaiBaseURL != "" ||
+		config.AkamaiClientToken != "" ||
+		config.AkamaiClientSecret != "" ||
+		config.AkamaiAccessToken != "" ||
+		config.AkamaiPurgeRetries != 0 ||
+		config.AkamaiPurgeRetryBackoff.Duration != 0 {
+		return nil, fmt.Errorf("Akamai purging is no longer configured in the OCSP updater, move it to akamaiPurger.purger and set purgeOCSPResponses")
+	}
+	if config.ShardCount < 0 || config.ShardCount > maxShards {
+		return nil, fmt.Errorf("Shard count must be between 0 and %d", maxShards)
+	}
+	shardCount := config.ShardCount
+	if shardCount == 0 {
+		shardCount = 1
+	}
+	if config.Shard < 0 || config.Shard >= shardCount {
+		return nil, fmt.Errorf("Shard must be between 0 and %d", shardCount-1)
+	}
 
 	log := blog.GetAuditLogger()
 
@@ -89,6 +109,8 @@ func newUpdater(
 		numLogs:             numLogs,
 		ocspMinTimeToExpiry: config.OCSPMinTimeToExpiry.Duration,
 		oldestIssuedSCT:     config.OldestIssuedSCT.Duration,
+		shard:               config.Shard,
+		shardCount:          shardCount,
 	}
 
 	// Setup loops
@@ -138,74 +160,97 @@ func newUpdater(
 		})
 	}
 
-	// TODO(#1050): Remove this gate and the nil ccu checks below
-	if config.AkamaiBaseURL != "" {
+	if config.CertificateEventBatchSize != 0 &&
+		config.CertificateEventWindow.Duration != 0 {
+		updater.loops = append(updater.loops, &looper{
+			clk:                  clk,
+			stats:                stats,
+			batchSize:            config.CertificateEventBatchSize,
+			tickDur:              config.CertificateEventWindow.Duration,
+			tickFunc:             updater.certificateEventsTick,
+			name:                 "CertificateEvents",
+			failureBackoffFactor: config.SignFailureBackoffFactor,
+			failureBackoffMax:    config.SignFailureBackoffMax.Duration,
+		})
+	}
+
+	if config.PurgeOCSPResponses {
 		issuer, err := core.LoadCert(issuerPath)
-		ccu, err := akamai.NewCachePurgeClient(
-			config.AkamaiBaseURL,
-			config.AkamaiClientToken,
-			config.AkamaiClientSecret,
-			config.AkamaiAccessToken,
-			config.AkamaiPurgeRetries,
-			config.AkamaiPurgeRetryBackoff.Duration,
-			log,
-			stats,
-		)
 		if err != nil {
 			return nil, err
 		}
-		updater.ccu = ccu
+		updater.purgeQueue = purger.NewQueue(dbMap, clk)
 		updater.issuer = issuer
 	}
 
 	return &updater, nil
 }
 
-// sendPurge should only be called as a Goroutine as it will block until the purge
-// request is successful
-func (updater *OCSPUpdater) sendPurge(der []byte) {
+// queuePurge queues the GET URLs the CDN may have cached the OCSP response for
+// der under, at each of its OCSP servers, to be purged by the akamai-purger
+func (updater *OCSPUpdater) queuePurge(der []byte) {
 	cert, err := x509.ParseCertificate(der)
 	if err != nil {
 		updater.log.AuditErr(fmt.Errorf("Failed to parse certificate for cache purge: %s", err))
 		return
 	}
 
-	req, err := ocsp.CreateRequest(cert, updater.issuer, nil)
+	urls, err := purger.OCSPURLs(cert, updater.issuer)
 	if err != nil {
-		updater.log.AuditErr(fmt.Errorf("Failed to create OCSP request for cache purge: %s", err))
+		updater.log.AuditErr(fmt.Errorf("Failed to create OCSP requests for cache purge: %s", err))
 		return
 	}
 
-	// Create a GET style OCSP url for each endpoint in cert.OCSPServer (still waiting
-	// on word from Akamai on how to properly purge cached POST requests, for now just
-	// do GET)
-	urls := []string{}
-	for _, ocspServer := range cert.OCSPServer {
-		urls = append(
-			urls,
-			path.Join(ocspServer, url.QueryEscape(base64.StdEncoding.EncodeToString(req))),
-		)
+	err = updater.purgeQueue.Add(urls)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.QueuePurge", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to queue OCSP response cache purge: %s", err))
 	}
+}
 
-	err = updater.ccu.Purge(urls)
-	if err != nil {
-		updater.log.AuditErr(fmt.Errorf("Failed to purge OCSP response from CDN: %s", err))
+// maxShards is the number of distinct values of the last two hex digits of a
+// serial, which shardCondition splits certificates by
+const maxShards = 256
+
+// shardCondition returns a WHERE clause condition, starting with AND, that
+// matches the serials in column belonging to this updater's shard, or an empty
+// string if there is only one shard. Serials are assigned to shards by the
+// value of their last two hex digits modulo the number of shards, which spreads
+// them evenly since the CA picks serials at random.
+func (updater *OCSPUpdater) shardCondition(column string) string {
+	if updater.shardCount <= 1 {
+		return ""
+	}
+	var suffixes []string
+	for i := updater.shard; i < maxShards; i += updater.shardCount {
+		suffixes = append(suffixes, fmt.Sprintf("'%02x'", i))
 	}
+	return fmt.Sprintf(" AND SUBSTR(%s, LENGTH(%s) - 1, 2) IN (%s)", column, column, strings.Join(suffixes, ","))
+}
+
+// lagStat returns the name of the gauge reporting how many seconds behind the
+// named loop is, which is per shard when there is more than one
+func (updater *OCSPUpdater) lagStat(loop string) string {
+	if updater.shardCount <= 1 {
+		return fmt.Sprintf("OCSP.%s.Lag", loop)
+	}
+	return fmt.Sprintf("OCSP.%s.Shard%d.Lag", loop, updater.shard)
 }
 
 func (updater *OCSPUpdater) findStaleOCSPResponses(oldestLastUpdatedTime time.Time, batchSize int) ([]core.CertificateStatus, error) {
 	var statuses []core.CertificateStatus
 	_, err := updater.dbMap.Select(
 		&statuses,
-		`SELECT cs.*
+		fmt.Sprintf(`SELECT cs.*
 			 FROM certificateStatus AS cs
 			 JOIN certificates AS cert
 			 ON cs.serial = cert.serial
 			 WHERE cs.ocspLastUpdated < :lastUpdate
-			 AND cert.expires > now()
+			 AND cert.expires > :now%s
 			 ORDER BY cs.ocspLastUpdated ASC
-			 LIMIT :limit`,
+			 LIMIT :limit`, updater.shardCondition("cs.serial")),
 		map[string]interface{}{
+			"now":        updater.clk.Now(),
 			"lastUpdate": oldestLastUpdatedTime,
 			"limit":      batchSize,
 		},
@@ -220,10 +265,11 @@ func (updater *OCSPUpdater) getCertificatesWithMissingResponses(batchSize int) (
 	var statuses []core.CertificateStatus
 	_, err := updater.dbMap.Select(
 		&statuses,
-		`SELECT * FROM certificateStatus
-			 WHERE ocspLastUpdated = 0
-			 LIMIT :limit`,
+		fmt.Sprintf(`SELECT * FROM certificateStatus
+			 WHERE ocspLastUpdated = :zero%s
+			 LIMIT :limit`, updater.shardCondition("serial")),
 		map[string]interface{}{
+			"zero":  time.Time{},
 			"limit": batchSize,
 		},
 	)
@@ -269,9 +315,9 @@ func (updater *OCSPUpdater) generateResponse(status core.CertificateStatus) (*co
 	status.OCSPLastUpdated = updater.clk.Now()
 	status.OCSPResponse = ocspResponse
 
-	// Purge OCSP response from CDN, gated on client having been initialized
-	if updater.ccu != nil {
-		go updater.sendPurge(cert.DER)
+	// Purge OCSP response from CDN, gated on purging having been configured
+	if updater.purgeQueue != nil {
+		updater.queuePurge(cert.DER)
 	}
 
 	return &status, nil
@@ -299,9 +345,9 @@ func (updater *OCSPUpdater) generateRevokedResponse(status core.CertificateStatu
 	status.OCSPLastUpdated = now
 	status.OCSPResponse = ocspResponse
 
-	// Purge OCSP response from CDN, gated on client having been initialized
-	if updater.ccu != nil {
-		go updater.sendPurge(cert.DER)
+	// Purge OCSP response from CDN, gated on purging having been configured
+	if updater.purgeQueue != nil {
+		updater.queuePurge(cert.DER)
 	}
 
 	return &status, nil
@@ -313,10 +359,10 @@ func (updater *OCSPUpdater) storeResponse(status *core.CertificateStatus) error
 	// containing a 'good' status and that we don't do the inverse when the OCSP
 	// status should be 'good'.
 	_, err := updater.dbMap.Exec(
-		`UPDATE certificateStatus
+		sa.Rebind(updater.dbMap, `UPDATE certificateStatus
 		 SET ocspResponse=?,ocspLastUpdated=?
 		 WHERE serial=?
-		 AND status=?`,
+		 AND status=?`),
 		status.OCSPResponse,
 		status.OCSPLastUpdated,
 		status.Serial,
@@ -344,10 +390,10 @@ func (updater *OCSPUpdater) findRevokedCertificatesToUpdate(batchSize int) ([]co
 	var statuses []core.CertificateStatus
 	_, err := updater.dbMap.Select(
 		&statuses,
-		`SELECT * FROM certificateStatus
+		fmt.Sprintf(`SELECT * FROM certificateStatus
 		 WHERE status = :revoked
-		 AND ocspLastUpdated <= revokedDate
-		 LIMIT :limit`,
+		 AND ocspLastUpdated <= revokedDate%s
+		 LIMIT :limit`, updater.shardCondition("serial")),
 		map[string]interface{}{
 			"revoked": string(core.OCSPStatusRevoked),
 			"limit":   batchSize,
@@ -381,6 +427,102 @@ func (updater *OCSPUpdater) revokedCertificatesTick(batchSize int) error {
 	return nil
 }
 
+// certificateEvent is a row of the certificateEvents table, which the SA
+// writes to in the same transaction as it issues or revokes a certificate
+type certificateEvent struct {
+	ID      int64     `db:"id"`
+	Serial  string    `db:"serial"`
+	Type    string    `db:"type"`
+	Created time.Time `db:"created"`
+}
+
+func (updater *OCSPUpdater) findCertificateEvents(batchSize int) ([]certificateEvent, error) {
+	var events []certificateEvent
+	_, err := updater.dbMap.Select(
+		&events,
+		// shardCondition starts with AND, so give it something to follow
+		fmt.Sprintf(`SELECT * FROM certificateEvents
+		 WHERE 1 = 1%s
+		 ORDER BY id ASC
+		 LIMIT :limit`, updater.shardCondition("serial")),
+		map[string]interface{}{"limit": batchSize},
+	)
+	if err == sql.ErrNoRows {
+		return events, nil
+	}
+	return events, err
+}
+
+func (updater *OCSPUpdater) deleteCertificateEvent(id int64) error {
+	_, err := updater.dbMap.Exec(sa.Rebind(updater.dbMap, "DELETE FROM certificateEvents WHERE id = ?"), id)
+	return err
+}
+
+// certificateEventsTick signs and stores a response for each certificate the
+// SA has issued or revoked since the last tick, so that new certificates and
+// revocations don't have to wait for the newCertificateTick and
+// revokedCertificatesTick sweeps. Those sweeps still find anything an event was
+// missed or failed for, so an event is only kept for a later tick when the CA
+// is unavailable.
+func (updater *OCSPUpdater) certificateEventsTick(batchSize int) error {
+	events, err := updater.findCertificateEvents(batchSize)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.FindCertificateEvents", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to find certificate events: %s", err))
+		return err
+	}
+
+	var lag time.Duration
+	if len(events) > 0 {
+		lag = updater.clk.Now().Sub(events[0].Created)
+	}
+	updater.stats.Gauge(updater.lagStat("CertificateEvents"), int64(lag.Seconds()), 1.0)
+
+	for _, event := range events {
+		err = updater.handleCertificateEvent(event)
+		if _, ok := err.(core.ServiceUnavailableError); ok {
+			return err
+		}
+		if err = updater.deleteCertificateEvent(event.ID); err != nil {
+			updater.stats.Inc("OCSP.Errors.DeleteCertificateEvent", 1, 1.0)
+			updater.log.AuditErr(fmt.Errorf("Failed to delete certificate event %d: %s", event.ID, err))
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCertificateEvent signs and stores a response reflecting the current
+// status of the certificate event names
+func (updater *OCSPUpdater) handleCertificateEvent(event certificateEvent) error {
+	var status core.CertificateStatus
+	err := updater.dbMap.SelectOne(
+		&status,
+		"SELECT * FROM certificateStatus WHERE serial = :serial",
+		map[string]interface{}{"serial": event.Serial},
+	)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.CertificateEventStatus", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to get status for %s certificate event for serial %s: %s", event.Type, event.Serial, err))
+		return err
+	}
+
+	meta, err := updater.generateResponse(status)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.CertificateEventResponseGeneration", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to generate OCSP response for %s certificate event for serial %s: %s", event.Type, event.Serial, err))
+		return err
+	}
+	err = updater.storeResponse(meta)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.StoreCertificateEventResponse", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to store OCSP response for serial %s: %s", event.Serial, err))
+		return err
+	}
+	updater.stats.Inc(fmt.Sprintf("OCSP.CertificateEvents.%s", event.Type), 1, 1.0)
+	return nil
+}
+
 func (updater *OCSPUpdater) generateOCSPResponses(statuses []core.CertificateStatus) error {
 	for _, status := range statuses {
 		meta, err := updater.generateResponse(status)
@@ -412,6 +554,14 @@ func (updater *OCSPUpdater) oldOCSPResponsesTick(batchSize int) error {
 		return err
 	}
 
+	// The oldest stale response comes first, report how long it has been
+	// stale for
+	var lag time.Duration
+	if len(statuses) > 0 {
+		lag = now.Add(-updater.ocspMinTimeToExpiry).Sub(statuses[0].OCSPLastUpdated)
+	}
+	updater.stats.Gauge(updater.lagStat("OldOCSPResponses"), int64(lag.Seconds()), 1.0)
+
 	return updater.generateOCSPResponses(statuses)
 }
 
@@ -419,10 +569,10 @@ func (updater *OCSPUpdater) getSerialsIssuedSince(since time.Time, batchSize int
 	var serials []string
 	_, err := updater.dbMap.Select(
 		&serials,
-		`SELECT serial FROM certificates
-			 WHERE issued > :since
+		fmt.Sprintf(`SELECT serial FROM certificates
+			 WHERE issued > :since%s
 			 ORDER BY issued ASC
-			 LIMIT :limit`,
+			 LIMIT :limit`, updater.shardCondition("serial")),
 		map[string]interface{}{
 			"since": since,
 			"limit": batchSize,
@@ -2,6 +2,9 @@ package main
 
 import (
 	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/purger"
 	"github.com/letsencrypt/boulder/sa"
 	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
@@ -256,6 +260,30 @@ func TestMissingReceiptsTick(t *testing.T) {
 	test.AssertEquals(t, count, 1)
 }
 
+func TestQueuePurge(t *testing.T) {
+	updater, _, _, fc, cleanUp := setup(t)
+	defer cleanUp()
+	// The SA's database user can't add to the purge queue
+	fullDbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Failed to create dbMap")
+	updater.purgeQueue = purger.NewQueue(fullDbMap, fc)
+	updater.issuer, err = core.LoadCert("../../test/test-ca.pem")
+	test.AssertNotError(t, err, "Couldn't read issuer certificate")
+
+	certDER, err := ioutil.ReadFile("../../sa/test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	updater.queuePurge(certDER)
+
+	cert, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Couldn't parse test certificate")
+	expected, err := purger.OCSPURLs(cert, updater.issuer)
+	test.AssertNotError(t, err, "Failed to generate OCSP URLs")
+	var urls []string
+	_, err = fullDbMap.Select(&urls, "SELECT url FROM purgeQueue ORDER BY id")
+	test.AssertNotError(t, err, "Failed to get queued purges")
+	test.AssertEquals(t, strings.Join(urls, " "), strings.Join(expected, " "))
+}
+
 func TestRevokedCertificatesTick(t *testing.T) {
 	updater, sa, _, _, cleanUp := setup(t)
 	defer cleanUp()
@@ -281,6 +309,156 @@ func TestRevokedCertificatesTick(t *testing.T) {
 	test.Assert(t, len(status.OCSPResponse) != 0, "Certificate status doesn't contain OCSP response")
 }
 
+// unavailableCA fails every signing request as though its HSM were down
+type unavailableCA struct {
+	mockCA
+}
+
+func (ca *unavailableCA) GenerateOCSP(xferObj core.OCSPSigningRequest) ([]byte, error) {
+	return nil, core.ServiceUnavailableError("sad HSM")
+}
+
+func TestCertificateEventsTick(t *testing.T) {
+	updater, ssa, _, _, cleanUp := setup(t)
+	defer cleanUp()
+	// The updater deletes the events it has handled, which the SA's database
+	// user can't do
+	fullDbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Failed to create dbMap")
+	updater.dbMap = fullDbMap
+	ssa.(*sa.SQLStorageAuthority).RecordCertificateEvents = true
+
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	parsedCert, err := core.LoadCert("test-cert.pem")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	serial := core.SerialToString(parsedCert.SerialNumber)
+	_, err = ssa.AddCertificate(parsedCert.Raw, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
+
+	events, err := updater.findCertificateEvents(10)
+	test.AssertNotError(t, err, "Failed to find certificate events")
+	test.AssertEquals(t, len(events), 1)
+	test.AssertEquals(t, events[0].Serial, serial)
+	test.AssertEquals(t, events[0].Type, "issued")
+
+	// While the CA is unavailable events are kept for the next tick
+	updater.cac = &unavailableCA{}
+	err = updater.certificateEventsTick(10)
+	test.AssertError(t, err, "Tick didn't fail with the CA unavailable")
+	_, ok := err.(core.ServiceUnavailableError)
+	test.Assert(t, ok, "Tick didn't return the CA's error")
+	events, err = updater.findCertificateEvents(10)
+	test.AssertNotError(t, err, "Failed to find certificate events")
+	test.AssertEquals(t, len(events), 1)
+
+	updater.cac = &mockCA{}
+	err = updater.certificateEventsTick(10)
+	test.AssertNotError(t, err, "Failed to handle certificate events")
+	status, err := ssa.GetCertificateStatus(serial)
+	test.AssertNotError(t, err, "Failed to get certificate status")
+	test.AssertByteEquals(t, status.OCSPResponse, []byte{1, 2, 3})
+	events, err = updater.findCertificateEvents(10)
+	test.AssertNotError(t, err, "Failed to find certificate events")
+	test.AssertEquals(t, len(events), 0)
+
+	// A revocation gets a revoked response without waiting for the
+	// revokedCertificatesTick sweep
+	err = ssa.MarkCertificateRevoked(serial, core.RevocationCode(1))
+	test.AssertNotError(t, err, "Failed to revoke certificate")
+	err = updater.certificateEventsTick(10)
+	test.AssertNotError(t, err, "Failed to handle certificate events")
+	status, err = ssa.GetCertificateStatus(serial)
+	test.AssertNotError(t, err, "Failed to get certificate status")
+	test.AssertEquals(t, status.Status, core.OCSPStatusRevoked)
+	test.Assert(t, !status.OCSPLastUpdated.Before(status.RevokedDate), "Revoked response wasn't stored")
+	events, err = updater.findCertificateEvents(10)
+	test.AssertNotError(t, err, "Failed to find certificate events")
+	test.AssertEquals(t, len(events), 0)
+}
+
+func TestShardCondition(t *testing.T) {
+	updater := &OCSPUpdater{shardCount: 1}
+	test.AssertEquals(t, updater.shardCondition("serial"), "")
+
+	updater = &OCSPUpdater{shard: 1, shardCount: 64}
+	test.AssertEquals(t, updater.shardCondition("cs.serial"),
+		" AND SUBSTR(cs.serial, LENGTH(cs.serial) - 1, 2) IN ('01','41','81','c1')")
+
+	updater = &OCSPUpdater{shard: 255, shardCount: 256}
+	test.AssertEquals(t, updater.shardCondition("serial"),
+		" AND SUBSTR(serial, LENGTH(serial) - 1, 2) IN ('ff')")
+}
+
+func TestAkamaiConfigRejected(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	config := cmd.OCSPUpdaterConfig{
+		NewCertificateBatchSize: 1,
+		OldOCSPBatchSize:        1,
+		MissingSCTBatchSize:     1,
+		NewCertificateWindow:    cmd.ConfigDuration{Duration: time.Second},
+		OldOCSPWindow:           cmd.ConfigDuration{Duration: time.Second},
+		MissingSCTWindow:        cmd.ConfigDuration{Duration: time.Second},
+		AkamaiBaseURL:           "https://akamai.example.com",
+	}
+	_, err := newUpdater(stats, clock.NewFake(), nil, nil, nil, nil, config, 0, "")
+	test.AssertError(t, err, "Accepted the old Akamai purging config")
+}
+
+func TestShardConfig(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	config := cmd.OCSPUpdaterConfig{
+		NewCertificateBatchSize: 1,
+		OldOCSPBatchSize:        1,
+		MissingSCTBatchSize:     1,
+		NewCertificateWindow:    cmd.ConfigDuration{Duration: time.Second},
+		OldOCSPWindow:           cmd.ConfigDuration{Duration: time.Second},
+		MissingSCTWindow:        cmd.ConfigDuration{Duration: time.Second},
+	}
+	for _, shards := range [][2]int{{1, 1}, {2, 2}, {-1, 2}, {0, 257}} {
+		config.Shard, config.ShardCount = shards[0], shards[1]
+		_, err := newUpdater(stats, clock.NewFake(), nil, nil, nil, nil, config, 0, "")
+		test.AssertError(t, err, fmt.Sprintf("Accepted shard %d of %d", shards[0], shards[1]))
+	}
+	config.Shard, config.ShardCount = 3, 4
+	updater, err := newUpdater(stats, clock.NewFake(), nil, nil, nil, nil, config, 0, "")
+	test.AssertNotError(t, err, "Failed to create sharded updater")
+	test.AssertEquals(t, updater.lagStat("OldOCSPResponses"), "OCSP.OldOCSPResponses.Shard3.Lag")
+}
+
+func TestShardedUpdaters(t *testing.T) {
+	updater, ssa, _, _, cleanUp := setup(t)
+	defer cleanUp()
+	ssa.(*sa.SQLStorageAuthority).RecordCertificateEvents = true
+
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	parsedCert, err := core.LoadCert("test-cert.pem")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	_, err = ssa.AddCertificate(parsedCert.Raw, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
+	err = ssa.MarkCertificateRevoked(core.SerialToString(parsedCert.SerialNumber), core.RevocationCode(1))
+	test.AssertNotError(t, err, "Failed to revoke certificate")
+
+	// The certificate's serial is 0xee, which is in the third of four shards and
+	// no other
+	for shard, want := range []int{0, 0, 1, 0} {
+		sharded := *updater
+		sharded.shard, sharded.shardCount = shard, 4
+
+		statuses, err := sharded.getCertificatesWithMissingResponses(10)
+		test.AssertNotError(t, err, "Failed to find certificates with missing responses")
+		test.AssertEquals(t, len(statuses), want)
+		statuses, err = sharded.findRevokedCertificatesToUpdate(10)
+		test.AssertNotError(t, err, "Failed to find revoked certificates")
+		test.AssertEquals(t, len(statuses), want)
+		serials, err := sharded.getSerialsIssuedSince(time.Time{}, 10)
+		test.AssertNotError(t, err, "Failed to find issued certificates")
+		test.AssertEquals(t, len(serials), want)
+		events, err := sharded.findCertificateEvents(10)
+		test.AssertNotError(t, err, "Failed to find certificate events")
+		test.AssertEquals(t, len(events), 2*want)
+	}
+}
+
 func TestStoreResponseGuard(t *testing.T) {
 	updater, sa, _, _, cleanUp := setup(t)
 	defer cleanUp()
@@ -0,0 +1,203 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/rpc"
+)
+
+const clientName = "RateLimitOverrides"
+
+func loadConfig(c *cli.Context) (config cmd.Config, err error) {
+	configFileName := c.GlobalString("config")
+	configJSON, err := ioutil.ReadFile(configFileName)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(configJSON, &config)
+	return
+}
+
+func setupContext(c *cli.Context) *rpc.StorageAuthorityClient {
+	config, err := loadConfig(c)
+	cmd.FailOnError(err, "Failed to load Boulder configuration")
+	stats, _ := cmd.StatsAndLogging(config.Statsd, config.Syslog)
+
+	sac, err := rpc.NewStorageAuthorityClient(clientName, config.RateLimitOverrides.AMQP, stats)
+	cmd.FailOnError(err, "Failed to create SA client")
+	return sac
+}
+
+// parseExpiry parses an expiry given either as a date, meaning midnight UTC at
+// the start of that day, or as an RFC 3339 timestamp. The expiry must be in
+// the future.
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	expires, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		expires, err = time.Parse(time.RFC3339, s)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiry %q must be a date (YYYY-MM-DD) or an RFC 3339 timestamp", s)
+	}
+	if !expires.After(now) {
+		return time.Time{}, fmt.Errorf("expiry %s is in the past", expires.Format(time.RFC3339))
+	}
+	return expires.UTC(), nil
+}
+
+// overrideFromFlags builds the override described by the add command's flags
+// and validates it.
+func overrideFromFlags(c *cli.Context, now time.Time) (core.RateLimitOverride, error) {
+	expires, err := parseExpiry(c.String("expires"), now)
+	if err != nil {
+		return core.RateLimitOverride{}, err
+	}
+	owner := c.String("owner")
+	if owner == "" {
+		if u, err := user.Current(); err == nil {
+			owner = u.Username
+		}
+	}
+	override := core.RateLimitOverride{
+		LimitName:      c.String("limit"),
+		Key:            c.String("key"),
+		RegistrationID: int64(c.Int("registration")),
+		Threshold:      c.Int("threshold"),
+		Owner:          owner,
+		Reason:         c.String("reason"),
+		Expires:        expires,
+	}
+	return override, cmd.ValidateRateLimitOverride(override)
+}
+
+// printOverrides writes overrides to w as a table.
+func printOverrides(w io.Writer, overrides []core.RateLimitOverride) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLIMIT\tAPPLIES TO\tTHRESHOLD\tEXPIRES\tOWNER\tREASON")
+	for _, o := range overrides {
+		appliesTo := o.Key
+		if o.RegistrationID != 0 {
+			appliesTo = fmt.Sprintf("registration %d", o.RegistrationID)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			o.ID, o.LimitName, appliesTo, o.Threshold, o.Expires.Format(time.RFC3339), o.Owner, o.Reason)
+	}
+	tw.Flush()
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "rate-limit-overrides"
+	app.Usage = "Manages the rate limit overrides stored in the database, which the RA applies on top of its rate limit policies"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "add",
+			Usage: "Add an override for a key or a registration",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "limit",
+					Usage: "Name of the rate limit, as in the policies file, e.g. certificatesPerName",
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "Key the limit counts on, e.g. a registered domain for certificatesPerName",
+				},
+				cli.IntFlag{
+					Name:  "registration",
+					Usage: "ID of the registration to override the limit for, instead of a key",
+				},
+				cli.IntFlag{
+					Name:  "threshold",
+					Usage: "Threshold to apply instead of the limit's default",
+				},
+				cli.StringFlag{
+					Name:  "owner",
+					Usage: "Who asked for the override. Defaults to the current user",
+				},
+				cli.StringFlag{
+					Name:  "reason",
+					Usage: "Why the override is needed",
+				},
+				cli.StringFlag{
+					Name:  "expires",
+					Usage: "When the override lapses, as a date (YYYY-MM-DD) or an RFC 3339 timestamp",
+				},
+			},
+			Action: func(c *cli.Context) {
+				override, err := overrideFromFlags(c, clock.Default().Now())
+				cmd.FailOnError(err, "Invalid override")
+
+				sac := setupContext(c)
+				override, err = sac.AddRateLimitOverride(override)
+				cmd.FailOnError(err, "Couldn't add override")
+				printOverrides(os.Stdout, []core.RateLimitOverride{override})
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "List the overrides that have not expired",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Include overrides that have expired",
+				},
+			},
+			Action: func(c *cli.Context) {
+				asOf := clock.Default().Now()
+				if c.Bool("all") {
+					asOf = time.Time{}
+				}
+
+				sac := setupContext(c)
+				overrides, err := sac.GetRateLimitOverrides(asOf)
+				cmd.FailOnError(err, "Couldn't list overrides")
+				printOverrides(os.Stdout, overrides)
+			},
+		},
+		{
+			Name:  "expire",
+			Usage: "Expire the override with the given ID now",
+			Action: func(c *cli.Context) {
+				id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+				cmd.FailOnError(err, "Override ID argument must be an integer")
+
+				sac := setupContext(c)
+				err = sac.ExpireRateLimitOverride(id)
+				cmd.FailOnError(err, "Couldn't expire override")
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	cmd.FailOnError(err, "Failed to run application")
+}
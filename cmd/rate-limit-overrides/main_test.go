@@ -0,0 +1,62 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2016, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	expires, err := parseExpiry("2017-01-01", now)
+	test.AssertNotError(t, err, "Couldn't parse date")
+	test.AssertEquals(t, expires, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	expires, err = parseExpiry("2016-10-21T09:30:00-07:00", now)
+	test.AssertNotError(t, err, "Couldn't parse timestamp")
+	test.AssertEquals(t, expires, time.Date(2016, 10, 21, 16, 30, 0, 0, time.UTC))
+
+	_, err = parseExpiry("next tuesday", now)
+	test.AssertError(t, err, "Parsed nonsense expiry")
+	_, err = parseExpiry("2016-10-20", now)
+	test.AssertError(t, err, "Accepted expiry in the past")
+}
+
+func TestPrintOverrides(t *testing.T) {
+	var out bytes.Buffer
+	printOverrides(&out, []core.RateLimitOverride{
+		{
+			ID:        1,
+			LimitName: "certificatesPerName",
+			Key:       "example.com",
+			Threshold: 1000,
+			Owner:     "alice",
+			Reason:    "hosting partner",
+			Expires:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:             2,
+			LimitName:      "certificatesPerName",
+			RegistrationID: 7,
+			Threshold:      500,
+			Owner:          "bob",
+			Reason:         "integrator",
+			Expires:        time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+	})
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	test.AssertEquals(t, len(lines), 3)
+	test.Assert(t, strings.Contains(lines[1], "example.com"), "Key missing from output")
+	test.Assert(t, strings.Contains(lines[2], "registration 7"), "Registration missing from output")
+	test.Assert(t, strings.Contains(lines[2], "2017-02-01T00:00:00Z"), "Expiry missing from output")
+}
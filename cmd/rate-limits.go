@@ -1,9 +1,20 @@
 package cmd
 
 import (
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/yaml.v2"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/yaml.v2"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
 )
 
 // RateLimitConfig contains all application layer rate limiting policies
@@ -17,6 +28,11 @@ type RateLimitConfig struct {
 	// These are counted by "base domain" aka eTLD+1, so any entries in the
 	// overrides section must be an eTLD+1 according to the publicsuffix package.
 	CertificatesPerName RateLimitPolicy `yaml:"certificatesPerName"`
+	// Number of certificates that can be issued for exactly the same set of
+	// names, regardless of order or case. Renewals are exempt from
+	// CertificatesPerName and counted here instead. Overrides are keyed by
+	// the lowercased names, sorted and joined with commas.
+	CertificatesPerFQDNSet RateLimitPolicy `yaml:"certificatesPerFQDNSet"`
 	// Number of registrations that can be created per IP.
 	// Note: Since this is checked before a registration is created, setting a
 	// RegistrationOverride on it has no effect.
@@ -24,6 +40,9 @@ type RateLimitConfig struct {
 	// Number of pending authorizations that can exist per account. Overrides by
 	// key are not applied, but overrides by registration are.
 	PendingAuthorizationsPerAccount RateLimitPolicy `yaml:"pendingAuthorizationsPerAccount"`
+	// Number of authorizations for a given hostname that can fail validation
+	// per account. Overrides are keyed by the lowercased hostname.
+	InvalidAuthorizationsPerAccount RateLimitPolicy `yaml:"invalidAuthorizationsPerAccount"`
 }
 
 // RateLimitPolicy describes a general limiting policy
@@ -39,13 +58,18 @@ type RateLimitPolicy struct {
 	// a key, while a rate limit on the number of registrations per IP subnet would
 	// use subnet as a key.
 	// Note that a zero entry in the overrides map does not mean "not limit," it
-	// means a limit of zero.
+	// means a limit of zero. Overrides stored in the database with the
+	// rate-limit-overrides tool take priority over these.
 	Overrides map[string]int `yaml:"overrides"`
 	// A per-registration override setting. This can be used, e.g. if there are
 	// hosting providers that we would like to grant a higher rate of issuance
 	// than the default. If both key-based and registration-based overrides are
 	// available, the registration-based on takes priority.
 	RegistrationOverrides map[int64]int `yaml:"registrationOverrides"`
+	// In shadow mode, requests over the threshold are logged and counted as
+	// "ShadowExceeded" but allowed to proceed. This allows new thresholds to be
+	// trialled before they are enforced.
+	Shadow bool `yaml:"shadow"`
 }
 
 // Enabled returns true iff the RateLimitPolicy is enabled.
@@ -71,8 +95,184 @@ func (rlp *RateLimitPolicy) WindowBegin(windowEnd time.Time) time.Time {
 	return windowEnd.Add(-1 * rlp.Window.Duration)
 }
 
+// validate checks the policy's threshold, window and overrides. keyOK, if
+// non-nil, returns an error for any override key the policy can't match.
+func (rlp *RateLimitPolicy) validate(needsWindow bool, keyOK func(string) error) error {
+	if rlp.Threshold < 0 {
+		return fmt.Errorf("negative threshold %d", rlp.Threshold)
+	}
+	if needsWindow && rlp.Enabled() && rlp.Window.Duration <= 0 {
+		return fmt.Errorf("window must be positive, got %s", rlp.Window.Duration)
+	}
+	for key, threshold := range rlp.Overrides {
+		if threshold < 0 {
+			return fmt.Errorf("negative override %d for %q", threshold, key)
+		}
+		if keyOK != nil {
+			if err := keyOK(key); err != nil {
+				return fmt.Errorf("override %q: %s", key, err)
+			}
+		}
+	}
+	for regID, threshold := range rlp.RegistrationOverrides {
+		if threshold < 0 {
+			return fmt.Errorf("negative override %d for registration %d", threshold, regID)
+		}
+	}
+	return nil
+}
+
+// namedPolicy is one of the policies in a RateLimitConfig, with the name it
+// has in the YAML and how to check its override keys.
+type namedPolicy struct {
+	name        string
+	policy      *RateLimitPolicy
+	needsWindow bool
+	// keyOK returns an error for an override key the limit can't match. A nil
+	// keyOK means the limit doesn't count by key.
+	keyOK func(string) error
+}
+
+// policies returns every policy in the config, by name.
+func (rlc *RateLimitConfig) policies() []namedPolicy {
+	return []namedPolicy{
+		{"totalCertificates", &rlc.TotalCertificates, true, nil},
+		{"certificatesPerName", &rlc.CertificatesPerName, true, func(key string) error {
+			eTLDPlusOne, err := publicsuffix.EffectiveTLDPlusOne(key)
+			if err != nil {
+				return err
+			}
+			if eTLDPlusOne != key {
+				return fmt.Errorf("not a registered domain, use %q", eTLDPlusOne)
+			}
+			return nil
+		}},
+		{"certificatesPerFQDNSet", &rlc.CertificatesPerFQDNSet, true, func(key string) error {
+			names := core.UniqueLowerNames(strings.Split(key, ","))
+			sort.Strings(names)
+			if canonical := strings.Join(names, ","); canonical != key {
+				return fmt.Errorf("names must be lowercased, sorted and unique, use %q", canonical)
+			}
+			return nil
+		}},
+		{"registrationsPerIP", &rlc.RegistrationsPerIP, true, func(key string) error {
+			if net.ParseIP(key) == nil {
+				return fmt.Errorf("not an IP address")
+			}
+			return nil
+		}},
+		// Pending authorizations are counted as they stand, not over a window.
+		{"pendingAuthorizationsPerAccount", &rlc.PendingAuthorizationsPerAccount, false, nil},
+		{"invalidAuthorizationsPerAccount", &rlc.InvalidAuthorizationsPerAccount, true, func(key string) error {
+			if strings.ToLower(key) != key {
+				return fmt.Errorf("hostname must be lowercase")
+			}
+			return nil
+		}},
+	}
+}
+
+// policy returns the policy with the given name, or nil if there isn't one.
+func (rlc *RateLimitConfig) policy(name string) *namedPolicy {
+	for _, p := range rlc.policies() {
+		if p.name == name {
+			return &p
+		}
+	}
+	return nil
+}
+
+// LongestWindow returns the longest window of any enabled policy.
+func (rlc *RateLimitConfig) LongestWindow() time.Duration {
+	var longest time.Duration
+	for _, p := range rlc.policies() {
+		if p.policy.Enabled() && p.policy.Window.Duration > longest {
+			longest = p.policy.Window.Duration
+		}
+	}
+	return longest
+}
+
+// Validate checks that every policy has a usable threshold and window, and
+// that override keys are in the form the corresponding limit counts on.
+func (rlc *RateLimitConfig) Validate() error {
+	for _, p := range rlc.policies() {
+		if err := p.policy.validate(p.needsWindow, p.keyOK); err != nil {
+			return fmt.Errorf("%s: %s", p.name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateRateLimitOverride checks that a database-managed override names a
+// known limit, applies to exactly one of a key or a registration, and says
+// who asked for it and why.
+func ValidateRateLimitOverride(o core.RateLimitOverride) error {
+	var rlc RateLimitConfig
+	p := rlc.policy(o.LimitName)
+	if p == nil {
+		return fmt.Errorf("unknown rate limit %q", o.LimitName)
+	}
+	if o.Threshold < 0 {
+		return fmt.Errorf("negative threshold %d", o.Threshold)
+	}
+	switch {
+	case o.Key != "" && o.RegistrationID != 0:
+		return fmt.Errorf("override must be for a key or a registration, not both")
+	case o.Key != "":
+		if p.keyOK == nil {
+			return fmt.Errorf("%s does not take overrides by key", o.LimitName)
+		}
+		if err := p.keyOK(o.Key); err != nil {
+			return fmt.Errorf("key %q: %s", o.Key, err)
+		}
+	case o.RegistrationID <= 0:
+		return fmt.Errorf("override must be for a key or a registration")
+	}
+	if o.Owner == "" || o.Reason == "" {
+		return fmt.Errorf("override must have an owner and a reason")
+	}
+	if o.Expires.IsZero() {
+		return fmt.Errorf("override must have an expiry date")
+	}
+	return nil
+}
+
+// WithOverrides returns a copy of the config with the given database-managed
+// overrides added to its policies. They take priority over overrides from
+// the YAML for the same key or registration. The receiver's override maps
+// are not modified. Overrides for unknown limits are ignored.
+func (rlc RateLimitConfig) WithOverrides(overrides []core.RateLimitOverride) RateLimitConfig {
+	copied := make(map[*RateLimitPolicy]bool)
+	for _, o := range overrides {
+		p := rlc.policy(o.LimitName)
+		if p == nil {
+			continue
+		}
+		rlp := p.policy
+		if !copied[rlp] {
+			keyOverrides := make(map[string]int, len(rlp.Overrides))
+			for k, v := range rlp.Overrides {
+				keyOverrides[k] = v
+			}
+			regOverrides := make(map[int64]int, len(rlp.RegistrationOverrides))
+			for k, v := range rlp.RegistrationOverrides {
+				regOverrides[k] = v
+			}
+			rlp.Overrides, rlp.RegistrationOverrides = keyOverrides, regOverrides
+			copied[rlp] = true
+		}
+		if o.RegistrationID != 0 {
+			rlp.RegistrationOverrides[o.RegistrationID] = o.Threshold
+		} else {
+			rlp.Overrides[o.Key] = o.Threshold
+		}
+	}
+	return rlc
+}
+
 // LoadRateLimitPolicies loads various rate limiting policies from a YAML
-// configuration file
+// configuration file, and validates them.
 func LoadRateLimitPolicies(filename string) (RateLimitConfig, error) {
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -83,5 +283,29 @@ func LoadRateLimitPolicies(filename string) (RateLimitConfig, error) {
 	if err != nil {
 		return RateLimitConfig{}, err
 	}
+	if err = rlc.Validate(); err != nil {
+		return RateLimitConfig{}, err
+	}
 	return rlc, nil
 }
+
+// ReloadRateLimitPoliciesOnSignal reloads the rate limit policies from
+// filename each time the process receives SIGUSR1, passing them to apply. If
+// the file can't be loaded or fails validation, the error is logged and apply
+// is not called, so the policies already in effect are kept. SIGHUP can't be
+// used because RPC servers shut down on it.
+func ReloadRateLimitPoliciesOnSignal(filename string, logger *blog.AuditLogger, apply func(RateLimitConfig)) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+	go func() {
+		for range sigChan {
+			rlc, err := LoadRateLimitPolicies(filename)
+			if err != nil {
+				logger.Err(fmt.Sprintf("Not reloading rate limit policies from %s: %s", filename, err))
+				continue
+			}
+			apply(rlc)
+			logger.Info(fmt.Sprintf("Reloaded rate limit policies from %s", filename))
+		}
+	}()
+}
@@ -3,6 +3,8 @@ package cmd
 import (
 	"testing"
 	"time"
+
+	"github.com/letsencrypt/boulder/core"
 )
 
 func TestEnabled(t *testing.T) {
@@ -58,3 +60,143 @@ func TestWindowBegin(t *testing.T) {
 		t.Errorf("Incorrect WindowBegin: %s, expected %s", actual, expected)
 	}
 }
+
+func TestLongestWindow(t *testing.T) {
+	rlc := RateLimitConfig{
+		TotalCertificates:   RateLimitPolicy{Threshold: 10, Window: ConfigDuration{Duration: 2160 * time.Hour}},
+		CertificatesPerName: RateLimitPolicy{Threshold: 5, Window: ConfigDuration{Duration: 168 * time.Hour}},
+		// Disabled policies don't count.
+		RegistrationsPerIP: RateLimitPolicy{Window: ConfigDuration{Duration: 10000 * time.Hour}},
+	}
+	if longest := rlc.LongestWindow(); longest != 2160*time.Hour {
+		t.Errorf("Incorrect LongestWindow: %s, expected %s", longest, 2160*time.Hour)
+	}
+	if longest := (&RateLimitConfig{}).LongestWindow(); longest != 0 {
+		t.Errorf("Incorrect LongestWindow for no policies: %s", longest)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	day := ConfigDuration{Duration: 24 * time.Hour}
+	testCases := []struct {
+		rlc   RateLimitConfig
+		valid bool
+	}{
+		{RateLimitConfig{}, true},
+		{RateLimitConfig{
+			CertificatesPerName: RateLimitPolicy{Threshold: 2, Window: day, Overrides: map[string]int{"example.co.uk": 10}},
+		}, true},
+		{RateLimitConfig{
+			CertificatesPerName: RateLimitPolicy{Threshold: 2},
+		}, false},
+		{RateLimitConfig{
+			CertificatesPerName: RateLimitPolicy{Threshold: -1, Window: day},
+		}, false},
+		{RateLimitConfig{
+			CertificatesPerName: RateLimitPolicy{Threshold: 2, Window: day, Overrides: map[string]int{"www.example.com": 10}},
+		}, false},
+		{RateLimitConfig{
+			CertificatesPerName: RateLimitPolicy{Threshold: 2, Window: day, RegistrationOverrides: map[int64]int{101: -1}},
+		}, false},
+		{RateLimitConfig{
+			CertificatesPerFQDNSet: RateLimitPolicy{Threshold: 2, Window: day, Overrides: map[string]int{"example.com,www.example.com": 10}},
+		}, true},
+		{RateLimitConfig{
+			CertificatesPerFQDNSet: RateLimitPolicy{Threshold: 2, Window: day, Overrides: map[string]int{"www.example.com,example.com": 10}},
+		}, false},
+		{RateLimitConfig{
+			RegistrationsPerIP: RateLimitPolicy{Threshold: 2, Window: day, Overrides: map[string]int{"example.com": 10}},
+		}, false},
+		{RateLimitConfig{
+			PendingAuthorizationsPerAccount: RateLimitPolicy{Threshold: 3},
+		}, true},
+	}
+	for i, tc := range testCases {
+		err := tc.rlc.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("case %d: invalid config was accepted", i)
+		}
+	}
+}
+
+func TestLoadRateLimitPolicies(t *testing.T) {
+	rlc, err := LoadRateLimitPolicies("../test/rate-limit-policies.yml")
+	if err != nil {
+		t.Fatalf("Failed to load test rate limit policies: %s", err)
+	}
+	if !rlc.CertificatesPerName.Enabled() {
+		t.Errorf("certificatesPerName should have been enabled")
+	}
+}
+
+func TestValidateRateLimitOverride(t *testing.T) {
+	valid := core.RateLimitOverride{
+		LimitName: "certificatesPerName",
+		Key:       "example.com",
+		Threshold: 1000,
+		Owner:     "alice",
+		Reason:    "hosting partner",
+		Expires:   time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := ValidateRateLimitOverride(valid); err != nil {
+		t.Errorf("Valid override rejected: %s", err)
+	}
+	byReg := valid
+	byReg.Key, byReg.RegistrationID = "", 7
+	if err := ValidateRateLimitOverride(byReg); err != nil {
+		t.Errorf("Valid registration override rejected: %s", err)
+	}
+
+	cases := map[string]func(o *core.RateLimitOverride){
+		"unknown limit":      func(o *core.RateLimitOverride) { o.LimitName = "certificatesPerPony" },
+		"negative threshold": func(o *core.RateLimitOverride) { o.Threshold = -1 },
+		"key and reg":        func(o *core.RateLimitOverride) { o.RegistrationID = 7 },
+		"neither key or reg": func(o *core.RateLimitOverride) { o.Key = "" },
+		"bad key":            func(o *core.RateLimitOverride) { o.Key = "www.example.com" },
+		"keyless limit":      func(o *core.RateLimitOverride) { o.LimitName = "totalCertificates" },
+		"no owner":           func(o *core.RateLimitOverride) { o.Owner = "" },
+		"no reason":          func(o *core.RateLimitOverride) { o.Reason = "" },
+		"no expiry":          func(o *core.RateLimitOverride) { o.Expires = time.Time{} },
+	}
+	for name, mutate := range cases {
+		o := valid
+		mutate(&o)
+		if err := ValidateRateLimitOverride(o); err == nil {
+			t.Errorf("%s: invalid override accepted", name)
+		}
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	base := RateLimitConfig{
+		CertificatesPerName: RateLimitPolicy{
+			Threshold: 2,
+			Overrides: map[string]int{
+				"example.com": 10,
+				"example.net": 20,
+			},
+		},
+	}
+	rlc := base.WithOverrides([]core.RateLimitOverride{
+		{LimitName: "certificatesPerName", Key: "example.com", Threshold: 100},
+		{LimitName: "certificatesPerName", RegistrationID: 7, Threshold: 200},
+		{LimitName: "certificatesPerPony", Key: "example.com", Threshold: 300},
+	})
+
+	policy := rlc.CertificatesPerName
+	if threshold := policy.GetThreshold("example.com", 1); threshold != 100 {
+		t.Errorf("Expected database override to win, got %d", threshold)
+	}
+	if threshold := policy.GetThreshold("example.net", 1); threshold != 20 {
+		t.Errorf("Expected YAML override to be kept, got %d", threshold)
+	}
+	if threshold := policy.GetThreshold("example.org", 7); threshold != 200 {
+		t.Errorf("Expected registration override, got %d", threshold)
+	}
+	if threshold := base.CertificatesPerName.GetThreshold("example.com", 7); threshold != 10 {
+		t.Errorf("Base config was modified, got threshold %d", threshold)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/rpc"
+)
+
+const clientName = "ValidationReplay"
+
+func loadConfig(c *cli.Context) (config cmd.Config, err error) {
+	configFileName := c.GlobalString("config")
+	configJSON, err := ioutil.ReadFile(configFileName)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(configJSON, &config)
+	return
+}
+
+// replayIndexes returns the challenges of authz to replay: just index if it
+// is non-negative, otherwise every challenge the subscriber attempted.
+func replayIndexes(authz core.Authorization, index int) []int {
+	if index >= 0 {
+		return []int{index}
+	}
+	var indexes []int
+	for i, chall := range authz.Challenges {
+		if chall.Status != core.StatusPending {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "validation-replay"
+	app.Usage = "Re-runs validation of an authorization's challenges without updating it, printing a trace of each step. Takes an authorization ID as its argument"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+		cli.IntFlag{
+			Name:  "challenge",
+			Value: -1,
+			Usage: "Index of the challenge to replay. By default every attempted challenge is replayed",
+		},
+	}
+
+	app.Action = func(c *cli.Context) {
+		authzID := c.Args().First()
+		if authzID == "" {
+			cli.ShowAppHelp(c)
+			os.Exit(1)
+		}
+
+		config, err := loadConfig(c)
+		cmd.FailOnError(err, "Failed to load Boulder configuration")
+		stats, auditlogger := cmd.StatsAndLogging(config.Statsd, config.Syslog)
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		defer auditlogger.AuditPanic()
+
+		amqpConf := config.ValidationReplay.AMQP
+		sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
+		cmd.FailOnError(err, "Failed to create SA client")
+		vac, err := rpc.NewValidationAuthorityClient(clientName, amqpConf, stats)
+		cmd.FailOnError(err, "Failed to create VA client")
+
+		authz, err := sac.GetAuthorization(authzID)
+		cmd.FailOnError(err, "Couldn't fetch authorization")
+
+		indexes := replayIndexes(authz, c.GlobalInt("challenge"))
+		if len(indexes) == 0 {
+			cmd.FailOnError(fmt.Errorf("no attempted challenges"), fmt.Sprintf("Nothing to replay for authorization %s", authzID))
+		}
+
+		traces := make([]*core.ValidationTrace, 0, len(indexes))
+		for _, i := range indexes {
+			trace, err := vac.ReplayValidation(authz, i)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't replay challenge %d", i))
+			traces = append(traces, trace)
+		}
+
+		out, err := json.MarshalIndent(traces, "", "  ")
+		cmd.FailOnError(err, "Couldn't marshal validation traces")
+		fmt.Println(string(out))
+	}
+
+	err := app.Run(os.Args)
+	cmd.FailOnError(err, "Failed to run application")
+}
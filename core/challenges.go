@@ -32,3 +32,8 @@ func TLSSNIChallenge01(accountKey *jose.JsonWebKey) Challenge {
 func DNSChallenge01(accountKey *jose.JsonWebKey) Challenge {
 	return newChallenge(ChallengeTypeDNS01, accountKey)
 }
+
+// TLSALPNChallenge01 constructs a random tls-alpn-01 challenge
+func TLSALPNChallenge01(accountKey *jose.JsonWebKey) Challenge {
+	return newChallenge(ChallengeTypeTLSALPN01, accountKey)
+}
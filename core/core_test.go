@@ -47,9 +47,15 @@ func TestChallenges(t *testing.T) {
 		t.Errorf("New dns-01 challenge is not sane: %v", dns01)
 	}
 
+	tlsalpn01 := TLSALPNChallenge01(accountKey)
+	if !tlsalpn01.IsSane(false) {
+		t.Errorf("New tls-alpn-01 challenge is not sane: %v", tlsalpn01)
+	}
+
 	test.Assert(t, ValidChallenge(ChallengeTypeHTTP01), "Refused valid challenge")
 	test.Assert(t, ValidChallenge(ChallengeTypeTLSSNI01), "Refused valid challenge")
 	test.Assert(t, ValidChallenge(ChallengeTypeDNS01), "Refused valid challenge")
+	test.Assert(t, ValidChallenge(ChallengeTypeTLSALPN01), "Refused valid challenge")
 	test.Assert(t, !ValidChallenge("nonsense-71"), "Accepted invalid challenge")
 }
 
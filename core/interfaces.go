@@ -74,6 +74,12 @@ type RegistrationAuthority interface {
 	// [AdminRevoker]
 	AdministrativelyRevokeCertificate(x509.Certificate, RevocationCode, string) error
 
+	// [WebFrontEnd]
+	RateLimitStatus(int64, []string) ([]RateLimitStatus, error)
+
+	// [WebFrontEnd]
+	UpdateNotificationPreferences(NotificationPreferences) error
+
 	// [ValidationAuthority]
 	OnValidationUpdate(Authorization) error
 }
@@ -88,6 +94,7 @@ type CertificateAuthority interface {
 // PolicyAuthority defines the public interface for the Boulder PA
 type PolicyAuthority interface {
 	WillingToIssue(id AcmeIdentifier, regID int64) error
+	WillingToDelegate(target string) error
 	ChallengesFor(AcmeIdentifier, *jose.JsonWebKey) ([]Challenge, [][]int, error)
 }
 
@@ -97,14 +104,22 @@ type StorageGetter interface {
 	GetRegistrationByKey(jose.JsonWebKey) (Registration, error)
 	GetAuthorization(string) (Authorization, error)
 	GetLatestValidAuthorization(int64, AcmeIdentifier) (Authorization, error)
+	GetLatestPendingAuthorization(int64, AcmeIdentifier) (Authorization, error)
 	GetCertificate(string) (Certificate, error)
 	GetCertificateStatus(string) (CertificateStatus, error)
 	AlreadyDeniedCSR([]string) (bool, error)
 	CountCertificatesRange(time.Time, time.Time) (int64, error)
 	CountCertificatesByNames([]string, time.Time, time.Time) (map[string]int, error)
+	FQDNSetExists([]string) (bool, error)
+	CountFQDNSets([]string, time.Time, time.Time) (int, error)
 	CountRegistrationsByIP(net.IP, time.Time, time.Time) (int, error)
 	CountPendingAuthorizations(regID int64) (int, error)
+	CountInvalidAuthorizations(regID int64, hostname string, earliest, latest time.Time) (int, error)
+	InvalidAuthorizationExpiries(regID int64, hostname string, earliest, latest time.Time) ([]time.Time, error)
 	GetSCTReceipt(string, string) (SignedCertificateTimestamp, error)
+	GetRateLimitOverrides(asOf time.Time) ([]RateLimitOverride, error)
+	GetNotificationPreferences(regID int64) (NotificationPreferences, error)
+	GetManualReviews(status ManualReviewStatus) ([]ManualReview, error)
 }
 
 // StorageAdder are the Boulder SA's write/update methods
@@ -121,6 +136,14 @@ type StorageAdder interface {
 	AddCertificate([]byte, int64) (string, error)
 
 	AddSCTReceipt(SignedCertificateTimestamp) error
+
+	AddRateLimitOverride(RateLimitOverride) (RateLimitOverride, error)
+	ExpireRateLimitOverride(id int64) error
+
+	SetNotificationPreferences(NotificationPreferences) error
+
+	HoldForReview(hostname string, regID int64) (ManualReview, error)
+	SetManualReviewStatus(id int64, status ManualReviewStatus, reviewer string) error
 }
 
 // StorageAuthority interface represents a simple key/value
@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/subtle"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -58,6 +59,9 @@ const (
 	ResourceRevokeCert   = AcmeResource("revoke-cert")
 	ResourceRegistration = AcmeResource("reg")
 	ResourceChallenge    = AcmeResource("challenge")
+	ResourceRateLimits   = AcmeResource("rate-limits")
+
+	ResourceNotificationPreferences = AcmeResource("notification-preferences")
 )
 
 // These status are the states of OCSP
@@ -68,9 +72,10 @@ const (
 
 // These types are the available challenges
 const (
-	ChallengeTypeHTTP01   = "http-01"
-	ChallengeTypeTLSSNI01 = "tls-sni-01"
-	ChallengeTypeDNS01    = "dns-01"
+	ChallengeTypeHTTP01    = "http-01"
+	ChallengeTypeTLSSNI01  = "tls-sni-01"
+	ChallengeTypeDNS01     = "dns-01"
+	ChallengeTypeTLSALPN01 = "tls-alpn-01"
 )
 
 // ValidChallenge tests whether the provided string names a known challenge
@@ -81,6 +86,8 @@ func ValidChallenge(name string) bool {
 	case ChallengeTypeTLSSNI01:
 		fallthrough
 	case ChallengeTypeDNS01:
+		fallthrough
+	case ChallengeTypeTLSALPN01:
 		return true
 
 	default:
@@ -94,6 +101,13 @@ const TLSSNISuffix = "acme.invalid"
 // DNSPrefix is attached to DNS names in DNS challenges
 const DNSPrefix = "_acme-challenge"
 
+// ALPNProtocol is the ALPN protocol negotiated for TLS-ALPN challenges
+const ALPNProtocol = "acme-tls/1"
+
+// IDPeACMEIdentifier is the OID of the acmeIdentifier certificate extension
+// carrying the key authorization digest in TLS-ALPN challenges
+var IDPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
 // An AcmeIdentifier encodes an identifier that can
 // be validated by ACME.  The protocol allows for different
 // types of identifier to be supported (DNS names, IP
@@ -180,6 +194,8 @@ func (r *Registration) MergeUpdate(input Registration) {
 type ValidationRecord struct {
 	// DNS only
 	Authorities []string
+	// The CNAME targets followed from the _acme-challenge name, in order
+	CNAMEChain []string `json:"cnameChain,omitempty"`
 
 	// SimpleHTTP only
 	URL string `json:"url,omitempty"`
@@ -307,10 +323,10 @@ type Challenge struct {
 	// A URI to which a response can be POSTed
 	URI string `json:"uri"`
 
-	// Used by http-01, tls-sni-01, and dns-01 challenges
+	// Used by http-01, tls-sni-01, tls-alpn-01, and dns-01 challenges
 	Token string `json:"token,omitempty"` // Used by http-00, tls-sni-00, and dns-00 challenges
 
-	// Used by http-01, tls-sni-01, and dns-01 challenges
+	// Used by http-01, tls-sni-01, tls-alpn-01, and dns-01 challenges
 	KeyAuthorization *KeyAuthorization `json:"keyAuthorization,omitempty"`
 
 	// Contains information about URLs used or redirected to and IPs resolved and
@@ -343,7 +359,7 @@ func (ch Challenge) RecordsSane() bool {
 				return false
 			}
 		}
-	case ChallengeTypeTLSSNI01:
+	case ChallengeTypeTLSSNI01, ChallengeTypeTLSALPN01:
 		if len(ch.ValidationRecord) > 1 {
 			return false
 		}
@@ -518,6 +534,35 @@ type ExternalCert struct {
 	CertDER  []byte    `db:"rawDERCert"` // DER (binary) encoding of the raw certificate
 }
 
+// RateLimitStatus describes usage of one rate limit policy for one key.
+type RateLimitStatus struct {
+	// Name of the policy, as in the rate limit policies file, e.g.
+	// "certificatesPerName".
+	Limit string `json:"limit"`
+	// What the policy counts by, e.g. a registered domain or an IP address.
+	// Empty for policies without a key.
+	Key       string `json:"key,omitempty"`
+	Count     int    `json:"count"`
+	Threshold int    `json:"threshold"`
+	// When enough of what is now counted will have left the policy's window
+	// for the threshold to no longer be reached. Nil if the threshold isn't
+	// reached, or if when the counted events happened isn't known.
+	Reset *time.Time `json:"reset,omitempty"`
+}
+
+// Exceeded returns true if another request would be over the threshold.
+func (s RateLimitStatus) Exceeded() bool {
+	return s.Count >= s.Threshold
+}
+
+// Remaining returns how many more requests would be allowed.
+func (s RateLimitStatus) Remaining() int {
+	if s.Count >= s.Threshold {
+		return 0
+	}
+	return s.Threshold - s.Count
+}
+
 // CertificateStatus structs are internal to the server. They represent the
 // latest data about the status of the certificate, required for OCSP updating
 // and for validating that the subscriber has accepted the certificate.
@@ -592,6 +637,83 @@ type DeniedCSR struct {
 	Names string `db:"names"`
 }
 
+// RateLimitOverride is a database-managed exception to a rate limit's
+// threshold. It applies either to a key the limit counts on or to a
+// registration, never both, and lapses at Expires.
+type RateLimitOverride struct {
+	ID int64 `db:"id" json:"id"`
+
+	// Name of the limit, as in the rate limit policy YAML, e.g.
+	// certificatesPerName
+	LimitName      string `db:"limitName" json:"limitName"`
+	Key            string `db:"overrideKey" json:"key,omitempty"`
+	RegistrationID int64  `db:"registrationID" json:"registrationID,omitempty"`
+	Threshold      int    `db:"threshold" json:"threshold"`
+
+	// Who asked for the override and why, for whoever reviews it later
+	Owner  string `db:"owner" json:"owner"`
+	Reason string `db:"reason" json:"reason"`
+
+	Created time.Time `db:"created" json:"created"`
+	Expires time.Time `db:"expires" json:"expires"`
+}
+
+// NotificationPreferences records which optional emails a registration's
+// contacts want. Registrations without stored preferences get all of them, as
+// DefaultNotificationPreferences describes.
+type NotificationPreferences struct {
+	RegistrationID int64 `db:"registrationID" json:"registrationID"`
+
+	// ExpirationEmails is whether the expiration mailer warns the
+	// registration's contacts about its expiring certificates
+	ExpirationEmails bool `db:"expirationEmails" json:"expirationEmails"`
+
+	// Locale is the BCP 47 language tag of the language the registration's
+	// contacts want emails in, or empty for the default language
+	Locale string `db:"locale" json:"locale,omitempty"`
+
+	Updated time.Time `db:"updated" json:"updated"`
+}
+
+// DefaultNotificationPreferences returns the preferences of a registration
+// that hasn't changed any
+func DefaultNotificationPreferences(regID int64) NotificationPreferences {
+	return NotificationPreferences{
+		RegistrationID:   regID,
+		ExpirationEmails: true,
+	}
+}
+
+// ManualReviewStatus is where a manual review of a hostname stands
+type ManualReviewStatus string
+
+// These statuses are used by ManualReview
+const (
+	ManualReviewPending  = ManualReviewStatus("pending")
+	ManualReviewApproved = ManualReviewStatus("approved")
+	ManualReviewDenied   = ManualReviewStatus("denied")
+)
+
+// ManualReview records that a hostname the VA's reputation providers consider
+// high-risk is held until an operator approves or denies issuance for it.
+// There is at most one per hostname, and its verdict applies to every
+// registration.
+type ManualReview struct {
+	ID       int64  `db:"id" json:"id"`
+	Hostname string `db:"hostname" json:"hostname"`
+
+	// RegistrationID is the registration whose authorization first asked
+	// for the hostname
+	RegistrationID int64              `db:"registrationID" json:"registrationID"`
+	Status         ManualReviewStatus `db:"status" json:"status"`
+
+	// Who approved or denied the hostname and when; Reviewed is the zero
+	// time while the review is pending
+	Reviewer string    `db:"reviewer" json:"reviewer,omitempty"`
+	Created  time.Time `db:"created" json:"created"`
+	Reviewed time.Time `db:"reviewed" json:"reviewed"`
+}
+
 // OCSPSigningRequest is a transfer object representing an OCSP Signing Request
 type OCSPSigningRequest struct {
 	CertDER   []byte
@@ -0,0 +1,106 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+// The ASN.1 structure of an OCSPRequest, RFC 6960 section 4.1.1, including the
+// optional parts golang.org/x/crypto/ocsp doesn't parse, such as the nonce
+// extension many clients send
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspSingleRequest struct {
+	CertID     ocspCertID
+	Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+	Signature  asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// The ASN.1 structure of a canonical OCSPRequest, which is nothing but the
+// CertID, the same as golang.org/x/crypto/ocsp.CreateRequest produces
+type canonicalOCSPSingleRequest struct {
+	CertID ocspCertID
+}
+
+type canonicalOCSPTBSRequest struct {
+	RequestList []canonicalOCSPSingleRequest
+}
+
+type canonicalOCSPRequest struct {
+	TBSRequest canonicalOCSPTBSRequest
+}
+
+// CanonicalOCSPRequest returns the DER encoding of the OCSP request der with
+// everything but the CertID of the certificate it asks about removed: the
+// nonce and any other extensions, the requestor name and the signature. The
+// hash algorithm identifier is given NULL parameters. Requests that differ only
+// in those parts get the same response, so this is the form responses are
+// cached under.
+func CanonicalOCSPRequest(der []byte) ([]byte, error) {
+	var req ocspRequest
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("Trailing data after OCSP request")
+	}
+	if len(req.TBSRequest.RequestList) != 1 {
+		return nil, errors.New("OCSP request must ask about exactly one certificate")
+	}
+
+	certID := req.TBSRequest.RequestList[0].CertID
+	certID.HashAlgorithm.Parameters = asn1.RawValue{Tag: 5 /* ASN.1 NULL */}
+	return asn1.Marshal(canonicalOCSPRequest{
+		canonicalOCSPTBSRequest{
+			RequestList: []canonicalOCSPSingleRequest{{CertID: certID}},
+		},
+	})
+}
+
+// DecodeOCSPRequestPath decodes the base64 encoded OCSP request in the
+// already unescaped path of a GET request, as RFC 6960 appendix A.1 describes.
+// Clients don't agree on how to encode requests, so it accepts the standard
+// and URL-safe alphabets, with or without padding, with '+' turned into ' ' by
+// query unescaping, and with extra leading slashes, which can't be part of the
+// encoding as a DER OCSP request always encodes to a string starting with 'M'.
+func DecodeOCSPRequestPath(path string) ([]byte, error) {
+	path = strings.TrimLeft(path, "/")
+	path = strings.Replace(path, " ", "+", -1)
+	path = strings.Replace(path, "-", "+", -1)
+	path = strings.Replace(path, "_", "/", -1)
+	path = strings.TrimRight(path, "=")
+	return base64.RawStdEncoding.DecodeString(path)
+}
+
+// OCSPRequestPath returns the canonical, escaped, GET path for the OCSP request
+// der, as Boulder's OCSP updater purges from CDN caches
+func OCSPRequestPath(der []byte) string {
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(der))
+}
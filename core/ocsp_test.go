@@ -0,0 +1,82 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+var (
+	sha1OID  = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	nonceOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+)
+
+func testCertID() ocspCertID {
+	return ocspCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: sha1OID, Parameters: asn1.RawValue{Tag: 5}},
+		IssuerNameHash: []byte("name hash is twenty!"),
+		IssuerKeyHash:  []byte("key hash is twenty!!"),
+		SerialNumber:   big.NewInt(0xdeadbeef),
+	}
+}
+
+func TestCanonicalOCSPRequest(t *testing.T) {
+	plain, err := asn1.Marshal(canonicalOCSPRequest{
+		canonicalOCSPTBSRequest{RequestList: []canonicalOCSPSingleRequest{{CertID: testCertID()}}},
+	})
+	test.AssertNotError(t, err, "Failed to marshal request")
+	canonical, err := CanonicalOCSPRequest(plain)
+	test.AssertNotError(t, err, "Failed to canonicalize request")
+	test.AssertByteEquals(t, canonical, plain)
+
+	// A nonce and a hash algorithm without parameters don't change the
+	// canonical request
+	certID := testCertID()
+	certID.HashAlgorithm.Parameters = asn1.RawValue{}
+	withNonce, err := asn1.Marshal(ocspRequest{TBSRequest: ocspTBSRequest{
+		RequestList: []ocspSingleRequest{{CertID: certID}},
+		Extensions:  []pkix.Extension{{Id: nonceOID, Value: []byte{4, 2, 1, 2}}},
+	}})
+	test.AssertNotError(t, err, "Failed to marshal request")
+	canonical, err = CanonicalOCSPRequest(withNonce)
+	test.AssertNotError(t, err, "Failed to canonicalize request")
+	test.AssertByteEquals(t, canonical, plain)
+
+	twoCerts, err := asn1.Marshal(canonicalOCSPRequest{
+		canonicalOCSPTBSRequest{RequestList: []canonicalOCSPSingleRequest{{CertID: testCertID()}, {CertID: testCertID()}}},
+	})
+	test.AssertNotError(t, err, "Failed to marshal request")
+	_, err = CanonicalOCSPRequest(twoCerts)
+	test.AssertError(t, err, "Canonicalized a request for two certificates")
+	_, err = CanonicalOCSPRequest(append(plain, 0))
+	test.AssertError(t, err, "Canonicalized a request with trailing data")
+}
+
+func TestDecodeOCSPRequestPath(t *testing.T) {
+	// Chosen to encode to both '+' and '/' and need padding
+	der := []byte{0xfb, 0xff, 0xbf, 0x30}
+	for _, path := range []string{
+		base64.StdEncoding.EncodeToString(der),
+		"/" + base64.RawStdEncoding.EncodeToString(der),
+		base64.URLEncoding.EncodeToString(der),
+		base64.RawURLEncoding.EncodeToString(der),
+		" / /MA==",
+	} {
+		decoded, err := DecodeOCSPRequestPath(path)
+		test.AssertNotError(t, err, "Failed to decode "+path)
+		test.AssertByteEquals(t, decoded, der)
+	}
+	_, err := DecodeOCSPRequestPath("not*base64")
+	test.AssertError(t, err, "Decoded an invalid path")
+
+	test.AssertEquals(t, OCSPRequestPath(der), "%2B%2F%2B%2FMA%3D%3D")
+}
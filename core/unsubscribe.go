@@ -0,0 +1,56 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unsubscribeTokenContext keeps unsubscribe tokens from being valid MACs for
+// anything else signed with the same key
+const unsubscribeTokenContext = "boulder expiration email unsubscribe"
+
+func unsubscribeMAC(key []byte, regID string) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%s", unsubscribeTokenContext, regID)
+	return mac.Sum(nil)
+}
+
+// UnsubscribeToken returns a token that proves whoever holds it was sent an
+// expiration email for the registration regID, so that it can be put in an
+// unsubscribe link that works without the registration's key. It is the
+// registration ID and an HMAC of it under key, and doesn't expire.
+func UnsubscribeToken(key []byte, regID int64) string {
+	id := strconv.FormatInt(regID, 10)
+	return id + "." + base64.RawURLEncoding.EncodeToString(unsubscribeMAC(key, id))
+}
+
+// VerifyUnsubscribeToken checks token was made by UnsubscribeToken with key
+// and returns the registration ID it is for
+func VerifyUnsubscribeToken(key []byte, token string) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, errors.New("Malformed unsubscribe token")
+	}
+	regID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || regID <= 0 {
+		return 0, errors.New("Malformed unsubscribe token")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, errors.New("Malformed unsubscribe token")
+	}
+	if !hmac.Equal(mac, unsubscribeMAC(key, parts[0])) {
+		return 0, errors.New("Invalid unsubscribe token")
+	}
+	return regID, nil
+}
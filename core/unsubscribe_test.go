@@ -0,0 +1,36 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	key := []byte("unsubscribe key")
+	token := UnsubscribeToken(key, 1234)
+	test.Assert(t, strings.HasPrefix(token, "1234."), "Token doesn't start with the registration ID")
+
+	regID, err := VerifyUnsubscribeToken(key, token)
+	test.AssertNotError(t, err, "Failed to verify token")
+	test.AssertEquals(t, regID, int64(1234))
+
+	_, err = VerifyUnsubscribeToken([]byte("another key"), token)
+	test.AssertError(t, err, "Verified token with the wrong key")
+
+	// The MAC covers the registration ID
+	forged := "1235" + strings.TrimPrefix(token, "1234")
+	_, err = VerifyUnsubscribeToken(key, forged)
+	test.AssertError(t, err, "Verified token for another registration")
+
+	for _, malformed := range []string{"", "1234", "1234.", "abc." + token[5:], "-1." + token[5:], token + ".x", "1234.!!!"} {
+		_, err = VerifyUnsubscribeToken(key, malformed)
+		test.AssertError(t, err, "Verified malformed token "+malformed)
+	}
+}
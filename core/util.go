@@ -30,6 +30,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -92,8 +93,12 @@ type CertificateIssuanceError string
 // NoSuchRegistrationError indicates that a registration could not be found.
 type NoSuchRegistrationError string
 
-// RateLimitedError indicates the user has hit a rate limit
-type RateLimitedError string
+// RateLimitedError indicates the user has hit a rate limit. Status, if set,
+// describes the limit that was hit.
+type RateLimitedError struct {
+	Detail string
+	Status *RateLimitStatus
+}
 
 // TooManyRPCRequestsError indicates an RPC server has hit it's concurrent request
 // limit
@@ -115,7 +120,7 @@ func (e LengthRequiredError) Error() string      { return string(e) }
 func (e SignatureValidationError) Error() string { return string(e) }
 func (e CertificateIssuanceError) Error() string { return string(e) }
 func (e NoSuchRegistrationError) Error() string  { return string(e) }
-func (e RateLimitedError) Error() string         { return string(e) }
+func (e RateLimitedError) Error() string         { return e.Detail }
 func (e TooManyRPCRequestsError) Error() string  { return string(e) }
 func (e ServiceUnavailableError) Error() string  { return string(e) }
 func (e BadNonceError) Error() string            { return string(e) }
@@ -192,6 +197,17 @@ func LooksLikeAToken(token string) bool {
 	return tokenFormat.MatchString(token)
 }
 
+// localeFormat matches the language and region (or other subtags) of BCP 47
+// language tags, like "en", "de-CH" or "zh-Hant-TW", up to the 35 characters
+// that RFC 5646 section 4.4.1 recommends supporting
+var localeFormat = regexp.MustCompile("^[a-zA-Z]{2,8}(-[a-zA-Z0-9]{1,8})*$")
+
+// LooksLikeALocale checks whether a string is shaped like a BCP 47 language
+// tag. It doesn't check the subtags are registered.
+func LooksLikeALocale(locale string) bool {
+	return len(locale) <= 35 && localeFormat.MatchString(locale)
+}
+
 // Fingerprints
 
 // Fingerprint256 produces an unpadded, URL-safe Base64-encoded SHA256 digest
@@ -429,6 +445,16 @@ func UniqueLowerNames(names []string) (unique []string) {
 	return
 }
 
+// HashNames returns a hash of the set of names, independent of their order,
+// case and any duplicates. It identifies an "FQDN set": certificates covering
+// exactly the same names share a hash, which lets a renewal be recognized.
+func HashNames(names []string) []byte {
+	names = UniqueLowerNames(names)
+	sort.Strings(names)
+	hash := sha256.Sum256([]byte(strings.Join(names, ",")))
+	return hash[:]
+}
+
 // LoadCertBundle loads a PEM bundle of certificates from disk
 func LoadCertBundle(filename string) ([]*x509.Certificate, error) {
 	bundleBytes, err := ioutil.ReadFile(filename)
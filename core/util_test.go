@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
@@ -44,6 +45,15 @@ func TestLooksLikeAToken(t *testing.T) {
 	test.Assert(t, LooksLikeAToken("R-UL_7MrV3tUUjO9v5ym2srK3dGGCwlxbVyKBdwLOSU"), "Rejected valid token")
 }
 
+func TestLooksLikeALocale(t *testing.T) {
+	for _, locale := range []string{"en", "de-CH", "zh-Hant-TW", "es-419"} {
+		test.Assert(t, LooksLikeALocale(locale), "Rejected valid locale "+locale)
+	}
+	for _, locale := range []string{"", "e", "en_US", "en-", "-en", "de-CH-abcdefghi", "en\n", "en-" + strings.Repeat("a-", 20)} {
+		test.Assert(t, !LooksLikeALocale(locale), "Accepted invalid locale "+locale)
+	}
+}
+
 func TestSerialUtils(t *testing.T) {
 	serial := SerialToString(big.NewInt(100000000000000000))
 	test.AssertEquals(t, serial, "00000000000000000000016345785d8a0000")
@@ -114,6 +124,15 @@ func TestUniqueLowerNames(t *testing.T) {
 	test.AssertDeepEquals(t, []string{"bar.com", "baz.com", "foobar.com"}, u)
 }
 
+func TestHashNames(t *testing.T) {
+	h1 := HashNames([]string{"a.com", "B.com", "a.com"})
+	h2 := HashNames([]string{"b.com", "a.com"})
+	test.AssertByteEquals(t, h1, h2)
+
+	h3 := HashNames([]string{"a.com", "b.com", "c.com"})
+	test.Assert(t, string(h1) != string(h3), "Different name sets hashed the same")
+}
+
 func TestUnmarshalAcmeURL(t *testing.T) {
 	var u AcmeURL
 	err := u.UnmarshalJSON([]byte(`":"`))
@@ -134,7 +153,7 @@ func TestProblemDetailsFromError(t *testing.T) {
 		{UnauthorizedError("foo"), 403, probs.UnauthorizedProblem},
 		{NotFoundError("foo"), 404, probs.MalformedProblem},
 		{SignatureValidationError("foo"), 400, probs.MalformedProblem},
-		{RateLimitedError("foo"), 429, probs.RateLimitedProblem},
+		{RateLimitedError{Detail: "foo"}, 429, probs.RateLimitedProblem},
 		{LengthRequiredError("foo"), 411, probs.MalformedProblem},
 		{BadNonceError("foo"), 400, probs.BadNonceProblem},
 	}
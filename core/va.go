@@ -11,6 +11,9 @@ type ValidationAuthority interface {
 	UpdateValidations(Authorization, int) error
 	CheckCAARecords(AcmeIdentifier) (bool, bool, error)
 	IsSafeDomain(*IsSafeDomainRequest) (*IsSafeDomainResponse, error)
+
+	// [Admin tools]
+	ReplayValidation(Authorization, int) (*ValidationTrace, error)
 }
 
 // IsSafeDomainRequest is the request struct for the IsSafeDomain call. The Domain field
@@ -20,8 +23,29 @@ type IsSafeDomainRequest struct {
 }
 
 // IsSafeDomainResponse is the response struct for the IsSafeDomain call. The
-// IsSafe bool is true if and only if the third-party safe browing API says the
-// domain is safe.
+// IsSafe bool is true if and only if none of the VA's reputation providers
+// says the domain is unsafe. NeedsReview is true if a provider considers the
+// domain high-risk; the RA then holds the domain until an operator approves
+// it with the manual-reviews tool.
 type IsSafeDomainResponse struct {
-	IsSafe bool
+	IsSafe      bool
+	NeedsReview bool `json:",omitempty"`
+}
+
+// ValidationTraceStep is one observation made by the VA while replaying a
+// validation: a DNS answer, an HTTP request or redirect hop, a TLS
+// certificate, or the CAA records found at one label.
+type ValidationTraceStep struct {
+	Kind   string
+	Name   string
+	Detail string   `json:",omitempty"`
+	Values []string `json:",omitempty"`
+}
+
+// ValidationTrace is the response to a ReplayValidation call. Challenge is the
+// challenge as validation would have left it; the authorization itself is
+// never updated by a replay.
+type ValidationTrace struct {
+	Challenge Challenge
+	Steps     []ValidationTraceStep
 }
@@ -13,9 +13,12 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"mime"
+	"mime/multipart"
 	"mime/quotedprintable"
 	"net"
 	"net/smtp"
+	"net/textproto"
 	"strconv"
 	"strings"
 	"time"
@@ -42,7 +45,8 @@ func (s realSource) generate() *big.Int {
 
 // Mailer provides the interface for a mailer
 type Mailer interface {
-	SendMail([]string, string, string) error
+	SendMail(to []string, subject, msg string) error
+	SendMultipartMail(to []string, subject, text, html string) error
 }
 
 // MailerImpl defines a mail transfer agent to use for sending mail
@@ -79,7 +83,25 @@ func New(server, port, username, password, from string) MailerImpl {
 	}
 }
 
-func (m *MailerImpl) generateMessage(to []string, subject, body string) ([]byte, error) {
+// encodeBody returns body encoded as quoted-printable
+func encodeBody(body string) (string, error) {
+	bodyBuf := new(bytes.Buffer)
+	mimeWriter := quotedprintable.NewWriter(bodyBuf)
+	_, err := mimeWriter.Write([]byte(body))
+	if err != nil {
+		return "", err
+	}
+	err = mimeWriter.Close()
+	if err != nil {
+		return "", err
+	}
+	return bodyBuf.String(), nil
+}
+
+// generateMessage builds a UTF-8 email with the body text, or, if html isn't
+// empty, a multipart/alternative email with both a text/plain and a text/html
+// part. The subject is RFC 2047 encoded if it isn't plain ASCII.
+func (m *MailerImpl) generateMessage(to []string, subject, text, html string) ([]byte, error) {
 	mid := m.csprgSource.generate()
 	now := m.clk.Now().UTC()
 	addrs := []string{}
@@ -92,27 +114,67 @@ func (m *MailerImpl) generateMessage(to []string, subject, body string) ([]byte,
 	headers := []string{
 		fmt.Sprintf("To: %s", strings.Join(addrs, ", ")),
 		fmt.Sprintf("From: %s", m.from),
-		fmt.Sprintf("Subject: %s", subject),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("UTF-8", subject)),
 		fmt.Sprintf("Date: %s", now.Format(time.RFC822)),
 		fmt.Sprintf("Message-Id: <%s.%s.%s>", now.Format("20060102T150405"), mid.String(), m.from),
 		"MIME-Version: 1.0",
-		"Content-Type: text/plain; charset=UTF-8",
-		"Content-Transfer-Encoding: quoted-printable",
 	}
 	for i := range headers[1:] {
 		// strip LFs
 		headers[i] = strings.Replace(headers[i], "\n", "", -1)
 	}
+
+	if html == "" {
+		body, err := encodeBody(text)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers,
+			"Content-Type: text/plain; charset=UTF-8",
+			"Content-Transfer-Encoding: quoted-printable",
+		)
+		return []byte(fmt.Sprintf(
+			"%s\r\n\r\n%s\r\n",
+			strings.Join(headers, "\r\n"),
+			body,
+		)), nil
+	}
+
 	bodyBuf := new(bytes.Buffer)
-	mimeWriter := quotedprintable.NewWriter(bodyBuf)
-	_, err := mimeWriter.Write([]byte(body))
+	partWriter := multipart.NewWriter(bodyBuf)
+	// The Message-Id is already unique, so reuse it rather than reading more
+	// randomness
+	err := partWriter.SetBoundary(fmt.Sprintf("%s.%s", now.Format("20060102T150405"), mid.String()))
 	if err != nil {
 		return nil, err
 	}
-	err = mimeWriter.Close()
-	if err != nil {
+	// Parts are in increasing order of preference, RFC 2046 section 5.1.4
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		body, err := encodeBody(part.body)
+		if err != nil {
+			return nil, err
+		}
+		w, err := partWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write([]byte(body)); err != nil {
+			return nil, err
+		}
+	}
+	if err = partWriter.Close(); err != nil {
 		return nil, err
 	}
+	headers = append(headers, fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", partWriter.Boundary()))
 	return []byte(fmt.Sprintf(
 		"%s\r\n\r\n%s\r\n",
 		strings.Join(headers, "\r\n"),
@@ -150,10 +212,20 @@ func (m *MailerImpl) Connect() error {
 // SendMail sends an email to the provided list of recipients. The email body
 // is simple text.
 func (m *MailerImpl) SendMail(to []string, subject, msg string) error {
+	return m.send(to, subject, msg, "")
+}
+
+// SendMultipartMail sends an email to the provided list of recipients, with
+// both a plain text and an HTML body for their mail clients to choose from.
+func (m *MailerImpl) SendMultipartMail(to []string, subject, text, html string) error {
+	return m.send(to, subject, text, html)
+}
+
+func (m *MailerImpl) send(to []string, subject, text, html string) error {
 	if m.client == nil {
 		return errors.New("call Connect before SendMail")
 	}
-	body, err := m.generateMessage(to, subject, msg)
+	body, err := m.generateMessage(to, subject, text, html)
 	if err != nil {
 		return err
 	}
@@ -9,8 +9,12 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"mime/multipart"
 	"net"
+	netmail "net/mail"
 	"strings"
 	"testing"
 
@@ -30,7 +34,7 @@ func TestGenerateMessage(t *testing.T) {
 	m := New("", "", "", "", "send@email.com")
 	m.clk = fc
 	m.csprgSource = fakeSource{}
-	messageBytes, err := m.generateMessage([]string{"recv@email.com"}, "test subject", "this is the body\n")
+	messageBytes, err := m.generateMessage([]string{"recv@email.com"}, "test subject", "this is the body\n", "")
 	test.AssertNotError(t, err, "Failed to generate email body")
 	message := string(messageBytes)
 	fields := strings.Split(message, "\r\n")
@@ -48,9 +52,57 @@ func TestGenerateMessage(t *testing.T) {
 	test.AssertEquals(t, fields[9], "this is the body")
 }
 
+func TestGenerateMessageUTF8(t *testing.T) {
+	fc := clock.NewFake()
+	m := New("", "", "", "", "send@email.com")
+	m.clk = fc
+	m.csprgSource = fakeSource{}
+	messageBytes, err := m.generateMessage([]string{"recv@email.com"}, "Zertifikat läuft ab", "Ihr Zertifikat läuft ab\n", "")
+	test.AssertNotError(t, err, "Failed to generate email body")
+	fields := strings.Split(string(messageBytes), "\r\n")
+	test.AssertEquals(t, fields[2], "Subject: =?UTF-8?q?Zertifikat_l=C3=A4uft_ab?=")
+	test.AssertEquals(t, fields[9], "Ihr Zertifikat l=C3=A4uft ab")
+}
+
+func TestGenerateMultipartMessage(t *testing.T) {
+	fc := clock.NewFake()
+	m := New("", "", "", "", "send@email.com")
+	m.clk = fc
+	m.csprgSource = fakeSource{}
+	messageBytes, err := m.generateMessage([]string{"recv@email.com"}, "test subject", "this is the body\n", "<p>this is the body</p>\n")
+	test.AssertNotError(t, err, "Failed to generate email body")
+	message := string(messageBytes)
+	fields := strings.Split(message, "\r\n")
+	test.AssertEquals(t, fields[5], "MIME-Version: 1.0")
+	test.AssertEquals(t, fields[6], "Content-Type: multipart/alternative; boundary=\"19700101T000000.1991\"")
+	test.AssertEquals(t, fields[7], "")
+
+	msg, err := netmail.ReadMessage(strings.NewReader(message))
+	test.AssertNotError(t, err, "Failed to parse message")
+	r := multipart.NewReader(msg.Body, "19700101T000000.1991")
+	for _, expected := range []struct {
+		contentType string
+		body        string
+	}{
+		// quoted-printable line breaks are CRLF on the wire
+		{"text/plain; charset=UTF-8", "this is the body\r\n"},
+		{"text/html; charset=UTF-8", "<p>this is the body</p>\r\n"},
+	} {
+		part, err := r.NextPart()
+		test.AssertNotError(t, err, "Failed to read part")
+		test.AssertEquals(t, part.Header.Get("Content-Type"), expected.contentType)
+		// The multipart reader undoes the quoted-printable encoding itself
+		body, err := ioutil.ReadAll(part)
+		test.AssertNotError(t, err, "Failed to read part body")
+		test.AssertEquals(t, string(body), expected.body)
+	}
+	_, err = r.NextPart()
+	test.AssertEquals(t, err, io.EOF)
+}
+
 func TestFailNonASCIIAddress(t *testing.T) {
 	m := New("", "", "", "", "send@email.com")
-	_, err := m.generateMessage([]string{"遗憾@email.com"}, "test subject", "this is the body\n")
+	_, err := m.generateMessage([]string{"遗憾@email.com"}, "test subject", "this is the body\n", "")
 	test.AssertError(t, err, "Allowed a non-ASCII to address incorrectly")
 }
 
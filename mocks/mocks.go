@@ -258,6 +258,11 @@ func (sa *StorageAuthority) GetLatestValidAuthorization(registrationID int64, id
 	return core.Authorization{}, errors.New("no authz")
 }
 
+// GetLatestPendingAuthorization is a mock
+func (sa *StorageAuthority) GetLatestPendingAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+	return core.Authorization{}, errors.New("no authz")
+}
+
 // CountCertificatesRange is a mock
 func (sa *StorageAuthority) CountCertificatesRange(_, _ time.Time) (int64, error) {
 	return 0, nil
@@ -268,6 +273,16 @@ func (sa *StorageAuthority) CountCertificatesByNames(_ []string, _, _ time.Time)
 	return
 }
 
+// FQDNSetExists is a mock
+func (sa *StorageAuthority) FQDNSetExists(_ []string) (bool, error) {
+	return false, nil
+}
+
+// CountFQDNSets is a mock
+func (sa *StorageAuthority) CountFQDNSets(_ []string, _, _ time.Time) (int, error) {
+	return 0, nil
+}
+
 // CountRegistrationsByIP is a mock
 func (sa *StorageAuthority) CountRegistrationsByIP(_ net.IP, _, _ time.Time) (int, error) {
 	return 0, nil
@@ -278,6 +293,61 @@ func (sa *StorageAuthority) CountPendingAuthorizations(_ int64) (int, error) {
 	return 0, nil
 }
 
+// CountInvalidAuthorizations is a mock
+func (sa *StorageAuthority) CountInvalidAuthorizations(_ int64, _ string, _, _ time.Time) (int, error) {
+	return 0, nil
+}
+
+// InvalidAuthorizationExpiries is a mock
+func (sa *StorageAuthority) InvalidAuthorizationExpiries(_ int64, _ string, _, _ time.Time) ([]time.Time, error) {
+	return nil, nil
+}
+
+// GetRateLimitOverrides is a mock
+func (sa *StorageAuthority) GetRateLimitOverrides(_ time.Time) ([]core.RateLimitOverride, error) {
+	return nil, nil
+}
+
+// AddRateLimitOverride is a mock
+func (sa *StorageAuthority) AddRateLimitOverride(override core.RateLimitOverride) (core.RateLimitOverride, error) {
+	return override, nil
+}
+
+// ExpireRateLimitOverride is a mock
+func (sa *StorageAuthority) ExpireRateLimitOverride(_ int64) error {
+	return nil
+}
+
+// GetNotificationPreferences is a mock
+func (sa *StorageAuthority) GetNotificationPreferences(regID int64) (core.NotificationPreferences, error) {
+	return core.DefaultNotificationPreferences(regID), nil
+}
+
+// SetNotificationPreferences is a mock
+func (sa *StorageAuthority) SetNotificationPreferences(_ core.NotificationPreferences) error {
+	return nil
+}
+
+// HoldForReview is a mock
+func (sa *StorageAuthority) HoldForReview(hostname string, regID int64) (core.ManualReview, error) {
+	return core.ManualReview{
+		Hostname:       hostname,
+		RegistrationID: regID,
+		Status:         core.ManualReviewPending,
+		Created:        sa.clk.Now(),
+	}, nil
+}
+
+// GetManualReviews is a mock
+func (sa *StorageAuthority) GetManualReviews(_ core.ManualReviewStatus) ([]core.ManualReview, error) {
+	return nil, nil
+}
+
+// SetManualReviewStatus is a mock
+func (sa *StorageAuthority) SetManualReviewStatus(_ int64, _ core.ManualReviewStatus, _ string) error {
+	return nil
+}
+
 // Publisher is a mock
 type Publisher struct {
 	// empty
@@ -348,12 +418,14 @@ func NewStatter() Statter {
 
 // Mailer is a mock
 type Mailer struct {
-	Messages []string
+	Messages     []string
+	HTMLMessages []string
 }
 
 // Clear removes any previously recorded messages
 func (m *Mailer) Clear() {
 	m.Messages = []string{}
+	m.HTMLMessages = []string{}
 }
 
 // SendMail is a mock
@@ -363,3 +435,12 @@ func (m *Mailer) SendMail(to []string, subject, msg string) (err error) {
 	}
 	return
 }
+
+// SendMultipartMail is a mock
+func (m *Mailer) SendMultipartMail(to []string, subject, text, html string) (err error) {
+	for range to {
+		m.Messages = append(m.Messages, text)
+		m.HTMLMessages = append(m.HTMLMessages, html)
+	}
+	return
+}
@@ -0,0 +1,30 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- This is the schema the MySQL migrations in policy/_db add up to. Hosts are
+-- compared bytewise, as the blacklist and reputation lookups find a host's
+-- closest parent domain by its sort order.
+
+CREATE TABLE blacklist (
+  host VARCHAR(255) COLLATE "C" NOT NULL,
+  PRIMARY KEY (host)
+);
+
+CREATE TABLE whitelist (
+  host VARCHAR(255) COLLATE "C" NOT NULL,
+  PRIMARY KEY (host)
+);
+
+CREATE TABLE domainReputation (
+  host VARCHAR(255) COLLATE "C" NOT NULL,
+  verdict VARCHAR(16) NOT NULL,
+  PRIMARY KEY (host)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE domainReputation;
+DROP TABLE whitelist;
+DROP TABLE blacklist;
@@ -0,0 +1,28 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- This is the schema the MySQL migrations in policy/_db add up to.
+
+CREATE TABLE blacklist (
+  host VARCHAR(255) NOT NULL,
+  PRIMARY KEY (host)
+);
+
+CREATE TABLE whitelist (
+  host VARCHAR(255) NOT NULL,
+  PRIMARY KEY (host)
+);
+
+CREATE TABLE domainReputation (
+  host VARCHAR(255) NOT NULL,
+  verdict VARCHAR(16) NOT NULL,
+  PRIMARY KEY (host)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE domainReputation;
+DROP TABLE whitelist;
+DROP TABLE blacklist;
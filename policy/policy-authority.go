@@ -204,6 +204,42 @@ func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier, regID int64
 	return nil
 }
 
+// WillingToDelegate determines whether the CA is willing to follow a DNS
+// delegation (such as a CNAME from _acme-challenge) to target while
+// validating a challenge. Delegation targets are not issued for, so unlike
+// WillingToIssue underscores are allowed and the whitelist is not consulted,
+// but the target:
+//
+//  * MUST NOT match the syntax of an IP address
+//  * MUST end in a public suffix, so that private names such as *.local or
+//    *.internal can't be used
+//  * MUST NOT be a label-wise suffix match for a name on the black list
+//
+// If WillingToDelegate returns an error, it will be of type
+// MalformedRequestError.
+func (pa PolicyAuthorityImpl) WillingToDelegate(target string) error {
+	target = strings.ToLower(strings.TrimRight(target, "."))
+	if target == "" {
+		return errEmptyName
+	}
+	if len(target) > 255 {
+		return errNameTooLong
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return errIPAddress
+	}
+
+	icannTLD, err := publicsuffix.ICANNTLD(target)
+	if err != nil {
+		return errNonPublic
+	}
+	if icannTLD == target {
+		return errICANNTLD
+	}
+
+	return pa.DB.CheckHostLists(target, false)
+}
+
 // ChallengesFor makes a decision of what challenges, and combinations, are
 // acceptable for the given identifier.
 //
@@ -223,6 +259,10 @@ func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier, acco
 		challenges = append(challenges, core.DNSChallenge01(accountKey))
 	}
 
+	if pa.enabledChallenges[core.ChallengeTypeTLSALPN01] {
+		challenges = append(challenges, core.TLSALPNChallenge01(accountKey))
+	}
+
 	// We shuffle the challenges and combinations to prevent ACME clients from
 	// relying on the specific order that boulder returns them in.
 	shuffled := make([]core.Challenge, len(challenges))
@@ -181,6 +181,33 @@ func TestWillingToIssue(t *testing.T) {
 	}
 }
 
+func TestWillingToDelegate(t *testing.T) {
+	pa, cleanup := paImpl(t)
+	defer cleanup()
+
+	err := pa.DB.LoadRules(RuleSet{Blacklist: []BlacklistRule{{Host: "evil.com"}}})
+	test.AssertNotError(t, err, "Couldn't load rules")
+
+	testCases := []struct {
+		target string
+		err    error
+	}{
+		{"_acme-challenge.validation.example.com", nil},
+		{"validation.example.com.", nil},
+		{"", errEmptyName},
+		{"127.0.0.1", errIPAddress},
+		{"validation.local", errNonPublic},
+		{"example.internal", errNonPublic},
+		{"co.uk", errICANNTLD},
+		{"delegated.evil.com", errBlacklisted},
+	}
+	for _, tc := range testCases {
+		if err := pa.WillingToDelegate(tc.target); err != tc.err {
+			t.Errorf("WillingToDelegate(%q) = %v, expected %v", tc.target, err, tc.err)
+		}
+	}
+}
+
 var accountKeyJSON = `{
   "kty":"RSA",
   "n":"yNWVhtYEKJR21y9xsHV-PD_bYwbXSeNuFal46xYxVfRL5mqha7vttvjB_vc7Xg2RvgCxHPCqoxgMPTzHrZT75LjCwIW2K_klBYN8oYvTwwmeSkAz6ut7ZxPv-nZaT5TJhGk0NT2kh_zSpdriEJ_3vW-mqxYbbBmpvHqsa1_zx9fSuHYctAZJWzxzUZXykbWMWQZpEiE0J4ajj51fInEzVn7VxV-mzfMyboQjujPh7aNJxAWSq4oQEJJDgWwSh9leyoJoPpONHxh5nEE5AjE01FkGICSxjpZsF-w8hOTI3XXohUdu29Se26k2B0PolDSuj0GIQU6-W9TdLXSjBb2SpQ",
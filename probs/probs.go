@@ -16,6 +16,7 @@ const (
 	RateLimitedProblem    = ProblemType("urn:acme:error:rateLimited")
 	BadNonceProblem       = ProblemType("urn:acme:error:badNonce")
 	InvalidEmailProblem   = ProblemType("urn:acme:error:invalidEmail")
+	DNSSECProblem         = ProblemType("urn:acme:error:dnssec")
 )
 
 // ProblemType defines the error types in the ACME protocol
@@ -47,7 +48,7 @@ func ProblemDetailsToStatusCode(prob *ProblemDetails) int {
 		return prob.HTTPStatus
 	}
 	switch prob.Type {
-	case ConnectionProblem, MalformedProblem, TLSProblem, UnknownHostProblem, BadNonceProblem:
+	case ConnectionProblem, MalformedProblem, TLSProblem, UnknownHostProblem, BadNonceProblem, DNSSECProblem:
 		return http.StatusBadRequest
 	case ServerInternalProblem:
 		return http.StatusInternalServerError
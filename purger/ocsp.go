@@ -0,0 +1,62 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"crypto"
+	// Register the hash algorithms OCSP requests are generated with
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// ocspRequestHashes are the hash algorithms clients identify certificates with
+// in OCSP requests
+var ocspRequestHashes = []crypto.Hash{crypto.SHA1, crypto.SHA256}
+
+// OCSPURLs returns the GET URLs, at each of cert's OCSP servers, that a CDN
+// may have cached cert's OCSP response under. There is one for each hash
+// algorithm a request may identify cert with and each way clients commonly
+// base64 encode requests. Requests with a nonce, or other extensions, can't be
+// listed, but an OCSP responder that redirects them to their canonical form
+// (see core.CanonicalOCSPRequest) leaves nothing else cached. Responses to
+// POST requests aren't cached by CDNs, so there is nothing to purge for them.
+func OCSPURLs(cert, issuer *x509.Certificate) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, hash := range ocspRequestHashes {
+		req, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: hash})
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range []string{
+			core.OCSPRequestPath(req),
+			base64.StdEncoding.EncodeToString(req),
+			base64.RawStdEncoding.EncodeToString(req),
+			base64.URLEncoding.EncodeToString(req),
+			base64.RawURLEncoding.EncodeToString(req),
+		} {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	var urls []string
+	for _, server := range cert.OCSPServer {
+		for _, path := range paths {
+			urls = append(urls, strings.TrimSuffix(server, "/")+"/"+path)
+		}
+	}
+	return urls, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"crypto"
+	"crypto/x509"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestOCSPURLs(t *testing.T) {
+	der, err := ioutil.ReadFile("../sa/test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Couldn't parse test certificate")
+	issuer, err := core.LoadCert("../test/test-ca.pem")
+	test.AssertNotError(t, err, "Couldn't read issuer certificate")
+
+	urls, err := OCSPURLs(cert, issuer)
+	test.AssertNotError(t, err, "Failed to generate OCSP URLs")
+	sha1Req, err := ocsp.CreateRequest(cert, issuer, nil)
+	test.AssertNotError(t, err, "Failed to create OCSP request")
+	test.AssertEquals(t, urls[0], "http://localhost:4002/ocsp/"+core.OCSPRequestPath(sha1Req))
+
+	// Every URL is for one of the requests, however it was encoded, and they
+	// are all different
+	hashes := make(map[crypto.Hash]int)
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		test.Assert(t, !seen[u], "Duplicate URL "+u)
+		seen[u] = true
+		parsed, err := url.Parse(u)
+		test.AssertNotError(t, err, "Couldn't parse URL "+u)
+		req, err := core.DecodeOCSPRequestPath(strings.TrimPrefix(parsed.Path, "/ocsp/"))
+		test.AssertNotError(t, err, "Couldn't decode request in "+u)
+		parsedReq, err := ocsp.ParseRequest(req)
+		test.AssertNotError(t, err, "Couldn't parse request in "+u)
+		test.AssertEquals(t, parsedReq.SerialNumber.Cmp(cert.SerialNumber), 0)
+		hashes[parsedReq.HashAlgorithm]++
+	}
+	// Encodings with and without padding are the same for requests that don't
+	// need any, but there are always at least three distinct ones
+	test.Assert(t, hashes[crypto.SHA1] >= 3, "Not enough SHA-1 request encodings")
+	test.Assert(t, hashes[crypto.SHA256] >= 3, "Not enough SHA-256 request encodings")
+}
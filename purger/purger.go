@@ -0,0 +1,166 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+
+	"github.com/letsencrypt/boulder/akamai"
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// Purger removes resources from a CDN's cache so that the next request for
+// them is answered by the origin. A Purger that purges each URL separately
+// returns a PartialPurgeError if only some of them fail.
+type Purger interface {
+	Purge(urls []string) error
+}
+
+// PartialPurgeError maps each URL a Purger failed to purge to the reason, the
+// rest of the URLs it was given were purged
+type PartialPurgeError map[string]error
+
+func (e PartialPurgeError) Error() string {
+	failures := make([]string, 0, len(e))
+	for u, err := range e {
+		failures = append(failures, fmt.Sprintf("%s: %s", u, err))
+	}
+	sort.Strings(failures)
+	return fmt.Sprintf("Failed to purge %d URLs: %s", len(e), strings.Join(failures, ", "))
+}
+
+// New returns the Purger described by config
+func New(config cmd.PurgerConfig, log *blog.AuditLogger, stats statsd.Statter) (Purger, error) {
+	switch config.Type {
+	case "akamai":
+		p, err := akamai.NewCachePurgeClient(
+			config.AkamaiBaseURL,
+			config.AkamaiClientToken,
+			config.AkamaiClientSecret,
+			config.AkamaiAccessToken,
+			config.AkamaiPurgeRetries,
+			config.AkamaiPurgeRetryBackoff.Duration,
+			log,
+			stats,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "http":
+		p, err := NewHTTPPurger(config.HTTPMethod, config.HTTPEndpoint, log, stats)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "noop":
+		return NoopPurger{}, nil
+	case "":
+		return nil, fmt.Errorf("Purger type must be set to akamai, http or noop")
+	default:
+		return nil, fmt.Errorf("Unknown purger type %q", config.Type)
+	}
+}
+
+// NoopPurger doesn't purge anything, for when there is no CDN in front of the
+// OCSP responder
+type NoopPurger struct{}
+
+// Purge does nothing
+func (NoopPurger) Purge(urls []string) error {
+	return nil
+}
+
+// HTTPPurger purges resources from caches such as Varnish or nginx that
+// accept a PURGE, BAN or similar request for the resource to remove
+type HTTPPurger struct {
+	client *http.Client
+	method string
+	// endpoint, if set, is where requests are sent instead of the host named
+	// by each URL, which is still sent in the Host header
+	endpoint *url.URL
+	log      *blog.AuditLogger
+	stats    statsd.Statter
+}
+
+// NewHTTPPurger constructs an HTTPPurger. method defaults to PURGE.
+func NewHTTPPurger(method, endpoint string, log *blog.AuditLogger, stats statsd.Statter) (*HTTPPurger, error) {
+	if method == "" {
+		method = "PURGE"
+	}
+	p := &HTTPPurger{
+		client: &http.Client{Timeout: 10 * time.Second},
+		method: method,
+		log:    log,
+		stats:  stats,
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("HTTP purger endpoint %q must be an absolute URL", endpoint)
+		}
+		p.endpoint = u
+	}
+	return p, nil
+}
+
+// Purge sends a purge request for each of urls and returns a
+// PartialPurgeError naming those that failed. A 404 is taken to mean the
+// resource wasn't cached.
+func (p *HTTPPurger) Purge(urls []string) error {
+	failed := make(PartialPurgeError)
+	for _, u := range urls {
+		if err := p.purge(u); err != nil {
+			p.stats.Inc("HTTPPurger.FailedPurges", 1, 1.0)
+			failed[u] = err
+			continue
+		}
+		p.stats.Inc("HTTPPurger.SuccessfulPurges", 1, 1.0)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (p *HTTPPurger) purge(rawURL string) error {
+	req, err := http.NewRequest(p.method, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if p.endpoint != nil {
+		req.Host = req.URL.Host
+		req.URL.Scheme = p.endpoint.Scheme
+		req.URL.Host = p.endpoint.Host
+	}
+
+	rS := time.Now()
+	resp, err := p.client.Do(req)
+	p.stats.TimingDuration("HTTPPurger.PurgeRequestLatency", time.Since(rS), 1.0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("%s %s failed: %s", p.method, rawURL, resp.Status)
+	}
+	p.log.Debug(fmt.Sprintf("Purged %s with %s: %s", rawURL, p.method, resp.Status))
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+
+	"github.com/letsencrypt/boulder/akamai"
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNew(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	log := blog.GetAuditLogger()
+
+	_, err := New(cmd.PurgerConfig{}, log, stats)
+	test.AssertError(t, err, "Created purger without a type")
+	p, err := New(cmd.PurgerConfig{Type: "noop"}, log, stats)
+	test.AssertNotError(t, err, "Failed to create noop purger")
+	_, ok := p.(NoopPurger)
+	test.Assert(t, ok, "Noop purger isn't a NoopPurger")
+
+	p, err = New(cmd.PurgerConfig{Type: "akamai", AkamaiBaseURL: "https://akamai.example.com"}, log, stats)
+	test.AssertNotError(t, err, "Failed to create Akamai purger")
+	_, ok = p.(*akamai.CachePurgeClient)
+	test.Assert(t, ok, "Akamai purger isn't a CachePurgeClient")
+
+	p, err = New(cmd.PurgerConfig{Type: "http", HTTPMethod: "BAN"}, log, stats)
+	test.AssertNotError(t, err, "Failed to create HTTP purger")
+	test.AssertEquals(t, p.(*HTTPPurger).method, "BAN")
+
+	_, err = New(cmd.PurgerConfig{Type: "http", HTTPEndpoint: "varnish:6081"}, log, stats)
+	test.AssertError(t, err, "Created HTTP purger with a relative endpoint")
+	_, err = New(cmd.PurgerConfig{Type: "squid"}, log, stats)
+	test.AssertError(t, err, "Created purger of an unknown type")
+}
+
+func TestHTTPPurger(t *testing.T) {
+	var methods, hosts, paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		hosts = append(hosts, r.Host)
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/uncached":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	stats, _ := statsd.NewNoopClient(nil)
+	p, err := NewHTTPPurger("", server.URL, blog.GetAuditLogger(), stats)
+	test.AssertNotError(t, err, "Failed to create HTTP purger")
+
+	// Requests go to the endpoint with the URL's own host, and resources that
+	// aren't cached don't count as failures
+	err = p.Purge([]string{"http://ocsp.example.com/cached", "http://ocsp.example.com/uncached"})
+	test.AssertNotError(t, err, "Failed to purge")
+	test.AssertEquals(t, len(methods), 2)
+	test.AssertEquals(t, methods[0], "PURGE")
+	test.AssertEquals(t, hosts[0], "ocsp.example.com")
+	test.AssertEquals(t, paths[1], "/uncached")
+
+	// A failure doesn't stop the rest from being purged, and only the URLs
+	// that failed are reported
+	err = p.Purge([]string{"http://ocsp.example.com/broken", "http://ocsp.example.com/cached"})
+	test.AssertError(t, err, "Purge didn't fail")
+	test.AssertEquals(t, len(methods), 4)
+	partial, ok := err.(PartialPurgeError)
+	test.Assert(t, ok, "Purge didn't return a PartialPurgeError")
+	test.AssertEquals(t, len(partial), 1)
+	_, present := partial["http://ocsp.example.com/broken"]
+	test.Assert(t, present, "Failed URL wasn't reported")
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/sa"
+)
+
+// QueuedPurge is a URL waiting in the purgeQueue table to be purged
+type QueuedPurge struct {
+	ID          int64     `db:"id"`
+	URL         string    `db:"url"`
+	Created     time.Time `db:"created"`
+	Attempts    int       `db:"attempts"`
+	NextAttempt time.Time `db:"nextAttempt"`
+}
+
+// Queue keeps URLs to be purged in the database until a purge of them
+// succeeds, so that they aren't lost if the process that wanted them purged,
+// or the one purging them, restarts
+type Queue struct {
+	dbMap *gorp.DbMap
+	clk   clock.Clock
+}
+
+// NewQueue returns a Queue using the purgeQueue table in dbMap's database
+func NewQueue(dbMap *gorp.DbMap, clk clock.Clock) *Queue {
+	return &Queue{dbMap: dbMap, clk: clk}
+}
+
+// Add queues urls to be purged as soon as possible
+func (q *Queue) Add(urls []string) error {
+	now := q.clk.Now()
+	tx, err := q.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	for _, u := range urls {
+		_, err = tx.Exec(
+			sa.Rebind(q.dbMap, "INSERT INTO purgeQueue (url, created, attempts, nextAttempt) VALUES (?, ?, 0, ?)"),
+			u, now, now,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Due returns up to limit queued purges whose next attempt is due, oldest
+// first
+func (q *Queue) Due(limit int) ([]QueuedPurge, error) {
+	var purges []QueuedPurge
+	_, err := q.dbMap.Select(
+		&purges,
+		`SELECT * FROM purgeQueue
+		 WHERE nextAttempt <= :now
+		 ORDER BY id ASC
+		 LIMIT :limit`,
+		map[string]interface{}{"now": q.clk.Now(), "limit": limit},
+	)
+	return purges, err
+}
+
+// Remove deletes the queued purges with the given IDs, once they have been
+// purged or given up on
+func (q *Queue) Remove(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := q.dbMap.Exec(sa.Rebind(q.dbMap, "DELETE FROM purgeQueue WHERE id IN ("+placeholders+")"), args...)
+	return err
+}
+
+// Postpone records a failed attempt to purge the queued purge with the given
+// ID and has it retried at next
+func (q *Queue) Postpone(id int64, next time.Time) error {
+	_, err := q.dbMap.Exec(
+		sa.Rebind(q.dbMap, "UPDATE purgeQueue SET attempts = attempts + 1, nextAttempt = ? WHERE id = ?"),
+		next, id,
+	)
+	return err
+}
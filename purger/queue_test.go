@@ -0,0 +1,56 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package purger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func TestQueue(t *testing.T) {
+	// The OCSP updater adds to the queue and the purger drains it, each with
+	// their own database user, so use one that can do both
+	dbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms)
+	test.AssertNotError(t, err, "Couldn't connect to the database")
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	fc := clock.NewFake()
+	fc.Set(time.Date(2016, 3, 4, 5, 0, 0, 0, time.UTC))
+	q := NewQueue(dbMap, fc)
+
+	err = q.Add([]string{"http://ocsp.example.com/a", "http://ocsp.example.com/b", "http://ocsp.example.com/c"})
+	test.AssertNotError(t, err, "Failed to queue purges")
+
+	due, err := q.Due(2)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 2)
+	test.AssertEquals(t, due[0].URL, "http://ocsp.example.com/a")
+	test.AssertEquals(t, due[0].Attempts, 0)
+
+	// Postponed purges aren't due until their next attempt
+	err = q.Postpone(due[0].ID, fc.Now().Add(time.Minute))
+	test.AssertNotError(t, err, "Failed to postpone purge")
+	err = q.Remove([]int64{due[1].ID})
+	test.AssertNotError(t, err, "Failed to remove purge")
+	due, err = q.Due(10)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 1)
+	test.AssertEquals(t, due[0].URL, "http://ocsp.example.com/c")
+
+	fc.Add(time.Minute)
+	due, err = q.Due(10)
+	test.AssertNotError(t, err, "Failed to get due purges")
+	test.AssertEquals(t, len(due), 2)
+	test.AssertEquals(t, due[0].URL, "http://ocsp.example.com/a")
+	test.AssertEquals(t, due[0].Attempts, 1)
+}
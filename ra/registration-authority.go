@@ -23,6 +23,7 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/ratelimit"
 
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/cmd"
@@ -50,6 +51,7 @@ type RegistrationAuthorityImpl struct {
 	VA          core.ValidationAuthority
 	SA          core.StorageAuthority
 	PA          core.PolicyAuthority
+	RateLimits  ratelimit.Counter // Optional; if nil, limits are counted by the SA
 	stats       statsd.Statter
 	DNSResolver bdns.DNSResolver
 	clk         clock.Clock
@@ -59,16 +61,37 @@ type RegistrationAuthorityImpl struct {
 	// How long before a newly created authorization expires.
 	authorizationLifetime        time.Duration
 	pendingAuthorizationLifetime time.Duration
+	rlMu                         *sync.RWMutex
 	rlPolicies                   cmd.RateLimitConfig
+	rlOverrides                  []core.RateLimitOverride // read from the SA
+	rlMerged                     cmd.RateLimitConfig      // rlPolicies with rlOverrides applied
+	rlOverridesRefresh           *time.Time               // when to next read overrides
 	tiMu                         *sync.RWMutex
 	totalIssuedCache             int
 	lastIssuedCount              *time.Time
 	maxContactsPerReg            int
 
-	regByIPStats         metrics.Scope
-	pendAuthByRegIDStats metrics.Scope
-	certsForDomainStats  metrics.Scope
-	totalCertsStats      metrics.Scope
+	// When the rate limit counters started recording events. Windows that
+	// begin before this are still counted by the SA, so that limits aren't
+	// under-counted while the counters warm up.
+	RateLimitsSince time.Time
+
+	// How long overrides read from the SA are cached. If zero, only the
+	// overrides in the rate limit policies are used.
+	RateLimitOverridesTTL time.Duration
+
+	// NewAuthorization returns an existing valid or pending authorization
+	// for the identifier instead of creating one if it remains usable for at
+	// least this long. If zero or negative, a new authorization is always
+	// created.
+	AuthorizationReuseWindow time.Duration
+
+	regByIPStats            metrics.Scope
+	pendAuthByRegIDStats    metrics.Scope
+	invalidAuthByRegIDStats metrics.Scope
+	certsForDomainStats     metrics.Scope
+	certsPerFQDNSetStats    metrics.Scope
+	totalCertsStats         metrics.Scope
 }
 
 // NewRegistrationAuthorityImpl constructs a new RA object.
@@ -82,15 +105,18 @@ func NewRegistrationAuthorityImpl(clk clock.Clock, logger *blog.AuditLogger, sta
 		dc:    dc,
 		authorizationLifetime:        DefaultAuthorizationLifetime,
 		pendingAuthorizationLifetime: DefaultPendingAuthorizationLifetime,
+		rlMu:                         new(sync.RWMutex),
 		rlPolicies:                   policies,
 		tiMu:                         new(sync.RWMutex),
 		maxContactsPerReg:            maxContactsPerReg,
 		keyPolicy:                    keyPolicy,
 
-		regByIPStats:         scope.NewScope("RA", "RateLimit", "RegistrationsByIP"),
-		pendAuthByRegIDStats: scope.NewScope("RA", "RateLimit", "PendingAuthorizationsByRegID"),
-		certsForDomainStats:  scope.NewScope("RA", "RateLimit", "CertificatesForDomain"),
-		totalCertsStats:      scope.NewScope("RA", "RateLimit", "TotalCertificates"),
+		regByIPStats:            scope.NewScope("RA", "RateLimit", "RegistrationsByIP"),
+		pendAuthByRegIDStats:    scope.NewScope("RA", "RateLimit", "PendingAuthorizationsByRegID"),
+		invalidAuthByRegIDStats: scope.NewScope("RA", "RateLimit", "InvalidAuthorizationsByRegID"),
+		certsForDomainStats:     scope.NewScope("RA", "RateLimit", "CertificatesForDomain"),
+		certsPerFQDNSetStats:    scope.NewScope("RA", "RateLimit", "CertificatesPerFQDNSet"),
+		totalCertsStats:         scope.NewScope("RA", "RateLimit", "TotalCertificates"),
 	}
 	return ra
 }
@@ -156,27 +182,28 @@ func (ra *RegistrationAuthorityImpl) issuanceCountInvalid(now time.Time) bool {
 	return ra.lastIssuedCount == nil || ra.lastIssuedCount.Add(issuanceCountCacheLife).Before(now)
 }
 
-func (ra *RegistrationAuthorityImpl) getIssuanceCount() (int, error) {
+func (ra *RegistrationAuthorityImpl) getIssuanceCount(limit cmd.RateLimitPolicy) (int, error) {
+	now := ra.clk.Now()
+	if ra.useCounters(limit.WindowBegin(now)) {
+		return ra.RateLimits.Count(ratelimit.TotalCertificatesKey, limit.WindowBegin(now), now)
+	}
 	ra.tiMu.RLock()
 	if ra.issuanceCountInvalid(ra.clk.Now()) {
 		ra.tiMu.RUnlock()
-		return ra.setIssuanceCount()
+		return ra.setIssuanceCount(limit)
 	}
 	count := ra.totalIssuedCache
 	ra.tiMu.RUnlock()
 	return count, nil
 }
 
-func (ra *RegistrationAuthorityImpl) setIssuanceCount() (int, error) {
+func (ra *RegistrationAuthorityImpl) setIssuanceCount(limit cmd.RateLimitPolicy) (int, error) {
 	ra.tiMu.Lock()
 	defer ra.tiMu.Unlock()
 
 	now := ra.clk.Now()
 	if ra.issuanceCountInvalid(now) {
-		count, err := ra.SA.CountCertificatesRange(
-			now.Add(-ra.rlPolicies.TotalCertificates.Window.Duration),
-			now,
-		)
+		count, err := ra.SA.CountCertificatesRange(limit.WindowBegin(now), now)
 		if err != nil {
 			return 0, err
 		}
@@ -186,28 +213,204 @@ func (ra *RegistrationAuthorityImpl) setIssuanceCount() (int, error) {
 	return ra.totalIssuedCache, nil
 }
 
+// rateLimitPolicies returns the rate limit policies currently in effect: the
+// configured policies with any overrides stored in the SA added to them. The
+// merged policies are cached with the overrides, and must not be modified.
+func (ra *RegistrationAuthorityImpl) rateLimitPolicies() cmd.RateLimitConfig {
+	ra.rlMu.RLock()
+	if ra.RateLimitOverridesTTL <= 0 {
+		defer ra.rlMu.RUnlock()
+		return ra.rlPolicies
+	}
+	if ra.overridesFresh(ra.clk.Now()) {
+		defer ra.rlMu.RUnlock()
+		return ra.rlMerged
+	}
+	ra.rlMu.RUnlock()
+	return ra.refreshRateLimitOverrides()
+}
+
+// overridesFresh returns true if the cached overrides don't need to be read
+// again yet. rlMu must be held.
+func (ra *RegistrationAuthorityImpl) overridesFresh(now time.Time) bool {
+	return ra.rlOverridesRefresh != nil && now.Before(*ra.rlOverridesRefresh)
+}
+
+// refreshRateLimitOverrides reads the current overrides from the SA and
+// applies them to the configured policies. The overrides are cached until the
+// TTL passes or the first of them expires, whichever is sooner. If the SA
+// can't be reached, the overrides already cached that haven't expired are
+// kept.
+func (ra *RegistrationAuthorityImpl) refreshRateLimitOverrides() cmd.RateLimitConfig {
+	ra.rlMu.Lock()
+	defer ra.rlMu.Unlock()
+
+	now := ra.clk.Now()
+	// Another request may have refreshed the overrides while we waited.
+	if ra.overridesFresh(now) {
+		return ra.rlMerged
+	}
+
+	overrides, err := ra.SA.GetRateLimitOverrides(now)
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Couldn't read rate limit overrides, keeping those cached: %s", err))
+		overrides = ra.rlOverrides
+	}
+	refresh := now.Add(ra.RateLimitOverridesTTL)
+	var valid []core.RateLimitOverride
+	for _, o := range overrides {
+		if !o.Expires.After(now) {
+			continue
+		}
+		if err := cmd.ValidateRateLimitOverride(o); err != nil {
+			ra.log.Warning(fmt.Sprintf("Ignoring rate limit override %d: %s", o.ID, err))
+			continue
+		}
+		if o.Expires.Before(refresh) {
+			refresh = o.Expires
+		}
+		valid = append(valid, o)
+	}
+	ra.rlOverrides = valid
+	ra.rlOverridesRefresh = &refresh
+	ra.rlMerged = ra.rlPolicies.WithOverrides(valid)
+	return ra.rlMerged
+}
+
+// SetRateLimitPolicies replaces the rate limit policies in effect. Checks
+// already in progress finish with the policies they started with. The caller
+// is responsible for validating policies first. Overrides stored in the SA are
+// read again and applied to the new policies.
+func (ra *RegistrationAuthorityImpl) SetRateLimitPolicies(policies cmd.RateLimitConfig) {
+	ra.rlMu.Lock()
+	ra.rlPolicies = policies
+	ra.rlOverridesRefresh = nil
+	ra.rlMu.Unlock()
+
+	// The cached issuance count may have been taken over a different window.
+	ra.tiMu.Lock()
+	ra.lastIssuedCount = nil
+	ra.tiMu.Unlock()
+}
+
+// limitExceeded records that a rate limit policy's threshold has been reached
+// and returns a RateLimitedError with the given detail and status. If the
+// policy is in shadow mode the rejection is only logged and counted, and nil
+// is returned so the request proceeds.
+func (ra *RegistrationAuthorityImpl) limitExceeded(limit cmd.RateLimitPolicy, stats metrics.Scope, msg, detail string, status core.RateLimitStatus) error {
+	if limit.Shadow {
+		stats.Inc("ShadowExceeded", 1)
+		ra.log.Info(fmt.Sprintf("%s (shadow mode, not enforced)", msg))
+		return nil
+	}
+	stats.Inc("Exceeded", 1)
+	ra.log.Info(msg)
+	return core.RateLimitedError{Detail: detail, Status: &status}
+}
+
+// windowStatus builds the status of a policy counted over a window. The
+// reset time is left unset, since it depends on when each counted event
+// happened; see setCounterReset.
+func windowStatus(name, key string, count int, limit cmd.RateLimitPolicy, regID int64) core.RateLimitStatus {
+	return core.RateLimitStatus{
+		Limit:     name,
+		Key:       key,
+		Count:     count,
+		Threshold: limit.GetThreshold(key, regID),
+	}
+}
+
+// setCounterReset sets the reset time of an exceeded status counted over
+// (earliest, latest] from the buckets of the rate limit counter with the
+// given key. If the limit isn't exceeded, or the counters don't cover the
+// window, the reset time isn't known and is left unset.
+func (ra *RegistrationAuthorityImpl) setCounterReset(status *core.RateLimitStatus, counterKey string, earliest, latest time.Time, limit cmd.RateLimitPolicy) error {
+	if !status.Exceeded() || !ra.useCounters(earliest) {
+		return nil
+	}
+	buckets, err := ra.RateLimits.Buckets(counterKey, earliest, latest)
+	if err != nil {
+		return err
+	}
+	status.Reset = ratelimit.ResetTime(buckets, status.Threshold, limit.Window.Duration)
+	return nil
+}
+
 // noRegistrationID is used for the regID parameter to GetThreshold when no
 // registration-based overrides are necessary.
 const noRegistrationID = -1
 
+func (ra *RegistrationAuthorityImpl) registrationsPerIPStatus(ip net.IP, limit cmd.RateLimitPolicy) (core.RateLimitStatus, error) {
+	now := ra.clk.Now()
+	count, err := ra.countRegistrationsByIP(ip, limit.WindowBegin(now), now)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	status := windowStatus("registrationsPerIP", ip.String(), count, limit, noRegistrationID)
+	err = ra.setCounterReset(&status, ratelimit.RegistrationsPerIPKey(ip), limit.WindowBegin(now), now, limit)
+	return status, err
+}
+
 func (ra *RegistrationAuthorityImpl) checkRegistrationLimit(ip net.IP) error {
-	limit := ra.rlPolicies.RegistrationsPerIP
+	limit := ra.rateLimitPolicies().RegistrationsPerIP
 	if limit.Enabled() {
-		now := ra.clk.Now()
-		count, err := ra.SA.CountRegistrationsByIP(ip, limit.WindowBegin(now), now)
+		status, err := ra.registrationsPerIPStatus(ip, limit)
 		if err != nil {
 			return err
 		}
-		if count >= limit.GetThreshold(ip.String(), noRegistrationID) {
-			ra.regByIPStats.Inc("Exceeded", 1)
-			ra.log.Info(fmt.Sprintf("Rate limit exceeded, RegistrationsByIP, IP: %s", ip))
-			return core.RateLimitedError("Too many registrations from this IP")
+		if status.Exceeded() {
+			return ra.limitExceeded(limit, ra.regByIPStats,
+				fmt.Sprintf("Rate limit exceeded, RegistrationsByIP, IP: %s", ip),
+				"Too many registrations from this IP", status)
 		}
 		ra.regByIPStats.Inc("Pass", 1)
 	}
 	return nil
 }
 
+// useCounters returns true if the rate limit counters are configured and have
+// been recording events since the start of a window beginning at earliest.
+func (ra *RegistrationAuthorityImpl) useCounters(earliest time.Time) bool {
+	return ra.RateLimits != nil && !earliest.Before(ra.RateLimitsSince)
+}
+
+// PruneRateLimitCounters discards the rate limit counter buckets that are
+// older than the longest window of the policies in effect, returning how many
+// were removed.
+func (ra *RegistrationAuthorityImpl) PruneRateLimitCounters() (int64, error) {
+	if ra.RateLimits == nil {
+		return 0, nil
+	}
+	policies := ra.rateLimitPolicies()
+	longest := policies.LongestWindow()
+	if longest <= 0 {
+		return 0, nil
+	}
+	return ra.RateLimits.Prune(ra.clk.Now().Add(-longest))
+}
+
+// countRegistrationsByIP counts the registrations created from ip in the given
+// window, using the rate limit counters if they cover it.
+func (ra *RegistrationAuthorityImpl) countRegistrationsByIP(ip net.IP, earliest, latest time.Time) (int, error) {
+	if ra.useCounters(earliest) {
+		return ra.RateLimits.Count(ratelimit.RegistrationsPerIPKey(ip), earliest, latest)
+	}
+	return ra.SA.CountRegistrationsByIP(ip, earliest, latest)
+}
+
+// recordRegistration updates the rate limit counters, if configured, for a
+// newly created registration. Failures are logged rather than returned, since
+// the registration already exists.
+func (ra *RegistrationAuthorityImpl) recordRegistration(ip net.IP) {
+	if ra.RateLimits == nil {
+		return
+	}
+	err := ra.RateLimits.Increment(ratelimit.RegistrationsPerIPKey(ip), ra.clk.Now(), 1)
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Couldn't update registration rate limit counter for %s: %s", ip, err))
+	}
+}
+
 // NewRegistration constructs a new Registration from a request.
 func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (reg core.Registration, err error) {
 	if err = ra.keyPolicy.GoodKey(init.Key.Key); err != nil {
@@ -238,6 +441,8 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 		// InternalServerError since the user-data was validated before being
 		// passed to the SA.
 		err = core.InternalServerError(err.Error())
+	} else {
+		ra.recordRegistration(reg.InitialIP)
 	}
 
 	ra.stats.Inc("RA.NewRegistrations", 1, 1.0)
@@ -276,26 +481,115 @@ func (ra *RegistrationAuthorityImpl) validateContacts(ctx context.Context, conta
 	return
 }
 
+// pendingAuthorizationStatus counts regID's pending authorizations. They are
+// counted as they stand rather than over a window, so the status has no reset
+// time.
+func (ra *RegistrationAuthorityImpl) pendingAuthorizationStatus(regID int64, limit cmd.RateLimitPolicy) (core.RateLimitStatus, error) {
+	count, err := ra.SA.CountPendingAuthorizations(regID)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	// Most rate limits have a key for overrides, but there is no meaningful key
+	// here.
+	noKey := ""
+	return core.RateLimitStatus{
+		Limit:     "pendingAuthorizationsPerAccount",
+		Count:     count,
+		Threshold: limit.GetThreshold(noKey, regID),
+	}, nil
+}
+
 func (ra *RegistrationAuthorityImpl) checkPendingAuthorizationLimit(regID int64) error {
-	limit := ra.rlPolicies.PendingAuthorizationsPerAccount
+	limit := ra.rateLimitPolicies().PendingAuthorizationsPerAccount
 	if limit.Enabled() {
-		count, err := ra.SA.CountPendingAuthorizations(regID)
+		status, err := ra.pendingAuthorizationStatus(regID, limit)
 		if err != nil {
 			return err
 		}
-		// Most rate limits have a key for overrides, but there is no meaningful key
-		// here.
-		noKey := ""
-		if count >= limit.GetThreshold(noKey, regID) {
-			ra.pendAuthByRegIDStats.Inc("Exceeded", 1)
-			ra.log.Info(fmt.Sprintf("Rate limit exceeded, PendingAuthorizationsByRegID, regID: %d", regID))
-			return core.RateLimitedError("Too many currently pending authorizations.")
+		if status.Exceeded() {
+			return ra.limitExceeded(limit, ra.pendAuthByRegIDStats,
+				fmt.Sprintf("Rate limit exceeded, PendingAuthorizationsByRegID, regID: %d", regID),
+				"Too many currently pending authorizations.", status)
 		}
 		ra.pendAuthByRegIDStats.Inc("Pass", 1)
 	}
 	return nil
 }
 
+// invalidAuthorizationStatus counts the authorizations for hostname regID
+// has had fail validation within the policy's window. Invalid authorizations
+// keep the expiry they were given while pending, so the window is shifted
+// forward by the pending authorization lifetime to count those created within
+// it. If the limit is reached, the reset time is when enough of them will
+// have expired out of the shifted window.
+func (ra *RegistrationAuthorityImpl) invalidAuthorizationStatus(regID int64, hostname string, limit cmd.RateLimitPolicy) (core.RateLimitStatus, error) {
+	now := ra.clk.Now()
+	latest := now.Add(ra.pendingAuthorizationLifetime)
+	count, err := ra.SA.CountInvalidAuthorizations(regID, hostname, limit.WindowBegin(latest), latest)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	status := windowStatus("invalidAuthorizationsPerAccount", hostname, count, limit, regID)
+	if !status.Exceeded() {
+		return status, nil
+	}
+	expiries, err := ra.SA.InvalidAuthorizationExpiries(regID, hostname, limit.WindowBegin(latest), latest)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	// Fewer than the threshold remain once the first count-threshold+1 have
+	// left the window.
+	if i := status.Count - status.Threshold; i >= 0 && i < len(expiries) {
+		reset := expiries[i].Add(limit.Window.Duration - ra.pendingAuthorizationLifetime)
+		status.Reset = &reset
+	}
+	return status, nil
+}
+
+func (ra *RegistrationAuthorityImpl) checkInvalidAuthorizationLimit(regID int64, hostname string) error {
+	limit := ra.rateLimitPolicies().InvalidAuthorizationsPerAccount
+	if !limit.Enabled() {
+		return nil
+	}
+	status, err := ra.invalidAuthorizationStatus(regID, hostname, limit)
+	if err != nil {
+		return err
+	}
+	if status.Exceeded() {
+		detail := fmt.Sprintf("Too many failed authorizations recently for %s", hostname)
+		if status.Reset != nil {
+			detail += fmt.Sprintf(", retry after %s", status.Reset.UTC().Format(time.RFC3339))
+		}
+		return ra.limitExceeded(limit, ra.invalidAuthByRegIDStats,
+			fmt.Sprintf("Rate limit exceeded, InvalidAuthorizationsByRegID, regID: %d, hostname: %s", regID, hostname),
+			detail,
+			status)
+	}
+	ra.invalidAuthByRegIDStats.Inc("Pass", 1)
+	return nil
+}
+
+// checkManualReview holds a hostname the VA considers high-risk for manual
+// review, returning nil only once an operator has approved it.
+func (ra *RegistrationAuthorityImpl) checkManualReview(hostname string, regID int64) error {
+	review, err := ra.SA.HoldForReview(hostname, regID)
+	if err != nil {
+		outErr := core.InternalServerError("unable to look up the manual review of the domain")
+		ra.log.Warning(fmt.Sprintf("%s: %s", string(outErr), err))
+		return outErr
+	}
+	switch review.Status {
+	case core.ManualReviewApproved:
+		ra.log.Audit(fmt.Sprintf("Authorization for %#v by registration %d allowed by manual review %d, approved by %s", hostname, regID, review.ID, review.Reviewer))
+		return nil
+	case core.ManualReviewDenied:
+		return core.UnauthorizedError(fmt.Sprintf("%#v was denied issuance after manual review", hostname))
+	default:
+		ra.log.Audit(fmt.Sprintf("Authorization for %#v by registration %d held for manual review %d", hostname, regID, review.ID))
+		return core.UnauthorizedError(fmt.Sprintf("%#v is considered high-risk and is held for manual review before issuance", hostname))
+	}
+}
+
 // NewAuthorization constructs a new Authz from a request. Values (domains) in
 // request.Identifier will be lowercased before storage.
 func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization, regID int64) (authz core.Authorization, err error) {
@@ -313,19 +607,36 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		return authz, err
 	}
 
+	// Reusing an authorization creates nothing, so it's done before the rate
+	// limits on creating them are checked.
+	if existing, ok := ra.reusableAuthorization(regID, identifier); ok {
+		return existing, nil
+	}
+
 	if err = ra.checkPendingAuthorizationLimit(regID); err != nil {
 		return authz, err
 	}
 
 	if identifier.Type == core.IdentifierDNS {
-		isSafe, err := ra.dc.IsSafe(identifier.Value)
+		if err = ra.checkInvalidAuthorizationLimit(regID, identifier.Value); err != nil {
+			return authz, err
+		}
+	}
+
+	if identifier.Type == core.IdentifierDNS {
+		safety, err := ra.dc.Check(identifier.Value)
 		if err != nil {
 			outErr := core.InternalServerError("unable to determine if domain was safe")
 			ra.log.Warning(fmt.Sprintf("%s: %s", string(outErr), err))
 			return authz, outErr
 		}
-		if !isSafe {
-			return authz, core.UnauthorizedError(fmt.Sprintf("%#v was considered an unsafe domain by a third-party API", identifier.Value))
+		if !safety.IsSafe {
+			return authz, core.UnauthorizedError(fmt.Sprintf("%#v was considered an unsafe domain by a domain reputation check", identifier.Value))
+		}
+		if safety.NeedsReview {
+			if err = ra.checkManualReview(identifier.Value, regID); err != nil {
+				return authz, err
+			}
 		}
 	}
 
@@ -366,6 +677,31 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 	return authz, err
 }
 
+// reusableAuthorization returns the authorization of regID for identifier
+// that expires last and remains usable for at least the reuse window,
+// preferring valid authorizations to pending ones. It returns false if
+// there's none, or if reuse is disabled.
+func (ra *RegistrationAuthorityImpl) reusableAuthorization(regID int64, identifier core.AcmeIdentifier) (core.Authorization, bool) {
+	if ra.AuthorizationReuseWindow <= 0 {
+		return core.Authorization{}, false
+	}
+	usableUntil := ra.clk.Now().Add(ra.AuthorizationReuseWindow)
+
+	// Errors, which include there being no such authorization, just mean a
+	// new one is created.
+	authz, err := ra.SA.GetLatestValidAuthorization(regID, identifier)
+	if err == nil && authz.Expires != nil && authz.Expires.After(usableUntil) {
+		ra.stats.Inc("RA.ReusedValidAuthorizations", 1, 1.0)
+		return authz, true
+	}
+	authz, err = ra.SA.GetLatestPendingAuthorization(regID, identifier)
+	if err == nil && authz.Expires != nil && authz.Expires.After(usableUntil) {
+		ra.stats.Inc("RA.ReusedPendingAuthorizations", 1, 1.0)
+		return authz, true
+	}
+	return core.Authorization{}, false
+}
+
 // MatchesCSR tests the contents of a generated certificate to make sure
 // that the PublicKey, CommonName, and DNSNames match those provided in
 // the CSR that was used to generate the certificate. It also checks the
@@ -582,6 +918,7 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 
 	logEventResult = "successful"
 
+	ra.recordIssuance(names)
 	ra.stats.Inc("RA.NewCertificates", 1, 1.0)
 	return cert, nil
 }
@@ -605,58 +942,194 @@ func domainsForRateLimiting(names []string) ([]string, error) {
 	return domains, nil
 }
 
-func (ra *RegistrationAuthorityImpl) checkCertificatesPerNameLimit(names []string, limit cmd.RateLimitPolicy, regID int64) error {
+// countCertificatesByNames counts the certificates issued for each of the
+// given registered domains in the window, using the rate limit counters if
+// they cover it.
+func (ra *RegistrationAuthorityImpl) countCertificatesByNames(domains []string, earliest, latest time.Time) (map[string]int, error) {
+	if !ra.useCounters(earliest) {
+		return ra.SA.CountCertificatesByNames(domains, earliest, latest)
+	}
+	counts := make(map[string]int, len(domains))
+	for _, domain := range domains {
+		count, err := ra.RateLimits.Count(ratelimit.CertificatesPerNameKey(domain), earliest, latest)
+		if err != nil {
+			return nil, err
+		}
+		counts[domain] = count
+	}
+	return counts, nil
+}
+
+// countFQDNSets counts the certificates issued for exactly the given names in
+// the window, using the rate limit counters if they cover it.
+func (ra *RegistrationAuthorityImpl) countFQDNSets(names []string, earliest, latest time.Time) (int, error) {
+	if ra.useCounters(earliest) {
+		return ra.RateLimits.Count(ratelimit.CertificatesPerFQDNSetKey(names), earliest, latest)
+	}
+	return ra.SA.CountFQDNSets(names, earliest, latest)
+}
+
+// recordIssuance updates the rate limit counters, if configured, for a newly
+// issued certificate. Failures are logged rather than returned, since the
+// certificate has already been issued.
+func (ra *RegistrationAuthorityImpl) recordIssuance(names []string) {
+	if ra.RateLimits == nil {
+		return
+	}
+	now := ra.clk.Now()
+	keys := []string{
+		ratelimit.TotalCertificatesKey,
+		ratelimit.CertificatesPerFQDNSetKey(names),
+	}
+	domains, err := domainsForRateLimiting(core.UniqueLowerNames(names))
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Couldn't determine rate limit domains for %s: %s", strings.Join(names, ","), err))
+	}
+	for _, domain := range domains {
+		keys = append(keys, ratelimit.CertificatesPerNameKey(domain))
+	}
+	for _, key := range keys {
+		if err := ra.RateLimits.Increment(key, now, 1); err != nil {
+			ra.log.Warning(fmt.Sprintf("Couldn't update rate limit counter %s: %s", key, err))
+		}
+	}
+}
+
+// certificatesPerNameStatus returns a status for each registered domain
+// among names.
+func (ra *RegistrationAuthorityImpl) certificatesPerNameStatus(names []string, limit cmd.RateLimitPolicy, regID int64) ([]core.RateLimitStatus, error) {
 	names, err := domainsForRateLimiting(names)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	now := ra.clk.Now()
 	windowBegin := limit.WindowBegin(now)
-	counts, err := ra.SA.CountCertificatesByNames(names, windowBegin, now)
+	counts, err := ra.countCertificatesByNames(names, windowBegin, now)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var badNames []string
+	statuses := make([]core.RateLimitStatus, 0, len(names))
 	for _, name := range names {
 		count, ok := counts[name]
 		if !ok {
 			// Shouldn't happen, but let's be careful anyhow.
-			return errors.New("StorageAuthority failed to return a count for every name")
+			return nil, errors.New("StorageAuthority failed to return a count for every name")
 		}
-		if count >= limit.GetThreshold(name, regID) {
-			badNames = append(badNames, name)
+		status := windowStatus("certificatesPerName", name, count, limit, regID)
+		err = ra.setCounterReset(&status, ratelimit.CertificatesPerNameKey(name), windowBegin, now, limit)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (ra *RegistrationAuthorityImpl) checkCertificatesPerNameLimit(names []string, limit cmd.RateLimitPolicy, regID int64) error {
+	statuses, err := ra.certificatesPerNameStatus(names, limit, regID)
+	if err != nil {
+		return err
+	}
+	var badNames []string
+	var firstBad core.RateLimitStatus
+	for _, status := range statuses {
+		if status.Exceeded() {
+			if len(badNames) == 0 {
+				firstBad = status
+			}
+			badNames = append(badNames, status.Key)
 		}
 	}
 	if len(badNames) > 0 {
 		domains := strings.Join(badNames, ", ")
-		ra.certsForDomainStats.Inc("Exceeded", 1)
-		ra.log.Info(fmt.Sprintf("Rate limit exceeded, CertificatesForDomain, regID: %d, domains: %s", regID, domains))
-		return core.RateLimitedError(fmt.Sprintf(
-			"Too many certificates already issued for: %s", domains))
-
+		return ra.limitExceeded(limit, ra.certsForDomainStats,
+			fmt.Sprintf("Rate limit exceeded, CertificatesForDomain, regID: %d, domains: %s", regID, domains),
+			fmt.Sprintf("Too many certificates already issued for: %s", domains),
+			firstBad)
 	}
 	ra.certsForDomainStats.Inc("Pass", 1)
 
 	return nil
 }
 
+func (ra *RegistrationAuthorityImpl) certificatesPerFQDNSetStatus(names []string, limit cmd.RateLimitPolicy, regID int64) (core.RateLimitStatus, error) {
+	names = core.UniqueLowerNames(names)
+	sort.Strings(names)
+	setKey := strings.Join(names, ",")
+	now := ra.clk.Now()
+	count, err := ra.countFQDNSets(names, limit.WindowBegin(now), now)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	status := windowStatus("certificatesPerFQDNSet", setKey, count, limit, regID)
+	err = ra.setCounterReset(&status, ratelimit.CertificatesPerFQDNSetKey(names), limit.WindowBegin(now), now, limit)
+	return status, err
+}
+
+func (ra *RegistrationAuthorityImpl) checkCertificatesPerFQDNSetLimit(names []string, limit cmd.RateLimitPolicy, regID int64) error {
+	status, err := ra.certificatesPerFQDNSetStatus(names, limit, regID)
+	if err != nil {
+		return err
+	}
+	if status.Exceeded() {
+		return ra.limitExceeded(limit, ra.certsPerFQDNSetStats,
+			fmt.Sprintf("Rate limit exceeded, CertificatesPerFQDNSet, regID: %d, names: %s", regID, status.Key),
+			fmt.Sprintf("Too many certificates already issued for exact set of domains: %s", status.Key),
+			status)
+	}
+	ra.certsPerFQDNSetStats.Inc("Pass", 1)
+	return nil
+}
+
+func (ra *RegistrationAuthorityImpl) totalCertificatesStatus(limit cmd.RateLimitPolicy) (core.RateLimitStatus, error) {
+	totalIssued, err := ra.getIssuanceCount(limit)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+	status := windowStatus("totalCertificates", "", totalIssued, limit, noRegistrationID)
+	now := ra.clk.Now()
+	err = ra.setCounterReset(&status, ratelimit.TotalCertificatesKey, limit.WindowBegin(now), now, limit)
+	return status, err
+}
+
 func (ra *RegistrationAuthorityImpl) checkLimits(names []string, regID int64) error {
-	limits := ra.rlPolicies
+	limits := ra.rateLimitPolicies()
 	if limits.TotalCertificates.Enabled() {
-		totalIssued, err := ra.getIssuanceCount()
+		status, err := ra.totalCertificatesStatus(limits.TotalCertificates)
 		if err != nil {
 			return err
 		}
-		if totalIssued >= ra.rlPolicies.TotalCertificates.Threshold {
+		if status.Exceeded() {
 			domains := strings.Join(names, ",")
-			ra.totalCertsStats.Inc("Exceeded", 1)
-			ra.log.Info(fmt.Sprintf("Rate limit exceeded, TotalCertificates, regID: %d, domains: %s, totalIssued: %d", regID, domains, totalIssued))
-			return core.RateLimitedError("Certificate issuance limit reached")
+			err = ra.limitExceeded(limits.TotalCertificates, ra.totalCertsStats,
+				fmt.Sprintf("Rate limit exceeded, TotalCertificates, regID: %d, domains: %s, totalIssued: %d", regID, domains, status.Count),
+				"Certificate issuance limit reached", status)
+			if err != nil {
+				return err
+			}
+		} else {
+			ra.totalCertsStats.Inc("Pass", 1)
 		}
-		ra.totalCertsStats.Inc("Pass", 1)
 	}
 	if limits.CertificatesPerName.Enabled() {
-		err := ra.checkCertificatesPerNameLimit(names, limits.CertificatesPerName, regID)
+		// A renewal of exactly the same set of names as a previous certificate
+		// doesn't use up any of the per-name budget. It is governed by the
+		// CertificatesPerFQDNSet limit below instead.
+		renewal, err := ra.SA.FQDNSetExists(names)
+		if err != nil {
+			return err
+		}
+		if renewal {
+			ra.certsForDomainStats.Inc("FQDNSetBypass", 1)
+		} else {
+			err = ra.checkCertificatesPerNameLimit(names, limits.CertificatesPerName, regID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if limits.CertificatesPerFQDNSet.Enabled() {
+		err := ra.checkCertificatesPerFQDNSetLimit(names, limits.CertificatesPerFQDNSet, regID)
 		if err != nil {
 			return err
 		}
@@ -664,6 +1137,77 @@ func (ra *RegistrationAuthorityImpl) checkLimits(names []string, regID int64) er
 	return nil
 }
 
+// maxRateLimitStatusNames bounds how many names RateLimitStatus will look up
+// at once.
+const maxRateLimitStatusNames = 100
+
+// RateLimitStatus reports regID's current usage of each enabled rate limit
+// policy that applies to the account, and of those that would apply to a
+// certificate for names. It lets subscribers see how close they are to a
+// limit before they hit it.
+func (ra *RegistrationAuthorityImpl) RateLimitStatus(regID int64, names []string) ([]core.RateLimitStatus, error) {
+	if len(names) > maxRateLimitStatusNames {
+		return nil, core.MalformedRequestError(fmt.Sprintf("Too many names, at most %d may be queried at once", maxRateLimitStatusNames))
+	}
+	reg, err := ra.SA.GetRegistration(regID)
+	if err != nil {
+		return nil, core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", regID))
+	}
+	names = core.UniqueLowerNames(names)
+	limits := ra.rateLimitPolicies()
+
+	var statuses []core.RateLimitStatus
+	appendStatus := func(status core.RateLimitStatus, err error) error {
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+		return nil
+	}
+	if limits.TotalCertificates.Enabled() {
+		if err = appendStatus(ra.totalCertificatesStatus(limits.TotalCertificates)); err != nil {
+			return nil, err
+		}
+	}
+	if limits.RegistrationsPerIP.Enabled() && reg.InitialIP != nil {
+		if err = appendStatus(ra.registrationsPerIPStatus(reg.InitialIP, limits.RegistrationsPerIP)); err != nil {
+			return nil, err
+		}
+	}
+	if limits.PendingAuthorizationsPerAccount.Enabled() {
+		if err = appendStatus(ra.pendingAuthorizationStatus(regID, limits.PendingAuthorizationsPerAccount)); err != nil {
+			return nil, err
+		}
+	}
+	if len(names) == 0 {
+		return statuses, nil
+	}
+	if _, err = domainsForRateLimiting(names); err != nil {
+		return nil, core.MalformedRequestError(fmt.Sprintf("Invalid names: %s", err))
+	}
+
+	if limits.CertificatesPerName.Enabled() {
+		nameStatuses, err := ra.certificatesPerNameStatus(names, limits.CertificatesPerName, regID)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, nameStatuses...)
+	}
+	if limits.CertificatesPerFQDNSet.Enabled() {
+		if err = appendStatus(ra.certificatesPerFQDNSetStatus(names, limits.CertificatesPerFQDNSet, regID)); err != nil {
+			return nil, err
+		}
+	}
+	if limits.InvalidAuthorizationsPerAccount.Enabled() {
+		for _, name := range names {
+			if err = appendStatus(ra.invalidAuthorizationStatus(regID, name, limits.InvalidAuthorizationsPerAccount)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return statuses, nil
+}
+
 // UpdateRegistration updates an existing Registration with new values.
 func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration, update core.Registration) (reg core.Registration, err error) {
 	base.MergeUpdate(update)
@@ -686,6 +1230,22 @@ func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration,
 	return
 }
 
+// UpdateNotificationPreferences replaces the notification preferences of an
+// existing registration.
+func (ra *RegistrationAuthorityImpl) UpdateNotificationPreferences(prefs core.NotificationPreferences) error {
+	if _, err := ra.SA.GetRegistration(prefs.RegistrationID); err != nil {
+		return core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", prefs.RegistrationID))
+	}
+	if prefs.Locale != "" && !core.LooksLikeALocale(prefs.Locale) {
+		return core.MalformedRequestError(fmt.Sprintf("Invalid locale: %q", prefs.Locale))
+	}
+	if err := ra.SA.SetNotificationPreferences(prefs); err != nil {
+		return core.InternalServerError(fmt.Sprintf("Could not update notification preferences: %s", err))
+	}
+	ra.stats.Inc("RA.UpdatedNotificationPreferences", 1, 1.0)
+	return nil
+}
+
 // UpdateAuthorization updates an authorization with new values.
 func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
 	// Refuse to update expired authorizations
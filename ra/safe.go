@@ -17,17 +17,13 @@ type DomainCheck struct {
 	VA core.ValidationAuthority
 }
 
-// IsSafe returns true if the VA's IsSafeDomain RPC says the domain is safe or
-// if DomainCheck is nil.
-func (d *DomainCheck) IsSafe(domain string) (bool, error) {
+// Check returns the VA's IsSafeDomain verdict for the domain, or a safe
+// verdict if DomainCheck is nil.
+func (d *DomainCheck) Check(domain string) (*core.IsSafeDomainResponse, error) {
 	// This nil check allows us to not actually call
 	if d == nil {
-		return true, nil
+		return &core.IsSafeDomainResponse{IsSafe: true}, nil
 	}
 
-	resp, err := d.VA.IsSafeDomain(&core.IsSafeDomainRequest{Domain: domain})
-	if err != nil {
-		return false, err
-	}
-	return resp.IsSafe, nil
+	return d.VA.IsSafeDomain(&core.IsSafeDomainRequest{Domain: domain})
 }
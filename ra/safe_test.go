@@ -27,6 +27,45 @@ func TestChecksVASafeDomain(t *testing.T) {
 	}
 }
 
+func TestChecksVASafeDomainReview(t *testing.T) {
+	va, sa, ra, _, cleanUp := initAuthorities(t)
+	defer cleanUp()
+
+	va.NeedsReview = true
+
+	_, err := ra.NewAuthorization(AuthzRequest, Registration.ID)
+	if err == nil {
+		t.Errorf("want UnauthorizedError, got nil")
+	} else if _, ok := err.(core.UnauthorizedError); !ok {
+		t.Errorf("want UnauthorizedError, got %T", err)
+	}
+
+	reviews, err := sa.GetManualReviews(core.ManualReviewPending)
+	test.AssertNotError(t, err, "Failed to get pending manual reviews")
+	test.AssertEquals(t, len(reviews), 1)
+	test.AssertEquals(t, reviews[0].Hostname, AuthzRequest.Identifier.Value)
+	test.AssertEquals(t, reviews[0].RegistrationID, Registration.ID)
+
+	// Asking again doesn't queue the hostname twice
+	_, err = ra.NewAuthorization(AuthzRequest, Registration.ID)
+	test.AssertError(t, err, "Authorization held for review was allowed")
+	reviews, err = sa.GetManualReviews(core.ManualReviewPending)
+	test.AssertNotError(t, err, "Failed to get pending manual reviews")
+	test.AssertEquals(t, len(reviews), 1)
+
+	err = sa.SetManualReviewStatus(reviews[0].ID, core.ManualReviewDenied, "reviewer@example.com")
+	test.AssertNotError(t, err, "Failed to deny manual review")
+	_, err = ra.NewAuthorization(AuthzRequest, Registration.ID)
+	if _, ok := err.(core.UnauthorizedError); !ok {
+		t.Errorf("want UnauthorizedError, got %T", err)
+	}
+
+	err = sa.SetManualReviewStatus(reviews[0].ID, core.ManualReviewApproved, "reviewer@example.com")
+	test.AssertNotError(t, err, "Failed to approve manual review")
+	_, err = ra.NewAuthorization(AuthzRequest, Registration.ID)
+	test.AssertNotError(t, err, "Authorization approved by manual review was refused")
+}
+
 func TestHandlesVASafeDomainError(t *testing.T) {
 	va, _, ra, _, cleanUp := initAuthorities(t)
 	defer cleanUp()
@@ -0,0 +1,103 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package ratelimit provides event counters for the RA's rate limits. Rather
+// than counting certificates and registrations with live queries against the
+// SA, the RA increments a counter for each rate limit key when it issues a
+// certificate or creates a registration, and reads the counter back when
+// checking a limit.
+//
+// Counters only know about events recorded since they were enabled, so until
+// the longest rate limit window has passed since then the RA keeps counting
+// windows that begin earlier with live queries against the SA (see the RA's
+// RateLimitsSince). Buckets older than the longest window are no longer needed
+// and are discarded with Prune.
+//
+// Counters are kept in fixed-width time buckets, so checking a key costs a
+// single lookup whatever the volume of issuance. A window's count includes
+// the whole bucket its start falls in, so counts may be over-estimated by up
+// to one bucket's worth of events, but never under-estimated.
+package ratelimit
+
+import (
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Counter records events by key and counts them over a sliding window.
+type Counter interface {
+	// Increment records n events for key at the given time.
+	Increment(key string, at time.Time, n int) error
+	// Count returns the number of events recorded for key in the window
+	// (earliest, latest].
+	Count(key string, earliest, latest time.Time) (int, error)
+	// Buckets returns the non-empty buckets counted for key in the window
+	// (earliest, latest], oldest first.
+	Buckets(key string, earliest, latest time.Time) ([]Bucket, error)
+	// Prune discards the events recorded for every key in buckets that end
+	// at or before the given time, and returns how many buckets it removed.
+	Prune(before time.Time) (int64, error)
+}
+
+// Bucket is the number of events recorded for a key between Start and End.
+type Bucket struct {
+	Start, End time.Time
+	Count      int
+}
+
+// ResetTime returns when enough of the events in buckets will have left a
+// window of the given width for fewer than threshold to remain counted, or nil
+// if fewer than threshold are counted already. buckets must be oldest first.
+func ResetTime(buckets []Bucket, threshold int, window time.Duration) *time.Time {
+	excess := 1 - threshold
+	for _, b := range buckets {
+		excess += b.Count
+	}
+	if excess <= 0 {
+		return nil
+	}
+	for _, b := range buckets {
+		excess -= b.Count
+		if excess <= 0 {
+			// A bucket is counted for as long as the window's start falls
+			// in or before it.
+			reset := b.End.Add(window)
+			return &reset
+		}
+	}
+	return nil
+}
+
+// DefaultResolution is the bucket width used when none is configured.
+const DefaultResolution = time.Hour
+
+// bucketStart returns the start of the bucket containing t.
+func bucketStart(t time.Time, resolution time.Duration) time.Time {
+	return t.UTC().Truncate(resolution)
+}
+
+// TotalCertificatesKey is the key counting every certificate issued.
+const TotalCertificatesKey = "totalCertificates"
+
+// CertificatesPerNameKey returns the key counting certificates issued for
+// names under the given registered domain (eTLD+1).
+func CertificatesPerNameKey(domain string) string {
+	return "certificatesPerName:" + domain
+}
+
+// CertificatesPerFQDNSetKey returns the key counting certificates issued for
+// exactly the given set of names, ignoring order, case and duplicates.
+func CertificatesPerFQDNSetKey(names []string) string {
+	return "certificatesPerFQDNSet:" + hex.EncodeToString(core.HashNames(names))
+}
+
+// RegistrationsPerIPKey returns the key counting registrations created from
+// the given IP.
+func RegistrationsPerIPKey(ip net.IP) string {
+	return "registrationsPerIP:" + ip.String()
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCounter is a Counter held in process memory. Its counts are not
+// shared between RA instances and are lost on restart, so it is intended for
+// tests and single-instance development setups.
+type MemoryCounter struct {
+	resolution time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]map[time.Time]int
+}
+
+// NewMemoryCounter constructs a MemoryCounter with the given bucket width. A
+// zero resolution means DefaultResolution.
+func NewMemoryCounter(resolution time.Duration) *MemoryCounter {
+	if resolution <= 0 {
+		resolution = DefaultResolution
+	}
+	return &MemoryCounter{
+		resolution: resolution,
+		buckets:    make(map[string]map[time.Time]int),
+	}
+}
+
+// Increment records n events for key at the given time.
+func (mc *MemoryCounter) Increment(key string, at time.Time, n int) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	keyBuckets, ok := mc.buckets[key]
+	if !ok {
+		keyBuckets = make(map[time.Time]int)
+		mc.buckets[key] = keyBuckets
+	}
+	keyBuckets[bucketStart(at, mc.resolution)] += n
+	return nil
+}
+
+// Count returns the number of events recorded for key in the window
+// (earliest, latest].
+func (mc *MemoryCounter) Count(key string, earliest, latest time.Time) (int, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	first := bucketStart(earliest, mc.resolution)
+	var count int
+	for start, n := range mc.buckets[key] {
+		if !start.Before(first) && !start.After(latest) {
+			count += n
+		}
+	}
+	return count, nil
+}
+
+// Buckets returns the non-empty buckets counted for key in the window
+// (earliest, latest], oldest first.
+func (mc *MemoryCounter) Buckets(key string, earliest, latest time.Time) ([]Bucket, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	first := bucketStart(earliest, mc.resolution)
+	var buckets []Bucket
+	for start, n := range mc.buckets[key] {
+		if n != 0 && !start.Before(first) && !start.After(latest) {
+			buckets = append(buckets, Bucket{Start: start, End: start.Add(mc.resolution), Count: n})
+		}
+	}
+	sort.Sort(byStart(buckets))
+	return buckets, nil
+}
+
+type byStart []Bucket
+
+func (b byStart) Len() int           { return len(b) }
+func (b byStart) Less(i, j int) bool { return b[i].Start.Before(b[j].Start) }
+func (b byStart) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Prune discards the events recorded for every key in buckets that end at or
+// before the given time.
+func (mc *MemoryCounter) Prune(before time.Time) (int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	first := bucketStart(before, mc.resolution)
+	var pruned int64
+	for key, keyBuckets := range mc.buckets {
+		for start := range keyBuckets {
+			if start.Before(first) {
+				delete(keyBuckets, start)
+				pruned++
+			}
+		}
+		if len(keyBuckets) == 0 {
+			delete(mc.buckets, key)
+		}
+	}
+	return pruned, nil
+}
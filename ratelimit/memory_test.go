@@ -0,0 +1,99 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+var start = time.Date(2015, 3, 4, 5, 0, 0, 0, time.UTC)
+
+// testCounter exercises the behaviour every Counter implementation should
+// share, given one with a one hour resolution.
+func testCounter(t *testing.T, c Counter) {
+	key := CertificatesPerNameKey("example.com")
+	test.AssertNotError(t, c.Increment(key, start.Add(10*time.Minute), 1), "Increment failed")
+	test.AssertNotError(t, c.Increment(key, start.Add(20*time.Minute), 2), "Increment failed")
+	test.AssertNotError(t, c.Increment(key, start.Add(5*time.Hour), 1), "Increment failed")
+	test.AssertNotError(t, c.Increment(CertificatesPerNameKey("example.org"), start, 1), "Increment failed")
+
+	testCases := []struct {
+		earliest, latest time.Time
+		count            int
+	}{
+		{start, start.Add(6 * time.Hour), 4},
+		{start, start.Add(time.Hour), 3},
+		// A window starting part way through a bucket includes all of it.
+		{start.Add(30 * time.Minute), start.Add(time.Hour), 3},
+		{start.Add(time.Hour), start.Add(6 * time.Hour), 1},
+		{start.Add(6 * time.Hour), start.Add(7 * time.Hour), 0},
+	}
+	for _, tc := range testCases {
+		count, err := c.Count(key, tc.earliest, tc.latest)
+		test.AssertNotError(t, err, "Count failed")
+		test.AssertEquals(t, count, tc.count)
+	}
+
+	count, err := c.Count(CertificatesPerNameKey("example.net"), start, start.Add(time.Hour))
+	test.AssertNotError(t, err, "Count failed")
+	test.AssertEquals(t, count, 0)
+
+	buckets, err := c.Buckets(key, start.Add(30*time.Minute), start.Add(6*time.Hour))
+	test.AssertNotError(t, err, "Buckets failed")
+	test.AssertEquals(t, len(buckets), 2)
+	test.Assert(t, buckets[0].Start.Equal(start), "wrong start for first bucket")
+	test.Assert(t, buckets[0].End.Equal(start.Add(time.Hour)), "wrong end for first bucket")
+	test.AssertEquals(t, buckets[0].Count, 3)
+	test.Assert(t, buckets[1].Start.Equal(start.Add(5*time.Hour)), "wrong start for second bucket")
+	test.AssertEquals(t, buckets[1].Count, 1)
+
+	// Pruning keeps the bucket containing the given time.
+	pruned, err := c.Prune(start.Add(5*time.Hour + 30*time.Minute))
+	test.AssertNotError(t, err, "Prune failed")
+	test.AssertEquals(t, pruned, int64(2))
+	count, err = c.Count(key, start, start.Add(6*time.Hour))
+	test.AssertNotError(t, err, "Count failed")
+	test.AssertEquals(t, count, 1)
+	count, err = c.Count(CertificatesPerNameKey("example.org"), start, start.Add(time.Hour))
+	test.AssertNotError(t, err, "Count failed")
+	test.AssertEquals(t, count, 0)
+}
+
+func TestMemoryCounter(t *testing.T) {
+	testCounter(t, NewMemoryCounter(time.Hour))
+}
+
+func TestResetTime(t *testing.T) {
+	buckets := []Bucket{
+		{Start: start, End: start.Add(time.Hour), Count: 3},
+		{Start: start.Add(5 * time.Hour), End: start.Add(6 * time.Hour), Count: 1},
+	}
+	window := 24 * time.Hour
+
+	test.Assert(t, ResetTime(buckets, 5, window) == nil, "reset time for a limit that isn't reached")
+	test.Assert(t, ResetTime(nil, 1, window) == nil, "reset time with nothing counted")
+
+	// Once the first bucket leaves the window fewer than 4 remain...
+	reset := ResetTime(buckets, 4, window)
+	test.Assert(t, reset != nil && reset.Equal(start.Add(25*time.Hour)), "wrong reset time")
+	reset = ResetTime(buckets, 2, window)
+	test.Assert(t, reset != nil && reset.Equal(start.Add(25*time.Hour)), "wrong reset time")
+	// ...but fewer than 1 remain only once the second has too.
+	reset = ResetTime(buckets, 1, window)
+	test.Assert(t, reset != nil && reset.Equal(start.Add(30*time.Hour)), "wrong reset time")
+}
+
+func TestCertificatesPerFQDNSetKey(t *testing.T) {
+	test.AssertEquals(t,
+		CertificatesPerFQDNSetKey([]string{"www.example.com", "Example.com"}),
+		CertificatesPerFQDNSetKey([]string{"example.com", "www.example.com", "example.com"}))
+	test.AssertNotEquals(t,
+		CertificatesPerFQDNSetKey([]string{"example.com"}),
+		CertificatesPerFQDNSetKey([]string{"example.com", "www.example.com"}))
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"time"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+// SQLCounter is a Counter backed by the rateLimitCounters table of the SA
+// database, which lets every RA instance share the same counts.
+type SQLCounter struct {
+	dbMap      *gorp.DbMap
+	dialect    sa.Dialect
+	resolution time.Duration
+}
+
+// NewSQLCounter constructs a SQLCounter using the given dbMap and bucket
+// width. A zero resolution means DefaultResolution. Every RA sharing the table
+// must use the same resolution.
+func NewSQLCounter(dbMap *gorp.DbMap, resolution time.Duration) *SQLCounter {
+	if resolution <= 0 {
+		resolution = DefaultResolution
+	}
+	return &SQLCounter{dbMap: dbMap, dialect: sa.DialectOf(dbMap), resolution: resolution}
+}
+
+// Increment records n events for key at the given time.
+func (sc *SQLCounter) Increment(key string, at time.Time, n int) error {
+	_, err := sc.dbMap.Exec(
+		sa.Rebind(sc.dbMap, `INSERT INTO rateLimitCounters (counterKey, bucket, count)
+		 VALUES (?, ?, ?) `)+
+			sc.dialect.OnDuplicateKey(
+				[]string{"counterKey", "bucket"},
+				"count = rateLimitCounters.count + "+sc.dialect.Inserted("count"),
+			),
+		key,
+		bucketStart(at, sc.resolution),
+		n,
+	)
+	return err
+}
+
+// Count returns the number of events recorded for key in the window
+// (earliest, latest].
+func (sc *SQLCounter) Count(key string, earliest, latest time.Time) (int, error) {
+	var count int64
+	err := sc.dbMap.SelectOne(
+		&count,
+		`SELECT COALESCE(SUM(count), 0) FROM rateLimitCounters
+		 WHERE counterKey = :key
+		 AND bucket >= :first AND bucket <= :latest`,
+		map[string]interface{}{
+			"key":    key,
+			"first":  bucketStart(earliest, sc.resolution),
+			"latest": latest,
+		},
+	)
+	return int(count), err
+}
+
+// Buckets returns the non-empty buckets counted for key in the window
+// (earliest, latest], oldest first.
+func (sc *SQLCounter) Buckets(key string, earliest, latest time.Time) ([]Bucket, error) {
+	var rows []struct {
+		Bucket time.Time `db:"bucket"`
+		Count  int       `db:"count"`
+	}
+	_, err := sc.dbMap.Select(
+		&rows,
+		`SELECT bucket, count FROM rateLimitCounters
+		 WHERE counterKey = :key
+		 AND bucket >= :first AND bucket <= :latest
+		 AND count != 0
+		 ORDER BY bucket`,
+		map[string]interface{}{
+			"key":    key,
+			"first":  bucketStart(earliest, sc.resolution),
+			"latest": latest,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]Bucket, len(rows))
+	for i, row := range rows {
+		start := row.Bucket.UTC()
+		buckets[i] = Bucket{Start: start, End: start.Add(sc.resolution), Count: row.Count}
+	}
+	return buckets, nil
+}
+
+// Prune discards the events recorded for every key in buckets that end at or
+// before the given time.
+func (sc *SQLCounter) Prune(before time.Time) (int64, error) {
+	result, err := sc.dbMap.Exec(
+		sa.Rebind(sc.dbMap, `DELETE FROM rateLimitCounters WHERE bucket < ?`),
+		bucketStart(before, sc.resolution),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
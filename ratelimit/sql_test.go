@@ -0,0 +1,26 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func TestSQLCounter(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnSARA)
+	if err != nil {
+		t.Fatalf("Failed to create dbMap: %s", err)
+	}
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+
+	testCounter(t, NewSQLCounter(dbMap, time.Hour))
+}
@@ -187,9 +187,10 @@ func (rpc *AmqpRPCServer) HandleDeliveries(handler DeliveryHandler) {
 // rpcError is a JSON wrapper for error as it cannot be un/marshalled
 // due to type interface{}.
 type rpcError struct {
-	Value      string `json:"value"`
-	Type       string `json:"type,omitempty"`
-	HTTPStatus int    `json:"status,omitempty"`
+	Value      string                `json:"value"`
+	Type       string                `json:"type,omitempty"`
+	HTTPStatus int                   `json:"status,omitempty"`
+	RateLimit  *core.RateLimitStatus `json:"rateLimit,omitempty"`
 }
 
 // Wraps an error in a rpcError so it can be marshalled to
@@ -220,6 +221,7 @@ func wrapError(err error) *rpcError {
 			wrapped.Type = "TooManyRPCRequestsError"
 		case core.RateLimitedError:
 			wrapped.Type = "RateLimitedError"
+			wrapped.RateLimit = terr.Status
 		case core.ServiceUnavailableError:
 			wrapped.Type = "ServiceUnavailableError"
 		case *probs.ProblemDetails:
@@ -255,7 +257,7 @@ func unwrapError(rpcError *rpcError) error {
 		case "TooManyRPCRequestsError":
 			return core.TooManyRPCRequestsError(rpcError.Value)
 		case "RateLimitedError":
-			return core.RateLimitedError(rpcError.Value)
+			return core.RateLimitedError{Detail: rpcError.Value, Status: rpcError.RateLimit}
 		case "ServiceUnavailableError":
 			return core.ServiceUnavailableError(rpcError.Value)
 		default:
@@ -431,7 +433,7 @@ func (rpc *AmqpRPCServer) Start(c *cmd.AMQPConfig) error {
 	rpc.connected = true
 	rpc.mu.Unlock()
 
-	go rpc.catchSignals()
+	rpc.catchSignals()
 
 	for {
 		select {
@@ -479,16 +481,21 @@ var signalToName = map[os.Signal]string{
 	syscall.SIGHUP:  "SIGHUP",
 }
 
+// catchSignals stops the server when the process receives one of the signals
+// in signalToName. Other signals, such as the SIGUSR1 the RA reloads its rate
+// limit policies on, are left to the rest of the process.
 func (rpc *AmqpRPCServer) catchSignals() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM)
 	signal.Notify(sigChan, syscall.SIGINT)
 	signal.Notify(sigChan, syscall.SIGHUP)
 
-	sig := <-sigChan
-	rpc.log.Info(fmt.Sprintf(" [!] Caught %s", signalToName[sig]))
-	rpc.Stop()
-	signal.Stop(sigChan)
+	go func() {
+		sig := <-sigChan
+		rpc.log.Info(fmt.Sprintf(" [!] Caught %s", signalToName[sig]))
+		rpc.Stop()
+		signal.Stop(sigChan)
+	}()
 }
 
 // Stop gracefully stops the AmqpRPCServer, after calling AmqpRPCServer.Start will
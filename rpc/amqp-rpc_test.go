@@ -7,10 +7,19 @@ package rpc
 
 import (
 	"errors"
+	"os"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/golang/mock/gomock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
+	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -25,7 +34,7 @@ func TestWrapError(t *testing.T) {
 		core.SignatureValidationError("foo"),
 		core.CertificateIssuanceError("foo"),
 		core.NoSuchRegistrationError("foo"),
-		core.RateLimitedError("foo"),
+		core.RateLimitedError{Detail: "foo"},
 		core.TooManyRPCRequestsError("foo"),
 		errors.New("foo"),
 	}
@@ -62,6 +71,16 @@ func TestWrapError(t *testing.T) {
 			errors.New(""),
 			errors.New(""),
 		},
+		{
+			core.RateLimitedError{
+				Detail: "too many",
+				Status: &core.RateLimitStatus{Limit: "certificatesPerName", Key: "example.com", Count: 5, Threshold: 5},
+			},
+			core.RateLimitedError{
+				Detail: "too many",
+				Status: &core.RateLimitStatus{Limit: "certificatesPerName", Key: "example.com", Count: 5, Threshold: 5},
+			},
+		},
 	}
 	for i, tc := range complicated {
 		actual := unwrapError(wrapError(tc.given))
@@ -71,3 +90,62 @@ func TestWrapError(t *testing.T) {
 
 	}
 }
+
+// TestServerKeepsServingOnReload checks that the signal the RA reloads its
+// rate limit policies on doesn't also stop its RPC server.
+func TestServerKeepsServingOnReload(t *testing.T) {
+	ac, mockChannel, finish := setup(t)
+	defer finish()
+	deliveries := make(chan amqp.Delivery)
+	mockChannel.EXPECT().QueueDeclare(
+		"fooqueue", AmqpDurable, AmqpDeleteUnused, AmqpExclusive, AmqpNoWait, nil)
+	mockChannel.EXPECT().QueueBind("fooqueue", "fooqueue", AmqpExchange, false, nil)
+	mockChannel.EXPECT().Consume("fooqueue", consumerName, AmqpAutoAck, AmqpExclusive, AmqpNoLocal, AmqpNoWait, nil).Return((<-chan amqp.Delivery)(deliveries), nil)
+	mockChannel.EXPECT().NotifyClose(gomock.Any()).Return(make(chan *amqp.Error))
+	mockChannel.EXPECT().Cancel(consumerName, false)
+
+	stats, _ := statsd.NewNoopClient(nil)
+	server := &AmqpRPCServer{
+		serverQueue:   "fooqueue",
+		connection:    ac,
+		log:           blog.GetAuditLogger(),
+		dispatchTable: make(map[string]messageHandler),
+		stats:         stats,
+		clk:           clock.NewFake(),
+	}
+	handled := make(chan string)
+	server.HandleDeliveries(func(d amqp.Delivery) {
+		handled <- string(d.Body)
+	})
+
+	reloaded := make(chan struct{}, 1)
+	cmd.ReloadRateLimitPoliciesOnSignal("../test/rate-limit-policies.yml", blog.GetAuditLogger(), func(cmd.RateLimitConfig) {
+		reloaded <- struct{}{}
+	})
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Start(&cmd.AMQPConfig{})
+	}()
+	deliveries <- amqp.Delivery{Body: []byte("before")}
+	test.AssertEquals(t, <-handled, "before")
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	test.AssertNotError(t, err, "Failed to send reload signal")
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rate limit policies weren't reloaded")
+	}
+
+	select {
+	case deliveries <- amqp.Delivery{Body: []byte("after")}:
+		test.AssertEquals(t, <-handled, "after")
+	case err := <-stopped:
+		t.Fatalf("RPC server stopped on reload signal: %v", err)
+	}
+
+	server.Stop()
+	close(deliveries)
+	test.AssertNotError(t, <-stopped, "RPC server failed")
+}
@@ -45,15 +45,19 @@ const (
 	MethodRevokeCertificateWithReg          = "RevokeCertificateWithReg"          // RA
 	MethodAdministrativelyRevokeCertificate = "AdministrativelyRevokeCertificate" // RA
 	MethodOnValidationUpdate                = "OnValidationUpdate"                // RA
+	MethodRateLimitStatus                   = "RateLimitStatus"                   // RA
+	MethodUpdateNotificationPreferences     = "UpdateNotificationPreferences"     // RA
 	MethodUpdateValidations                 = "UpdateValidations"                 // VA
 	MethodCheckCAARecords                   = "CheckCAARecords"                   // VA
 	MethodIsSafeDomain                      = "IsSafeDomain"                      // VA
+	MethodReplayValidation                  = "ReplayValidation"                  // VA
 	MethodIssueCertificate                  = "IssueCertificate"                  // CA
 	MethodGenerateOCSP                      = "GenerateOCSP"                      // CA
 	MethodGetRegistration                   = "GetRegistration"                   // SA
 	MethodGetRegistrationByKey              = "GetRegistrationByKey"              // RA, SA
 	MethodGetAuthorization                  = "GetAuthorization"                  // SA
 	MethodGetLatestValidAuthorization       = "GetLatestValidAuthorization"       // SA
+	MethodGetLatestPendingAuthorization     = "GetLatestPendingAuthorization"     // SA
 	MethodGetCertificate                    = "GetCertificate"                    // SA
 	MethodGetCertificateStatus              = "GetCertificateStatus"              // SA
 	MethodMarkCertificateRevoked            = "MarkCertificateRevoked"            // SA
@@ -66,9 +70,21 @@ const (
 	MethodCountCertificatesRange            = "CountCertificatesRange"            // SA
 	MethodCountCertificatesByNames          = "CountCertificatesByNames"          // SA
 	MethodCountRegistrationsByIP            = "CountRegistrationsByIP"            // SA
+	MethodFQDNSetExists                     = "FQDNSetExists"                     // SA
+	MethodCountFQDNSets                     = "CountFQDNSets"                     // SA
 	MethodCountPendingAuthorizations        = "CountPendingAuthorizations"        // SA
+	MethodCountInvalidAuthorizations        = "CountInvalidAuthorizations"        // SA
+	MethodInvalidAuthorizationExpiries      = "InvalidAuthorizationExpiries"      // SA
 	MethodGetSCTReceipt                     = "GetSCTReceipt"                     // SA
 	MethodAddSCTReceipt                     = "AddSCTReceipt"                     // SA
+	MethodGetRateLimitOverrides             = "GetRateLimitOverrides"             // SA
+	MethodAddRateLimitOverride              = "AddRateLimitOverride"              // SA
+	MethodExpireRateLimitOverride           = "ExpireRateLimitOverride"           // SA
+	MethodGetNotificationPreferences        = "GetNotificationPreferences"        // SA
+	MethodSetNotificationPreferences        = "SetNotificationPreferences"        // SA
+	MethodHoldForReview                     = "HoldForReview"                     // SA
+	MethodGetManualReviews                  = "GetManualReviews"                  // SA
+	MethodSetManualReviewStatus             = "SetManualReviewStatus"             // SA
 	MethodSubmitToCT                        = "SubmitToCT"                        // Pub
 )
 
@@ -90,6 +106,11 @@ type authorizationRequest struct {
 	RegID int64
 }
 
+type rateLimitStatusRequest struct {
+	RegID int64
+	Names []string
+}
+
 type updateAuthorizationRequest struct {
 	Authz    core.Authorization
 	Index    int
@@ -155,6 +176,10 @@ type countCertificatesByNamesRequest struct {
 	Latest   time.Time
 }
 
+type fqdnSetExistsRequest struct {
+	Names []string
+}
+
 type countRegistrationsByIPRequest struct {
 	IP       net.IP
 	Earliest time.Time
@@ -165,6 +190,40 @@ type countPendingAuthorizationsRequest struct {
 	RegID int64
 }
 
+type countInvalidAuthorizationsRequest struct {
+	RegID    int64
+	Hostname string
+	Earliest time.Time
+	Latest   time.Time
+}
+
+type getRateLimitOverridesRequest struct {
+	AsOf time.Time
+}
+
+type expireRateLimitOverrideRequest struct {
+	ID int64
+}
+
+type getNotificationPreferencesRequest struct {
+	RegID int64
+}
+
+type holdForReviewRequest struct {
+	Hostname string
+	RegID    int64
+}
+
+type getManualReviewsRequest struct {
+	Status core.ManualReviewStatus
+}
+
+type setManualReviewStatusRequest struct {
+	ID       int64
+	Status   core.ManualReviewStatus
+	Reviewer string
+}
+
 // Response structs
 type caaResponse struct {
 	Present bool
@@ -354,6 +413,40 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		return
 	})
 
+	rpc.Handle(MethodRateLimitStatus, func(req []byte) (response []byte, err error) {
+		var rlsReq rateLimitStatusRequest
+		if err = json.Unmarshal(req, &rlsReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodRateLimitStatus, err, req)
+			return
+		}
+
+		statuses, err := impl.RateLimitStatus(rlsReq.RegID, rlsReq.Names)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(statuses)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodRateLimitStatus, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodUpdateNotificationPreferences, func(req []byte) (response []byte, err error) {
+		var prefs core.NotificationPreferences
+		if err = json.Unmarshal(req, &prefs); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateNotificationPreferences, err, req)
+			return
+		}
+
+		err = impl.UpdateNotificationPreferences(prefs)
+		return
+	})
+
 	return nil
 }
 
@@ -506,10 +599,41 @@ func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorizati
 	return
 }
 
+// RateLimitStatus sends a request for a registration's rate limit usage
+func (rac RegistrationAuthorityClient) RateLimitStatus(regID int64, names []string) (statuses []core.RateLimitStatus, err error) {
+	data, err := json.Marshal(rateLimitStatusRequest{regID, names})
+	if err != nil {
+		return
+	}
+
+	response, err := rac.rpc.DispatchSync(MethodRateLimitStatus, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &statuses)
+	return
+}
+
+// UpdateNotificationPreferences sends a request to change a registration's
+// notification preferences
+func (rac RegistrationAuthorityClient) UpdateNotificationPreferences(prefs core.NotificationPreferences) (err error) {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return
+	}
+
+	_, err = rac.rpc.DispatchSync(MethodUpdateNotificationPreferences, data)
+	return
+}
+
 // NewValidationAuthorityServer constructs an RPC server
 //
 // ValidationAuthorityClient / Server
 //  -> UpdateValidations
+//  -> CheckCAARecords
+//  -> IsSafeDomain
+//  -> ReplayValidation
 func NewValidationAuthorityServer(rpc Server, impl core.ValidationAuthority) (err error) {
 	rpc.Handle(MethodUpdateValidations, func(req []byte) (response []byte, err error) {
 		var vaReq validationRequest
@@ -567,6 +691,20 @@ func NewValidationAuthorityServer(rpc Server, impl core.ValidationAuthority) (er
 		return jsonResp, nil
 	})
 
+	rpc.Handle(MethodReplayValidation, func(req []byte) ([]byte, error) {
+		var vaReq validationRequest
+		if err := json.Unmarshal(req, &vaReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodReplayValidation, err, req)
+			return nil, err
+		}
+		trace, err := impl.ReplayValidation(vaReq.Authz, vaReq.Index)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(trace)
+	})
+
 	return nil
 }
 
@@ -640,6 +778,28 @@ func (vac ValidationAuthorityClient) IsSafeDomain(req *core.IsSafeDomainRequest)
 	return resp, nil
 }
 
+// ReplayValidation asks the VA to re-run validation of a challenge without
+// updating the authorization, returning a trace of what it observed.
+func (vac ValidationAuthorityClient) ReplayValidation(authz core.Authorization, index int) (*core.ValidationTrace, error) {
+	data, err := json.Marshal(validationRequest{
+		Authz: authz,
+		Index: index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	jsonResp, err := vac.rpc.DispatchSync(MethodReplayValidation, data)
+	if err != nil {
+		return nil, err
+	}
+	trace := &core.ValidationTrace{}
+	err = json.Unmarshal(jsonResp, trace)
+	if err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
 // NewPublisherServer creates a new server that wraps a CT publisher
 func NewPublisherServer(rpc Server, impl core.Publisher) (err error) {
 	rpc.Handle(MethodSubmitToCT, func(req []byte) (response []byte, err error) {
@@ -869,6 +1029,28 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return
 	})
 
+	rpc.Handle(MethodGetLatestPendingAuthorization, func(req []byte) (response []byte, err error) {
+		var lpar latestValidAuthorizationRequest
+		if err = json.Unmarshal(req, &lpar); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetLatestPendingAuthorization, err, req)
+			return
+		}
+
+		authz, err := impl.GetLatestPendingAuthorization(lpar.RegID, lpar.Identifier)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetLatestPendingAuthorization, err, req)
+			return
+		}
+		return
+	})
+
 	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
 		var acReq addCertificateRequest
 		err = json.Unmarshal(req, &acReq)
@@ -1063,6 +1245,34 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return json.Marshal(counts)
 	})
 
+	rpc.Handle(MethodFQDNSetExists, func(req []byte) (response []byte, err error) {
+		var fReq fqdnSetExistsRequest
+		err = json.Unmarshal(req, &fReq)
+		if err != nil {
+			return
+		}
+
+		exists, err := impl.FQDNSetExists(fReq.Names)
+		if err != nil {
+			return
+		}
+		return json.Marshal(exists)
+	})
+
+	rpc.Handle(MethodCountFQDNSets, func(req []byte) (response []byte, err error) {
+		var cReq countCertificatesByNamesRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		count, err := impl.CountFQDNSets(cReq.Names, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
 	rpc.Handle(MethodCountRegistrationsByIP, func(req []byte) (response []byte, err error) {
 		var cReq countRegistrationsByIPRequest
 		err = json.Unmarshal(req, &cReq)
@@ -1091,6 +1301,34 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return json.Marshal(count)
 	})
 
+	rpc.Handle(MethodCountInvalidAuthorizations, func(req []byte) (response []byte, err error) {
+		var cReq countInvalidAuthorizationsRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		count, err := impl.CountInvalidAuthorizations(cReq.RegID, cReq.Hostname, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
+	rpc.Handle(MethodInvalidAuthorizationExpiries, func(req []byte) (response []byte, err error) {
+		var cReq countInvalidAuthorizationsRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		expiries, err := impl.InvalidAuthorizationExpiries(cReq.RegID, cReq.Hostname, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(expiries)
+	})
+
 	rpc.Handle(MethodGetSCTReceipt, func(req []byte) (response []byte, err error) {
 		var gsctReq struct {
 			Serial string
@@ -1134,6 +1372,147 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return nil, nil
 	})
 
+	rpc.Handle(MethodGetRateLimitOverrides, func(req []byte) (response []byte, err error) {
+		var gReq getRateLimitOverridesRequest
+		err = json.Unmarshal(req, &gReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetRateLimitOverrides, err, req)
+			return
+		}
+
+		overrides, err := impl.GetRateLimitOverrides(gReq.AsOf)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetRateLimitOverrides, err, req)
+			return
+		}
+		return json.Marshal(overrides)
+	})
+
+	rpc.Handle(MethodAddRateLimitOverride, func(req []byte) (response []byte, err error) {
+		var override core.RateLimitOverride
+		err = json.Unmarshal(req, &override)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddRateLimitOverride, err, req)
+			return
+		}
+
+		override, err = impl.AddRateLimitOverride(override)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodAddRateLimitOverride, err, req)
+			return
+		}
+		return json.Marshal(override)
+	})
+
+	rpc.Handle(MethodExpireRateLimitOverride, func(req []byte) (response []byte, err error) {
+		var eReq expireRateLimitOverrideRequest
+		err = json.Unmarshal(req, &eReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodExpireRateLimitOverride, err, req)
+			return
+		}
+
+		err = impl.ExpireRateLimitOverride(eReq.ID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodExpireRateLimitOverride, err, req)
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetNotificationPreferences, func(req []byte) (response []byte, err error) {
+		var gReq getNotificationPreferencesRequest
+		err = json.Unmarshal(req, &gReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetNotificationPreferences, err, req)
+			return
+		}
+
+		prefs, err := impl.GetNotificationPreferences(gReq.RegID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetNotificationPreferences, err, req)
+			return
+		}
+		return json.Marshal(prefs)
+	})
+
+	rpc.Handle(MethodSetNotificationPreferences, func(req []byte) (response []byte, err error) {
+		var prefs core.NotificationPreferences
+		err = json.Unmarshal(req, &prefs)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodSetNotificationPreferences, err, req)
+			return
+		}
+
+		err = impl.SetNotificationPreferences(prefs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodSetNotificationPreferences, err, req)
+		}
+		return
+	})
+
+	rpc.Handle(MethodHoldForReview, func(req []byte) (response []byte, err error) {
+		var hReq holdForReviewRequest
+		err = json.Unmarshal(req, &hReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodHoldForReview, err, req)
+			return
+		}
+
+		review, err := impl.HoldForReview(hReq.Hostname, hReq.RegID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodHoldForReview, err, req)
+			return
+		}
+		return json.Marshal(review)
+	})
+
+	rpc.Handle(MethodGetManualReviews, func(req []byte) (response []byte, err error) {
+		var gReq getManualReviewsRequest
+		err = json.Unmarshal(req, &gReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetManualReviews, err, req)
+			return
+		}
+
+		reviews, err := impl.GetManualReviews(gReq.Status)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetManualReviews, err, req)
+			return
+		}
+		return json.Marshal(reviews)
+	})
+
+	rpc.Handle(MethodSetManualReviewStatus, func(req []byte) (response []byte, err error) {
+		var sReq setManualReviewStatusRequest
+		err = json.Unmarshal(req, &sReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodSetManualReviewStatus, err, req)
+			return
+		}
+
+		err = impl.SetManualReviewStatus(sReq.ID, sReq.Status, sReq.Reviewer)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodSetManualReviewStatus, err, req)
+		}
+		return
+	})
+
 	return nil
 }
 
@@ -1215,6 +1594,27 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationID int
 	return
 }
 
+// GetLatestPendingAuthorization sends a request to get the pending
+// Authorization for a RegID and Identifier that expires last
+func (cac StorageAuthorityClient) GetLatestPendingAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+	var lpar latestValidAuthorizationRequest
+	lpar.RegID = registrationID
+	lpar.Identifier = identifier
+
+	data, err := json.Marshal(lpar)
+	if err != nil {
+		return
+	}
+
+	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetLatestPendingAuthorization, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthz, &authz)
+	return
+}
+
 // GetCertificate sends a request to get a Certificate by ID
 func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certificate, err error) {
 	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificate, []byte(id))
@@ -1418,6 +1818,36 @@ func (cac StorageAuthorityClient) CountCertificatesByNames(names []string, earli
 	return
 }
 
+// FQDNSetExists calls FQDNSetExists on the remote StorageAuthority.
+func (cac StorageAuthorityClient) FQDNSetExists(names []string) (exists bool, err error) {
+	data, err := json.Marshal(fqdnSetExistsRequest{Names: names})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodFQDNSetExists, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &exists)
+	return
+}
+
+// CountFQDNSets calls CountFQDNSets on the remote StorageAuthority.
+func (cac StorageAuthorityClient) CountFQDNSets(names []string, earliest, latest time.Time) (count int, err error) {
+	var cReq countCertificatesByNamesRequest
+	cReq.Names, cReq.Earliest, cReq.Latest = names, earliest, latest
+	data, err := json.Marshal(cReq)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodCountFQDNSets, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &count)
+	return
+}
+
 // CountRegistrationsByIP calls CountRegistrationsByIP on the remote
 // StorageAuthority.
 func (cac StorageAuthorityClient) CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (count int, err error) {
@@ -1452,6 +1882,40 @@ func (cac StorageAuthorityClient) CountPendingAuthorizations(regID int64) (count
 	return
 }
 
+// CountInvalidAuthorizations calls CountInvalidAuthorizations on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) CountInvalidAuthorizations(regID int64, hostname string, earliest, latest time.Time) (count int, err error) {
+	var cReq countInvalidAuthorizationsRequest
+	cReq.RegID, cReq.Hostname, cReq.Earliest, cReq.Latest = regID, hostname, earliest, latest
+	data, err := json.Marshal(cReq)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodCountInvalidAuthorizations, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+// InvalidAuthorizationExpiries calls InvalidAuthorizationExpiries on the
+// remote StorageAuthority.
+func (cac StorageAuthorityClient) InvalidAuthorizationExpiries(regID int64, hostname string, earliest, latest time.Time) (expiries []time.Time, err error) {
+	var cReq countInvalidAuthorizationsRequest
+	cReq.RegID, cReq.Hostname, cReq.Earliest, cReq.Latest = regID, hostname, earliest, latest
+	data, err := json.Marshal(cReq)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodInvalidAuthorizationExpiries, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &expiries)
+	return
+}
+
 // GetSCTReceipt retrieves an SCT according to the serial number of a certificate
 // and the logID of the log to which it was submitted.
 func (cac StorageAuthorityClient) GetSCTReceipt(serial string, logID string) (receipt core.SignedCertificateTimestamp, err error) {
@@ -1486,3 +1950,109 @@ func (cac StorageAuthorityClient) AddSCTReceipt(sct core.SignedCertificateTimest
 	_, err = cac.rpc.DispatchSync(MethodAddSCTReceipt, data)
 	return
 }
+
+// GetRateLimitOverrides calls GetRateLimitOverrides on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) GetRateLimitOverrides(asOf time.Time) (overrides []core.RateLimitOverride, err error) {
+	data, err := json.Marshal(getRateLimitOverridesRequest{AsOf: asOf})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodGetRateLimitOverrides, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &overrides)
+	return
+}
+
+// AddRateLimitOverride calls AddRateLimitOverride on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) AddRateLimitOverride(override core.RateLimitOverride) (added core.RateLimitOverride, err error) {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodAddRateLimitOverride, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &added)
+	return
+}
+
+// ExpireRateLimitOverride calls ExpireRateLimitOverride on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) ExpireRateLimitOverride(id int64) (err error) {
+	data, err := json.Marshal(expireRateLimitOverrideRequest{ID: id})
+	if err != nil {
+		return
+	}
+	_, err = cac.rpc.DispatchSync(MethodExpireRateLimitOverride, data)
+	return
+}
+
+// GetNotificationPreferences calls GetNotificationPreferences on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) GetNotificationPreferences(regID int64) (prefs core.NotificationPreferences, err error) {
+	data, err := json.Marshal(getNotificationPreferencesRequest{RegID: regID})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodGetNotificationPreferences, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &prefs)
+	return
+}
+
+// SetNotificationPreferences calls SetNotificationPreferences on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) SetNotificationPreferences(prefs core.NotificationPreferences) (err error) {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return
+	}
+	_, err = cac.rpc.DispatchSync(MethodSetNotificationPreferences, data)
+	return
+}
+
+// HoldForReview calls HoldForReview on the remote StorageAuthority.
+func (cac StorageAuthorityClient) HoldForReview(hostname string, regID int64) (review core.ManualReview, err error) {
+	data, err := json.Marshal(holdForReviewRequest{Hostname: hostname, RegID: regID})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodHoldForReview, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &review)
+	return
+}
+
+// GetManualReviews calls GetManualReviews on the remote StorageAuthority.
+func (cac StorageAuthorityClient) GetManualReviews(status core.ManualReviewStatus) (reviews []core.ManualReview, err error) {
+	data, err := json.Marshal(getManualReviewsRequest{Status: status})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodGetManualReviews, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &reviews)
+	return
+}
+
+// SetManualReviewStatus calls SetManualReviewStatus on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) SetManualReviewStatus(id int64, status core.ManualReviewStatus, reviewer string) (err error) {
+	data, err := json.Marshal(setManualReviewStatusRequest{ID: id, Status: status, Reviewer: reviewer})
+	if err != nil {
+		return
+	}
+	_, err = cac.rpc.DispatchSync(MethodSetManualReviewStatus, data)
+	return
+}
@@ -0,0 +1,223 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- This is the schema the MySQL migrations in sa/_db add up to. Identifiers
+-- are left unquoted, so PostgreSQL folds them to lower case, as gorp expects.
+
+CREATE TABLE registrations (
+  id BIGSERIAL NOT NULL,
+  jwk BYTEA NOT NULL,
+  jwk_sha256 VARCHAR(255) NOT NULL,
+  contact VARCHAR(191) NOT NULL,
+  agreement VARCHAR(255) NOT NULL,
+  LockCol BIGINT NOT NULL,
+  initialIP BYTEA NOT NULL DEFAULT '',
+  createdAt TIMESTAMP NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT jwk_sha256 UNIQUE (jwk_sha256)
+);
+
+CREATE INDEX initialIP_createdAt ON registrations (initialIP, createdAt);
+
+CREATE TABLE authz (
+  id VARCHAR(255) NOT NULL,
+  identifier VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  expires TIMESTAMP DEFAULT NULL,
+  combinations VARCHAR(255) NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT regId_authz FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX registrationID_identifier_status_expires_authz_idx ON authz (registrationID, identifier, status, expires DESC);
+
+CREATE TABLE pendingAuthorizations (
+  id VARCHAR(255) NOT NULL,
+  identifier VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  expires TIMESTAMP DEFAULT NULL,
+  combinations VARCHAR(255) NOT NULL,
+  LockCol BIGINT NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT regId_pending_authz FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX regId_expires_idx ON pendingAuthorizations (registrationID, expires);
+
+CREATE TABLE challenges (
+  id BIGSERIAL NOT NULL,
+  authorizationID VARCHAR(255) NOT NULL,
+  LockCol BIGINT DEFAULT NULL,
+  type VARCHAR(255) NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  error BYTEA DEFAULT NULL,
+  validated TIMESTAMP DEFAULT NULL,
+  token VARCHAR(255) NOT NULL,
+  tls BOOLEAN DEFAULT NULL,
+  validationRecord BYTEA,
+  accountKey BYTEA,
+  keyAuthorization VARCHAR(255),
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX authorizationID_challenges_idx ON challenges (authorizationID);
+
+CREATE TABLE certificates (
+  registrationID BIGINT NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  digest VARCHAR(255) NOT NULL,
+  der BYTEA NOT NULL,
+  issued TIMESTAMP NOT NULL,
+  expires TIMESTAMP NOT NULL,
+  PRIMARY KEY (serial),
+  CONSTRAINT regId_certificates FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX regId_certificates_idx ON certificates (registrationID);
+
+CREATE TABLE certificateStatus (
+  serial VARCHAR(255) NOT NULL,
+  subscriberApproved BOOLEAN NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  ocspLastUpdated TIMESTAMP NOT NULL,
+  revokedDate TIMESTAMP NOT NULL,
+  revokedReason INTEGER NOT NULL,
+  lastExpirationNagSent TIMESTAMP NOT NULL,
+  LockCol BIGINT NOT NULL,
+  ocspResponse BYTEA,
+  PRIMARY KEY (serial)
+);
+
+CREATE INDEX ocspLastUpdated_certificateStatus_idx ON certificateStatus (ocspLastUpdated);
+CREATE INDEX status_certificateStatus_idx ON certificateStatus (status);
+
+CREATE TABLE crls (
+  serial VARCHAR(255) NOT NULL,
+  createdAt TIMESTAMP NOT NULL,
+  crl VARCHAR(255) NOT NULL,
+  PRIMARY KEY (serial)
+);
+
+CREATE TABLE deniedCSRs (
+  id SERIAL NOT NULL,
+  names VARCHAR(255) NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE ocspResponses (
+  id SERIAL NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  createdAt TIMESTAMP NOT NULL,
+  response BYTEA NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX ocspResponses_serial_idx ON ocspResponses (serial);
+
+CREATE TABLE identifierData (
+  reversedName VARCHAR(255) NOT NULL,
+  certSHA1 VARCHAR(40) NOT NULL,
+  UNIQUE (certSHA1, reversedName)
+);
+
+CREATE TABLE externalCerts (
+  sha1 VARCHAR(40) NOT NULL,
+  issuer TEXT DEFAULT NULL,
+  subject TEXT DEFAULT NULL,
+  notAfter TIMESTAMP DEFAULT NULL,
+  spki BYTEA DEFAULT NULL,
+  valid BOOLEAN DEFAULT NULL,
+  ev BOOLEAN DEFAULT NULL,
+  rawDERCert BYTEA DEFAULT NULL,
+  UNIQUE (sha1)
+);
+
+CREATE TABLE sctReceipts (
+  id BIGSERIAL NOT NULL,
+  sctVersion SMALLINT NOT NULL,
+  logID VARCHAR(255) NOT NULL,
+  timestamp BIGINT NOT NULL,
+  extensions BYTEA,
+  signature BYTEA,
+  certificateSerial VARCHAR(255) NOT NULL,
+  LockCol BIGINT DEFAULT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT certificateSerial_logID UNIQUE (certificateSerial, logID)
+);
+
+CREATE TABLE issuedNames (
+  id SERIAL NOT NULL,
+  -- DNS names are restricted to the ASCII character set.
+  -- 640 char limit is enforced in policy-authority.go.
+  reversedName VARCHAR(640) NOT NULL,
+  notBefore TIMESTAMP NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  PRIMARY KEY (id)
+);
+
+-- varchar_pattern_ops lets the index serve the LIKE prefix matches in
+-- countCertificatesByName whatever the database's collation.
+CREATE INDEX reversedName_notBefore_Idx ON issuedNames (reversedName varchar_pattern_ops, notBefore);
+
+CREATE TABLE fqdnSets (
+  id BIGSERIAL NOT NULL,
+  -- SHA256 hash of alphabetically sorted, lowercased, comma joined
+  -- DNS names contained in a certificate
+  setHash BYTEA NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  issued TIMESTAMP NOT NULL,
+  expires TIMESTAMP NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX fqdnSets_serial_idx ON fqdnSets (serial);
+CREATE INDEX setHash_issued_idx ON fqdnSets (setHash, issued);
+
+CREATE TABLE rateLimitCounters (
+  -- Rate limit name and key, e.g. certificatesPerName:example.com
+  counterKey VARCHAR(255) NOT NULL,
+  -- Start of the time bucket the events were recorded in
+  bucket TIMESTAMP NOT NULL,
+  count INTEGER NOT NULL,
+  PRIMARY KEY (counterKey, bucket)
+);
+CREATE INDEX bucket_rateLimitCounters_idx ON rateLimitCounters (bucket);
+
+CREATE TABLE rateLimitOverrides (
+  id BIGSERIAL NOT NULL,
+  limitName VARCHAR(64) NOT NULL,
+  -- Exactly one of overrideKey and registrationID is set
+  overrideKey VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  threshold INTEGER NOT NULL,
+  owner VARCHAR(255) NOT NULL,
+  reason TEXT NOT NULL,
+  created TIMESTAMP NOT NULL,
+  expires TIMESTAMP NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX rateLimitOverrides_expires_idx ON rateLimitOverrides (expires);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE rateLimitOverrides;
+DROP TABLE rateLimitCounters;
+DROP TABLE fqdnSets;
+DROP TABLE issuedNames;
+DROP TABLE sctReceipts;
+DROP TABLE externalCerts;
+DROP TABLE identifierData;
+DROP TABLE ocspResponses;
+DROP TABLE deniedCSRs;
+DROP TABLE crls;
+DROP TABLE certificateStatus;
+DROP TABLE certificates;
+DROP TABLE challenges;
+DROP TABLE pendingAuthorizations;
+DROP TABLE authz;
+DROP TABLE registrations;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE certificateEvents (
+  id BIGSERIAL NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  -- Either 'issued' or 'revoked'
+  type VARCHAR(40) NOT NULL,
+  created TIMESTAMP NOT NULL,
+  PRIMARY KEY (id)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE certificateEvents;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE purgeQueue (
+  id BIGSERIAL NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  created TIMESTAMP NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  nextAttempt TIMESTAMP NOT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX nextAttempt_purgeQueue_idx ON purgeQueue (nextAttempt);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE purgeQueue;
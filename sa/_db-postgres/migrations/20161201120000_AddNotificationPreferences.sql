@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE notificationPreferences (
+  registrationID BIGINT NOT NULL,
+  expirationEmails BOOLEAN NOT NULL,
+  updated TIMESTAMP NOT NULL,
+  PRIMARY KEY (registrationID)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE notificationPreferences;
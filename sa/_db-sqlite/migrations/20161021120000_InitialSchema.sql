@@ -0,0 +1,210 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- This is the schema the MySQL migrations in sa/_db add up to.
+
+CREATE TABLE registrations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  jwk BLOB NOT NULL,
+  jwk_sha256 VARCHAR(255) NOT NULL,
+  contact VARCHAR(191) NOT NULL,
+  agreement VARCHAR(255) NOT NULL,
+  LockCol BIGINT NOT NULL,
+  initialIP BLOB NOT NULL DEFAULT X'',
+  createdAt DATETIME NOT NULL,
+  CONSTRAINT jwk_sha256 UNIQUE (jwk_sha256)
+);
+
+CREATE INDEX initialIP_createdAt ON registrations (initialIP, createdAt);
+
+CREATE TABLE authz (
+  id VARCHAR(255) NOT NULL,
+  identifier VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  expires DATETIME DEFAULT NULL,
+  combinations VARCHAR(255) NOT NULL,
+  CONSTRAINT regId_authz FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX registrationID_identifier_status_expires_authz_idx ON authz (registrationID, identifier, status, expires);
+
+CREATE TABLE pendingAuthorizations (
+  id VARCHAR(255) NOT NULL,
+  identifier VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  expires DATETIME DEFAULT NULL,
+  combinations VARCHAR(255) NOT NULL,
+  LockCol BIGINT NOT NULL,
+  CONSTRAINT regId_pending_authz FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX regId_expires_idx ON pendingAuthorizations (registrationID, expires);
+
+CREATE TABLE challenges (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  authorizationID VARCHAR(255) NOT NULL,
+  LockCol BIGINT DEFAULT NULL,
+  type VARCHAR(255) NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  error BLOB DEFAULT NULL,
+  validated DATETIME DEFAULT NULL,
+  token VARCHAR(255) NOT NULL,
+  tls BOOLEAN DEFAULT NULL,
+  validationRecord BLOB,
+  accountKey BLOB,
+  keyAuthorization VARCHAR(255)
+);
+
+CREATE INDEX authorizationID_challenges_idx ON challenges (authorizationID);
+
+CREATE TABLE certificates (
+  registrationID BIGINT NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  digest VARCHAR(255) NOT NULL,
+  der BLOB NOT NULL,
+  issued DATETIME NOT NULL,
+  expires DATETIME NOT NULL,
+  PRIMARY KEY (serial),
+  CONSTRAINT regId_certificates FOREIGN KEY (registrationID) REFERENCES registrations (id) ON DELETE NO ACTION ON UPDATE NO ACTION
+);
+
+CREATE INDEX regId_certificates_idx ON certificates (registrationID);
+
+CREATE TABLE certificateStatus (
+  serial VARCHAR(255) NOT NULL,
+  subscriberApproved BOOLEAN NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  ocspLastUpdated DATETIME NOT NULL,
+  revokedDate DATETIME NOT NULL,
+  revokedReason INTEGER NOT NULL,
+  lastExpirationNagSent DATETIME NOT NULL,
+  LockCol BIGINT NOT NULL,
+  ocspResponse BLOB,
+  PRIMARY KEY (serial)
+);
+
+CREATE INDEX ocspLastUpdated_certificateStatus_idx ON certificateStatus (ocspLastUpdated);
+CREATE INDEX status_certificateStatus_idx ON certificateStatus (status);
+
+CREATE TABLE crls (
+  serial VARCHAR(255) NOT NULL,
+  createdAt DATETIME NOT NULL,
+  crl VARCHAR(255) NOT NULL,
+  PRIMARY KEY (serial)
+);
+
+CREATE TABLE deniedCSRs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  names VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE ocspResponses (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  serial VARCHAR(255) NOT NULL,
+  createdAt DATETIME NOT NULL,
+  response BLOB NOT NULL
+);
+
+CREATE INDEX ocspResponses_serial_idx ON ocspResponses (serial);
+
+CREATE TABLE identifierData (
+  reversedName VARCHAR(255) NOT NULL,
+  certSHA1 VARCHAR(40) NOT NULL,
+  UNIQUE (certSHA1, reversedName)
+);
+
+CREATE TABLE externalCerts (
+  sha1 VARCHAR(40) NOT NULL,
+  issuer TEXT DEFAULT NULL,
+  subject TEXT DEFAULT NULL,
+  notAfter DATETIME DEFAULT NULL,
+  spki BLOB DEFAULT NULL,
+  valid BOOLEAN DEFAULT NULL,
+  ev BOOLEAN DEFAULT NULL,
+  rawDERCert BLOB DEFAULT NULL,
+  UNIQUE (sha1)
+);
+
+CREATE TABLE sctReceipts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  sctVersion SMALLINT NOT NULL,
+  logID VARCHAR(255) NOT NULL,
+  timestamp BIGINT NOT NULL,
+  extensions BLOB,
+  signature BLOB,
+  certificateSerial VARCHAR(255) NOT NULL,
+  LockCol BIGINT DEFAULT NULL,
+  CONSTRAINT certificateSerial_logID UNIQUE (certificateSerial, logID)
+);
+
+CREATE TABLE issuedNames (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- DNS names are restricted to the ASCII character set.
+  -- 640 char limit is enforced in policy-authority.go.
+  reversedName VARCHAR(640) NOT NULL,
+  notBefore DATETIME NOT NULL,
+  serial VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX reversedName_notBefore_Idx ON issuedNames (reversedName, notBefore);
+
+CREATE TABLE fqdnSets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- SHA256 hash of alphabetically sorted, lowercased, comma joined
+  -- DNS names contained in a certificate
+  setHash BLOB NOT NULL,
+  serial VARCHAR(255) NOT NULL,
+  issued DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+
+CREATE INDEX fqdnSets_serial_idx ON fqdnSets (serial);
+CREATE INDEX setHash_issued_idx ON fqdnSets (setHash, issued);
+
+CREATE TABLE rateLimitCounters (
+  -- Rate limit name and key, e.g. certificatesPerName:example.com
+  counterKey VARCHAR(255) NOT NULL,
+  -- Start of the time bucket the events were recorded in
+  bucket DATETIME NOT NULL,
+  count INTEGER NOT NULL,
+  PRIMARY KEY (counterKey, bucket)
+);
+CREATE INDEX bucket_rateLimitCounters_idx ON rateLimitCounters (bucket);
+
+CREATE TABLE rateLimitOverrides (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  limitName VARCHAR(64) NOT NULL,
+  -- Exactly one of overrideKey and registrationID is set
+  overrideKey VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  threshold INTEGER NOT NULL,
+  owner VARCHAR(255) NOT NULL,
+  reason TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+
+CREATE INDEX rateLimitOverrides_expires_idx ON rateLimitOverrides (expires);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE rateLimitOverrides;
+DROP TABLE rateLimitCounters;
+DROP TABLE fqdnSets;
+DROP TABLE issuedNames;
+DROP TABLE sctReceipts;
+DROP TABLE externalCerts;
+DROP TABLE identifierData;
+DROP TABLE ocspResponses;
+DROP TABLE deniedCSRs;
+DROP TABLE crls;
+DROP TABLE certificateStatus;
+DROP TABLE certificates;
+DROP TABLE challenges;
+DROP TABLE pendingAuthorizations;
+DROP TABLE authz;
+DROP TABLE registrations;
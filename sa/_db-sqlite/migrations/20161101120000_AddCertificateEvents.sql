@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE certificateEvents (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  serial VARCHAR(255) NOT NULL,
+  -- Either 'issued' or 'revoked'
+  type VARCHAR(40) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE certificateEvents;
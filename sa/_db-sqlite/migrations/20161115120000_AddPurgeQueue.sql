@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE purgeQueue (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url VARCHAR(2048) NOT NULL,
+  created DATETIME NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  nextAttempt DATETIME NOT NULL
+);
+
+CREATE INDEX nextAttempt_purgeQueue_idx ON purgeQueue (nextAttempt);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE purgeQueue;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE notificationPreferences (
+  registrationID INTEGER PRIMARY KEY,
+  expirationEmails BOOLEAN NOT NULL,
+  updated DATETIME NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE notificationPreferences;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE manualReviews (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  hostname VARCHAR(255) NOT NULL,
+  registrationID BIGINT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  reviewer VARCHAR(255) NOT NULL,
+  created DATETIME NOT NULL,
+  reviewed DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX hostname_manualReviews_idx ON manualReviews (hostname);
+CREATE INDEX status_manualReviews_idx ON manualReviews (status);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE manualReviews;
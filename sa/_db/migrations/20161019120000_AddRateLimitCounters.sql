@@ -0,0 +1,19 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `rateLimitCounters` (
+  -- Rate limit name and key, e.g. certificatesPerName:example.com
+  `counterKey` VARCHAR(255) NOT NULL,
+  -- Start of the time bucket the events were recorded in
+  `bucket` DATETIME NOT NULL,
+  `count` INT(11) NOT NULL,
+  PRIMARY KEY (`counterKey`, `bucket`),
+  -- For pruning buckets older than the longest rate limit window
+  KEY `bucket_rateLimitCounters_idx` (`bucket`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `rateLimitCounters`;
@@ -0,0 +1,23 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `rateLimitOverrides` (
+  `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+  `limitName` VARCHAR(64) NOT NULL,
+  -- Exactly one of overrideKey and registrationID is set
+  `overrideKey` VARCHAR(255) NOT NULL,
+  `registrationID` BIGINT(20) NOT NULL,
+  `threshold` INT(11) NOT NULL,
+  `owner` VARCHAR(255) NOT NULL,
+  `reason` TEXT NOT NULL,
+  `created` DATETIME NOT NULL,
+  `expires` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `expires_idx` (`expires`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `rateLimitOverrides`;
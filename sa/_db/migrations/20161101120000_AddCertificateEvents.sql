@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `certificateEvents` (
+  `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+  `serial` VARCHAR(255) NOT NULL,
+  -- Either 'issued' or 'revoked'
+  `type` VARCHAR(40) NOT NULL,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `certificateEvents`;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `purgeQueue` (
+  `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+  `url` VARCHAR(2048) NOT NULL,
+  `created` DATETIME NOT NULL,
+  `attempts` INT(11) NOT NULL DEFAULT 0,
+  `nextAttempt` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `nextAttempt_purgeQueue_idx` (`nextAttempt`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `purgeQueue`;
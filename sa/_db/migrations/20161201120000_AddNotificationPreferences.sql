@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `notificationPreferences` (
+  `registrationID` BIGINT(20) NOT NULL,
+  `expirationEmails` TINYINT(1) NOT NULL,
+  `updated` DATETIME NOT NULL,
+  PRIMARY KEY (`registrationID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `notificationPreferences`;
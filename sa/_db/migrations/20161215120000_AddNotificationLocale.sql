@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE `notificationPreferences` ADD COLUMN `locale` VARCHAR(35) NOT NULL DEFAULT "";
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `notificationPreferences` DROP COLUMN `locale`;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `manualReviews` (
+  `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+  `hostname` VARCHAR(255) NOT NULL,
+  `registrationID` BIGINT(20) NOT NULL,
+  `status` VARCHAR(16) NOT NULL,
+  `reviewer` VARCHAR(255) NOT NULL,
+  `created` DATETIME NOT NULL,
+  `reviewed` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `hostname_idx` (`hostname`),
+  KEY `status_idx` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `manualReviews`;
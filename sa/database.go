@@ -11,8 +11,6 @@ import (
 	"net/url"
 	"strings"
 
-	// Provide access to the MySQL driver
-	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
@@ -22,28 +20,41 @@ import (
 // database schema you wish to map. Each DbMap contains a list of mapped tables.
 // It automatically maps the tables for the primary parts of Boulder around the
 // Storage Authority. This may require some further work when we use a disjoint
-// schema, like that for `certificate-authority-data.go`.
+// schema, like that for `certificate-authority-data.go`. The kind of database
+// is chosen by the URL's scheme; see Dialect.
 func NewDbMap(dbConnect string) (*gorp.DbMap, error) {
 	logger := blog.GetAuditLogger()
 
-	var err error
-	dbConnect, err = recombineURLForDB(dbConnect)
+	dbConnect = strings.TrimSpace(dbConnect)
+	dbURL, err := url.Parse(dbConnect)
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := dialectForURL(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := dialect.dataSourceName(dbConnect)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Debug("Connecting to database")
+	logger.Debug(fmt.Sprintf("Connecting to %s database", dialect.Name()))
 
-	db, err := sql.Open("mysql", dbConnect)
+	db, err := sql.Open(dialect.driverName(), dsn)
 	if err != nil {
 		return nil, err
 	}
+	// Each connection to an in-memory SQLite database gets a database of its
+	// own, so there must only be one.
+	if dsn == "file::memory:" || strings.HasPrefix(dsn, "file::memory:?") {
+		db.SetMaxOpenConns(1)
+	}
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
 
-	dialect := gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"}
-	dbmap := &gorp.DbMap{Db: db, Dialect: dialect, TypeConverter: BoulderTypeConverter{}}
+	dbmap := &gorp.DbMap{Db: db, Dialect: dialect.gorpDialect(), TypeConverter: BoulderTypeConverter{}}
 
 	initTables(dbmap)
 
@@ -144,9 +155,14 @@ func initTables(dbMap *gorp.DbMap) {
 	dbMap.AddTableWithName(authzModel{}, "authz").SetKeys(false, "ID")
 	dbMap.AddTableWithName(challModel{}, "challenges").SetKeys(true, "ID").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(issuedNameModel{}, "issuedNames").SetKeys(true, "ID")
+	dbMap.AddTableWithName(fqdnSetModel{}, "fqdnSets").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.Certificate{}, "certificates").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.CertificateStatus{}, "certificateStatus").SetKeys(false, "Serial").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.DeniedCSR{}, "deniedCSRs").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.SignedCertificateTimestamp{}, "sctReceipts").SetKeys(true, "ID").SetVersionCol("LockCol")
+	dbMap.AddTableWithName(core.RateLimitOverride{}, "rateLimitOverrides").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.NotificationPreferences{}, "notificationPreferences").SetKeys(false, "RegistrationID")
+	dbMap.AddTableWithName(core.ManualReview{}, "manualReviews").SetKeys(true, "ID")
+	dbMap.AddTableWithName(certificateEventModel{}, "certificateEvents").SetKeys(true, "ID")
 }
@@ -0,0 +1,56 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build postgres
+
+package sa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/lib/pq"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+)
+
+func init() {
+	dialectsByScheme["postgres"] = postgresDialect{}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Concat(exprs ...string) string {
+	return "(" + strings.Join(exprs, " || ") + ")"
+}
+
+func (postgresDialect) SecondsBetween(start, end string) string {
+	return fmt.Sprintf("EXTRACT(EPOCH FROM (%s - %s))", end, start)
+}
+
+func (postgresDialect) OnDuplicateKey(keyColumns []string, set string) string {
+	return "ON CONFLICT (" + strings.Join(keyColumns, ", ") + ") DO UPDATE SET " + set
+}
+
+func (postgresDialect) Inserted(column string) string {
+	return "EXCLUDED." + column
+}
+
+func (postgresDialect) IsDuplicate(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation"
+}
+
+func (postgresDialect) driverName() string { return "postgres" }
+
+// The pq driver takes postgres:// URLs as they are.
+func (postgresDialect) dataSourceName(dbConnect string) (string, error) {
+	return dbConnect, nil
+}
+
+func (postgresDialect) gorpDialect() gorp.Dialect {
+	return gorp.PostgresDialect{}
+}
@@ -0,0 +1,21 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build postgres
+
+package sa
+
+import (
+	"testing"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	test.AssertEquals(t,
+		Rebind(&gorp.DbMap{Dialect: postgresDialect{}.gorpDialect()}, "UPDATE certificateStatus SET ocspResponse=? WHERE serial=?"),
+		"UPDATE certificateStatus SET ocspResponse=$1 WHERE serial=$2")
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build sqlite
+
+package sa
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+)
+
+func init() {
+	dialectsByScheme["sqlite3"] = sqliteDialect{}
+	sql.Register("sqlite3-utc", sqliteUTCDriver{})
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Concat(exprs ...string) string {
+	return "(" + strings.Join(exprs, " || ") + ")"
+}
+
+func (sqliteDialect) SecondsBetween(start, end string) string {
+	return fmt.Sprintf("(strftime('%%s', %s) - strftime('%%s', %s))", end, start)
+}
+
+func (sqliteDialect) OnDuplicateKey(keyColumns []string, set string) string {
+	return "ON CONFLICT (" + strings.Join(keyColumns, ", ") + ") DO UPDATE SET " + set
+}
+
+func (sqliteDialect) Inserted(column string) string {
+	return "excluded." + column
+}
+
+func (sqliteDialect) IsDuplicate(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) driverName() string { return "sqlite3-utc" }
+
+// dataSourceName turns the URL's path into a file: URI for the sqlite3
+// driver. Times are read back in UTC, and foreign keys are enforced as they
+// are in MySQL.
+func (sqliteDialect) dataSourceName(dbConnect string) (string, error) {
+	dbURL, err := url.Parse(dbConnect)
+	if err != nil {
+		return "", err
+	}
+	path := dbURL.Path
+	// sqlite3:relative/path.db and sqlite3::memory: have no slashes after
+	// the scheme, so url.Parse leaves them in Opaque.
+	if path == "" {
+		path = dbURL.Opaque
+	}
+	if path == "" {
+		return "", fmt.Errorf("sqlite3 database URL has no path")
+	}
+	return "file:" + path + "?_loc=UTC&_foreign_keys=1&_busy_timeout=5000", nil
+}
+
+func (sqliteDialect) gorpDialect() gorp.Dialect {
+	return gorp.SqliteDialect{}
+}
+
+// sqliteUTCDriver is the sqlite3 driver, except that times are converted to
+// UTC before they're stored or compared. SQLite keeps times as text, so times
+// in different zones wouldn't compare correctly.
+type sqliteUTCDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d sqliteUTCDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteUTCConn{conn}, nil
+}
+
+type sqliteUTCConn struct {
+	driver.Conn
+}
+
+// CheckNamedValue converts times to UTC and leaves everything else to the
+// default conversion.
+func (sqliteUTCConn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch t := nv.Value.(type) {
+	case time.Time:
+		nv.Value = t.UTC()
+		return nil
+	case *time.Time:
+		if t != nil {
+			nv.Value = t.UTC()
+			return nil
+		}
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build sqlite
+
+package sa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestSQLiteDataSourceName(t *testing.T) {
+	for dbConnect, expected := range map[string]string{
+		"sqlite3:///var/lib/boulder/sa.db": "file:/var/lib/boulder/sa.db?_loc=UTC&_foreign_keys=1&_busy_timeout=5000",
+		"sqlite3:sa.db":                    "file:sa.db?_loc=UTC&_foreign_keys=1&_busy_timeout=5000",
+		"sqlite3::memory:":                 "file::memory:?_loc=UTC&_foreign_keys=1&_busy_timeout=5000",
+	} {
+		dsn, err := sqliteDialect{}.dataSourceName(dbConnect)
+		test.AssertNotError(t, err, "Failed to make a DSN for "+dbConnect)
+		test.AssertEquals(t, dsn, expected)
+	}
+	_, err := sqliteDialect{}.dataSourceName("sqlite3://")
+	test.AssertError(t, err, "Made a DSN without a path")
+}
+
+// TestSQLiteDialect runs the dialect's expressions against an in-memory
+// database, which unlike the other databases needs no server.
+func TestSQLiteDialect(t *testing.T) {
+	dbMap, err := NewDbMap("sqlite3::memory:")
+	test.AssertNotError(t, err, "Couldn't open an in-memory database")
+	defer dbMap.Db.Close()
+	dialect := DialectOf(dbMap)
+	test.AssertEquals(t, dialect.Name(), "sqlite")
+
+	_, err = dbMap.Exec("CREATE TABLE counters (name VARCHAR(255) NOT NULL, count INTEGER NOT NULL, PRIMARY KEY (name))")
+	test.AssertNotError(t, err, "Couldn't create table")
+	insert := Rebind(dbMap, "INSERT INTO counters (name, count) VALUES (?, ?) ")
+	for i := 0; i < 2; i++ {
+		_, err = dbMap.Exec(insert, "a", 2)
+		if i == 0 {
+			test.AssertNotError(t, err, "Couldn't insert row")
+		} else {
+			test.Assert(t, dialect.IsDuplicate(err), "Second insert wasn't a duplicate")
+		}
+	}
+	upsert := insert + dialect.OnDuplicateKey([]string{"name"}, "count = counters.count + "+dialect.Inserted("count"))
+	_, err = dbMap.Exec(upsert, "a", 3)
+	test.AssertNotError(t, err, "Couldn't update row on duplicate key")
+
+	concatenated, err := dbMap.SelectStr("SELECT "+dialect.Concat("name", "'.%'")+" FROM counters WHERE count = :count",
+		map[string]interface{}{"count": 5})
+	test.AssertNotError(t, err, "Couldn't select concatenation")
+	test.AssertEquals(t, concatenated, "a.%")
+
+	start := time.Date(2015, 3, 4, 5, 0, 0, 0, time.UTC)
+	seconds, err := dbMap.SelectInt("SELECT "+dialect.SecondsBetween(":start", ":end"),
+		map[string]interface{}{
+			"start": start,
+			"end":   start.Add(90 * time.Minute).In(time.FixedZone("UTC+2", 2*60*60)),
+		})
+	test.AssertNotError(t, err, "Couldn't select seconds between")
+	test.AssertEquals(t, seconds, int64(90*60))
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"strings"
+	"testing"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestIsDBURL(t *testing.T) {
+	for _, dbConnect := range []string{
+		"mysql+tcp://sa@localhost:3306/boulder_sa_test",
+		"postgres://sa@localhost:5432/boulder_sa_test?sslmode=disable",
+		"sqlite3:///var/lib/boulder/sa.db",
+		"sqlite3::memory:",
+		" sqlite3:sa.db\n",
+	} {
+		test.Assert(t, IsDBURL(dbConnect), dbConnect+" should be a database URL")
+	}
+	for _, dbConnect := range []string{
+		"file:test/issuer-ocsp-responses.txt",
+		"mysql://sa@localhost:3306/boulder_sa_test",
+		"invalid",
+	} {
+		test.Assert(t, !IsDBURL(dbConnect), dbConnect+" shouldn't be a database URL")
+	}
+}
+
+func TestUnknownScheme(t *testing.T) {
+	_, err := NewDbMap("mysql://sa@localhost:3306/boulder_sa_test")
+	test.AssertError(t, err, "Accepted a URL with an unknown scheme")
+	test.Assert(t, strings.HasPrefix(err.Error(), "given database connection string was not a mysql+tcp://"),
+		"Unexpected error "+err.Error())
+	test.Assert(t, strings.HasSuffix(err.Error(), ` URL, was "mysql"`), "Unexpected error "+err.Error())
+}
+
+func TestDialectNotBuilt(t *testing.T) {
+	for scheme, tag := range dialectTags {
+		if _, ok := dialectsByScheme[scheme]; ok {
+			continue
+		}
+		_, err := NewDbMap(scheme + "://localhost/boulder_sa_test")
+		test.AssertError(t, err, "Accepted a URL for a dialect that wasn't built")
+		test.Assert(t, strings.Contains(err.Error(), "-tags "+tag), "Unexpected error "+err.Error())
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE certificateStatus SET ocspResponse=? WHERE serial=?"
+	test.AssertEquals(t,
+		Rebind(&gorp.DbMap{Dialect: mysqlDialect{}.gorpDialect()}, query),
+		query)
+}
+
+func TestDialectOf(t *testing.T) {
+	for _, dialect := range dialectsByScheme {
+		dbMap := &gorp.DbMap{Dialect: dialect.gorpDialect()}
+		test.AssertEquals(t, DialectOf(dbMap).Name(), dialect.Name())
+	}
+}
@@ -26,6 +26,32 @@ type issuedNameModel struct {
 	Serial       string    `db:"serial"`
 }
 
+// fqdnSetModel records the set of names in an issued certificate, identified
+// by core.HashNames, so that later issuance for the same set can be found.
+type fqdnSetModel struct {
+	ID      int64     `db:"id"`
+	SetHash []byte    `db:"setHash"`
+	Serial  string    `db:"serial"`
+	Issued  time.Time `db:"issued"`
+	Expires time.Time `db:"expires"`
+}
+
+// Types of certificateEventModel
+const (
+	certificateEventIssued  = "issued"
+	certificateEventRevoked = "revoked"
+)
+
+// certificateEventModel records that a certificate was issued or revoked, in
+// the same transaction as the change itself, so that the OCSP updater can sign
+// a new response for it right away rather than waiting for its next sweep.
+type certificateEventModel struct {
+	ID      int64     `db:"id"`
+	Serial  string    `db:"serial"`
+	Type    string    `db:"type"`
+	Created time.Time `db:"created"`
+}
+
 // regModel is the description of a core.Registration in the database.
 type regModel struct {
 	ID        int64           `db:"id"`
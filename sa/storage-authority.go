@@ -29,9 +29,15 @@ const getChallengesQuery = "SELECT * FROM challenges WHERE authorizationID = :au
 
 // SQLStorageAuthority defines a Storage Authority
 type SQLStorageAuthority struct {
-	dbMap *gorp.DbMap
-	clk   clock.Clock
-	log   *blog.AuditLogger
+	dbMap   *gorp.DbMap
+	dialect Dialect
+	clk     clock.Clock
+	log     *blog.AuditLogger
+
+	// Whether issuances and revocations are recorded in the certificateEvents
+	// table. Only enable this if the OCSP updater's certificate events loop is
+	// running to consume them, otherwise the table grows without bound.
+	RecordCertificateEvents bool
 }
 
 func digest256(data []byte) []byte {
@@ -59,9 +65,10 @@ func NewSQLStorageAuthority(dbMap *gorp.DbMap, clk clock.Clock) (*SQLStorageAuth
 	logger.Notice("Storage Authority Starting")
 
 	ssa := &SQLStorageAuthority{
-		dbMap: dbMap,
-		clk:   clk,
-		log:   logger,
+		dbMap:   dbMap,
+		dialect: DialectOf(dbMap),
+		clk:     clk,
+		log:     logger,
 	}
 
 	return ssa, nil
@@ -215,6 +222,9 @@ func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authoriz
 
 // GetLatestValidAuthorization gets the valid authorization with biggest expire date for a given domain and registrationId
 func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+	// Identifiers are stored in lower case. MySQL compares them without
+	// regard to case anyway, but the other databases don't.
+	identifier.Value = strings.ToLower(identifier.Value)
 	ident, err := json.Marshal(identifier)
 	if err != nil {
 		return
@@ -231,6 +241,26 @@ func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationID int64
 	return ssa.GetAuthorization(auth.ID)
 }
 
+// GetLatestPendingAuthorization gets the pending authorization with the
+// biggest expire date for a given domain and registrationId
+func (ssa *SQLStorageAuthority) GetLatestPendingAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+	identifier.Value = strings.ToLower(identifier.Value)
+	ident, err := json.Marshal(identifier)
+	if err != nil {
+		return
+	}
+	var auth core.Authorization
+	err = ssa.dbMap.SelectOne(&auth, "SELECT id FROM pendingAuthorizations "+
+		"WHERE identifier = :identifier AND registrationID = :registrationID AND status = 'pending' "+
+		"ORDER BY expires DESC LIMIT 1",
+		map[string]interface{}{"identifier": string(ident), "registrationID": registrationID})
+	if err != nil {
+		return
+	}
+
+	return ssa.GetAuthorization(auth.ID)
+}
+
 // incrementIP returns a copy of `ip` incremented at a bit index `index`,
 // or in other words the first IP of the next highest subnet given a mask of
 // length `index`.
@@ -348,7 +378,7 @@ func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest,
 		&serials,
 		`SELECT serial from issuedNames
 		 WHERE (reversedName = :reversedDomain OR
-			      reversedName LIKE CONCAT(:reversedDomain, ".%"))
+			      reversedName LIKE `+ssa.dialect.Concat(":reversedDomain", "'.%'")+`)
 		 AND notBefore > :earliest AND notBefore <= :latest
 		 LIMIT :limit;`,
 		map[string]interface{}{
@@ -372,6 +402,37 @@ func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest,
 	return len(serialMap), nil
 }
 
+// FQDNSetExists returns true if a certificate has ever been issued for exactly
+// the given set of names, ignoring order, case and duplicates.
+func (ssa *SQLStorageAuthority) FQDNSetExists(names []string) (bool, error) {
+	var count int64
+	err := ssa.dbMap.SelectOne(
+		&count,
+		`SELECT COUNT(*) FROM fqdnSets WHERE setHash = :setHash`,
+		map[string]interface{}{"setHash": core.HashNames(names)},
+	)
+	return count > 0, err
+}
+
+// CountFQDNSets returns the number of certificates issued in the given time
+// range for exactly the given set of names, ignoring order, case and
+// duplicates.
+func (ssa *SQLStorageAuthority) CountFQDNSets(names []string, earliest, latest time.Time) (int, error) {
+	var count int64
+	err := ssa.dbMap.SelectOne(
+		&count,
+		`SELECT COUNT(*) FROM fqdnSets
+		 WHERE setHash = :setHash
+		 AND issued > :earliest AND issued <= :latest`,
+		map[string]interface{}{
+			"setHash":  core.HashNames(names),
+			"earliest": earliest,
+			"latest":   latest,
+		},
+	)
+	return int(count), err
+}
+
 // GetCertificate takes a serial number and returns the corresponding
 // certificate, or error if it does not exist.
 func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate, error) {
@@ -486,6 +547,18 @@ func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, reasonCode
 		err = errors.New("No certificate updated. Maybe the lock column was off?")
 		return
 	}
+
+	if ssa.RecordCertificateEvents {
+		err = tx.Insert(&certificateEventModel{
+			Serial:  serial,
+			Type:    certificateEventRevoked,
+			Created: now,
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
 	err = tx.Commit()
 
 	return
@@ -710,6 +783,13 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		}
 	}
 
+	fqdnSet := &fqdnSetModel{
+		SetHash: core.HashNames(parsedCertificate.DNSNames),
+		Serial:  serial,
+		Issued:  cert.Issued,
+		Expires: parsedCertificate.NotAfter,
+	}
+
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
@@ -736,6 +816,24 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		}
 	}
 
+	err = tx.Insert(fqdnSet)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if ssa.RecordCertificateEvents {
+		err = tx.Insert(&certificateEventModel{
+			Serial:  serial,
+			Type:    certificateEventIssued,
+			Created: cert.Issued,
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
 	err = tx.Commit()
 	return
 }
@@ -790,6 +888,156 @@ func (ssa *SQLStorageAuthority) CountPendingAuthorizations(regID int64) (count i
 	return
 }
 
+// CountInvalidAuthorizations returns the number of authorizations for
+// hostname belonging to regID that were finalized as invalid and expire
+// within the given time range.
+func (ssa *SQLStorageAuthority) CountInvalidAuthorizations(regID int64, hostname string, earliest, latest time.Time) (count int, err error) {
+	ident, err := json.Marshal(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: hostname})
+	if err != nil {
+		return
+	}
+	err = ssa.dbMap.SelectOne(&count,
+		`SELECT count(1) FROM authz
+		 WHERE registrationID = :regID AND
+				identifier = :identifier AND
+				status = :status AND
+				expires > :earliest AND
+				expires <= :latest`,
+		map[string]interface{}{
+			"regID":      regID,
+			"identifier": string(ident),
+			"status":     string(core.StatusInvalid),
+			"earliest":   earliest,
+			"latest":     latest,
+		})
+	return
+}
+
+// InvalidAuthorizationExpiries returns the expiry of each authorization
+// counted by CountInvalidAuthorizations, earliest first.
+func (ssa *SQLStorageAuthority) InvalidAuthorizationExpiries(regID int64, hostname string, earliest, latest time.Time) (expiries []time.Time, err error) {
+	ident, err := json.Marshal(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: hostname})
+	if err != nil {
+		return
+	}
+	var rows []struct {
+		Expires time.Time `db:"expires"`
+	}
+	_, err = ssa.dbMap.Select(&rows,
+		`SELECT expires FROM authz
+		 WHERE registrationID = :regID AND
+				identifier = :identifier AND
+				status = :status AND
+				expires > :earliest AND
+				expires <= :latest
+		 ORDER BY expires`,
+		map[string]interface{}{
+			"regID":      regID,
+			"identifier": string(ident),
+			"status":     string(core.StatusInvalid),
+			"earliest":   earliest,
+			"latest":     latest,
+		})
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		expiries = append(expiries, row.Expires)
+	}
+	return
+}
+
+// GetRateLimitOverrides returns the rate limit overrides that have not
+// expired as of the given time, oldest first.
+func (ssa *SQLStorageAuthority) GetRateLimitOverrides(asOf time.Time) (overrides []core.RateLimitOverride, err error) {
+	_, err = ssa.dbMap.Select(
+		&overrides,
+		`SELECT * FROM rateLimitOverrides
+		 WHERE expires > :asOf
+		 ORDER BY id`,
+		map[string]interface{}{"asOf": asOf},
+	)
+	return
+}
+
+// AddRateLimitOverride stores a new rate limit override, returning it with
+// its ID and creation time filled in.
+func (ssa *SQLStorageAuthority) AddRateLimitOverride(override core.RateLimitOverride) (core.RateLimitOverride, error) {
+	override.ID = 0
+	override.Created = ssa.clk.Now()
+	err := ssa.dbMap.Insert(&override)
+	if err != nil {
+		return core.RateLimitOverride{}, err
+	}
+	return override, nil
+}
+
+// ExpireRateLimitOverride ends the rate limit override with the given ID now.
+// Overrides that have already expired are left as they are.
+func (ssa *SQLStorageAuthority) ExpireRateLimitOverride(id int64) error {
+	var override core.RateLimitOverride
+	err := ssa.dbMap.SelectOne(
+		&override,
+		"SELECT * FROM rateLimitOverrides WHERE id = :id",
+		map[string]interface{}{"id": id},
+	)
+	if err == sql.ErrNoRows {
+		return core.NotFoundError(fmt.Sprintf("No rate limit override with ID %d", id))
+	}
+	if err != nil {
+		return err
+	}
+	now := ssa.clk.Now()
+	if !override.Expires.After(now) {
+		return nil
+	}
+	override.Expires = now
+	_, err = ssa.dbMap.Update(&override)
+	return err
+}
+
+// GetNotificationPreferences returns the notification preferences of the
+// registration with the given ID, or the defaults if it has never changed them.
+func (ssa *SQLStorageAuthority) GetNotificationPreferences(regID int64) (core.NotificationPreferences, error) {
+	obj, err := ssa.dbMap.Get(core.NotificationPreferences{}, regID)
+	if err != nil {
+		return core.NotificationPreferences{}, err
+	}
+	if obj == nil {
+		return core.DefaultNotificationPreferences(regID), nil
+	}
+	return *obj.(*core.NotificationPreferences), nil
+}
+
+// SetNotificationPreferences stores the notification preferences of a
+// registration, replacing any it had.
+func (ssa *SQLStorageAuthority) SetNotificationPreferences(prefs core.NotificationPreferences) error {
+	if prefs.RegistrationID <= 0 {
+		return core.MalformedRequestError("Notification preferences must be for a registration")
+	}
+	prefs.Updated = ssa.clk.Now()
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	existing, err := tx.Get(core.NotificationPreferences{}, prefs.RegistrationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if existing == nil {
+		err = tx.Insert(&prefs)
+	} else {
+		_, err = tx.Update(&prefs)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // ErrNoReceipt is an error type for non-existent SCT receipt
 type ErrNoReceipt string
 
@@ -827,8 +1075,78 @@ func (e ErrDuplicateReceipt) Error() string {
 // AddSCTReceipt adds a new SCT receipt to the (append-only) sctReceipts table
 func (ssa *SQLStorageAuthority) AddSCTReceipt(sct core.SignedCertificateTimestamp) error {
 	err := ssa.dbMap.Insert(&sct)
-	if err != nil && strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry") {
+	if err != nil && ssa.dialect.IsDuplicate(err) {
 		err = ErrDuplicateReceipt(err.Error())
 	}
 	return err
 }
+
+// HoldForReview returns the manual review of hostname, first storing a
+// pending one on behalf of the registration with the given ID if the
+// hostname has never been held.
+func (ssa *SQLStorageAuthority) HoldForReview(hostname string, regID int64) (core.ManualReview, error) {
+	review, err := ssa.getManualReview(hostname)
+	if err != sql.ErrNoRows {
+		return review, err
+	}
+	review = core.ManualReview{
+		Hostname:       hostname,
+		RegistrationID: regID,
+		Status:         core.ManualReviewPending,
+		Created:        ssa.clk.Now(),
+	}
+	err = ssa.dbMap.Insert(&review)
+	if err != nil {
+		// Another authorization may have held the hostname since we looked,
+		// in which case the unique hostname index rejects ours.
+		return ssa.getManualReview(hostname)
+	}
+	return review, nil
+}
+
+func (ssa *SQLStorageAuthority) getManualReview(hostname string) (review core.ManualReview, err error) {
+	err = ssa.dbMap.SelectOne(
+		&review,
+		"SELECT * FROM manualReviews WHERE hostname = :hostname",
+		map[string]interface{}{"hostname": hostname},
+	)
+	return
+}
+
+// GetManualReviews returns the manual reviews with the given status, oldest
+// first.
+func (ssa *SQLStorageAuthority) GetManualReviews(status core.ManualReviewStatus) (reviews []core.ManualReview, err error) {
+	_, err = ssa.dbMap.Select(
+		&reviews,
+		`SELECT * FROM manualReviews
+		 WHERE status = :status
+		 ORDER BY id`,
+		map[string]interface{}{"status": string(status)},
+	)
+	return
+}
+
+// SetManualReviewStatus records an operator's verdict on the manual review
+// with the given ID. A verdict can be changed, but a review can't be made
+// pending again.
+func (ssa *SQLStorageAuthority) SetManualReviewStatus(id int64, status core.ManualReviewStatus, reviewer string) error {
+	if status != core.ManualReviewApproved && status != core.ManualReviewDenied {
+		return core.MalformedRequestError(fmt.Sprintf("Manual reviews can only be approved or denied, not %s", status))
+	}
+	if reviewer == "" {
+		return core.MalformedRequestError("Manual review verdicts must name a reviewer")
+	}
+	obj, err := ssa.dbMap.Get(core.ManualReview{}, id)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return core.NotFoundError(fmt.Sprintf("No manual review with ID %d", id))
+	}
+	review := obj.(*core.ManualReview)
+	review.Status = status
+	review.Reviewer = reviewer
+	review.Reviewed = ssa.clk.Now()
+	_, err = ssa.dbMap.Update(review)
+	return err
+}
@@ -167,6 +167,173 @@ func TestCountPendingAuthorizations(t *testing.T) {
 	test.AssertEquals(t, count, 0)
 }
 
+func TestCountInvalidAuthorizations(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	finalize := func(hostname string, status core.AcmeStatus) {
+		expires := fc.Now().Add(time.Hour)
+		authz, err := sa.NewPendingAuthorization(core.Authorization{
+			RegistrationID: reg.ID,
+			Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: hostname},
+			Expires:        &expires,
+		})
+		test.AssertNotError(t, err, "Couldn't create new pending authorization")
+		authz.Status = status
+		err = sa.FinalizeAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	}
+	finalize("example.com", core.StatusInvalid)
+	finalize("example.com", core.StatusInvalid)
+	finalize("example.com", core.StatusValid)
+	finalize("www.example.com", core.StatusInvalid)
+
+	earliest, latest := fc.Now(), fc.Now().Add(2*time.Hour)
+	count, err := sa.CountInvalidAuthorizations(reg.ID, "example.com", earliest, latest)
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 2)
+
+	count, err = sa.CountInvalidAuthorizations(reg.ID+1, "example.com", earliest, latest)
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 0)
+
+	count, err = sa.CountInvalidAuthorizations(reg.ID, "example.com", latest, latest.Add(time.Hour))
+	test.AssertNotError(t, err, "Couldn't count invalid authorizations")
+	test.AssertEquals(t, count, 0)
+
+	expiries, err := sa.InvalidAuthorizationExpiries(reg.ID, "example.com", earliest, latest)
+	test.AssertNotError(t, err, "Couldn't get invalid authorization expiries")
+	test.AssertEquals(t, len(expiries), 2)
+	for _, expires := range expiries {
+		test.Assert(t, expires.Equal(fc.Now().Add(time.Hour)), "wrong expiry for invalid authorization")
+	}
+}
+
+func TestAddAndExpireRateLimitOverrides(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	added, err := sa.AddRateLimitOverride(core.RateLimitOverride{
+		LimitName: "certificatesPerName",
+		Key:       "example.com",
+		Threshold: 1000,
+		Owner:     "alice",
+		Reason:    "hosting partner",
+		Expires:   fc.Now().Add(24 * time.Hour),
+	})
+	test.AssertNotError(t, err, "Couldn't add override")
+	test.Assert(t, added.ID != 0, "Override ID not set")
+	test.AssertEquals(t, added.Created, fc.Now())
+	_, err = sa.AddRateLimitOverride(core.RateLimitOverride{
+		LimitName:      "certificatesPerName",
+		RegistrationID: 7,
+		Threshold:      500,
+		Owner:          "bob",
+		Reason:         "integrator",
+		Expires:        fc.Now().Add(time.Hour),
+	})
+	test.AssertNotError(t, err, "Couldn't add override")
+
+	overrides, err := sa.GetRateLimitOverrides(fc.Now())
+	test.AssertNotError(t, err, "Couldn't get overrides")
+	test.AssertEquals(t, len(overrides), 2)
+	test.AssertEquals(t, overrides[0].Key, "example.com")
+	test.AssertEquals(t, overrides[1].RegistrationID, int64(7))
+
+	overrides, err = sa.GetRateLimitOverrides(fc.Now().Add(2 * time.Hour))
+	test.AssertNotError(t, err, "Couldn't get overrides")
+	test.AssertEquals(t, len(overrides), 1)
+
+	err = sa.ExpireRateLimitOverride(added.ID)
+	test.AssertNotError(t, err, "Couldn't expire override")
+	overrides, err = sa.GetRateLimitOverrides(fc.Now())
+	test.AssertNotError(t, err, "Couldn't get overrides")
+	test.AssertEquals(t, len(overrides), 1)
+	overrides, err = sa.GetRateLimitOverrides(time.Time{})
+	test.AssertNotError(t, err, "Couldn't get overrides")
+	test.AssertEquals(t, len(overrides), 2)
+
+	err = sa.ExpireRateLimitOverride(added.ID + 100)
+	if _, ok := err.(core.NotFoundError); !ok {
+		t.Errorf("Expected NotFoundError expiring missing override, got %#v", err)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	prefs, err := sa.GetNotificationPreferences(reg.ID)
+	test.AssertNotError(t, err, "Couldn't get default preferences")
+	test.AssertEquals(t, prefs.RegistrationID, reg.ID)
+	test.Assert(t, prefs.ExpirationEmails, "Expiration emails not on by default")
+
+	err = sa.SetNotificationPreferences(core.NotificationPreferences{RegistrationID: reg.ID})
+	test.AssertNotError(t, err, "Couldn't turn off expiration emails")
+	prefs, err = sa.GetNotificationPreferences(reg.ID)
+	test.AssertNotError(t, err, "Couldn't get preferences")
+	test.Assert(t, !prefs.ExpirationEmails, "Expiration emails still on")
+	test.AssertEquals(t, prefs.Updated, fc.Now())
+
+	fc.Add(time.Hour)
+	err = sa.SetNotificationPreferences(core.NotificationPreferences{RegistrationID: reg.ID, ExpirationEmails: true, Locale: "de"})
+	test.AssertNotError(t, err, "Couldn't turn on expiration emails")
+	prefs, err = sa.GetNotificationPreferences(reg.ID)
+	test.AssertNotError(t, err, "Couldn't get preferences")
+	test.Assert(t, prefs.ExpirationEmails, "Expiration emails still off")
+	test.AssertEquals(t, prefs.Locale, "de")
+	test.AssertEquals(t, prefs.Updated, fc.Now())
+
+	err = sa.SetNotificationPreferences(core.NotificationPreferences{})
+	test.AssertError(t, err, "Set preferences without a registration")
+}
+
+func TestManualReviews(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	held, err := sa.HoldForReview("example.com", 7)
+	test.AssertNotError(t, err, "Couldn't hold hostname for review")
+	test.Assert(t, held.ID != 0, "Manual review ID not set")
+	test.AssertEquals(t, held.Status, core.ManualReviewPending)
+	test.AssertEquals(t, held.Created, fc.Now())
+
+	// Holding the hostname again, even for another registration, returns
+	// the existing review
+	again, err := sa.HoldForReview("example.com", 8)
+	test.AssertNotError(t, err, "Couldn't hold hostname for review")
+	test.AssertEquals(t, again.ID, held.ID)
+	test.AssertEquals(t, again.RegistrationID, int64(7))
+
+	reviews, err := sa.GetManualReviews(core.ManualReviewPending)
+	test.AssertNotError(t, err, "Couldn't get pending reviews")
+	test.AssertEquals(t, len(reviews), 1)
+
+	err = sa.SetManualReviewStatus(held.ID, core.ManualReviewPending, "alice")
+	test.AssertError(t, err, "Made a review pending again")
+	err = sa.SetManualReviewStatus(held.ID, core.ManualReviewApproved, "")
+	test.AssertError(t, err, "Approved a review without a reviewer")
+	err = sa.SetManualReviewStatus(held.ID+100, core.ManualReviewApproved, "alice")
+	if _, ok := err.(core.NotFoundError); !ok {
+		t.Errorf("Expected NotFoundError approving missing review, got %#v", err)
+	}
+
+	fc.Add(time.Hour)
+	err = sa.SetManualReviewStatus(held.ID, core.ManualReviewApproved, "alice")
+	test.AssertNotError(t, err, "Couldn't approve review")
+	reviews, err = sa.GetManualReviews(core.ManualReviewPending)
+	test.AssertNotError(t, err, "Couldn't get pending reviews")
+	test.AssertEquals(t, len(reviews), 0)
+
+	approved, err := sa.HoldForReview("example.com", 8)
+	test.AssertNotError(t, err, "Couldn't hold hostname for review")
+	test.AssertEquals(t, approved.Status, core.ManualReviewApproved)
+	test.AssertEquals(t, approved.Reviewer, "alice")
+	test.AssertEquals(t, approved.Reviewed, fc.Now())
+}
+
 func TestAddAuthorization(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
@@ -323,6 +490,43 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	test.AssertEquals(t, authz.ID, newAuthz.ID)
 }
 
+func TestGetLatestPendingAuthorization(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	domain := "example.org"
+	ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
+	reg := satest.CreateWorkingRegistration(t, sa)
+
+	_, err := sa.GetLatestPendingAuthorization(reg.ID, ident)
+	test.AssertError(t, err, "Found a pending auth before there was one")
+
+	// A valid auth isn't pending
+	authz := CreateDomainAuthWithRegID(t, domain, sa, reg.ID)
+	authz.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(authz)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+authz.ID)
+	_, err = sa.GetLatestPendingAuthorization(reg.ID, ident)
+	test.AssertError(t, err, "Found a valid auth as pending")
+
+	older := CreateDomainAuthWithRegID(t, domain, sa, reg.ID)
+	newer := CreateDomainAuthWithRegID(t, domain, sa, reg.ID)
+	exp := time.Now().AddDate(0, 0, 2) // expire in 2 days
+	newer.Expires = &exp
+	err = sa.UpdatePendingAuthorization(newer)
+	test.AssertNotError(t, err, "Couldn't update pending authorization with ID "+newer.ID)
+
+	authz, err = sa.GetLatestPendingAuthorization(reg.ID, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "Example.ORG"})
+	test.AssertNotError(t, err, "Should have found a pending auth for "+domain)
+	test.AssertEquals(t, authz.ID, newer.ID)
+	test.AssertEquals(t, authz.Status, core.StatusPending)
+	test.AssertEquals(t, len(authz.Challenges), 1)
+	test.Assert(t, authz.ID != older.ID, "Got the pending auth that expires first")
+
+	_, err = sa.GetLatestPendingAuthorization(reg.ID+1, ident)
+	test.AssertError(t, err, "Found a pending auth of another registration")
+}
+
 func TestAddCertificate(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
@@ -337,6 +541,11 @@ func TestAddCertificate(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 	test.AssertEquals(t, digest, "qWoItDZmR4P9eFbeYgXXP3SR4ApnkQj8x4LsB_ORKBo")
 
+	// Without RecordCertificateEvents nothing is left for the OCSP updater
+	count, err := sa.dbMap.SelectInt("SELECT COUNT(*) FROM certificateEvents")
+	test.AssertNotError(t, err, "Failed to count certificate events")
+	test.AssertEquals(t, count, int64(0))
+
 	retrievedCert, err := sa.GetCertificate("000000000000000000000000000000021bd4")
 	test.AssertNotError(t, err, "Couldn't get www.eff.org.der by full serial")
 	test.AssertByteEquals(t, certDER, retrievedCert.DER)
@@ -368,6 +577,63 @@ func TestAddCertificate(t *testing.T) {
 	test.Assert(t, certificateStatus2.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 }
 
+func TestFQDNSetExists(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+
+	// Test cert generated locally by Boulder / CFSSL, names [example.com,
+	// www.example.com, admin.example.com]
+	names := []string{"www.example.com", "admin.example.com", "EXAMPLE.com"}
+	exists, err := sa.FQDNSetExists(names)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, !exists, "FQDN set exists before any certificate was added")
+
+	certDER, err := ioutil.ReadFile("test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+
+	exists, err = sa.FQDNSetExists(names)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, exists, "FQDN set of an added certificate doesn't exist")
+
+	exists, err = sa.FQDNSetExists([]string{"example.com", "www.example.com"})
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, !exists, "A subset of an issued FQDN set was treated as the same set")
+}
+
+func TestCountFQDNSets(t *testing.T) {
+	sa, clk, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	names := []string{"example.com", "www.example.com", "admin.example.com"}
+	now := clk.Now()
+
+	count, err := sa.CountFQDNSets(names, now.Add(-time.Hour), now)
+	test.AssertNotError(t, err, "CountFQDNSets failed")
+	test.AssertEquals(t, count, 0)
+
+	// Test cert generated locally by Boulder / CFSSL, names [example.com,
+	// www.example.com, admin.example.com]
+	certDER, err := ioutil.ReadFile("test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+
+	count, err = sa.CountFQDNSets(names, now.Add(-time.Hour), now)
+	test.AssertNotError(t, err, "CountFQDNSets failed")
+	test.AssertEquals(t, count, 1)
+
+	// Outside the window
+	clk.Add(2 * time.Hour)
+	count, err = sa.CountFQDNSets(names, clk.Now().Add(-time.Hour), clk.Now())
+	test.AssertNotError(t, err, "CountFQDNSets failed")
+	test.AssertEquals(t, count, 0)
+}
+
 func TestCountCertificatesByNames(t *testing.T) {
 	sa, clk, cleanUp := initSA(t)
 	defer cleanUp()
@@ -534,6 +800,7 @@ func TestUpdateOCSP(t *testing.T) {
 func TestMarkCertificateRevoked(t *testing.T) {
 	sa, fc, cleanUp := initSA(t)
 	defer cleanUp()
+	sa.RecordCertificateEvents = true
 
 	reg := satest.CreateWorkingRegistration(t, sa)
 	// Add a cert to the DB to test with.
@@ -565,6 +832,17 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	if !fc.Now().Equal(afterStatus.RevokedDate) {
 		t.Errorf("RevokedData, expected %s, got %s", fc.Now(), afterStatus.RevokedDate)
 	}
+
+	// Both the issuance and the revocation are recorded for the OCSP updater
+	var events []certificateEventModel
+	_, err = sa.dbMap.Select(&events, "SELECT * FROM certificateEvents ORDER BY id")
+	test.AssertNotError(t, err, "Failed to fetch certificate events")
+	test.AssertEquals(t, len(events), 2)
+	test.AssertEquals(t, events[0].Serial, serial)
+	test.AssertEquals(t, events[0].Type, certificateEventIssued)
+	test.AssertEquals(t, events[1].Serial, serial)
+	test.AssertEquals(t, events[1].Type, certificateEventRevoked)
+	test.Assert(t, fc.Now().Equal(events[1].Created), "Revocation event has the wrong creation time")
 }
 
 func TestCountCertificates(t *testing.T) {
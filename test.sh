@@ -232,6 +232,25 @@ if [[ "$RUN" =~ "unit" ]] ; then
   fi
 fi
 
+#
+# Unit tests of the packages that use the database, against SQLite and, if
+# there is a PostgreSQL server set up with test/create_db_postgres.sh, against
+# PostgreSQL. The unit segment runs them against MySQL. These dialects are only
+# built with their build tags, and their drivers need Go 1.19 or later.
+#
+DB_TESTPATHS="./sa/... ./policy/... ./ratelimit/... ./va/... ./cmd/expiration-mailer/... ./cmd/expired-authz-purger/... ./cmd/ocsp-responder/... ./cmd/ocsp-updater/... ./cmd/ocsp-checker/... ./cmd/akamai-purger/... ./purger/..."
+if [[ "$RUN" =~ "sqlite" ]] ; then
+  start_context "sqlite"
+  BOULDER_TEST_DB=sqlite run go test -tags sqlite $GOTESTFLAGS ${DB_TESTPATHS}
+  end_context #sqlite
+fi
+
+if [[ "$RUN" =~ "postgres" ]] ; then
+  start_context "postgres"
+  BOULDER_TEST_DB=postgres run go test -tags postgres $GOTESTFLAGS ${DB_TESTPATHS}
+  end_context #postgres
+fi
+
 #
 # Integration tests
 #
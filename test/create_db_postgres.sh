@@ -0,0 +1,63 @@
+#!/bin/bash
+#
+# Creates the test and integration databases on a local PostgreSQL server, the
+# counterpart of create_db.sh for running the database tests with
+# BOULDER_TEST_DB=postgres.
+#
+set -o errexit
+cd $(dirname $0)/..
+source test/db-common.sh
+
+# set db connection for if running in a separate container or not
+dbconn="-U postgres"
+if [[ ! -z "$POSTGRES_CONTAINER" ]]; then
+	dbconn="-U postgres -h 127.0.0.1 --port 5432"
+fi
+
+USERS="policy
+sa
+ra
+ocsp_resp
+ocsp_update
+revoker
+importer
+mailer
+cert_checker
+purger
+test_setup"
+
+# Roles can't be dropped while databases hold grants to them, so drop the
+# databases first to get a fresh start.
+for svc in $SERVICES; do
+	for dbenv in $DBENVS; do
+		psql $dbconn -q -c "DROP DATABASE IF EXISTS boulder_${svc}_${dbenv}" postgres || die "unable to drop boulder_${svc}_${dbenv}"
+	done
+done
+
+for user in $USERS; do
+	psql $dbconn -q -c "DROP ROLE IF EXISTS ${user}" postgres || die "unable to drop role ${user}"
+	psql $dbconn -q -c "CREATE ROLE ${user} LOGIN" postgres || die "unable to create role ${user}"
+done
+
+for svc in $SERVICES; do
+	for dbenv in $DBENVS; do
+		(
+		db="boulder_${svc}_${dbenv}"
+		psql $dbconn -q -c "CREATE DATABASE ${db}" postgres || die "unable to create ${db}"
+
+		echo "created empty ${db} database"
+
+		goose -path=./$svc/_db-postgres/ -env=$dbenv up || die "unable to migrate ${db}"
+		echo "migrated ${db} database"
+
+		USERS_SQL=test/${svc}_db_users_postgres.sql
+		if [[ -f "$USERS_SQL" ]]; then
+			psql $dbconn -q -d $db < $USERS_SQL || die "unable to add users to ${db}"
+			echo "added users to ${db}"
+		fi
+		) &
+	done
+done
+wait
+
+echo "created all databases"
@@ -10,3 +10,8 @@ SERVICES="sa
 policy"
 DBENVS="test
 integration"
+# Migration directories for each database Boulder can run on: _db for MySQL,
+# _db-postgres and _db-sqlite for the others.
+DBDIRS="_db
+_db-postgres
+_db-sqlite"
@@ -4,7 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/letsencrypt/boulder/test/vars"
 )
 
 var (
@@ -40,7 +47,7 @@ func ResetPolicyTestDatabase(t *testing.T) func() {
 }
 
 func resetTestDatabase(t *testing.T, dbType string) func() {
-	db, err := sql.Open("mysql", fmt.Sprintf("test_setup@tcp(localhost:3306)/boulder_%s_test", dbType))
+	db, err := openTestDatabase(dbType)
 	if err != nil {
 		t.Fatalf("Couldn't create db: %s", err)
 	}
@@ -56,6 +63,90 @@ func resetTestDatabase(t *testing.T, dbType string) func() {
 	}
 }
 
+// openTestDatabase connects to the test database of the given service in the
+// database the tests are running against, as the user that may do anything to
+// it. The SQLite database is kept in a file that's created, with the schema of
+// the service's migrations, the first time it's opened.
+func openTestDatabase(dbType string) (*sql.DB, error) {
+	name := fmt.Sprintf("boulder_%s_test", dbType)
+	switch vars.TestDB {
+	case "postgres":
+		if err := requireDriver("postgres"); err != nil {
+			return nil, err
+		}
+		return sql.Open("postgres", fmt.Sprintf("postgres://test_setup@localhost:5432/%s?sslmode=disable", name))
+	case "sqlite":
+		// An immediate transaction takes the database's write lock as it
+		// begins, so tests of different packages starting at the same time
+		// wait for each other to create the schema.
+		if err := requireDriver("sqlite3"); err != nil {
+			return nil, err
+		}
+		db, err := sql.Open("sqlite3", "file:"+vars.SQLitePath(name)+"?_busy_timeout=5000&_txlock=immediate")
+		if err != nil {
+			return nil, err
+		}
+		if err := createSQLiteSchema(db, dbType); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	default:
+		return sql.Open("mysql", fmt.Sprintf("test_setup@tcp(localhost:3306)/%s", name))
+	}
+}
+
+// requireDriver returns an error if the database driver with the given name
+// isn't linked into the tests, which it is when they're built with the tag of
+// the database they're running against, e.g. -tags sqlite.
+func requireDriver(name string) error {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("BOULDER_TEST_DB=%s needs the tests built with -tags %s", vars.TestDB, vars.TestDB)
+}
+
+// createSQLiteSchema applies the Up sections of the SQLite migrations of the
+// given service to db, unless it already has tables.
+func createSQLiteSchema(db *sql.DB, dbType string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var tables int
+	err = tx.QueryRow("select count(*) from sqlite_master where type = 'table'").Scan(&tables)
+	if err != nil || tables > 0 {
+		return err
+	}
+
+	// This file is test/db.go, and the migrations are in <service>/_db-sqlite
+	// next to the test directory.
+	_, thisFile, _, _ := runtime.Caller(0)
+	migrationsDir := filepath.Join(filepath.Dir(thisFile), "..", dbType, "_db-sqlite", "migrations")
+	migrations, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return fmt.Errorf("no SQLite migrations found in %s", migrationsDir)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		contents, err := ioutil.ReadFile(migration)
+		if err != nil {
+			return err
+		}
+		up := strings.SplitN(string(contents), "-- +goose Down", 2)[0]
+		if _, err := tx.Exec(up); err != nil {
+			return fmt.Errorf("applying %s: %s", filepath.Base(migration), err)
+		}
+	}
+	return tx.Commit()
+}
+
 // clearEverythingInAllTables deletes all rows in the tables
 // available to the CleanUpDB passed in and resets the autoincrement
 // counters. See allTableNamesInDB for what is meant by "all tables
@@ -65,10 +156,19 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 	if err != nil {
 		return err
 	}
+	if vars.TestDB == "postgres" {
+		// PostgreSQL checks foreign keys row by row on DELETE, whatever order
+		// the tables are emptied in, but not on a TRUNCATE of all of them.
+		if len(ts) == 0 {
+			return nil
+		}
+		_, err := db.Exec("truncate table " + strings.Join(ts, ", ") + " restart identity")
+		return err
+	}
 	for _, tn := range ts {
 		// 1 = 1 here prevents the MariaDB i_am_a_dummy setting from
 		// rejecting the DELETE for not having a WHERE clause.
-		_, err := db.Exec("delete from `" + tn + "` where 1 = 1")
+		_, err := db.Exec("delete from " + quoteTableName(tn) + " where 1 = 1")
 		if err != nil {
 			return err
 		}
@@ -76,6 +176,15 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 	return err
 }
 
+// quoteTableName quotes a table name for use in a query to the database the
+// tests are running against.
+func quoteTableName(tn string) string {
+	if vars.TestDB == "mysql" {
+		return "`" + tn + "`"
+	}
+	return `"` + tn + `"`
+}
+
 // allTableNamesInDB returns the names of the tables available to the
 // CleanUpDB passed in. "Tables available" means all tables that can
 // be seen in the MariaDB configuration by the database user except
@@ -83,7 +192,14 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 // migrations) or the ones describing the internal configuration of
 // the server. To be used only in test code.
 func allTableNamesInDB(db CleanUpDB) ([]string, error) {
-	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';")
+	query := "select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';"
+	switch vars.TestDB {
+	case "postgres":
+		query = "select table_name from information_schema.tables t where t.table_schema = current_schema() and t.table_name != 'goose_db_version';"
+	case "sqlite":
+		query = "select name from sqlite_master where type = 'table' and name != 'goose_db_version' and name not like 'sqlite_%';"
+	}
+	r, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -19,4 +19,6 @@ GRANT USAGE ON *.* TO 'mailer'@'localhost';
 DROP USER 'mailer'@'localhost';
 GRANT USAGE ON *.* TO 'cert_checker'@'localhost';
 DROP USER 'cert_checker'@'localhost';
+GRANT USAGE ON *.* TO 'purger'@'localhost';
+DROP USER 'purger'@'localhost';
 
@@ -170,16 +170,15 @@ def run_node_test(domain, chall_type, expected_ct_submissions):
         print("\nIssuing failed")
         return ISSUANCE_FAILED
 
-    ee_ocsp_url = "http://localhost:4002"
-    issuer_ocsp_url = "http://localhost:4003"
+    ocsp_url = "http://localhost:4002"
 
     # As OCSP-Updater is generating responses independently of the CA we sit in a loop
     # checking OCSP until we either see a good response or we timeout (5s).
-    wait_for_ocsp_good(cert_file_pem, "../test-ca.pem", ee_ocsp_url)
+    wait_for_ocsp_good(cert_file_pem, "../test-ca.pem", ocsp_url)
 
-    # Verify that the static OCSP responder, which answers with a
-    # pre-signed, long-lived response for the CA cert, works.
-    wait_for_ocsp_good("../test-ca.pem", "../test-root.pem", issuer_ocsp_url)
+    # Verify that the same responder answers for the root too, with the
+    # pre-signed, long-lived response for the CA cert from its static source.
+    wait_for_ocsp_good("../test-ca.pem", "../test-root.pem", ocsp_url)
 
     verify_ct_submission(expected_ct_submissions, "http://localhost:4500/submissions")
 
@@ -239,7 +238,7 @@ def main():
             die(ExitStatus.Error)
         # Pick a random hostname so we don't run into certificate rate limiting.
         domain = "www." + subprocess.check_output("openssl rand -hex 6", shell=True).strip() + "-TEST.com"
-        challenge_types = ["http-01", "dns-01"]
+        challenge_types = ["http-01", "dns-01", "tls-alpn-01"]
 
         expected_ct_submissions = 1
         resp = urllib2.urlopen("http://localhost:4500/submissions")
@@ -361,6 +361,8 @@ function getReadyToValidate(err, resp, body) {
     validator = validateHttp01;
   } else if (cliOptions.challType == "dns-01") {
     validator = validateDns01;
+  } else if (cliOptions.challType == "tls-alpn-01") {
+    validator = validateTlsAlpn01;
   }
   validator(challenges[0]);
 }
@@ -394,6 +396,34 @@ function validateDns01(challenge) {
   }, txtCallback);
 }
 
+function validateTlsAlpn01(challenge) {
+  // Construct a key authorization for this token and key, and have
+  // tls-alpn-test-srv present a certificate for it
+  var thumbprint = cryptoUtil.thumbprint(state.accountKeyPair.publicKey);
+  var keyAuthorization = challenge.token + "." + thumbprint;
+
+  function alpnCallback(err, resp, body) {
+    if (Math.floor(resp.statusCode / 100) != 2) {
+      // Non-2XX response
+      console.log("Updating tls-alpn-test-srv failed with code " + resp.statusCode);
+      process.exit(1);
+    }
+    post(state.responseURL, {
+      resource: "challenge",
+      keyAuthorization: keyAuthorization,
+    }, ensureValidation);
+  }
+
+  request.post({
+    uri: "http://localhost:8056/set-alpn",
+    method: "POST",
+    json: {
+      "host": state.domain,
+      "keyAuthorization": keyAuthorization
+    }
+  }, alpnCallback);
+}
+
 function validateHttp01(challenge) {
   // Construct a key authorization for this token and key
   var thumbprint = cryptoUtil.thumbprint(state.accountKeyPair.publicKey);
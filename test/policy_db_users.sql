@@ -21,6 +21,7 @@
 -- read permission to CA and RA.
 GRANT SELECT,INSERT,DELETE ON blacklist TO 'policy'@'localhost';
 GRANT SELECT,INSERT,DELETE ON whitelist TO 'policy'@'localhost';
+GRANT SELECT,INSERT,DELETE ON domainReputation TO 'policy'@'localhost';
 
 -- Test setup and teardown
 GRANT ALL PRIVILEGES ON * to 'test_setup'@'localhost';
@@ -0,0 +1,27 @@
+--
+-- Copyright 2016 ISRG.  All rights reserved
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+--
+-- This file defines the default PostgreSQL users for the primary database, used by
+-- all the parts of Boulder except the Certificate Authority module, which
+-- utilizes its own database.
+--
+
+-- These are the grants of policy_db_users.sql in PostgreSQL terms. The roles are
+-- created by test/create_db_postgres.sh. Components that insert into tables
+-- with serial IDs also need to use those tables' sequences.
+
+-- Policy loader, CA, RA
+-- Note: The same config section, "pa" is used by the policy loader (for writes)
+-- and the CA and RA (for reads). So right now we have the one user that has
+-- both read and write permission, even though it would be better to give only
+-- read permission to CA and RA.
+GRANT SELECT,INSERT,DELETE ON blacklist TO policy;
+GRANT SELECT,INSERT,DELETE ON whitelist TO policy;
+GRANT SELECT,INSERT,DELETE ON domainReputation TO policy;
+
+-- Test setup and teardown
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO test_setup;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO test_setup;
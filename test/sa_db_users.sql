@@ -21,11 +21,19 @@ GRANT SELECT(id,Lockcol) ON pendingAuthorizations TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON certificates TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON certificateStatus TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON issuedNames TO 'sa'@'localhost';
+GRANT SELECT,INSERT ON fqdnSets TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON sctReceipts TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON deniedCSRs TO 'sa'@'localhost';
 GRANT INSERT ON ocspResponses TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON registrations TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON challenges TO 'sa'@'localhost';
+GRANT SELECT,INSERT,UPDATE ON rateLimitOverrides TO 'sa'@'localhost';
+GRANT INSERT ON certificateEvents TO 'sa'@'localhost';
+GRANT SELECT,INSERT,UPDATE ON notificationPreferences TO 'sa'@'localhost';
+GRANT SELECT,INSERT,UPDATE ON manualReviews TO 'sa'@'localhost';
+
+-- Registration Authority
+GRANT SELECT,INSERT,UPDATE,DELETE ON rateLimitCounters TO 'ra'@'localhost';
 
 -- OCSP Responder
 GRANT SELECT ON certificateStatus TO 'ocsp_resp'@'localhost';
@@ -36,6 +44,8 @@ GRANT INSERT ON ocspResponses TO 'ocsp_update'@'localhost';
 GRANT SELECT ON certificates TO 'ocsp_update'@'localhost';
 GRANT SELECT,UPDATE ON certificateStatus TO 'ocsp_update'@'localhost';
 GRANT SELECT ON sctReceipts TO 'ocsp_update'@'localhost';
+GRANT SELECT,DELETE ON certificateEvents TO 'ocsp_update'@'localhost';
+GRANT INSERT ON purgeQueue TO 'ocsp_update'@'localhost';
 
 -- Revoker Tool
 GRANT SELECT ON registrations TO 'revoker'@'localhost';
@@ -50,8 +60,15 @@ GRANT SELECT,INSERT,UPDATE,DELETE ON externalCerts TO 'importer'@'localhost';
 GRANT SELECT ON certificates TO 'mailer'@'localhost';
 GRANT SELECT,UPDATE ON certificateStatus TO 'mailer'@'localhost';
 
--- Cert checker
+-- Cert and OCSP checkers
 GRANT SELECT ON certificates TO 'cert_checker'@'localhost';
+GRANT SELECT ON certificateStatus TO 'cert_checker'@'localhost';
+
+-- Expired authorization and CDN cache purgers
+GRANT SELECT,DELETE ON pendingAuthorizations TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON authz TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON challenges TO 'purger'@'localhost';
+GRANT SELECT,UPDATE,DELETE ON purgeQueue TO 'purger'@'localhost';
 
 -- Test setup and teardown
 GRANT ALL PRIVILEGES ON * to 'test_setup'@'localhost';
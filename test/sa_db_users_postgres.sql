@@ -0,0 +1,79 @@
+--
+-- Copyright 2016 ISRG.  All rights reserved
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+--
+-- This file defines the default PostgreSQL users for the primary database, used by
+-- all the parts of Boulder except the Certificate Authority module, which
+-- utilizes its own database.
+--
+
+-- These are the grants of sa_db_users.sql in PostgreSQL terms. The roles are
+-- created by test/create_db_postgres.sh. Components that insert into tables
+-- with serial IDs also need to use those tables' sequences.
+
+-- Storage Authority
+GRANT SELECT,INSERT,UPDATE ON authz TO sa;
+GRANT SELECT,INSERT,UPDATE,DELETE ON pendingAuthorizations TO sa;
+GRANT SELECT(id,LockCol) ON pendingAuthorizations TO sa;
+GRANT SELECT,INSERT ON certificates TO sa;
+GRANT SELECT,INSERT,UPDATE ON certificateStatus TO sa;
+GRANT SELECT,INSERT ON issuedNames TO sa;
+GRANT SELECT,INSERT ON fqdnSets TO sa;
+GRANT SELECT,INSERT ON sctReceipts TO sa;
+GRANT SELECT,INSERT ON deniedCSRs TO sa;
+GRANT INSERT ON ocspResponses TO sa;
+GRANT SELECT,INSERT,UPDATE ON registrations TO sa;
+GRANT SELECT,INSERT,UPDATE ON challenges TO sa;
+GRANT SELECT,INSERT,UPDATE ON rateLimitOverrides TO sa;
+GRANT INSERT ON certificateEvents TO sa;
+GRANT SELECT,INSERT,UPDATE ON notificationPreferences TO sa;
+GRANT SELECT,INSERT,UPDATE ON manualReviews TO sa;
+
+GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO sa;
+
+-- Registration Authority
+GRANT SELECT,INSERT,UPDATE,DELETE ON rateLimitCounters TO ra;
+
+-- OCSP Responder
+GRANT SELECT ON certificateStatus TO ocsp_resp;
+GRANT SELECT ON ocspResponses TO ocsp_resp;
+
+-- OCSP Generator Tool (Updater)
+GRANT INSERT ON ocspResponses TO ocsp_update;
+GRANT USAGE ON ocspResponses_id_seq TO ocsp_update;
+GRANT SELECT ON certificates TO ocsp_update;
+GRANT SELECT,UPDATE ON certificateStatus TO ocsp_update;
+GRANT SELECT ON sctReceipts TO ocsp_update;
+GRANT SELECT,DELETE ON certificateEvents TO ocsp_update;
+GRANT INSERT ON purgeQueue TO ocsp_update;
+GRANT USAGE ON purgeQueue_id_seq TO ocsp_update;
+
+-- Revoker Tool
+GRANT SELECT ON registrations TO revoker;
+GRANT SELECT ON certificates TO revoker;
+GRANT SELECT,INSERT ON deniedCSRs TO revoker;
+GRANT USAGE ON deniedCSRs_id_seq TO revoker;
+
+-- External Cert Importer
+GRANT SELECT,INSERT,UPDATE,DELETE ON identifierData TO importer;
+GRANT SELECT,INSERT,UPDATE,DELETE ON externalCerts TO importer;
+
+-- Expiration mailer
+GRANT SELECT ON certificates TO mailer;
+GRANT SELECT,UPDATE ON certificateStatus TO mailer;
+
+-- Cert and OCSP checkers
+GRANT SELECT ON certificates TO cert_checker;
+GRANT SELECT ON certificateStatus TO cert_checker;
+
+-- Expired authorization and CDN cache purgers
+GRANT SELECT,DELETE ON pendingAuthorizations TO purger;
+GRANT SELECT,DELETE ON authz TO purger;
+GRANT SELECT,DELETE ON challenges TO purger;
+GRANT SELECT,UPDATE,DELETE ON purgeQueue TO purger;
+
+-- Test setup and teardown
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO test_setup;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO test_setup;
@@ -72,7 +72,8 @@ def start(race_detection):
         'ocsp-updater',
         'ocsp-responder',
         'ct-test-srv',
-        'dns-test-srv'
+        'dns-test-srv',
+        'tls-alpn-test-srv'
     ]
     if not install(race_detection):
         return False
@@ -86,14 +87,6 @@ def start(race_detection):
             # Don't keep building stuff if a server has already died.
             return False
 
-    # Additionally run the issuer-ocsp-responder, which is not amenable to the
-    # above `run` pattern because it uses a different config file.
-    try:
-        processes.append(run('ocsp-responder', race_detection, 'test/issuer-ocsp-responder.json'))
-    except Exception as e:
-        print(e)
-        return False
-
     # Wait until all servers are up before returning to caller. This means
     # checking each server's debug port until it's available.
     # seconds.
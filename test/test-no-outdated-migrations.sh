@@ -10,8 +10,8 @@ NEW_FILES_LIST=$(mktemp /tmp/new-files.XXXXX)
 trap 'rm ${NEW_FILES_LIST}' EXIT
 
 for svc in $SERVICES; do
-  for dbenv in $DBENVS; do
-    DB_DIR=$svc/_db/
+  for dbdir in $DBDIRS; do
+    DB_DIR=$svc/$dbdir/
     git diff --name-only master -- ${DB_DIR} > ${NEW_FILES_LIST}
     # Search for files in the migrations directory match the new files or come
     # lexically after them, then filter out the new files.
@@ -0,0 +1,171 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+type testSrv struct {
+	mu    *sync.RWMutex
+	key   *ecdsa.PrivateKey
+	certs map[string]*tls.Certificate
+}
+
+type setRequest struct {
+	Host             string `json:"host"`
+	KeyAuthorization string `json:"keyAuthorization"`
+}
+
+// challengeCert builds the self-signed certificate a client presents for
+// a tls-alpn-01 challenge: a single dNSName for host and a critical
+// acmeIdentifier extension containing the SHA-256 digest of the key
+// authorization.
+func (ts *testSrv) challengeCert(host, keyAuthorization string) (*tls.Certificate, error) {
+	digest := sha256.Sum256([]byte(keyAuthorization))
+	extValue, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(0, 0, 1),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+
+		DNSNames: []string{host},
+		ExtraExtensions: []pkix.Extension{{
+			Id:       core.IDPeACMEIdentifier,
+			Critical: true,
+			Value:    extValue,
+		}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &ts.key.PublicKey, ts.key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: ts.key}, nil
+}
+
+func (ts *testSrv) setALPN(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/set-alpn" {
+		http.NotFound(w, r)
+		return
+	} else if r.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+	msg, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sr setRequest
+	err = json.Unmarshal(msg, &sr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sr.Host == "" || sr.KeyAuthorization == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cert, err := ts.challengeCert(sr.Host, sr.KeyAuthorization)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.certs[strings.ToLower(sr.Host)] = cert
+	fmt.Printf("tls-alpn-srv: added challenge certificate for %s\n", sr.Host)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ts *testSrv) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	ts.mu.RLock()
+	cert, present := ts.certs[strings.ToLower(hello.ServerName)]
+	ts.mu.RUnlock()
+	if !present {
+		return nil, fmt.Errorf("no challenge certificate for %q", hello.ServerName)
+	}
+	fmt.Printf("tls-alpn-srv: serving challenge certificate for %s\n", hello.ServerName)
+	return cert, nil
+}
+
+func (ts *testSrv) serveTestTLS() {
+	listener, err := tls.Listen("tcp", "127.0.0.1:5001", &tls.Config{
+		GetCertificate: ts.getCertificate,
+		NextProtos:     []string{core.ALPNProtocol},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				// The VA only looks at the handshake, so there is nothing to
+				// do once it completes.
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					fmt.Printf("tls-alpn-srv: handshake failed: %s\n", err)
+				}
+			}(conn)
+		}
+	}()
+	webServer := &http.Server{
+		Addr:    "localhost:8056",
+		Handler: http.HandlerFunc(ts.setALPN),
+	}
+	go func() {
+		err := webServer.ListenAndServe()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}()
+}
+
+func main() {
+	fmt.Println("tls-alpn-srv: Starting test TLS-ALPN server")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	ts := testSrv{mu: new(sync.RWMutex), key: key, certs: make(map[string]*tls.Certificate)}
+	ts.serveTestTLS()
+	forever := make(chan bool, 1)
+	<-forever
+}
@@ -25,4 +25,8 @@ fi
 
 ./test/setup.sh
 
+if [[ "$RUN" =~ "postgres" ]] ; then
+  ./test/create_db_postgres.sh
+fi
+
 set +o xtrace
@@ -1,24 +1,68 @@
 package vars
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
 
 const (
-	dbURL = "mysql+tcp://%s@localhost:3306/%s"
+	dbURL         = "mysql+tcp://%s@localhost:3306/%s"
+	postgresDBURL = "postgres://%s@localhost:5432/%s?sslmode=disable"
 )
 
+// TestDB is the kind of database the tests run against: "mysql", the default,
+// "postgres" or "sqlite". It is set with the BOULDER_TEST_DB environment
+// variable.
+var TestDB = testDB()
+
+func testDB() string {
+	switch db := os.Getenv("BOULDER_TEST_DB"); db {
+	case "postgres", "sqlite":
+		return db
+	default:
+		return "mysql"
+	}
+}
+
+// SQLitePath returns the file the tests keep the named database in when they
+// run against SQLite.
+func SQLitePath(db string) string {
+	return filepath.ToSlash(filepath.Join(os.TempDir(), db+".db"))
+}
+
+// testDBURL returns the URL for user to connect to the named database in the
+// TestDB database. SQLite has no users, so user is ignored for it.
+func testDBURL(user, db string) string {
+	switch TestDB {
+	case "postgres":
+		return fmt.Sprintf(postgresDBURL, user, db)
+	case "sqlite":
+		return "sqlite3://" + SQLitePath(db)
+	default:
+		return fmt.Sprintf(dbURL, user, db)
+	}
+}
+
 var (
 	// DBConnPolicy is the policy database connection
-	DBConnPolicy = fmt.Sprintf(dbURL, "policy", "boulder_policy_test")
+	DBConnPolicy = testDBURL("policy", "boulder_policy_test")
 	// DBConnPolicyIntegration is the policy integration database connection
-	DBConnPolicyIntegration = fmt.Sprintf(dbURL, "policy", "boulder_policy_integration")
+	DBConnPolicyIntegration = testDBURL("policy", "boulder_policy_integration")
 	// DBConnSA is the sa database connection
-	DBConnSA = fmt.Sprintf(dbURL, "sa", "boulder_sa_test")
+	DBConnSA = testDBURL("sa", "boulder_sa_test")
 	// DBConnSAIntegration is the sa integration database connection
-	DBConnSAIntegration = fmt.Sprintf(dbURL, "sa", "boulder_sa_integration")
+	DBConnSAIntegration = testDBURL("sa", "boulder_sa_integration")
 	// DBConnSAMailer is the sa mailer database connection
-	DBConnSAMailer = fmt.Sprintf(dbURL, "mailer", "boulder_sa_test")
+	DBConnSAMailer = testDBURL("mailer", "boulder_sa_test")
 	// DBConnSAFullPerms is the sa database connection with full perms
-	DBConnSAFullPerms = fmt.Sprintf(dbURL, "test_setup", "boulder_sa_test")
+	DBConnSAFullPerms = testDBURL("test_setup", "boulder_sa_test")
+	// DBConnSARA is the sa database connection for the RA's rate limit counters
+	DBConnSARA = testDBURL("ra", "boulder_sa_test")
 	// DBConnSAOcspResp is the sa ocsp_resp database connection
-	DBConnSAOcspResp = fmt.Sprintf(dbURL, "ocsp_resp", "boulder_sa_test")
+	DBConnSAOcspResp = testDBURL("ocsp_resp", "boulder_sa_test")
+	// DBConnSAPurger is the sa purger database connection
+	DBConnSAPurger = testDBURL("purger", "boulder_sa_test")
+	// DBConnSACertChecker is the sa cert_checker database connection
+	DBConnSACertChecker = testDBURL("cert_checker", "boulder_sa_test")
 )
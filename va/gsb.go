@@ -11,7 +11,6 @@ package va
 
 import (
 	safebrowsing "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-safe-browsing-api"
-	"github.com/letsencrypt/boulder/core"
 )
 
 // SafeBrowsing is an interface for an third-party safe browing API client.
@@ -21,32 +20,27 @@ type SafeBrowsing interface {
 	IsListed(url string) (list string, err error)
 }
 
-// IsSafeDomain returns true if the domain given is determined to be safe by an
-// third-party safe browsing API. It's meant be called by the RA before pending
-// authorization creation. If no third-party client was provided, it fails open
-// and increments a Skips metric.
-func (va *ValidationAuthorityImpl) IsSafeDomain(req *core.IsSafeDomainRequest) (*core.IsSafeDomainResponse, error) {
-	va.stats.Inc("VA.IsSafeDomain.Requests", 1, 1.0)
-	if va.SafeBrowsing == nil {
-		va.stats.Inc("VA.IsSafeDomain.Skips", 1, 1.0)
-		return &core.IsSafeDomainResponse{IsSafe: true}, nil
-	}
+// SafeBrowsingProvider adapts a SafeBrowsing client into a ReputationProvider.
+// safebrowsing.ErrOutOfDateHashes only means the client hasn't caught up with
+// the lists yet, so like the VA always has it fails open for that, and any
+// other error is returned for the ReputationCheck's FailOpen setting to decide
+// what happens.
+type SafeBrowsingProvider struct {
+	Client SafeBrowsing
+}
 
-	list, err := va.SafeBrowsing.IsListed(req.Domain)
+// CheckDomain returns ReputationUnsafe if the domain is found on any of the
+// Google Safe Browsing lists.
+func (p SafeBrowsingProvider) CheckDomain(domain string) (ReputationVerdict, error) {
+	list, err := p.Client.IsListed(domain)
+	if err == safebrowsing.ErrOutOfDateHashes {
+		return ReputationSafe, nil
+	}
 	if err != nil {
-		va.stats.Inc("VA.IsSafeDomain.Errors", 1, 1.0)
-		if err == safebrowsing.ErrOutOfDateHashes {
-			va.stats.Inc("VA.IsSafeDomain.OutOfDateHashErrors", 1, 1.0)
-			return &core.IsSafeDomainResponse{IsSafe: true}, nil
-		}
-		return nil, err
+		return ReputationSafe, err
 	}
-	va.stats.Inc("VA.IsSafeDomain.Successes", 1, 1.0)
-	status := list == ""
-	if status {
-		va.stats.Inc("VA.IsSafeDomain.Status.Good", 1, 1.0)
-	} else {
-		va.stats.Inc("VA.IsSafeDomain.Status.Bad", 1, 1.0)
+	if list != "" {
+		return ReputationUnsafe, nil
 	}
-	return &core.IsSafeDomainResponse{IsSafe: status}, nil
+	return ReputationSafe, nil
 }
@@ -0,0 +1,126 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// DomainList is a ReputationProvider backed by a fixed set of domains. Any
+// domain in the set, or any subdomain of one, gets the list's verdict. This
+// allows meaningful checks in environments that can't reach a third-party API.
+type DomainList struct {
+	verdict ReputationVerdict
+	domains map[string]bool
+}
+
+// NewDomainList reads a list of domains, one per line, from r. Blank lines
+// and lines starting with '#' are ignored. Matching domains are given verdict.
+func NewDomainList(r io.Reader, verdict ReputationVerdict) (*DomainList, error) {
+	dl := &DomainList{verdict: verdict, domains: make(map[string]bool)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dl.domains[strings.TrimSuffix(strings.ToLower(line), ".")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// LoadDomainList reads a domain list from the named file.
+func LoadDomainList(filename string, verdict ReputationVerdict) (*DomainList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewDomainList(f, verdict)
+}
+
+// CheckDomain returns the list's verdict if domain or one of its parents is on
+// the list, and ReputationSafe otherwise.
+func (dl *DomainList) CheckDomain(domain string) (ReputationVerdict, error) {
+	name := strings.ToLower(domain)
+	for {
+		if dl.domains[name] {
+			return dl.verdict, nil
+		}
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return ReputationSafe, nil
+		}
+		name = name[i+1:]
+	}
+}
+
+// reputationRule is a row in the domainReputation table. Host is stored in
+// reversed form (see core.ReverseName), as the policy blacklist does.
+type reputationRule struct {
+	Host    string `db:"host"`
+	Verdict string `db:"verdict"`
+}
+
+// SQLDomainList is a ReputationProvider backed by the domainReputation table
+// of the policy database. The verdict column holds "unsafe" or "review".
+type SQLDomainList struct {
+	dbMap *gorp.DbMap
+}
+
+// NewSQLDomainList constructs a SQLDomainList using the given dbMap.
+func NewSQLDomainList(dbMap *gorp.DbMap) *SQLDomainList {
+	return &SQLDomainList{dbMap: dbMap}
+}
+
+// CheckDomain looks up the rules for domain and each of its parents and
+// returns the verdict of the closest one.
+func (sl *SQLDomainList) CheckDomain(domain string) (ReputationVerdict, error) {
+	labels := strings.Split(core.ReverseName(strings.ToLower(domain)), ".")
+	params := make(map[string]interface{}, len(labels))
+	names := make([]string, len(labels))
+	for i := range labels {
+		name := fmt.Sprintf("host%d", i)
+		params[name] = strings.Join(labels[:i+1], ".")
+		names[i] = ":" + name
+	}
+	var rules []reputationRule
+	_, err := sl.dbMap.Select(
+		&rules,
+		fmt.Sprintf(`SELECT host, verdict FROM domainReputation WHERE host IN (%s)`, strings.Join(names, ", ")),
+		params,
+	)
+	if err != nil {
+		return ReputationSafe, err
+	}
+	if len(rules) == 0 {
+		return ReputationSafe, nil
+	}
+	closest := rules[0]
+	for _, rule := range rules[1:] {
+		if len(rule.Host) > len(closest.Host) {
+			closest = rule
+		}
+	}
+	switch closest.Verdict {
+	case "unsafe":
+		return ReputationUnsafe, nil
+	case "review":
+		return ReputationReview, nil
+	}
+	return ReputationSafe, fmt.Errorf("unknown verdict %q for %s", closest.Verdict, closest.Host)
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// ReputationVerdict is a reputation provider's opinion of a domain.
+type ReputationVerdict int
+
+const (
+	// ReputationSafe means the provider knows nothing bad about the domain.
+	ReputationSafe ReputationVerdict = iota
+	// ReputationReview means the domain is high-risk and issuance should be
+	// held for manual review.
+	ReputationReview
+	// ReputationUnsafe means the domain is known to be bad.
+	ReputationUnsafe
+)
+
+func (v ReputationVerdict) String() string {
+	switch v {
+	case ReputationSafe:
+		return "Safe"
+	case ReputationReview:
+		return "Review"
+	case ReputationUnsafe:
+		return "Unsafe"
+	}
+	return fmt.Sprintf("ReputationVerdict(%d)", int(v))
+}
+
+// ReputationProvider is a source of opinions about whether a domain is safe to
+// issue for, such as a local blocklist or a third-party safe browsing API.
+type ReputationProvider interface {
+	CheckDomain(domain string) (ReputationVerdict, error)
+}
+
+// ReputationCheck is one link in the VA's chain of reputation providers.
+// Name is used in stats and logs. If FailOpen is true, an error from the
+// provider is counted and otherwise treated as a safe verdict; if false, the
+// error is returned and the RA will refuse to create the authorization.
+type ReputationCheck struct {
+	Name     string
+	Provider ReputationProvider
+	FailOpen bool
+}
+
+// IsSafeDomain consults each of the VA's reputation providers in order. It's
+// meant be called by the RA before pending authorization creation. The first
+// provider to call the domain unsafe ends the check; a review verdict is
+// remembered while the remaining providers are consulted. If no providers
+// are configured, it fails open and increments a Skips metric.
+func (va *ValidationAuthorityImpl) IsSafeDomain(req *core.IsSafeDomainRequest) (*core.IsSafeDomainResponse, error) {
+	va.stats.Inc("VA.IsSafeDomain.Requests", 1, 1.0)
+	if len(va.Reputation) == 0 {
+		va.stats.Inc("VA.IsSafeDomain.Skips", 1, 1.0)
+		return &core.IsSafeDomainResponse{IsSafe: true}, nil
+	}
+
+	resp := &core.IsSafeDomainResponse{IsSafe: true}
+	for _, check := range va.Reputation {
+		prefix := fmt.Sprintf("VA.IsSafeDomain.%s.", check.Name)
+		va.stats.Inc(prefix+"Requests", 1, 1.0)
+		verdict, err := check.Provider.CheckDomain(req.Domain)
+		if err != nil {
+			va.stats.Inc(prefix+"Errors", 1, 1.0)
+			if check.FailOpen {
+				va.stats.Inc(prefix+"FailOpen", 1, 1.0)
+				va.log.Warning(fmt.Sprintf("Reputation provider %s failed open for %s: %s", check.Name, req.Domain, err))
+				continue
+			}
+			va.stats.Inc("VA.IsSafeDomain.Errors", 1, 1.0)
+			return nil, fmt.Errorf("reputation provider %s: %s", check.Name, err)
+		}
+		va.stats.Inc(prefix+"Status."+verdict.String(), 1, 1.0)
+		if verdict == ReputationUnsafe {
+			va.log.Info(fmt.Sprintf("Reputation provider %s considers %s unsafe", check.Name, req.Domain))
+			resp.IsSafe = false
+			resp.NeedsReview = false
+			break
+		}
+		if verdict == ReputationReview {
+			va.log.Info(fmt.Sprintf("Reputation provider %s requires review of %s", check.Name, req.Domain))
+			resp.NeedsReview = true
+		}
+	}
+
+	va.stats.Inc("VA.IsSafeDomain.Successes", 1, 1.0)
+	switch {
+	case !resp.IsSafe:
+		va.stats.Inc("VA.IsSafeDomain.Status.Bad", 1, 1.0)
+	case resp.NeedsReview:
+		va.stats.Inc("VA.IsSafeDomain.Status.Review", 1, 1.0)
+	default:
+		va.stats.Inc("VA.IsSafeDomain.Status.Good", 1, 1.0)
+	}
+	return resp, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+type brokenProvider struct{}
+
+func (brokenProvider) CheckDomain(domain string) (ReputationVerdict, error) {
+	return ReputationSafe, errors.New("provider unavailable")
+}
+
+func TestDomainList(t *testing.T) {
+	dl, err := NewDomainList(strings.NewReader("# comment\n\nBad.com\nevil.example.org.\n"), ReputationUnsafe)
+	test.AssertNotError(t, err, "Failed to parse domain list")
+
+	testCases := []struct {
+		domain  string
+		verdict ReputationVerdict
+	}{
+		{"bad.com", ReputationUnsafe},
+		{"www.bad.com", ReputationUnsafe},
+		{"notbad.com", ReputationSafe},
+		{"evil.example.org", ReputationUnsafe},
+		{"example.org", ReputationSafe},
+		{"com", ReputationSafe},
+	}
+	for _, tc := range testCases {
+		verdict, err := dl.CheckDomain(tc.domain)
+		test.AssertNotError(t, err, "CheckDomain failed")
+		test.AssertEquals(t, verdict, tc.verdict)
+	}
+}
+
+func TestSQLDomainList(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnPolicy)
+	test.AssertNotError(t, err, "Could not construct dbMap")
+	cleanUp := test.ResetPolicyTestDatabase(t)
+	defer cleanUp()
+
+	rules := map[string]string{
+		"bad.com":          "unsafe",
+		"ok.bad.com":       "review",
+		"example.com":      "review",
+		"a.example.com":    "unsafe",
+		"weird.verdict.io": "maybe",
+	}
+	for host, verdict := range rules {
+		_, err = dbMap.Exec(
+			sa.Rebind(dbMap, "INSERT INTO domainReputation (host, verdict) VALUES (?, ?)"),
+			core.ReverseName(host), verdict)
+		test.AssertNotError(t, err, "Failed to insert rule")
+	}
+
+	sl := NewSQLDomainList(dbMap)
+	testCases := []struct {
+		domain  string
+		verdict ReputationVerdict
+	}{
+		{"bad.com", ReputationUnsafe},
+		{"www.bad.com", ReputationUnsafe},
+		{"ok.bad.com", ReputationReview},
+		{"www.ok.bad.com", ReputationReview},
+		{"notbad.com", ReputationSafe},
+		{"example.com", ReputationReview},
+		{"z.a.example.com", ReputationUnsafe},
+		// A rule for a sibling that sorts just before a name mustn't hide
+		// the rule for their parent.
+		{"b.example.com", ReputationReview},
+	}
+	for _, tc := range testCases {
+		verdict, err := sl.CheckDomain(tc.domain)
+		test.AssertNotError(t, err, "CheckDomain failed")
+		test.AssertEquals(t, verdict, tc.verdict)
+	}
+
+	_, err = sl.CheckDomain("weird.verdict.io")
+	test.AssertError(t, err, "CheckDomain accepted an unknown verdict")
+}
+
+func TestReputationChain(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.NewFake())
+
+	blocked, _ := NewDomainList(strings.NewReader("blocked.com\n"), ReputationUnsafe)
+	highRisk, _ := NewDomainList(strings.NewReader("risky.com\nblocked.com\n"), ReputationReview)
+	va.Reputation = []ReputationCheck{
+		{Name: "HighRisk", Provider: highRisk},
+		{Name: "Broken", Provider: brokenProvider{}, FailOpen: true},
+		{Name: "Blocklist", Provider: blocked},
+	}
+
+	testCases := []struct {
+		domain      string
+		isSafe      bool
+		needsReview bool
+	}{
+		{"example.com", true, false},
+		{"risky.com", true, true},
+		// An unsafe verdict later in the chain overrides an earlier review.
+		{"blocked.com", false, false},
+	}
+	for _, tc := range testCases {
+		resp, err := va.IsSafeDomain(&core.IsSafeDomainRequest{Domain: tc.domain})
+		test.AssertNotError(t, err, "IsSafeDomain failed with a fail-open provider")
+		test.AssertEquals(t, resp.IsSafe, tc.isSafe)
+		test.AssertEquals(t, resp.NeedsReview, tc.needsReview)
+	}
+
+	va.Reputation[1].FailOpen = false
+	_, err := va.IsSafeDomain(&core.IsSafeDomainRequest{Domain: "example.com"})
+	test.AssertError(t, err, "IsSafeDomain succeeded with a fail-closed provider erroring")
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// Kinds of ValidationTraceStep recorded during a replay
+const (
+	traceDNS      = "dns"
+	traceCNAME    = "cname"
+	traceTXT      = "txt"
+	traceHTTP     = "http"
+	traceRedirect = "redirect"
+	traceTLS      = "tls"
+	traceCAA      = "caa"
+)
+
+type traceKey struct{}
+
+// tracer collects the steps of a replayed validation. The CAA check runs in
+// its own goroutine, so appends are locked.
+type tracer struct {
+	mu    sync.Mutex
+	steps []core.ValidationTraceStep
+}
+
+func withTracer(ctx context.Context) (context.Context, *tracer) {
+	t := &tracer{}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// trace records a step if ctx belongs to a replay, and is a no-op otherwise.
+func trace(ctx context.Context, kind, name, detail string, values ...string) {
+	t, ok := ctx.Value(traceKey{}).(*tracer)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, core.ValidationTraceStep{
+		Kind:   kind,
+		Name:   name,
+		Detail: detail,
+		Values: values,
+	})
+}
+
+// traceCertificates records a summary of the certificate chain a server
+// presented.
+func traceCertificates(ctx context.Context, hostPort, negotiated string, certs []*x509.Certificate) {
+	var values []string
+	for _, cert := range certs {
+		fp := sha256.Sum256(cert.Raw)
+		values = append(values, fmt.Sprintf("subject=%q dnsNames=%v notAfter=%s sha256=%s",
+			cert.Subject.CommonName, cert.DNSNames, cert.NotAfter.UTC(), hex.EncodeToString(fp[:])))
+	}
+	detail := fmt.Sprintf("%d certificate(s) presented", len(certs))
+	if negotiated != "" {
+		detail = fmt.Sprintf("%s, ALPN protocol %q", detail, negotiated)
+	}
+	trace(ctx, traceTLS, hostPort, detail, values...)
+}
+
+// ReplayValidation re-runs the validation of one of authz's challenges,
+// including the CAA check, and returns a step-by-step trace of what the VA
+// observed. Unlike UpdateValidations it runs synchronously and never reports
+// the result to the RA, so the stored authorization is unaffected. It is
+// intended for support engineers debugging failed validations.
+func (va *ValidationAuthorityImpl) ReplayValidation(authz core.Authorization, challengeIndex int) (*core.ValidationTrace, error) {
+	if challengeIndex < 0 || challengeIndex >= len(authz.Challenges) {
+		return nil, core.MalformedRequestError(fmt.Sprintf("Challenge index %d out of range for authorization %s", challengeIndex, authz.ID))
+	}
+	ctx, t := withTracer(context.TODO())
+	challenge := authz.Challenges[challengeIndex]
+	// Stored challenges have already been finalized, so reset the status and
+	// error to what the VA is given when validation is first requested.
+	challenge.Status = core.StatusPending
+	challenge.Error = nil
+	challenge.ValidationRecord = nil
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.Audit(fmt.Sprintf("Replaying %s validation for authorization %s [%s]", challenge.Type, authz.ID, authz.Identifier.Value))
+	records, prob := va.validateChallengeAndCAA(ctx, authz.Identifier, challenge, authz.RegistrationID)
+	va.applyValidationResult(&challenge, records, prob)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &core.ValidationTrace{
+		Challenge: challenge,
+		Steps:     t.steps,
+	}, nil
+}
+
+// applyValidationResult sets the challenge's status, error, and records from
+// the outcome of validateChallengeAndCAA.
+func (va *ValidationAuthorityImpl) applyValidationResult(challenge *core.Challenge, records []core.ValidationRecord, prob *probs.ProblemDetails) {
+	challenge.ValidationRecord = records
+	if prob != nil {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = prob
+	} else if !challenge.RecordsSane() {
+		challenge.Status = core.StatusInvalid
+		challenge.Error = &probs.ProblemDetails{Type: probs.ServerInternalProblem,
+			Detail: "Records for validation failed sanity check"}
+	} else {
+		challenge.Status = core.StatusValid
+	}
+}
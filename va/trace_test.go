@@ -0,0 +1,101 @@
+// Copyright 2016 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// stepKinds returns the Kind of each step, in order.
+func stepKinds(steps []core.ValidationTraceStep) []string {
+	var kinds []string
+	for _, step := range steps {
+		kinds = append(kinds, step.Kind)
+	}
+	return kinds
+}
+
+func TestReplayValidationHTTP(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	setChallengeToken(&chall, expectedToken)
+	hs := httpSrv(t, chall.Token)
+	setChallengeToken(&chall, pathFound)
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.DNSResolver = &bdns.MockDNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	// A stored challenge has already been finalized
+	chall.Status = core.StatusInvalid
+	chall.Error = &probs.ProblemDetails{Type: probs.ConnectionProblem}
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+
+	trace, err := va.ReplayValidation(authz, 0)
+	test.AssertNotError(t, err, "ReplayValidation failed")
+	test.AssertEquals(t, trace.Challenge.Status, core.StatusValid)
+	test.AssertDeepEquals(t, stepKinds(trace.Steps),
+		[]string{traceDNS, traceHTTP, traceDNS, traceRedirect, traceDNS, traceRedirect, traceHTTP})
+	test.AssertEquals(t, trace.Steps[len(trace.Steps)-1].Detail, "response status 200")
+	test.Assert(t, mockRA.lastAuthz == nil, "ReplayValidation reported its result to the RA")
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+
+	_, err = va.ReplayValidation(authz, 1)
+	test.AssertError(t, err, "ReplayValidation accepted an out of range challenge index")
+}
+
+func TestReplayValidationDNS(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &bdns.MockDNSResolver{}
+	va.PA = &MockPolicyAuthority{}
+	va.RA = &MockRegistrationAuthority{}
+
+	chall := core.DNSChallenge01(accountKey)
+	setChallengeToken(&chall, expectedToken)
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "delegated-dns01.com"},
+		Challenges:     []core.Challenge{chall},
+	}
+
+	trace, err := va.ReplayValidation(authz, 0)
+	test.AssertNotError(t, err, "ReplayValidation failed")
+	test.AssertEquals(t, trace.Challenge.Status, core.StatusValid)
+
+	var cname, txt, caa int
+	for _, step := range trace.Steps {
+		switch step.Kind {
+		case traceCNAME:
+			cname++
+			test.AssertDeepEquals(t, step.Values, []string{"delegated.validation-zone.com"})
+		case traceTXT:
+			txt++
+			test.AssertEquals(t, step.Name, "delegated.validation-zone.com")
+		case traceCAA:
+			caa++
+		}
+	}
+	test.AssertEquals(t, cname, 1)
+	test.AssertEquals(t, txt, 1)
+	test.Assert(t, caa > 0, "No CAA lookups traced")
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -33,6 +34,10 @@ import (
 )
 
 const maxRedirect = 10
+
+// maxCNAMEChain is the number of CNAMEs that will be followed from the
+// _acme-challenge name of a dns-01 challenge before giving up.
+const maxCNAMEChain = 8
 const whitespaceCutset = "\n\t "
 
 var validationTimeout = time.Second * 5
@@ -40,10 +45,11 @@ var validationTimeout = time.Second * 5
 // ValidationAuthorityImpl represents a VA
 type ValidationAuthorityImpl struct {
 	RA           core.RegistrationAuthority
+	PA           core.PolicyAuthority
 	log          *blog.AuditLogger
 	DNSResolver  bdns.DNSResolver
 	IssuerDomain string
-	SafeBrowsing SafeBrowsing
+	Reputation   []ReputationCheck
 	httpPort     int
 	httpsPort    int
 	tlsPort      int
@@ -60,18 +66,28 @@ type PortConfig struct {
 	TLSPort   int
 }
 
-// NewValidationAuthorityImpl constructs a new VA
+// NewValidationAuthorityImpl constructs a new VA. If sbc is non-nil it is
+// installed as a reputation provider that fails closed on errors other than
+// out of date hashes; further providers can be appended to the Reputation
+// field.
 func NewValidationAuthorityImpl(pc *PortConfig, sbc SafeBrowsing, stats statsd.Statter, clk clock.Clock) *ValidationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Validation Authority Starting")
+	var reputation []ReputationCheck
+	if sbc != nil {
+		reputation = append(reputation, ReputationCheck{
+			Name:     "GoogleSafeBrowsing",
+			Provider: SafeBrowsingProvider{Client: sbc},
+		})
+	}
 	return &ValidationAuthorityImpl{
-		SafeBrowsing: sbc,
-		log:          logger,
-		httpPort:     pc.HTTPPort,
-		httpsPort:    pc.HTTPSPort,
-		tlsPort:      pc.TLSPort,
-		stats:        stats,
-		clk:          clk,
+		Reputation: reputation,
+		log:        logger,
+		httpPort:   pc.HTTPPort,
+		httpsPort:  pc.HTTPSPort,
+		tlsPort:    pc.TLSPort,
+		stats:      stats,
+		clk:        clk,
 	}
 }
 
@@ -94,6 +110,7 @@ func (va ValidationAuthorityImpl) getAddr(ctx context.Context, hostname string)
 	addrs, err := va.DNSResolver.LookupHost(ctx, hostname)
 	if err != nil {
 		va.log.Debug(fmt.Sprintf("%s DNS failure: %s", hostname, err))
+		trace(ctx, traceDNS, hostname, err.Error())
 		problem := bdns.ProblemDetailsFromDNSError(err)
 		return net.IP{}, nil, problem
 	}
@@ -107,6 +124,11 @@ func (va ValidationAuthorityImpl) getAddr(ctx context.Context, hostname string)
 	}
 	addr := addrs[0]
 	va.log.Info(fmt.Sprintf("Resolved addresses for %s [using %s]: %s", hostname, addr, addrs))
+	var addrStrings []string
+	for _, a := range addrs {
+		addrStrings = append(addrStrings, a.String())
+	}
+	trace(ctx, traceDNS, hostname, fmt.Sprintf("using %s", addr), addrStrings...)
 	return addr, addrs, nil
 }
 
@@ -180,6 +202,7 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 
 	dialer, prob := va.resolveAndConstructDialer(ctx, host, port)
 	dialer.record.URL = url.String()
+	trace(ctx, traceHTTP, url.String(), fmt.Sprintf("connecting to %s", dialer.record.AddressUsed))
 	validationRecords := []core.ValidationRecord{dialer.record}
 	if prob != nil {
 		return nil, validationRecords, prob
@@ -245,6 +268,7 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 		}
 		tr.Dial = dialer.Dial
 		va.log.Info(fmt.Sprintf("%s [%s] redirect from %q to %q [%s]", challenge.Type, identifier, via[len(via)-1].URL.String(), req.URL.String(), dialer.record.AddressUsed))
+		trace(ctx, traceRedirect, req.URL.String(), fmt.Sprintf("redirected from %s, connecting to %s", via[len(via)-1].URL, dialer.record.AddressUsed))
 		return nil
 	}
 	client := http.Client{
@@ -255,12 +279,17 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		va.log.Debug(err.Error())
+		trace(ctx, traceHTTP, url.String(), err.Error())
 		return nil, validationRecords, &probs.ProblemDetails{
 			Type:   parseHTTPConnError(err),
 			Detail: fmt.Sprintf("Could not connect to %s", url),
 		}
 	}
 	defer httpResponse.Body.Close()
+	trace(ctx, traceHTTP, httpResponse.Request.URL.String(), fmt.Sprintf("response status %d", httpResponse.StatusCode))
+	if httpResponse.TLS != nil {
+		traceCertificates(ctx, httpResponse.Request.URL.Host, "", httpResponse.TLS.PeerCertificates)
+	}
 
 	if httpResponse.StatusCode != 200 {
 		return nil, validationRecords, &probs.ProblemDetails{
@@ -305,12 +334,14 @@ func (va *ValidationAuthorityImpl) validateTLSWithZName(ctx context.Context, ide
 
 	if err != nil {
 		va.log.Debug(fmt.Sprintf("%s [%s] TLS Connection failure: %s", challenge.Type, identifier, err))
+		trace(ctx, traceTLS, hostPort, err.Error())
 		return validationRecords, &probs.ProblemDetails{
 			Type:   parseHTTPConnError(err),
 			Detail: "Failed to connect to host for DVSNI challenge",
 		}
 	}
 	defer conn.Close()
+	traceCertificates(ctx, hostPort, "", conn.ConnectionState().PeerCertificates)
 
 	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
@@ -393,6 +424,118 @@ func (va *ValidationAuthorityImpl) validateTLSSNI01(ctx context.Context, identif
 	return va.validateTLSWithZName(ctx, identifier, challenge, ZName)
 }
 
+func (va *ValidationAuthorityImpl) validateTLSALPN01(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	if identifier.Type != core.IdentifierDNS {
+		va.log.Debug(fmt.Sprintf("TLS-ALPN [%s] Identifier failure", identifier))
+		return nil, &probs.ProblemDetails{
+			Type:   probs.MalformedProblem,
+			Detail: "Identifier type for TLS-ALPN was not DNS",
+		}
+	}
+
+	addr, allAddrs, problem := va.getAddr(ctx, identifier.Value)
+	validationRecords := []core.ValidationRecord{
+		core.ValidationRecord{
+			Hostname:          identifier.Value,
+			AddressesResolved: allAddrs,
+			AddressUsed:       addr,
+		},
+	}
+	if problem != nil {
+		return validationRecords, problem
+	}
+
+	// Make a connection with SNI = identifier, offering only the acme-tls/1
+	// protocol
+	portString := strconv.Itoa(va.tlsPort)
+	hostPort := net.JoinHostPort(addr.String(), portString)
+	validationRecords[0].Port = portString
+	va.log.Notice(fmt.Sprintf("%s [%s] Attempting to validate for %s", challenge.Type, identifier, hostPort))
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: validationTimeout}, "tcp", hostPort, &tls.Config{
+		ServerName:         identifier.Value,
+		NextProtos:         []string{core.ALPNProtocol},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("%s [%s] TLS Connection failure: %s", challenge.Type, identifier, err))
+		trace(ctx, traceTLS, hostPort, err.Error())
+		return validationRecords, &probs.ProblemDetails{
+			Type:   parseHTTPConnError(err),
+			Detail: "Failed to connect to host for TLS-ALPN challenge",
+		}
+	}
+	defer conn.Close()
+
+	cs := conn.ConnectionState()
+	traceCertificates(ctx, hostPort, cs.NegotiatedProtocol, cs.PeerCertificates)
+	if cs.NegotiatedProtocol != core.ALPNProtocol || !cs.NegotiatedProtocolIsMutual {
+		return validationRecords, &probs.ProblemDetails{
+			Type: probs.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Cannot negotiate ALPN protocol %q for TLS-ALPN challenge",
+				core.ALPNProtocol),
+		}
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return validationRecords, &probs.ProblemDetails{
+			Type:   probs.UnauthorizedProblem,
+			Detail: "No certs presented for TLS-ALPN challenge",
+		}
+	}
+
+	leaf := cs.PeerCertificates[0]
+	if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+		return validationRecords, &probs.ProblemDetails{
+			Type:   probs.UnauthorizedProblem,
+			Detail: "Certificate presented for TLS-ALPN challenge is not self-signed",
+		}
+	}
+	if len(leaf.DNSNames) != 1 || !strings.EqualFold(leaf.DNSNames[0], identifier.Value) {
+		return validationRecords, &probs.ProblemDetails{
+			Type: probs.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Certificate for TLS-ALPN challenge must contain only %s as a dNSName. Found '%v'",
+				identifier.Value, strings.Join(leaf.DNSNames, ", ")),
+		}
+	}
+
+	// Compute the digest that must appear in the acmeIdentifier extension
+	h := sha256.New()
+	h.Write([]byte(challenge.KeyAuthorization.String()))
+	expectedDigest := h.Sum(nil)
+
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(core.IDPeACMEIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			return validationRecords, &probs.ProblemDetails{
+				Type:   probs.UnauthorizedProblem,
+				Detail: "acmeIdentifier extension for TLS-ALPN challenge is not critical",
+			}
+		}
+		var digest []byte
+		rest, err := asn1.Unmarshal(ext.Value, &digest)
+		if err != nil || len(rest) > 0 {
+			return validationRecords, &probs.ProblemDetails{
+				Type:   probs.UnauthorizedProblem,
+				Detail: "Malformed acmeIdentifier extension for TLS-ALPN challenge",
+			}
+		}
+		if subtle.ConstantTimeCompare(digest, expectedDigest) == 1 {
+			return validationRecords, nil
+		}
+		return validationRecords, &probs.ProblemDetails{
+			Type: probs.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Incorrect key authorization digest for TLS-ALPN challenge. Found '%s'",
+				hex.EncodeToString(digest)),
+		}
+	}
+
+	return validationRecords, &probs.ProblemDetails{
+		Type:   probs.UnauthorizedProblem,
+		Detail: "No acmeIdentifier extension found for TLS-ALPN challenge",
+	}
+}
+
 // parseHTTPConnError returns the ACME ProblemType corresponding to an error
 // that occurred during domain validation.
 func parseHTTPConnError(err error) probs.ProblemType {
@@ -400,9 +543,10 @@ func parseHTTPConnError(err error) probs.ProblemType {
 		err = urlErr.Err
 	}
 
-	// XXX: On all of the resolvers I tested that validate DNSSEC, there is
-	// no differentation between a DNSSEC failure and an unknown host. If we
-	// do not verify DNSSEC ourselves, this function should be modified.
+	// On all of the resolvers we tested that validate DNSSEC, there is no
+	// differentation between a DNSSEC failure and an unknown host. When
+	// Common.DNSSECTrustAnchors is configured, DNSSEC failures are caught by
+	// getAddr before we ever dial, so only connection errors end up here.
 	if netErr, ok := err.(*net.OpError); ok {
 		dnsErr, ok := netErr.Err.(*net.DNSError)
 		if ok && !dnsErr.Timeout() && !dnsErr.Temporary() {
@@ -429,32 +573,94 @@ func (va *ValidationAuthorityImpl) validateDNS01(ctx context.Context, identifier
 	h.Write([]byte(challenge.KeyAuthorization.String()))
 	authorizedKeysDigest := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 
-	// Look for the required record in the DNS
+	// Look for the required record in the DNS, following any delegation of
+	// the challenge subdomain to another zone. The delegations followed are
+	// recorded even if validation fails, so that rejected ones can be audited.
 	challengeSubdomain := fmt.Sprintf("%s.%s", core.DNSPrefix, identifier.Value)
-	txts, authorities, err := va.DNSResolver.LookupTXT(ctx, challengeSubdomain)
+	queryName, cnameChain, prob := va.followCNAMEs(ctx, identifier, challengeSubdomain)
+	record := core.ValidationRecord{
+		Hostname:   identifier.Value,
+		CNAMEChain: cnameChain,
+	}
+	if prob != nil {
+		return []core.ValidationRecord{record}, prob
+	}
+	txts, authorities, err := va.DNSResolver.LookupTXT(ctx, queryName)
 
 	if err != nil {
 		va.log.Debug(fmt.Sprintf("%s [%s] DNS failure: %s", challenge.Type, identifier, err))
+		trace(ctx, traceTXT, queryName, err.Error())
 
-		return nil, bdns.ProblemDetailsFromDNSError(err)
+		return []core.ValidationRecord{record}, bdns.ProblemDetailsFromDNSError(err)
 	}
+	trace(ctx, traceTXT, queryName, fmt.Sprintf("expected %s", authorizedKeysDigest), txts...)
 
 	for _, element := range txts {
 		if subtle.ConstantTimeCompare([]byte(element), []byte(authorizedKeysDigest)) == 1 {
 			// Successful challenge validation
-			return []core.ValidationRecord{{
-				Authorities: authorities,
-				Hostname:    identifier.Value,
-			}}, nil
+			record.Authorities = authorities
+			return []core.ValidationRecord{record}, nil
 		}
 	}
 
-	return nil, &probs.ProblemDetails{
+	return []core.ValidationRecord{record}, &probs.ProblemDetails{
 		Type:   probs.UnauthorizedProblem,
 		Detail: "Correct value not found for DNS challenge",
 	}
 }
 
+// followCNAMEs follows the chain of CNAMEs starting at name one hop at a
+// time, so that each delegation target can be recorded and checked against
+// the PA's policy before we trust any record found there. It returns the final
+// name in the chain along with the targets that were followed.
+func (va *ValidationAuthorityImpl) followCNAMEs(ctx context.Context, identifier core.AcmeIdentifier, name string) (string, []string, *probs.ProblemDetails) {
+	var chain []string
+	for {
+		target, err := va.DNSResolver.LookupCNAME(ctx, name)
+		if err != nil {
+			va.log.Debug(fmt.Sprintf("DNS [%s] CNAME failure: %s", identifier, err))
+			trace(ctx, traceCNAME, name, err.Error())
+			return name, chain, bdns.ProblemDetailsFromDNSError(err)
+		}
+		if target == "" {
+			return name, chain, nil
+		}
+		if len(chain) >= maxCNAMEChain {
+			return name, chain, &probs.ProblemDetails{
+				Type:   probs.ConnectionProblem,
+				Detail: fmt.Sprintf("Too many CNAMEs following %s.%s", core.DNSPrefix, identifier.Value),
+			}
+		}
+		chain = append(chain, target)
+		trace(ctx, traceCNAME, name, "", target)
+		va.log.Info(fmt.Sprintf("DNS [%s] following CNAME from %s to %s", identifier, name, target))
+
+		// Without a PA there is no policy to check the target against, so
+		// delegation isn't trusted at all
+		if va.PA == nil {
+			va.log.Warning(fmt.Sprintf("DNS [%s] no PA to check delegation to %s", identifier, target))
+			return name, chain, &probs.ProblemDetails{
+				Type:   probs.ServerInternalProblem,
+				Detail: "No policy configured for DNS delegation",
+			}
+		}
+		if err := va.PA.WillingToDelegate(target); err != nil {
+			if _, ok := err.(core.MalformedRequestError); !ok {
+				va.log.Warning(fmt.Sprintf("DNS [%s] error checking delegation to %s: %s", identifier, target, err))
+				return name, chain, &probs.ProblemDetails{
+					Type:   probs.ServerInternalProblem,
+					Detail: "Error checking policy for DNS delegation",
+				}
+			}
+			return name, chain, &probs.ProblemDetails{
+				Type:   probs.UnauthorizedProblem,
+				Detail: fmt.Sprintf("Policy forbids delegating %s to %s: %s", name, target, err),
+			}
+		}
+		name = target
+	}
+}
+
 func (va *ValidationAuthorityImpl) checkCAA(ctx context.Context, identifier core.AcmeIdentifier, regID int64) *probs.ProblemDetails {
 	// Check CAA records for the requested identifier
 	present, valid, err := va.checkCAARecords(ctx, identifier)
@@ -486,18 +692,9 @@ func (va *ValidationAuthorityImpl) validate(ctx context.Context, authz core.Auth
 	validationRecords, prob := va.validateChallengeAndCAA(ctx, authz.Identifier, *challenge, authz.RegistrationID)
 	va.stats.TimingDuration(fmt.Sprintf("VA.Validations.%s.%s", challenge.Type, challenge.Status), time.Since(vStart), 1.0)
 
-	challenge.ValidationRecord = validationRecords
-	if prob != nil {
-		challenge.Status = core.StatusInvalid
-		challenge.Error = prob
-		logEvent.Error = prob.Error()
-	} else if !authz.Challenges[challengeIndex].RecordsSane() {
-		challenge.Status = core.StatusInvalid
-		challenge.Error = &probs.ProblemDetails{Type: probs.ServerInternalProblem,
-			Detail: "Records for validation failed sanity check"}
+	va.applyValidationResult(challenge, validationRecords, prob)
+	if challenge.Error != nil {
 		logEvent.Error = challenge.Error.Error()
-	} else {
-		challenge.Status = core.StatusValid
 	}
 	logEvent.Challenge = *challenge
 
@@ -542,6 +739,8 @@ func (va *ValidationAuthorityImpl) validateChallenge(ctx context.Context, identi
 		return va.validateTLSSNI01(ctx, identifier, challenge)
 	case core.ChallengeTypeDNS01:
 		return va.validateDNS01(ctx, identifier, challenge)
+	case core.ChallengeTypeTLSALPN01:
+		return va.validateTLSALPN01(ctx, identifier, challenge)
 	}
 	return nil, &probs.ProblemDetails{
 		Type:   probs.MalformedProblem,
@@ -614,8 +813,14 @@ func (va *ValidationAuthorityImpl) getCAASet(ctx context.Context, hostname strin
 		}
 		CAAs, err := va.DNSResolver.LookupCAA(ctx, name)
 		if err != nil {
+			trace(ctx, traceCAA, name, err.Error())
 			return nil, err
 		}
+		var caaStrings []string
+		for _, caa := range CAAs {
+			caaStrings = append(caaStrings, fmt.Sprintf("%d %s %q", caa.Flag, caa.Tag, caa.Value))
+		}
+		trace(ctx, traceCAA, name, fmt.Sprintf("%d record(s)", len(CAAs)), caaStrings...)
 		if len(CAAs) > 0 {
 			return newCAASet(CAAs), nil
 		}
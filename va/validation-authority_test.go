@@ -6,12 +6,15 @@
 package va
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -516,6 +519,102 @@ func TestTLSError(t *testing.T) {
 	test.AssertEquals(t, prob.Type, probs.TLSProblem)
 }
 
+func tlsalpnSrv(t *testing.T, keyAuthorization string, names []string, critical bool, protos []string) *httptest.Server {
+	h := sha256.New()
+	h.Write([]byte(keyAuthorization))
+	extValue, err := asn1.Marshal(h.Sum(nil))
+	test.AssertNotError(t, err, "failed to marshal acmeIdentifier extension")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1337),
+		Subject: pkix.Name{
+			Organization: []string{"tests"},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+
+		DNSNames: names,
+		ExtraExtensions: []pkix.Extension{{
+			Id:       core.IDPeACMEIdentifier,
+			Critical: critical,
+			Value:    extValue,
+		}},
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "failed to create certificate")
+
+	hs := httptest.NewUnstartedServer(http.DefaultServeMux)
+	hs.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{certBytes},
+			PrivateKey:  key,
+		}},
+		NextProtos: protos,
+	}
+	hs.StartTLS()
+	return hs
+}
+
+func TestTLSALPN01(t *testing.T) {
+	chall := createChallenge(core.ChallengeTypeTLSALPN01)
+	keyAuthorization := chall.KeyAuthorization.String()
+
+	testCases := []struct {
+		name     string
+		names    []string
+		keyAuthz string
+		critical bool
+		protos   []string
+		valid    bool
+	}{
+		{"valid", []string{"localhost"}, keyAuthorization, true, []string{core.ALPNProtocol}, true},
+		{"wrong digest", []string{"localhost"}, "wrong", true, []string{core.ALPNProtocol}, false},
+		{"not critical", []string{"localhost"}, keyAuthorization, false, []string{core.ALPNProtocol}, false},
+		{"extra names", []string{"localhost", "example.com"}, keyAuthorization, true, []string{core.ALPNProtocol}, false},
+		// Depending on the TLS stack the server either aborts the handshake
+		// or ignores the unsupported protocol, so any failure will do.
+		{"no ALPN", []string{"localhost"}, keyAuthorization, true, []string{"http/1.1"}, false},
+	}
+	for _, tc := range testCases {
+		hs := tlsalpnSrv(t, tc.keyAuthz, tc.names, tc.critical, tc.protos)
+		port, err := getPort(hs)
+		test.AssertNotError(t, err, "failed to get test server port")
+
+		stats, _ := statsd.NewNoopClient()
+		va := NewValidationAuthorityImpl(&PortConfig{TLSPort: port}, nil, stats, clock.Default())
+		va.DNSResolver = &bdns.MockDNSResolver{}
+
+		records, prob := va.validateTLSALPN01(context.Background(), ident, chall)
+		hs.Close()
+		if tc.valid {
+			if prob != nil {
+				t.Fatalf("%s: unexpected failure in validateTLSALPN01: %s", tc.name, prob)
+			}
+			chall.ValidationRecord = records
+			test.Assert(t, chall.RecordsSane(), "TLS-ALPN validation records are not sane")
+			continue
+		}
+		if prob == nil {
+			t.Fatalf("%s: validateTLSALPN01 should have failed", tc.name)
+		}
+	}
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &bdns.MockDNSResolver{}
+	_, prob := va.validateTLSALPN01(context.Background(), core.AcmeIdentifier{
+		Type:  core.IdentifierType("ip"),
+		Value: "127.0.0.1",
+	}, chall)
+	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
+}
+
 func TestValidateHTTP(t *testing.T) {
 	chall := core.HTTPChallenge01(accountKey)
 	err := setChallengeToken(&chall, core.NewToken())
@@ -868,6 +967,70 @@ func TestDNSValidationOK(t *testing.T) {
 	test.Assert(t, authz.Challenges[0].Status == core.StatusValid, "Should be valid.")
 }
 
+func TestDNSValidationCNAME(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &bdns.MockDNSResolver{}
+	va.PA = &MockPolicyAuthority{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	chalDNS := core.DNSChallenge01(accountKey)
+	chalDNS.Token = expectedToken
+	keyAuthorization, _ := core.NewKeyAuthorization(chalDNS.Token, accountKey)
+	chalDNS.KeyAuthorization = &keyAuthorization
+
+	testCases := []struct {
+		name      string
+		valid     bool
+		chain     []string
+		errorType probs.ProblemType
+	}{
+		{"delegated-dns01.com", true, []string{"delegated.validation-zone.com"}, ""},
+		{"cname-loop.com", false, []string{
+			"_acme-challenge.cname-loop.com", "_acme-challenge.cname-loop.com",
+			"_acme-challenge.cname-loop.com", "_acme-challenge.cname-loop.com",
+			"_acme-challenge.cname-loop.com", "_acme-challenge.cname-loop.com",
+			"_acme-challenge.cname-loop.com", "_acme-challenge.cname-loop.com",
+		}, probs.ConnectionProblem},
+		{"delegated-private.com", false, []string{"validation.local"}, probs.UnauthorizedProblem},
+		{"cname-servfail.com", false, nil, probs.ConnectionProblem},
+	}
+	for _, tc := range testCases {
+		authz := core.Authorization{
+			ID:             core.NewToken(),
+			RegistrationID: 1,
+			Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: tc.name},
+			Challenges:     []core.Challenge{chalDNS},
+		}
+		va.validate(context.Background(), authz, 0)
+
+		test.AssertNotNil(t, mockRA.lastAuthz, "Should have gotten an authorization")
+		if tc.valid {
+			test.AssertEquals(t, authz.Challenges[0].Status, core.StatusValid)
+		} else {
+			test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+			test.AssertEquals(t, authz.Challenges[0].Error.Type, tc.errorType)
+		}
+		// The delegations followed are recorded whether or not validation
+		// succeeds
+		test.AssertEquals(t, len(authz.Challenges[0].ValidationRecord), 1)
+		test.AssertDeepEquals(t, authz.Challenges[0].ValidationRecord[0].CNAMEChain, tc.chain)
+	}
+
+	// Without a PA no delegation is trusted
+	va.PA = nil
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "delegated-dns01.com"},
+		Challenges:     []core.Challenge{chalDNS},
+	}
+	va.validate(context.Background(), authz, 0)
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+	test.AssertEquals(t, authz.Challenges[0].Error.Type, probs.ServerInternalProblem)
+}
+
 // TestDNSValidationLive is an integration test, depending on
 // the existence of some Internet resources. Because of that,
 // it asserts nothing; it is intended for coverage.
@@ -985,3 +1148,30 @@ func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization
 	ra.lastAuthz = &authz
 	return nil
 }
+
+func (ra *MockRegistrationAuthority) RateLimitStatus(regID int64, names []string) ([]core.RateLimitStatus, error) {
+	return nil, nil
+}
+
+func (ra *MockRegistrationAuthority) UpdateNotificationPreferences(prefs core.NotificationPreferences) error {
+	return nil
+}
+
+// MockPolicyAuthority refuses delegation to names under .local and
+// allows everything else.
+type MockPolicyAuthority struct{}
+
+func (pa *MockPolicyAuthority) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
+	return nil
+}
+
+func (pa *MockPolicyAuthority) WillingToDelegate(target string) error {
+	if strings.HasSuffix(target, ".local") {
+		return core.MalformedRequestError("Name does not end in a public suffix")
+	}
+	return nil
+}
+
+func (pa *MockPolicyAuthority) ChallengesFor(id core.AcmeIdentifier, key *jose.JsonWebKey) ([]core.Challenge, [][]int, error) {
+	return nil, nil, nil
+}
@@ -28,18 +28,22 @@ import (
 
 // Paths are the ACME-spec identified URL path-segments for various methods
 const (
-	DirectoryPath  = "/directory"
-	NewRegPath     = "/acme/new-reg"
-	RegPath        = "/acme/reg/"
-	NewAuthzPath   = "/acme/new-authz"
-	AuthzPath      = "/acme/authz/"
-	ChallengePath  = "/acme/challenge/"
-	NewCertPath    = "/acme/new-cert"
-	CertPath       = "/acme/cert/"
-	RevokeCertPath = "/acme/revoke-cert"
-	TermsPath      = "/terms"
-	IssuerPath     = "/acme/issuer-cert"
-	BuildIDPath    = "/build"
+	DirectoryPath   = "/directory"
+	NewRegPath      = "/acme/new-reg"
+	RegPath         = "/acme/reg/"
+	NewAuthzPath    = "/acme/new-authz"
+	AuthzPath       = "/acme/authz/"
+	ChallengePath   = "/acme/challenge/"
+	NewCertPath     = "/acme/new-cert"
+	CertPath        = "/acme/cert/"
+	RevokeCertPath  = "/acme/revoke-cert"
+	RateLimitsPath  = "/acme/rate-limits"
+	UnsubscribePath = "/acme/unsubscribe/"
+	TermsPath       = "/terms"
+	IssuerPath      = "/acme/issuer-cert"
+	BuildIDPath     = "/build"
+
+	NotificationPreferencesPath = "/acme/notification-preferences"
 )
 
 // WebFrontEndImpl provides all the logic for Boulder's web-facing interface,
@@ -72,6 +76,10 @@ type WebFrontEndImpl struct {
 	// URL to the current subscriber agreement (should contain some version identifier)
 	SubscriberAgreementURL string
 
+	// Key that the expiration mailer signs unsubscribe links with, see
+	// core.UnsubscribeToken. Unsubscribing is disabled if it is empty.
+	UnsubscribeKey []byte
+
 	// Register of anti-replay nonces
 	nonceService *core.NonceService
 
@@ -207,6 +215,9 @@ func (wfe *WebFrontEndImpl) Handler() (http.Handler, error) {
 	wfe.HandleFunc(m, ChallengePath, wfe.Challenge, "GET", "POST")
 	wfe.HandleFunc(m, CertPath, wfe.Certificate, "GET")
 	wfe.HandleFunc(m, RevokeCertPath, wfe.RevokeCertificate, "POST")
+	wfe.HandleFunc(m, RateLimitsPath, wfe.RateLimits, "POST")
+	wfe.HandleFunc(m, UnsubscribePath, wfe.Unsubscribe, "GET", "POST")
+	wfe.HandleFunc(m, NotificationPreferencesPath, wfe.NotificationPreferences, "POST")
 	wfe.HandleFunc(m, TermsPath, wfe.Terms, "GET")
 	wfe.HandleFunc(m, IssuerPath, wfe.Issuer, "GET")
 	wfe.HandleFunc(m, BuildIDPath, wfe.BuildID, "GET")
@@ -455,6 +466,10 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, logEvent *re
 		problemDoc = []byte("{\"detail\": \"Problem marshalling error message.\"}")
 	}
 
+	if rle, ok := ierr.(core.RateLimitedError); ok && rle.Status != nil {
+		wfe.setRateLimitHeaders(response, rle.Status)
+	}
+
 	// Paraphrased from
 	// https://golang.org/src/net/http/server.go#L1272
 	response.Header().Set("Content-Type", "application/problem+json")
@@ -468,6 +483,23 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, logEvent *re
 	}
 }
 
+// setRateLimitHeaders describes the rate limit a request was refused by, and
+// when to retry if that is known.
+func (wfe *WebFrontEndImpl) setRateLimitHeaders(response http.ResponseWriter, status *core.RateLimitStatus) {
+	response.Header().Set("X-RateLimit-Policy", status.Limit)
+	response.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.Threshold))
+	response.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining()))
+	if status.Reset != nil {
+		response.Header().Set("X-RateLimit-Reset", strconv.FormatInt(status.Reset.Unix(), 10))
+		retryAfter := status.Reset.Sub(wfe.clk.Now())
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		// Round up so clients don't retry before the reset time.
+		response.Header().Set("Retry-After", strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+	}
+}
+
 func link(url, relation string) string {
 	return fmt.Sprintf("<%s>;rel=\"%s\"", url, relation)
 }
@@ -1031,6 +1063,163 @@ func (wfe *WebFrontEndImpl) Registration(logEvent *requestEvent, response http.R
 	response.Write(jsonReply)
 }
 
+// RateLimits is used by clients to see their registration's usage of each rate
+// limit policy, including those that would apply to a certificate for the
+// names given in the request.
+func (wfe *WebFrontEndImpl) RateLimits(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	body, _, currReg, prob := wfe.verifyPOST(logEvent, request, true, core.ResourceRateLimits)
+	if prob != nil {
+		// verifyPOST handles its own setting of logEvent.Errors
+		wfe.sendError(response, logEvent, prob, nil)
+		return
+	}
+
+	var query struct {
+		Names []string `json:"names"`
+	}
+	if err := json.Unmarshal(body, &query); err != nil {
+		logEvent.AddError("unable to JSON unmarshal rate limit query: %s", err)
+		wfe.sendError(response, logEvent, probs.Malformed("Error unmarshaling JSON"), err)
+		return
+	}
+	logEvent.Extra["Names"] = query.Names
+
+	statuses, err := wfe.RA.RateLimitStatus(currReg.ID, query.Names)
+	if err != nil {
+		logEvent.AddError("unable to get rate limit status: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to get rate limit status"), err)
+		return
+	}
+
+	jsonReply, err := json.Marshal(struct {
+		RateLimits []core.RateLimitStatus `json:"rateLimits"`
+	}{statuses})
+	if err != nil {
+		// ServerInternal because we generated the statuses, they should be OK
+		logEvent.AddError("unable to marshal rate limit status: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Failed to marshal rate limit status"), err)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(jsonReply)
+}
+
+// Unsubscribe turns off expiration emails for the registration named by the
+// signed token at the end of the path, as linked to from those emails. It is
+// not part of the ACME spec. A GET only shows a form that POSTs back, so that
+// mail scanners following links don't unsubscribe anyone.
+func (wfe *WebFrontEndImpl) Unsubscribe(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	addNoCacheHeader(response)
+	if len(wfe.UnsubscribeKey) == 0 {
+		logEvent.AddError("unsubscribe key not configured")
+		wfe.sendError(response, logEvent, probs.NotFound("Unsubscribing is not supported"), nil)
+		return
+	}
+	token := strings.TrimPrefix(request.URL.Path, UnsubscribePath)
+	regID, err := core.VerifyUnsubscribeToken(wfe.UnsubscribeKey, token)
+	if err != nil {
+		logEvent.AddError("invalid unsubscribe token %#v: %s", token, err)
+		wfe.sendError(response, logEvent, probs.NotFound("Unsubscribe link not found"), nil)
+		return
+	}
+	logEvent.Requester = regID
+
+	response.Header().Set("Content-Type", "text/html")
+	if request.Method == "GET" {
+		response.Write([]byte(`<html>
+		<body>
+			<form method="POST">
+				Stop sending emails about this account's expiring certificates?
+				<input type="submit" value="Unsubscribe">
+			</form>
+		</body>
+	</html>
+	`))
+		return
+	}
+
+	// Keep the registration's other preferences, like its locale
+	prefs, err := wfe.SA.GetNotificationPreferences(regID)
+	if err != nil {
+		logEvent.AddError("unable to get notification preferences: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to unsubscribe"), err)
+		return
+	}
+	prefs.ExpirationEmails = false
+	err = wfe.RA.UpdateNotificationPreferences(prefs)
+	if err != nil {
+		logEvent.AddError("unable to update notification preferences: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to unsubscribe"), err)
+		return
+	}
+	wfe.stats.Inc("WFE.Unsubscribes", 1, 1.0)
+	response.Write([]byte(`<html>
+		<body>
+			You will no longer be sent emails about this account's expiring certificates.
+		</body>
+	</html>
+	`))
+}
+
+// NotificationPreferences is used by clients to see and change which optional
+// emails their registration's contacts get, and in what language. Fields left
+// out of the request keep their current values, so an otherwise empty request
+// just returns the current preferences. It is not part of the ACME spec.
+func (wfe *WebFrontEndImpl) NotificationPreferences(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	body, _, currReg, prob := wfe.verifyPOST(logEvent, request, true, core.ResourceNotificationPreferences)
+	if prob != nil {
+		// verifyPOST handles its own setting of logEvent.Errors
+		wfe.sendError(response, logEvent, prob, nil)
+		return
+	}
+
+	var update struct {
+		ExpirationEmails *bool   `json:"expirationEmails"`
+		Locale           *string `json:"locale"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		logEvent.AddError("unable to JSON unmarshal notification preferences: %s", err)
+		wfe.sendError(response, logEvent, probs.Malformed("Error unmarshaling JSON"), err)
+		return
+	}
+
+	prefs, err := wfe.SA.GetNotificationPreferences(currReg.ID)
+	if err != nil {
+		logEvent.AddError("unable to get notification preferences: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to get notification preferences"), err)
+		return
+	}
+	if update.ExpirationEmails != nil || update.Locale != nil {
+		if update.ExpirationEmails != nil {
+			prefs.ExpirationEmails = *update.ExpirationEmails
+		}
+		if update.Locale != nil {
+			prefs.Locale = *update.Locale
+		}
+		err = wfe.RA.UpdateNotificationPreferences(prefs)
+		if err != nil {
+			logEvent.AddError("unable to update notification preferences: %s", err)
+			wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to update notification preferences"), err)
+			return
+		}
+	}
+
+	jsonReply, err := json.Marshal(struct {
+		ExpirationEmails bool   `json:"expirationEmails"`
+		Locale           string `json:"locale"`
+	}{prefs.ExpirationEmails, prefs.Locale})
+	if err != nil {
+		// ServerInternal because we generated the preferences, they should be OK
+		logEvent.AddError("unable to marshal notification preferences: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Failed to marshal notification preferences"), err)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(jsonReply)
+}
+
 // Authorization is used by clients to submit an update to one of their
 // authorizations.
 func (wfe *WebFrontEndImpl) Authorization(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
@@ -176,6 +176,29 @@ func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization
 	return nil
 }
 
+func (ra *MockRegistrationAuthority) RateLimitStatus(regID int64, names []string) ([]core.RateLimitStatus, error) {
+	var statuses []core.RateLimitStatus
+	for _, name := range names {
+		statuses = append(statuses, core.RateLimitStatus{Limit: "certificatesPerName", Key: name, Count: 1, Threshold: 5})
+	}
+	return statuses, nil
+}
+
+func (ra *MockRegistrationAuthority) UpdateNotificationPreferences(prefs core.NotificationPreferences) error {
+	return nil
+}
+
+// rateLimitedRA refuses every new authorization with a RateLimitedError
+// carrying status.
+type rateLimitedRA struct {
+	MockRegistrationAuthority
+	status core.RateLimitStatus
+}
+
+func (ra *rateLimitedRA) NewAuthorization(authz core.Authorization, regID int64) (core.Authorization, error) {
+	return core.Authorization{}, core.RateLimitedError{Detail: "Too many currently pending authorizations.", Status: &ra.status}
+}
+
 type MockCA struct{}
 
 func (ca *MockCA) IssueCertificate(csr x509.CertificateRequest, regID int64) (core.Certificate, error) {
@@ -203,6 +226,10 @@ func (pa *MockPA) ChallengesFor(identifier core.AcmeIdentifier, key *jose.JsonWe
 	return
 }
 
+func (pa *MockPA) WillingToDelegate(target string) error {
+	return nil
+}
+
 func (pa *MockPA) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
 	return nil
 }
@@ -1512,3 +1539,164 @@ func TestGetCertificateHEADHasCorrectBodyLength(t *testing.T) {
 func newRequestEvent() *requestEvent {
 	return &requestEvent{Extra: make(map[string]interface{})}
 }
+
+func TestRateLimitHeaders(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	reset := fc.Now().Add(90*time.Second + time.Millisecond)
+	wfe.RA = &rateLimitedRA{status: core.RateLimitStatus{
+		Limit:     "invalidAuthorizationsPerAccount",
+		Key:       "test.com",
+		Count:     5,
+		Threshold: 5,
+		Reset:     &reset,
+	}}
+
+	responseWriter := httptest.NewRecorder()
+	wfe.NewAuthorization(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"new-authz","identifier":{"type":"dns","value":"test.com"}}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, 429)
+	test.AssertEquals(t, responseWriter.Header().Get("X-RateLimit-Policy"), "invalidAuthorizationsPerAccount")
+	test.AssertEquals(t, responseWriter.Header().Get("X-RateLimit-Limit"), "5")
+	test.AssertEquals(t, responseWriter.Header().Get("X-RateLimit-Remaining"), "0")
+	test.AssertEquals(t, responseWriter.Header().Get("X-RateLimit-Reset"), fmt.Sprintf("%d", reset.Unix()))
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "91")
+
+	// Limits that aren't counted over a window have no reset time
+	wfe.RA = &rateLimitedRA{status: core.RateLimitStatus{
+		Limit:     "pendingAuthorizationsPerAccount",
+		Count:     3,
+		Threshold: 3,
+	}}
+	responseWriter = httptest.NewRecorder()
+	wfe.NewAuthorization(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"new-authz","identifier":{"type":"dns","value":"test.com"}}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, 429)
+	test.AssertEquals(t, responseWriter.Header().Get("X-RateLimit-Policy"), "pendingAuthorizationsPerAccount")
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "")
+}
+
+func TestRateLimits(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	// GET instead of POST should be rejected
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(RateLimitsPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusMethodNotAllowed)
+
+	// The JWS resource must match
+	responseWriter = httptest.NewRecorder()
+	wfe.RateLimits(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"new-authz","names":["example.com"]}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusBadRequest)
+
+	responseWriter = httptest.NewRecorder()
+	wfe.RateLimits(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"rate-limits","names":["example.com"]}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"rateLimits":[{"limit":"certificatesPerName","key":"example.com","count":1,"threshold":5}]}`)
+}
+
+// prefsRecordingRA records the notification preferences it's asked to store
+type prefsRecordingRA struct {
+	MockRegistrationAuthority
+	updated []core.NotificationPreferences
+}
+
+func (ra *prefsRecordingRA) UpdateNotificationPreferences(prefs core.NotificationPreferences) error {
+	ra.updated = append(ra.updated, prefs)
+	return nil
+}
+
+func TestUnsubscribe(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	ra := &prefsRecordingRA{}
+	wfe.RA = ra
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	token := core.UnsubscribeToken([]byte("unsubscribe key"), 1)
+
+	// Without a key unsubscribing is disabled
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(UnsubscribePath + token),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+	test.AssertEquals(t, len(ra.updated), 0)
+
+	wfe.UnsubscribeKey = []byte("unsubscribe key")
+	mux, err = wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	// A GET only shows the form
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(UnsubscribePath + token),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.Assert(t, strings.Contains(responseWriter.Body.String(), `<form method="POST">`), "No unsubscribe form")
+	test.AssertEquals(t, len(ra.updated), 0)
+
+	// Tokens signed with another key are rejected
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(UnsubscribePath + core.UnsubscribeToken([]byte("another key"), 1)),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+	test.AssertEquals(t, len(ra.updated), 0)
+
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "POST",
+		URL:    mustParseURL(UnsubscribePath + token),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertDeepEquals(t, ra.updated, []core.NotificationPreferences{{RegistrationID: 1, ExpirationEmails: false}})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	ra := &prefsRecordingRA{}
+	wfe.RA = ra
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	// GET instead of POST should be rejected
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(NotificationPreferencesPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusMethodNotAllowed)
+
+	// The JWS resource must match
+	responseWriter = httptest.NewRecorder()
+	wfe.NotificationPreferences(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"rate-limits","locale":"de"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusBadRequest)
+	test.AssertEquals(t, len(ra.updated), 0)
+
+	// Without any fields the current preferences are returned unchanged
+	responseWriter = httptest.NewRecorder()
+	wfe.NotificationPreferences(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"notification-preferences"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"expirationEmails":true,"locale":""}`)
+	test.AssertEquals(t, len(ra.updated), 0)
+
+	// Fields left out keep their current values
+	responseWriter = httptest.NewRecorder()
+	wfe.NotificationPreferences(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"notification-preferences","locale":"de-CH"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"expirationEmails":true,"locale":"de-CH"}`)
+	test.AssertDeepEquals(t, ra.updated, []core.NotificationPreferences{{RegistrationID: 1, ExpirationEmails: true, Locale: "de-CH"}})
+}